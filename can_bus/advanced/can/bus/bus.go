@@ -1,14 +1,22 @@
 package bus
 
 import (
+	"fmt"
+	"slices"
+
 	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/common"
 	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/physical"
 	"github.com/hovsep/fmesh/component"
 )
 
 type Bus struct {
-	Wires    *component.Component // Simulates the differential pair
-	Watchdog *component.Component // Terminal resistors and halt logic
+	Name        string
+	Wires       *component.Component // Simulates the differential pair
+	Watchdog    *component.Component // Terminal resistors and halt logic
+	Disturbance *component.Component // Optional noise and faults between transceivers and wires
+	Timing      *Timing              // Optional length, node positions and bit timing (nodes see the voltages with propagation delays)
+	propagation *propagation
+	cycles      int // Cycles a bit takes on the bus
 }
 
 const (
@@ -16,12 +24,64 @@ const (
 	MaxValidVoltage = physical.Voltage(4.5)
 
 	portRecessiveBitRequest = "recessive_bit_request"
+
+	// A bit takes 4 cycles to travel wires -> transceiver -> controller -> transceiver -> wires
+	cyclesPerBit = 4
 )
 
 // New creates a new CAN bus
 func New(name string) *Bus {
-	wires := newWires(name + "-wires")
-	watchDog := newWatchdog(name + "-watchdog")
+	return newBus(name, 0, nil)
+}
+
+// Options defines the optional parts of the bus
+type Options struct {
+	Timing      *Timing            // Length, node positions and bit timing (nil is a bus without propagation delays)
+	Disturbance *DisturbanceConfig // Faults injected into the voltages written by transceivers (nil is a clean bus)
+}
+
+// NewWithOptions creates a new CAN bus with the given optional parts (the disturbance writes to the wires, which propagate the voltages)
+func NewWithOptions(name string, options *Options) (*Bus, error) {
+	var prop *propagation
+	if options.Timing != nil {
+		err := options.Timing.Validate()
+		if err != nil {
+			return nil, fmt.Errorf("invalid timing of %s: %w", name, err)
+		}
+		prop = &propagation{timing: options.Timing}
+	}
+
+	if options.Disturbance == nil {
+		return newBus(name, 0, prop), nil
+	}
+
+	// The disturbance is one more hop on the way to the wires, so each bit takes one cycle longer
+	b := newBus(name, 1, prop)
+	b.Disturbance = newDisturbance(name+"-disturbance", options.Disturbance)
+
+	// disturbance -> wires
+	b.Disturbance.OutputByName(common.PortCANL).PipeTo(b.Wires.InputByName(common.PortCANL))
+	b.Disturbance.OutputByName(common.PortCANH).PipeTo(b.Wires.InputByName(common.PortCANH))
+
+	return b, nil
+}
+
+// NewWithTiming creates a new CAN bus where each node sees the voltages at its position with the propagation delay
+// (connect nodes with the units listed in timing positions, other units are at the start of the bus)
+func NewWithTiming(name string, timing *Timing) (*Bus, error) {
+	return NewWithOptions(name, &Options{Timing: timing})
+}
+
+// NewWithDisturbance creates a new CAN bus with faults injected into the voltages written by transceivers
+func NewWithDisturbance(name string, config *DisturbanceConfig) *Bus {
+	// Without timing there is nothing to validate
+	b, _ := NewWithOptions(name, &Options{Disturbance: config})
+	return b
+}
+
+func newBus(name string, extraPropagationCycles int, prop *propagation) *Bus {
+	wires := newWires(name+"-wires", prop)
+	watchDog := newWatchdog(name+"-watchdog", extraPropagationCycles)
 
 	// wires -> watchdog
 	wires.OutputByName(common.PortCANL).PipeTo(watchDog.InputByName(common.PortCANL))
@@ -30,14 +90,56 @@ func New(name string) *Bus {
 	// watchdog -> wires
 	watchDog.OutputByName(portRecessiveBitRequest).PipeTo(wires.InputByName(portRecessiveBitRequest))
 
-	return &Bus{
-		Wires:    wires,
-		Watchdog: watchDog,
+	b := &Bus{
+		Name:        name,
+		Wires:       wires,
+		Watchdog:    watchDog,
+		propagation: prop,
+		cycles:      cyclesPerBit + extraPropagationCycles,
+	}
+	if prop != nil {
+		b.Timing = prop.timing
+	}
+	return b
+}
+
+// Output returns the wires ports with the voltages seen by the unit (the common ports when the bus has no timing)
+func (b *Bus) Output(unitName string) (lowPort, highPort string) {
+	if b.propagation == nil {
+		return common.PortCANL, common.PortCANH
+	}
+
+	lowPort, highPort = tapPorts(unitName)
+	if !slices.Contains(b.propagation.taps, unitName) {
+		b.propagation.taps = append(b.propagation.taps, unitName)
+		b.Wires.AddOutputs(lowPort, highPort)
 	}
+	return lowPort, highPort
+}
+
+// CyclesPerBit returns the number of mesh cycles one bit takes on the bus
+func (b Bus) CyclesPerBit() int {
+	return b.cycles
+}
+
+// Input returns the component transceivers write to (the disturbance if any, otherwise the wires)
+func (b Bus) Input() *component.Component {
+	if b.Disturbance != nil {
+		return b.Disturbance
+	}
+	return b.Wires
 }
 
 // GetAllComponents returns all fmesh components of the Bus
 func (b Bus) GetAllComponents() []*component.Component {
+	if b.Disturbance != nil {
+		return []*component.Component{
+			b.Wires,
+			b.Watchdog,
+			b.Disturbance,
+		}
+	}
+
 	return []*component.Component{
 		b.Wires,
 		b.Watchdog,
@@ -0,0 +1,144 @@
+package bus_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/hovsep/fmesh"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/bus"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/codec"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/common"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/controller"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/candump"
+	"github.com/hovsep/fmesh/component"
+	"github.com/hovsep/fmesh/signal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// timingWithNodesAtEnds returns the default timing with the replay node at one end of the bus and the recorder at the other
+func timingWithNodesAtEnds(length float64) *bus.Timing {
+	timing := bus.DefaultTiming(length)
+	timing.Positions[candump.ReplayUnitName] = 0
+	timing.Positions[candump.RecorderUnitName] = length
+	return timing
+}
+
+// sendOverBus replays the frame on the bus and returns the frames recorded by the other node
+// and whether the transmitter signalled an error
+func sendOverBus(t *testing.T, b *bus.Bus, frame *codec.Frame) ([]*candump.Entry, bool) {
+	log := &bytes.Buffer{}
+	replay := candump.NewReplayNode([]*candump.Entry{{Interface: "can0", Frame: frame}})
+	nodes := can.Nodes{
+		replay,
+		candump.NewRecorderNode(candump.DefaultInterface, log),
+	}
+	nodes.ConnectToBus(b)
+
+	errorSignalled := false
+	probe := component.New("probe").
+		AddInputs(common.PortControllerState).
+		WithActivationFunc(func(this *component.Component) error {
+			return this.InputByName(common.PortControllerState).Signals().ForEach(func(sig *signal.Signal) error {
+				for _, ctlState := range sig.PayloadOrNil().(controller.StateMap) {
+					errorSignalled = errorSignalled || ctlState == controller.StateErrorFlag
+				}
+				return nil
+			}).ChainableErr()
+		})
+	replay.Controller.OutputByName(common.PortControllerState).PipeTo(probe.InputByName(common.PortControllerState))
+
+	// The transmitter retries until the frame is acknowledged, so the mesh is stopped after a few attempts
+	_, err := fmesh.NewWithConfig("bus_test", &fmesh.Config{CyclesLimit: 5000}).
+		AddComponents(b.GetAllComponents()...).
+		AddComponents(nodes.GetAllComponents()...).
+		AddComponents(probe).
+		Run()
+	if !errorSignalled {
+		require.NoError(t, err)
+	}
+
+	recorded, err := candump.ReadLog(log)
+	require.NoError(t, err)
+	return recorded, errorSignalled
+}
+
+func TestBusLength(t *testing.T) {
+	frame := &codec.Frame{Id: 0x7E0, DLC: 8, Data: [codec.ProtocolMaxFDDataBytes]byte{0x02, 0x01, 0x0C}}
+
+	t.Run("bus within the max length", func(t *testing.T) {
+		timing := timingWithNodesAtEnds(100)
+		require.Less(t, timing.Length, timing.MaxLength())
+
+		b, err := bus.NewWithTiming("test-bus", timing)
+		require.NoError(t, err)
+
+		recorded, errorSignalled := sendOverBus(t, b, frame)
+		assert.False(t, errorSignalled)
+		require.Len(t, recorded, 1)
+		assert.Equal(t, frame, recorded[0].Frame)
+	})
+
+	t.Run("bus longer than the max length", func(t *testing.T) {
+		timing := timingWithNodesAtEnds(300)
+		require.Greater(t, timing.Length, timing.MaxLength())
+
+		b, err := bus.NewWithTiming("test-bus", timing)
+		require.NoError(t, err)
+
+		// ACK of the far receiver comes after the sample point of the transmitter
+		recorded, errorSignalled := sendOverBus(t, b, frame)
+		assert.True(t, errorSignalled)
+		assert.Empty(t, recorded)
+	})
+}
+
+func TestNewWithOptions(t *testing.T) {
+	t.Run("timing and disturbance", func(t *testing.T) {
+		b, err := bus.NewWithOptions("test-bus", &bus.Options{
+			Timing:      timingWithNodesAtEnds(40),
+			Disturbance: &bus.DisturbanceConfig{},
+		})
+		require.NoError(t, err)
+		assert.NotNil(t, b.Timing)
+		assert.NotNil(t, b.Disturbance)
+		assert.Same(t, b.Disturbance, b.Input())
+		assert.Equal(t, 5, b.CyclesPerBit())
+
+		frame := &codec.Frame{Id: 0x123, DLC: 2, Data: [codec.ProtocolMaxFDDataBytes]byte{0xCA, 0xFE}}
+		recorded, errorSignalled := sendOverBus(t, b, frame)
+		assert.False(t, errorSignalled)
+		require.Len(t, recorded, 1)
+		assert.Equal(t, frame, recorded[0].Frame)
+	})
+
+	t.Run("disturbance is applied on the long bus", func(t *testing.T) {
+		b, err := bus.NewWithOptions("test-bus", &bus.Options{
+			Timing: timingWithNodesAtEnds(40),
+			// The bus is shorted while the frame is transmitted
+			Disturbance: &bus.DisturbanceConfig{StuckDominant: []bus.Window{{From: 30, To: 40}}},
+		})
+		require.NoError(t, err)
+
+		_, errorSignalled := sendOverBus(t, b, &codec.Frame{Id: 0x123, DLC: 2})
+		assert.True(t, errorSignalled)
+	})
+
+	t.Run("no options", func(t *testing.T) {
+		b, err := bus.NewWithOptions("test-bus", &bus.Options{})
+		require.NoError(t, err)
+		assert.Nil(t, b.Timing)
+		assert.Nil(t, b.Disturbance)
+		assert.Same(t, b.Wires, b.Input())
+		assert.Equal(t, 4, b.CyclesPerBit())
+	})
+
+	t.Run("invalid timing", func(t *testing.T) {
+		_, err := bus.NewWithOptions("test-bus", &bus.Options{
+			Timing:      &bus.Timing{},
+			Disturbance: &bus.DisturbanceConfig{},
+		})
+		assert.ErrorContains(t, err, "invalid timing of test-bus: bit must have at least one time quantum")
+	})
+}
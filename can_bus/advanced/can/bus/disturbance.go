@@ -0,0 +1,204 @@
+package bus
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/common"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/physical"
+	"github.com/hovsep/fmesh/component"
+	"github.com/hovsep/fmesh/signal"
+)
+
+// Window is the range of disturbance ticks [From, To), a tick is one bit written to the bus by transceivers
+type Window struct {
+	From int
+	To   int
+}
+
+// Drift is the voltage offset growing linearly since the given tick.
+// The same offset on both lines is the common mode drift, which does not change bits until the voltages are out of range,
+// different offsets change the differential voltage. Wires fail on invalid voltages (e.g., CAN_L above CAN_H), which stops the mesh
+type Drift struct {
+	FromTick    int
+	LowPerTick  physical.Voltage
+	HighPerTick physical.Voltage
+}
+
+// DisturbanceConfig defines the faults injected between transceivers and wires
+type DisturbanceConfig struct {
+	Seed               int64              // Random faults are reproducible with the same seed
+	BitFlipProbability float64            // Probability of flipping each bit on the bus
+	StuckDominant      []Window           // The bus is shorted to dominant level
+	StuckRecessive     []Window           // The bus can not be driven dominant
+	Drift              Drift              // Voltage offset of both lines
+	DroppedBits        map[string]float64 // Probability of dropping the bit written by the unit (the unit's link is broken)
+}
+
+const (
+	// BitFlipProbabilityEnv is the environment variable enabling random bit flips on the bus (e.g., "0.001")
+	BitFlipProbabilityEnv = "CAN_BIT_FLIP_PROBABILITY"
+
+	// NoiseSeedEnv is the environment variable with the seed of random faults
+	NoiseSeedEnv = "CAN_NOISE_SEED"
+
+	// StuckDominantEnv is the environment variable with the windows of ticks when the bus is shorted to dominant level (e.g., "1000-1100,5000-5010")
+	StuckDominantEnv = "CAN_STUCK_DOMINANT"
+
+	// StuckRecessiveEnv is the environment variable with the windows of ticks when the bus can not be driven dominant (e.g., "2000-2050")
+	StuckRecessiveEnv = "CAN_STUCK_RECESSIVE"
+
+	stateKeyTicks = "ticks"
+)
+
+// Contains reports whether the tick is in the window
+func (window Window) Contains(tick int) bool {
+	return tick >= window.From && tick < window.To
+}
+
+// ParseWindows parses comma separated windows written as "from-to"
+func ParseWindows(windows string) ([]Window, error) {
+	var parsed []Window
+	for _, window := range strings.Split(windows, ",") {
+		from, to, found := strings.Cut(strings.TrimSpace(window), "-")
+		if !found {
+			return nil, fmt.Errorf("invalid window: %s", window)
+		}
+
+		fromTick, err := strconv.Atoi(from)
+		if err != nil {
+			return nil, fmt.Errorf("invalid start of window %s: %w", window, err)
+		}
+
+		toTick, err := strconv.Atoi(to)
+		if err != nil {
+			return nil, fmt.Errorf("invalid end of window %s: %w", window, err)
+		}
+
+		if fromTick < 0 || toTick <= fromTick {
+			return nil, fmt.Errorf("invalid window: %s", window)
+		}
+		parsed = append(parsed, Window{From: fromTick, To: toTick})
+	}
+	return parsed, nil
+}
+
+func newDisturbance(name string, config *DisturbanceConfig) *component.Component {
+	rng := rand.New(rand.NewSource(config.Seed))
+
+	// Random numbers are drawn in the fixed order of units, so the faults do not depend on the order of signals
+	var droppingUnits []string
+	for unit := range config.DroppedBits {
+		droppingUnits = append(droppingUnits, unit)
+	}
+	slices.Sort(droppingUnits)
+
+	return component.New(name).
+		WithDescription("Injects noise and faults into voltages written by transceivers").
+		AddInputs(common.PortCANL, common.PortCANH).
+		AddOutputs(common.PortCANL, common.PortCANH).
+		WithInitialState(func(state component.State) {
+			state.Set(stateKeyTicks, 0)
+		}).
+		WithActivationFunc(func(this *component.Component) error {
+			tick := this.State().Get(stateKeyTicks).(int)
+			this.State().Set(stateKeyTicks, tick+1)
+
+			allLow := collectSignals(this, common.PortCANL)
+			allHigh := collectSignals(this, common.PortCANH)
+
+			// The disturbed bit still takes its bit time
+			bitTime := collectBitTime(this, common.PortCANL)
+
+			// Broken links: the bit written by the unit does not reach the bus
+			for _, unit := range droppingUnits {
+				if rng.Float64() < config.DroppedBits[unit] {
+					this.Logger().Printf("tick %d: dropped the bit written by %s", tick, unit)
+					allLow = withoutDriver(allLow, unit)
+					allHigh = withoutDriver(allHigh, unit)
+				}
+			}
+
+			dominant := slices.ContainsFunc(allLow, isDominantLow)
+			flip := rng.Float64() < config.BitFlipProbability
+
+			switch {
+			case slices.ContainsFunc(config.StuckDominant, inWindow(tick)):
+				dominant = true
+			case slices.ContainsFunc(config.StuckRecessive, inWindow(tick)):
+				dominant = false
+			case flip:
+				this.Logger().Printf("tick %d: flipped the bit (dominant: %t)", tick, dominant)
+				dominant = !dominant
+			}
+
+			if dominant && !slices.ContainsFunc(allLow, isDominantLow) {
+				// Something else drives the bus dominant
+				allLow = append(allLow, withBitTime(signal.New(physical.DominantLowVoltage), bitTime).AddLabel(common.LabelBusDrivers, this.Name()))
+				allHigh = append(allHigh, withBitTime(signal.New(physical.DominantHighVoltage), bitTime).AddLabel(common.LabelBusDrivers, this.Name()))
+			}
+			if !dominant {
+				// Lines are held recessive, so nobody drives the bus
+				allLow = []*signal.Signal{withBitTime(signal.New(physical.RecessiveVoltage), bitTime)}
+				allHigh = []*signal.Signal{withBitTime(signal.New(physical.RecessiveVoltage), bitTime)}
+			}
+
+			var lowOffset, highOffset physical.Voltage
+			if config.Drift.FromTick <= tick {
+				lowOffset = physical.Voltage(tick-config.Drift.FromTick) * config.Drift.LowPerTick
+				highOffset = physical.Voltage(tick-config.Drift.FromTick) * config.Drift.HighPerTick
+			}
+
+			this.OutputByName(common.PortCANL).PutSignals(withOffset(allLow, lowOffset)...)
+			this.OutputByName(common.PortCANH).PutSignals(withOffset(allHigh, highOffset)...)
+			return nil
+		})
+}
+
+func collectSignals(this *component.Component, portName string) []*signal.Signal {
+	var sigs []*signal.Signal
+	this.InputByName(portName).Signals().ForEach(func(sig *signal.Signal) error {
+		sigs = append(sigs, sig)
+		return nil
+	})
+	return sigs
+}
+
+func inWindow(tick int) func(window Window) bool {
+	return func(window Window) bool {
+		return window.Contains(tick)
+	}
+}
+
+func isDominantLow(sig *signal.Signal) bool {
+	v, ok := sig.PayloadOrNil().(physical.Voltage)
+	return ok && v < physical.RecessiveVoltage
+}
+
+func withoutDriver(sigs []*signal.Signal, unit string) []*signal.Signal {
+	return slices.DeleteFunc(slices.Clone(sigs), func(sig *signal.Signal) bool {
+		return sig.Labels().ValueIs(common.LabelBusDrivers, unit)
+	})
+}
+
+// withOffset shifts the voltages keeping the labels of drivers and bit time
+func withOffset(sigs []*signal.Signal, offset physical.Voltage) []*signal.Signal {
+	shifted := make([]*signal.Signal, 0, len(sigs))
+	for _, sig := range sigs {
+		v, ok := sig.PayloadOrNil().(physical.Voltage)
+		if !ok || offset == 0 {
+			shifted = append(shifted, sig)
+			continue
+		}
+
+		shiftedSig := withBitTime(signal.New(v+offset), sig.Labels().ValueOrDefault(common.LabelBitTime, ""))
+		if driver := sig.Labels().ValueOrDefault(common.LabelBusDrivers, ""); driver != "" {
+			shiftedSig.AddLabel(common.LabelBusDrivers, driver)
+		}
+		shifted = append(shifted, shiftedSig)
+	}
+	return shifted
+}
@@ -0,0 +1,218 @@
+package bus
+
+import (
+	"testing"
+
+	"github.com/hovsep/fmesh"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/common"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/physical"
+	"github.com/hovsep/fmesh/component"
+	"github.com/hovsep/fmesh/signal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// busLevel is what the disturbance outputs in one tick
+type busLevel struct {
+	dominant bool
+	low      physical.Voltage // The lowest voltage of CAN_L
+	high     physical.Voltage // The highest voltage of CAN_H
+}
+
+// runDisturbance writes the bits of units (true is dominant) to the disturbance tick by tick and returns the bus levels
+func runDisturbance(t *testing.T, config *DisturbanceConfig, ticks int, written func(tick int) map[string]bool) []busLevel {
+	var levels []busLevel
+
+	driver := component.New("driver").
+		AddInputs(common.PortSelfActivation).
+		AddOutputs(common.PortCANL, common.PortCANH, common.PortSelfActivation).
+		WithInitialState(func(state component.State) {
+			state.Set(stateKeyTicks, 0)
+		}).
+		WithActivationFunc(func(this *component.Component) error {
+			tick := this.State().Get(stateKeyTicks).(int)
+			this.State().Set(stateKeyTicks, tick+1)
+
+			for unit, dominant := range written(tick) {
+				low, high := physical.RecessiveVoltage, physical.RecessiveVoltage
+				if dominant {
+					low, high = physical.DominantLowVoltage, physical.DominantHighVoltage
+				}
+				this.OutputByName(common.PortCANL).PutSignals(signal.New(low).AddLabel(common.LabelBusDrivers, unit))
+				this.OutputByName(common.PortCANH).PutSignals(signal.New(high).AddLabel(common.LabelBusDrivers, unit))
+			}
+
+			if tick+1 < ticks {
+				this.OutputByName(common.PortSelfActivation).PutSignals(signal.New(true))
+			}
+			return nil
+		})
+	driver.OutputByName(common.PortSelfActivation).PipeTo(driver.InputByName(common.PortSelfActivation))
+	driver.InputByName(common.PortSelfActivation).PutSignals(signal.New(true))
+
+	probe := component.New("probe").
+		AddInputs(common.PortCANL, common.PortCANH).
+		WithActivationFunc(func(this *component.Component) error {
+			level := busLevel{low: physical.RecessiveVoltage, high: physical.RecessiveVoltage}
+			for i, sig := range collectSignals(this, common.PortCANL) {
+				v := sig.PayloadOrNil().(physical.Voltage)
+				if i == 0 || v < level.low {
+					level.low = v
+				}
+				level.dominant = level.dominant || isDominantLow(sig)
+			}
+			for i, sig := range collectSignals(this, common.PortCANH) {
+				v := sig.PayloadOrNil().(physical.Voltage)
+				if i == 0 || v > level.high {
+					level.high = v
+				}
+			}
+			levels = append(levels, level)
+			return nil
+		})
+
+	disturbance := newDisturbance("disturbance", config)
+
+	// driver -> disturbance -> probe
+	driver.OutputByName(common.PortCANL).PipeTo(disturbance.InputByName(common.PortCANL))
+	driver.OutputByName(common.PortCANH).PipeTo(disturbance.InputByName(common.PortCANH))
+	disturbance.OutputByName(common.PortCANL).PipeTo(probe.InputByName(common.PortCANL))
+	disturbance.OutputByName(common.PortCANH).PipeTo(probe.InputByName(common.PortCANH))
+
+	_, err := fmesh.New("disturbance_test").AddComponents(driver, disturbance, probe).Run()
+	require.NoError(t, err)
+	require.Len(t, levels, ticks)
+	return levels
+}
+
+// dominantTicks returns the ticks when the bus is dominant
+func dominantTicks(levels []busLevel) []int {
+	var ticks []int
+	for tick, level := range levels {
+		if level.dominant {
+			ticks = append(ticks, tick)
+		}
+	}
+	return ticks
+}
+
+// recessiveNode writes only recessive bits
+func recessiveNode(int) map[string]bool {
+	return map[string]bool{"node": false}
+}
+
+func TestDisturbance(t *testing.T) {
+	t.Run("same seed reproduces the same flips", func(t *testing.T) {
+		const ticks = 500
+		flips := func(seed int64) []int {
+			return dominantTicks(runDisturbance(t, &DisturbanceConfig{Seed: seed, BitFlipProbability: 0.05}, ticks, recessiveNode))
+		}
+
+		first := flips(7)
+		assert.NotEmpty(t, first)
+		assert.Less(t, len(first), ticks/5)
+		assert.Equal(t, first, flips(7))
+		assert.NotEqual(t, first, flips(8))
+	})
+
+	t.Run("stuck windows override the written bits", func(t *testing.T) {
+		config := &DisturbanceConfig{
+			StuckDominant:  []Window{{From: 2, To: 4}},
+			StuckRecessive: []Window{{From: 8, To: 10}},
+			// Windows take precedence over random flips
+			BitFlipProbability: 1,
+		}
+		levels := runDisturbance(t, config, 12, func(tick int) map[string]bool {
+			return map[string]bool{"node": tick >= 6 && tick < 10}
+		})
+
+		// Flipped outside the windows
+		assert.Equal(t, []int{0, 1, 2, 3, 4, 5, 10, 11}, dominantTicks(levels))
+
+		// The shorted bus is driven by the disturbance
+		assert.Equal(t, physical.DominantLowVoltage, levels[2].low)
+		assert.Equal(t, physical.DominantHighVoltage, levels[2].high)
+		assert.Equal(t, physical.RecessiveVoltage, levels[8].low)
+	})
+
+	t.Run("dropped bits of the broken link", func(t *testing.T) {
+		config := &DisturbanceConfig{
+			DroppedBits: map[string]float64{"broken": 1, "flaky": 0.5},
+		}
+		written := func(tick int) map[string]bool {
+			return map[string]bool{
+				"broken": true,
+				"flaky":  tick%2 == 0,
+			}
+		}
+		levels := runDisturbance(t, config, 100, written)
+
+		// Only the bits of the flaky node reach the bus, some of them are lost too
+		dominant := dominantTicks(levels)
+		assert.NotEmpty(t, dominant)
+		assert.Less(t, len(dominant), 50)
+		for _, tick := range dominant {
+			assert.Zero(t, tick%2, "tick %d", tick)
+		}
+		assert.Equal(t, dominant, dominantTicks(runDisturbance(t, config, 100, written)))
+	})
+
+	t.Run("drift grows since the start tick", func(t *testing.T) {
+		config := &DisturbanceConfig{
+			Drift: Drift{FromTick: 10, LowPerTick: 0.01, HighPerTick: -0.02},
+		}
+		levels := runDisturbance(t, config, 30, recessiveNode)
+
+		assert.Equal(t, physical.RecessiveVoltage, levels[9].low)
+		assert.InDelta(t, float64(physical.RecessiveVoltage)+0.1, float64(levels[20].low), 1e-9)
+		assert.InDelta(t, float64(physical.RecessiveVoltage)-0.2, float64(levels[20].high), 1e-9)
+		assert.Empty(t, dominantTicks(levels))
+	})
+}
+
+func TestParseWindows(t *testing.T) {
+	tests := []struct {
+		name          string
+		windows       string
+		want          []Window
+		wantErrString string
+	}{
+		{
+			name:    "single window",
+			windows: "100-200",
+			want:    []Window{{From: 100, To: 200}},
+		},
+		{
+			name:    "multiple windows",
+			windows: "0-1, 5000-5010",
+			want:    []Window{{From: 0, To: 1}, {From: 5000, To: 5010}},
+		},
+		{
+			name:          "missing end",
+			windows:       "100",
+			wantErrString: "invalid window: 100",
+		},
+		{
+			name:          "not a number",
+			windows:       "100-abc",
+			wantErrString: "invalid end of window 100-abc",
+		},
+		{
+			name:          "empty window",
+			windows:       "200-200",
+			wantErrString: "invalid window: 200-200",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseWindows(tt.windows)
+			if tt.wantErrString != "" {
+				assert.ErrorContains(t, err, tt.wantErrString)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
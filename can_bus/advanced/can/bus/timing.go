@@ -0,0 +1,267 @@
+package bus
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/codec"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/common"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/physical"
+	"github.com/hovsep/fmesh/component"
+	"github.com/hovsep/fmesh/signal"
+)
+
+// Timing defines the bus length, node positions and the bit timing.
+// The voltage written by a unit is seen by other units after the propagation delay (counted in time quanta),
+// and each unit reads the bit at its sample point, so a long bus breaks arbitration and acknowledgement:
+// e.g., the transmitter must see the dominant ACK of the farthest receiver (the round trip) before its sample point.
+// Units writing SOF keep their bit clock, the others synchronize to the first SOF edge they see
+// (hard synchronization, resynchronization within the frame is not simulated), so contenders are out of phase
+// by the delay from the previous transmitter. Bits of the data phase of FD frames keep their (shorter) bit time,
+// but delays are counted in nominal time quanta: only the transmitter drives the bus there, so the bits seen by units do not change
+// (transmitters of real FD controllers compensate their loop delay)
+type Timing struct {
+	Length           float64            // Bus length in meters
+	Positions        map[string]float64 // Position of each unit in meters from one end of the bus (units not listed are at 0)
+	TimeQuanta       int                // Time quanta per bit (delays are rounded up to whole quanta)
+	SamplePoint      int                // Time quanta from the start of the bit to the sample point
+	TransceiverDelay time.Duration      // Loop delay of transceivers (transmitter and receiver) added to the propagation along the cable
+}
+
+const (
+	// PropagationDelayPerMeter is the signal delay of twisted pair cable (about 2/3 of the speed of light)
+	PropagationDelayPerMeter = 5 * time.Nanosecond
+
+	// BusLengthEnv is the environment variable with the length of the powertrain bus in meters (enables propagation delays)
+	BusLengthEnv = "CAN_BUS_LENGTH"
+
+	// SamplePointEnv is the environment variable with the sample point in percent of the bit (e.g., "87.5")
+	SamplePointEnv = "CAN_SAMPLE_POINT"
+
+	stateKeyBitHistory    = "bit_history"
+	stateKeySyncOffsets   = "sync_offsets"
+	stateKeyRecessiveBits = "recessive_bits"
+
+	// Frames have at most 6 consecutive recessive bits (5 stuffed ones and CRC delimiter),
+	// so the dominant bit after 7 recessive ones is SOF
+	recessiveBitsBeforeSOF = codec.ProtocolEOFSize
+)
+
+// voltagePair is the pair of voltages written by one unit in one bit
+type voltagePair struct {
+	low     physical.Voltage
+	high    physical.Voltage
+	bitTime string // Data bit time of the bit written in the data phase of FD frames
+}
+
+// propagation holds the timing and the units reading the bus at their positions
+type propagation struct {
+	timing *Timing
+	taps   []string
+}
+
+// DefaultTiming returns the bit timing of 500 kbit/s bus with 16 time quanta per bit and 87.5% sample point (CiA 601-3)
+func DefaultTiming(length float64) *Timing {
+	return &Timing{
+		Length:           length,
+		Positions:        make(map[string]float64),
+		TimeQuanta:       16,
+		SamplePoint:      14,
+		TransceiverDelay: 200 * time.Nanosecond,
+	}
+}
+
+// Validate checks the bit timing and the positions of units
+func (timing *Timing) Validate() error {
+	if timing.TimeQuanta <= 0 {
+		return errors.New("bit must have at least one time quantum")
+	}
+
+	if timing.SamplePoint <= 0 || timing.SamplePoint >= timing.TimeQuanta {
+		return fmt.Errorf("sample point %d is out of the bit (%d time quanta)", timing.SamplePoint, timing.TimeQuanta)
+	}
+
+	for unit, position := range timing.Positions {
+		if position < 0 || position > timing.Length {
+			return fmt.Errorf("position of %s (%g m) is out of the bus (%g m)", unit, position, timing.Length)
+		}
+	}
+	return nil
+}
+
+// TimeQuantum returns the duration of one time quantum
+func (timing *Timing) TimeQuantum() time.Duration {
+	return codec.ProtocolNominalBitTime / time.Duration(timing.TimeQuanta)
+}
+
+// Delay returns the number of time quanta the voltage written by one unit takes to be seen by another one
+// (the unit sees its own voltage after the transceiver loop delay)
+func (timing *Timing) Delay(from, to string) int {
+	distance := math.Abs(timing.Positions[from] - timing.Positions[to])
+	delay := time.Duration(distance*float64(PropagationDelayPerMeter)) + timing.TransceiverDelay
+	return int((delay + timing.TimeQuantum() - 1) / timing.TimeQuantum())
+}
+
+// MaxLength returns the longest bus where the ACK of a receiver at the far end reaches the transmitter before its sample point
+func (timing *Timing) MaxLength() float64 {
+	roundTrip := time.Duration(timing.SamplePoint) * timing.TimeQuantum()
+	return max(0, float64(roundTrip/2-timing.TransceiverDelay)/float64(PropagationDelayPerMeter))
+}
+
+// lag returns how many bits ago the unit wrote the bit seen by the reader at its sample point
+func (timing *Timing) lag(writer, reader string, syncOffsets map[string]int) int {
+	// Both units start their bits at the sync offset, the reader samples at the sample point of its bit
+	margin := syncOffsets[reader] + timing.SamplePoint - syncOffsets[writer] - timing.Delay(writer, reader)
+	if margin >= 0 {
+		return 0
+	}
+	return (-margin + timing.TimeQuanta - 1) / timing.TimeQuanta
+}
+
+// maxLag returns the number of bits kept in history: a bit may be delayed by the sync offset and the delay (both up to the whole bus)
+func (timing *Timing) maxLag() int {
+	longestDelay := timing.Delay("", "") + int(timing.Length*float64(PropagationDelayPerMeter)/float64(timing.TimeQuantum())) + 1
+	return (2*longestDelay-timing.SamplePoint+timing.TimeQuanta-1)/timing.TimeQuanta + 1
+}
+
+func initPropagationState(state component.State) {
+	state.Set(stateKeyBitHistory, []map[string]voltagePair{})
+	state.Set(stateKeySyncOffsets, make(map[string]int))
+	state.Set(stateKeyRecessiveBits, recessiveBitsBeforeSOF)
+}
+
+// propagate writes the voltages seen by each tapped unit at its position, taking into account the bits written earlier
+// which are still on their way to the unit (voltages without a unit, e.g. terminal resistors, are seen by all at once)
+func (p *propagation) propagate(this *component.Component, recessiveRequested bool) {
+	written := collectWrittenVoltages(this, recessiveRequested)
+	p.synchronize(this, written)
+
+	history := append(this.State().Get(stateKeyBitHistory).([]map[string]voltagePair), written)
+	if len(history) > p.timing.maxLag()+1 {
+		history = history[1:]
+	}
+	this.State().Set(stateKeyBitHistory, history)
+
+	syncOffsets := this.State().Get(stateKeySyncOffsets).(map[string]int)
+	for _, reader := range p.taps {
+		seen := voltagePair{low: physical.RecessiveVoltage, high: physical.RecessiveVoltage}
+		var drivers []string
+		for lag := range history {
+			for writer, voltages := range history[len(history)-1-lag] {
+				if writer == "" && lag > 0 || writer != "" && p.timing.lag(writer, reader, syncOffsets) != lag {
+					continue
+				}
+
+				seen.low, seen.high = min(seen.low, voltages.low), max(seen.high, voltages.high)
+				if voltages.bitTime != "" {
+					seen.bitTime = voltages.bitTime
+				}
+				if writer != "" && voltages.low < physical.RecessiveVoltage {
+					drivers = append(drivers, writer)
+				}
+			}
+		}
+
+		lowSignal, highSignal := withBitTime(signal.New(seen.low), seen.bitTime), withBitTime(signal.New(seen.high), seen.bitTime)
+		if len(drivers) > 0 {
+			slices.Sort(drivers)
+			lowSignal.AddLabel(common.LabelBusDrivers, strings.Join(drivers, ","))
+			highSignal.AddLabel(common.LabelBusDrivers, strings.Join(drivers, ","))
+		}
+		lowPort, highPort := tapPorts(reader)
+		this.OutputByName(lowPort).PutSignals(lowSignal)
+		this.OutputByName(highPort).PutSignals(highSignal)
+	}
+}
+
+// synchronize detects SOF and sets the sync offsets of units (time quanta from the start of the bit of the earliest unit):
+// the units writing SOF keep their offsets, the others start their bits when the first SOF edge reaches them
+func (p *propagation) synchronize(this *component.Component, written map[string]voltagePair) {
+	var contenders []string
+	busLow := physical.RecessiveVoltage
+	for writer, voltages := range written {
+		busLow = min(busLow, voltages.low)
+		if voltages.low < physical.RecessiveVoltage {
+			contenders = append(contenders, writer)
+		}
+	}
+
+	recessiveBits := this.State().Get(stateKeyRecessiveBits).(int)
+	if len(contenders) == 0 {
+		this.State().Set(stateKeyRecessiveBits, recessiveBits+1)
+		return
+	}
+	this.State().Set(stateKeyRecessiveBits, 0)
+
+	if recessiveBits < recessiveBitsBeforeSOF {
+		return
+	}
+
+	previousOffsets := this.State().Get(stateKeySyncOffsets).(map[string]int)
+	syncOffsets := make(map[string]int)
+	earliest := math.MaxInt
+	for _, reader := range p.taps {
+		syncOffsets[reader] = previousOffsets[reader]
+		if !slices.Contains(contenders, reader) {
+			syncOffsets[reader] = math.MaxInt
+			for _, contender := range contenders {
+				syncOffsets[reader] = min(syncOffsets[reader], previousOffsets[contender]+p.timing.Delay(contender, reader))
+			}
+		}
+		earliest = min(earliest, syncOffsets[reader])
+	}
+
+	// Only the differences matter, so the offsets are counted from the earliest unit
+	for reader := range syncOffsets {
+		syncOffsets[reader] -= earliest
+	}
+	this.Logger().Printf("SOF by %v, sync offsets in time quanta: %v", contenders, syncOffsets)
+	this.State().Set(stateKeySyncOffsets, syncOffsets)
+}
+
+// collectWrittenVoltages returns the voltages written by each unit in the current bit
+// (voltages without a unit, like the recessive level requested by the watchdog, are stored under the empty name)
+func collectWrittenVoltages(this *component.Component, recessiveRequested bool) map[string]voltagePair {
+	written := make(map[string]voltagePair)
+	if recessiveRequested {
+		written[""] = voltagePair{low: physical.RecessiveVoltage, high: physical.RecessiveVoltage}
+	}
+
+	update := func(portName string, apply func(pair *voltagePair, v physical.Voltage)) {
+		this.InputByName(portName).Signals().ForEach(func(sig *signal.Signal) error {
+			v, ok := sig.PayloadOrNil().(physical.Voltage)
+			if !ok {
+				return nil
+			}
+
+			writer := sig.Labels().ValueOrDefault(common.LabelBusDrivers, "")
+			pair, ok := written[writer]
+			if !ok {
+				pair = voltagePair{low: physical.RecessiveVoltage, high: physical.RecessiveVoltage}
+			}
+			apply(&pair, v)
+			if bitTime := sig.Labels().ValueOrDefault(common.LabelBitTime, ""); bitTime != "" {
+				pair.bitTime = bitTime
+			}
+			written[writer] = pair
+			return nil
+		})
+	}
+
+	update(common.PortCANL, func(pair *voltagePair, v physical.Voltage) {
+		pair.low = min(pair.low, v)
+	})
+	update(common.PortCANH, func(pair *voltagePair, v physical.Voltage) {
+		pair.high = max(pair.high, v)
+	})
+	return written
+}
+
+// tapPorts returns the names of wires ports with the voltages seen by the unit
+func tapPorts(unitName string) (string, string) {
+	return common.PortCANL + "-" + unitName, common.PortCANH + "-" + unitName
+}
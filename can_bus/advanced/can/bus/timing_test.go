@@ -0,0 +1,187 @@
+package bus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/physical"
+	"github.com/stretchr/testify/assert"
+)
+
+// getTestTiming returns the default timing of 40 m bus with units at both ends and in the middle
+// (a time quantum is 125 ns, the transceiver loop delay alone takes 2 quanta, 20 m of cable adds 100 ns)
+func getTestTiming() *Timing {
+	timing := DefaultTiming(40)
+	timing.Positions = map[string]float64{
+		"start":  0,
+		"middle": 20,
+		"end":    40,
+	}
+	return timing
+}
+
+func TestTimingDelay(t *testing.T) {
+	timing := getTestTiming()
+
+	assert.Equal(t, 125*time.Nanosecond, timing.TimeQuantum())
+	assert.Equal(t, 2, timing.Delay("start", "start"))
+	assert.Equal(t, 2, timing.Delay("unknown", "start"), "units not listed are at the start")
+	assert.Equal(t, 3, timing.Delay("start", "middle"), "delays are rounded up")
+	assert.Equal(t, 3, timing.Delay("end", "middle"))
+	assert.Equal(t, 4, timing.Delay("start", "end"))
+	assert.Equal(t, timing.Delay("start", "end"), timing.Delay("end", "start"))
+}
+
+func TestTimingMaxLength(t *testing.T) {
+	tests := []struct {
+		name   string
+		timing *Timing
+		want   float64
+	}{
+		{
+			name:   "default sample point",
+			timing: DefaultTiming(0),
+			want:   135, // (14 * 125 ns / 2 - 200 ns) / 5 ns
+		},
+		{
+			name:   "earlier sample point",
+			timing: &Timing{TimeQuanta: 16, SamplePoint: 12, TransceiverDelay: 200 * time.Nanosecond},
+			want:   110,
+		},
+		{
+			name:   "transceivers are too slow for any cable",
+			timing: &Timing{TimeQuanta: 16, SamplePoint: 2, TransceiverDelay: 200 * time.Nanosecond},
+			want:   0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.InDelta(t, tt.want, tt.timing.MaxLength(), 1e-9)
+		})
+	}
+}
+
+func TestTimingLag(t *testing.T) {
+	timing := getTestTiming()
+	long := DefaultTiming(500)
+	long.Positions = map[string]float64{"end": 500}
+
+	tests := []struct {
+		name        string
+		timing      *Timing
+		writer      string
+		reader      string
+		syncOffsets map[string]int
+		want        int
+	}{
+		{
+			name:   "delay is within the sample point",
+			timing: timing,
+			writer: "start",
+			reader: "end",
+			want:   0,
+		},
+		{
+			name:   "delay is beyond the sample point",
+			timing: long,
+			writer: "start",
+			reader: "end",
+			want:   1, // 2700 ns is 22 quanta
+		},
+		{
+			name:        "reader synchronized to the writer sees the bit in time",
+			timing:      long,
+			writer:      "start",
+			reader:      "end",
+			syncOffsets: map[string]int{"end": 22},
+			want:        0,
+		},
+		{
+			name:        "round trip of the synchronized reader",
+			timing:      long,
+			writer:      "end",
+			reader:      "start",
+			syncOffsets: map[string]int{"end": 22},
+			want:        2, // The bit starts 22 quanta late and arrives 22 quanta later, 30 quanta past the sample point
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.timing.lag(tt.writer, tt.reader, tt.syncOffsets))
+		})
+	}
+}
+
+func TestTimingValidate(t *testing.T) {
+	tests := []struct {
+		name          string
+		timing        *Timing
+		wantErrString string
+	}{
+		{
+			name:   "default timing",
+			timing: getTestTiming(),
+		},
+		{
+			name:          "no time quanta",
+			timing:        &Timing{},
+			wantErrString: "bit must have at least one time quantum",
+		},
+		{
+			name:          "sample point out of the bit",
+			timing:        &Timing{TimeQuanta: 16, SamplePoint: 16},
+			wantErrString: "sample point 16 is out of the bit (16 time quanta)",
+		},
+		{
+			name:          "unit out of the bus",
+			timing:        &Timing{Length: 10, TimeQuanta: 16, SamplePoint: 14, Positions: map[string]float64{"ecu": 11}},
+			wantErrString: "position of ecu (11 m) is out of the bus (10 m)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.timing.Validate()
+			if tt.wantErrString == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, tt.wantErrString)
+		})
+	}
+}
+
+func TestPropagationSynchronize(t *testing.T) {
+	prop := &propagation{
+		timing: getTestTiming(),
+		taps:   []string{"start", "middle", "end"},
+	}
+	wires := newWires("test-wires", prop)
+	dominant := voltagePair{low: physical.DominantLowVoltage, high: physical.DominantHighVoltage}
+	recessive := voltagePair{low: physical.RecessiveVoltage, high: physical.RecessiveVoltage}
+	syncOffsets := func() map[string]int {
+		return wires.State().Get(stateKeySyncOffsets).(map[string]int)
+	}
+
+	// SOF: the others start their bits when the edge reaches them
+	prop.synchronize(wires, map[string]voltagePair{"start": dominant})
+	assert.Equal(t, map[string]int{"start": 0, "middle": 3, "end": 4}, syncOffsets())
+
+	// Dominant bits within the frame do not synchronize
+	prop.synchronize(wires, map[string]voltagePair{"start": recessive})
+	prop.synchronize(wires, map[string]voltagePair{"end": dominant})
+	assert.Equal(t, map[string]int{"start": 0, "middle": 3, "end": 4}, syncOffsets())
+
+	// The next SOF after the bus is idle: the writer keeps its bit clock
+	for range recessiveBitsBeforeSOF {
+		prop.synchronize(wires, map[string]voltagePair{"": recessive})
+	}
+	prop.synchronize(wires, map[string]voltagePair{"end": dominant})
+	assert.Equal(t, map[string]int{"start": 4, "middle": 3, "end": 0}, syncOffsets())
+
+	// Contenders writing SOF together keep their clocks, the others follow the earliest edge
+	for range recessiveBitsBeforeSOF {
+		prop.synchronize(wires, map[string]voltagePair{})
+	}
+	prop.synchronize(wires, map[string]voltagePair{"start": dominant, "end": dominant})
+	assert.Equal(t, map[string]int{"start": 4, "middle": 3, "end": 0}, syncOffsets())
+}
@@ -15,7 +15,9 @@ const (
 	stopBusAfterIdleCycles     = 11 + 1            // If the bus remains idle for 12 (11 signals are needed for controller to start arbitration) consecutive cycles, stop watchdog self-activation to allow the bus to stop naturally)
 )
 
-func newWatchdog(name string) *component.Component {
+// newWatchdog creates the watchdog, extra propagation cycles are added to its idle thresholds
+// when there are more components between transceivers and wires
+func newWatchdog(name string, extraPropagationCycles int) *component.Component {
 	watchdog := component.New(name).
 		WithDescription("Simulates terminal resistors and halts the bus when all nodes are idle").
 		AddInputs(
@@ -67,14 +69,14 @@ func newWatchdog(name string) *component.Component {
 				this.State().Set(stateKeyObservedIdleCycles, 0)
 			}
 
-			if !allControllersAreIdle && idleCycleCount >= triggerBusAfterIdleCycles {
+			if !allControllersAreIdle && idleCycleCount >= triggerBusAfterIdleCycles+extraPropagationCycles {
 				this.State().Set(stateKeyObservedIdleCycles, 0)
 				this.Logger().Printf("The bus is idle for %d consecutive cycles. I will request 1 recessive bit", idleCycleCount)
 				this.OutputByName(portRecessiveBitRequest).PutSignals(signal.New(1))
 				return nil
 			}
 
-			if allControllersAreIdle && idleCycleCount >= stopBusAfterIdleCycles {
+			if allControllersAreIdle && idleCycleCount >= stopBusAfterIdleCycles+extraPropagationCycles {
 				this.Logger().Println("Looks like all controllers are idle. I'm letting the bus to stop naturally")
 				return nil
 			}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"slices"
+	"strings"
 
 	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/codec"
 	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/common"
@@ -17,17 +18,21 @@ const (
 	initialRecessiveBitsRequest = codec.ProtocolEOFSize + codec.ProtocolIFSSize + 1
 )
 
-func newWires(name string) *component.Component {
+// newWires creates the wires, with propagation the voltages seen by each tapped unit are written to its own ports
+// (the common ports always have the voltages as if the bus had no length)
+func newWires(name string, prop *propagation) *component.Component {
 	wires := component.New(name).
 		WithDescription("Simulates differential low/high pair, performs wire-and logic").
 		AddInputs(common.PortCANL, common.PortCANH, portRecessiveBitRequest).
 		AddOutputs(common.PortCANL, common.PortCANH, portRecessiveBitRequest).
 		WithLogger(common.NewNoopLogger()).
+		WithInitialState(initPropagationState).
 		WithActivationFunc(func(this *component.Component) error {
 			allLow, allHigh, err := processRecessiveBitRequest(this)
 			if err != nil {
 				return fmt.Errorf("failed to process recessive bits request: %w", err)
 			}
+			recessiveRequested := len(allLow) > 0
 
 			allLow, err = collectLow(this, allLow)
 			if err != nil {
@@ -44,7 +49,15 @@ func newWires(name string) *component.Component {
 				return err
 			}
 
-			return doWiredAND(this, allLow, allHigh)
+			err = doWiredAND(this, allLow, allHigh, collectDominantDrivers(this), collectBitTime(this, common.PortCANL))
+			if err != nil {
+				return err
+			}
+
+			if prop != nil {
+				prop.propagate(this, recessiveRequested)
+			}
+			return nil
 		})
 
 	// Set up self-activation pipe
@@ -135,15 +148,58 @@ func validateVoltages(allLow, allHigh []physical.Voltage) error {
 	return nil
 }
 
+// Collect the units driving the dominant level (transceivers label voltages with their unit)
+func collectDominantDrivers(this *component.Component) string {
+	var drivers []string
+	this.InputByName(common.PortCANL).Signals().ForEach(func(sig *signal.Signal) error {
+		v, ok := sig.PayloadOrNil().(physical.Voltage)
+		driver := sig.Labels().ValueOrDefault(common.LabelBusDrivers, "")
+		if ok && v < physical.RecessiveVoltage && driver != "" && !slices.Contains(drivers, driver) {
+			drivers = append(drivers, driver)
+		}
+		return nil
+	})
+
+	slices.Sort(drivers)
+	return strings.Join(drivers, ",")
+}
+
+// Collect the bit time the transmitter labels bits with in the data phase of FD frames (empty for nominal bits)
+func collectBitTime(this *component.Component, portName string) string {
+	bitTime := ""
+	this.InputByName(portName).Signals().ForEach(func(sig *signal.Signal) error {
+		if bitTime == "" {
+			bitTime = sig.Labels().ValueOrDefault(common.LabelBitTime, "")
+		}
+		return nil
+	})
+	return bitTime
+}
+
+// withBitTime labels the voltage with the bit time (nominal bits are not labeled)
+func withBitTime(sig *signal.Signal, bitTime string) *signal.Signal {
+	if bitTime != "" {
+		sig.AddLabel(common.LabelBitTime, bitTime)
+	}
+	return sig
+}
+
 // Simulate wired-AND behavior by deriving the bus voltage levels from all connected transceivers
-func doWiredAND(this *component.Component, allLow, allHigh []physical.Voltage) error {
+func doWiredAND(this *component.Component, allLow, allHigh []physical.Voltage, drivers string, bitTime string) error {
 	// For simplicity, we approximate this by using min(CAN_L) and max(CAN_H) across all nodes
 	busLow := slices.Min(allLow)
 	busHigh := slices.Max(allHigh)
 
 	this.Logger().Printf("bus voltage is L:%v / H:%v", busLow, busHigh)
 
-	this.OutputByName(common.PortCANL).PutSignals(signal.New(busLow))
-	this.OutputByName(common.PortCANH).PutSignals(signal.New(busHigh))
+	lowSignal, highSignal := withBitTime(signal.New(busLow), bitTime), withBitTime(signal.New(busHigh), bitTime)
+	if drivers != "" {
+		// Simulation metadata: lets bus monitors know who transmits
+		lowSignal.AddLabel(common.LabelBusDrivers, drivers)
+		highSignal.AddLabel(common.LabelBusDrivers, drivers)
+	}
+
+	this.OutputByName(common.PortCANL).PutSignals(lowSignal)
+	this.OutputByName(common.PortCANH).PutSignals(highSignal)
 	return nil
 }
@@ -120,6 +120,12 @@ func (bits Bits) WithoutStuffing(count int) Bits {
 	return result
 }
 
+// WithACK appends the ACK slot and the ACK delimiter, both are recessive when sent by the transmitter
+// (receivers overwrite the ACK slot with a dominant bit)
+func (bits Bits) WithACK() Bits {
+	return append(bits, RepeatBit(ProtocolRecessiveBit, ProtocolACKSlotSize+ProtocolACKDelimiterSize)...)
+}
+
 func (bits Bits) WithEOF() Bits {
 	return append(bits, RepeatBit(ProtocolRecessiveBit, ProtocolEOFSize)...)
 }
@@ -135,6 +141,14 @@ func (bits Bits) WithBits(extraBits ...Bit) Bits {
 	return bits
 }
 
+// WithInt appends the lowest size bits of the value (MSB first)
+func (bits Bits) WithInt(value int, size int) Bits {
+	for i := size - 1; i >= 0; i-- {
+		bits = append(bits, Bit((value>>i)&1 == 1))
+	}
+	return bits
+}
+
 func (bits Bits) ToInt() int {
 	var result = 0
 	for _, bit := range bits {
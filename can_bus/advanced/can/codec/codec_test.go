@@ -2,8 +2,10 @@ package codec
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func bitSeq(bools ...bool) Bits {
@@ -108,3 +110,288 @@ func TestAllBitsAre(t *testing.T) {
 	assert.True(t, bitSeq(true, true, true).AllBitsAre(true))
 	assert.False(t, bitSeq(true, false, true).AllBitsAre(true))
 }
+
+func TestCRC15(t *testing.T) {
+	// CRC-15/CAN check value of "123456789"
+	var bits Bits
+	for _, b := range []byte("123456789") {
+		for i := 7; i >= 0; i-- {
+			bits = append(bits, (b>>i)&1 == 1)
+		}
+	}
+	assert.Equal(t, uint16(0x059E), CRC15(bits))
+
+	withCRC := bits.WithCRC()
+	assert.Equal(t, bits.Len()+ProtocolCRCSize, withCRC.Len())
+	assert.Equal(t, 0x059E, withCRC[bits.Len():].ToInt())
+}
+
+func TestFrameToBitsCRC(t *testing.T) {
+	frame := &Frame{Id: 0x7DF, DLC: 3, Data: [ProtocolMaxFDDataBytes]byte{0x02, 0x01, 0x0C}}
+	unstuffed := frame.ToBits().WithoutStuffing(ProtocolBitStuffingStep)
+
+	firstCRCBitIndex := FrameHeaderSize(frame.Extended, false) + int(frame.DLC)*8
+	crcDelimiterIndex := firstCRCBitIndex + ProtocolCRCSize
+
+	assert.Equal(t, crcDelimiterIndex+ProtocolCRCDelimiterSize+ProtocolACKSlotSize+ProtocolACKDelimiterSize+ProtocolEOFSize, unstuffed.Len())
+	assert.Equal(t, int(CRC15(unstuffed[:firstCRCBitIndex])), unstuffed[firstCRCBitIndex:crcDelimiterIndex].ToInt())
+	assert.True(t, unstuffed[crcDelimiterIndex:].AllBitsAre(ProtocolRecessiveBit), "CRC delimiter, ACK and EOF should be recessive when transmitted")
+
+	decoded, err := FromBits(unstuffed[ProtocolSOFSize:firstCRCBitIndex])
+	assert.NoError(t, err)
+	assert.Equal(t, frame, decoded)
+}
+
+func TestExtendedFrameToBits(t *testing.T) {
+	frame := &Frame{Id: 0x18DB33F1, Extended: true, DLC: 2, Data: [ProtocolMaxFDDataBytes]byte{0x01, 0x0D}}
+	unstuffed := frame.ToBits().WithoutStuffing(ProtocolBitStuffingStep)
+
+	srrIndex := ProtocolSOFSize + ProtocolIDSize
+	ideIndex := srrIndex + ProtocolSRRSize
+	assert.Equal(t, 0x18DB33F1>>ProtocolExtendedIDSize, unstuffed[ProtocolSOFSize:srrIndex].ToInt(), "base ID holds the most significant bits")
+	assert.True(t, unstuffed[srrIndex].IsRecessive(), "SRR should be recessive")
+	assert.True(t, unstuffed[ideIndex].IsRecessive(), "IDE should be recessive in extended frames")
+	assert.Equal(t, 0x18DB33F1&0x3FFFF, unstuffed[ideIndex+1:ideIndex+1+ProtocolExtendedIDSize].ToInt())
+
+	firstCRCBitIndex := FrameHeaderSize(true, false) + int(frame.DLC)*8
+	decoded, err := FromBits(unstuffed[ProtocolSOFSize:firstCRCBitIndex])
+	assert.NoError(t, err)
+	assert.Equal(t, frame, decoded)
+
+	assert.False(t, (&Frame{Id: ProtocolMaxExtendedID + 1, Extended: true}).IsValid())
+	assert.False(t, (&Frame{Id: ProtocolMaxID + 1}).IsValid())
+	assert.True(t, (&Frame{Id: ProtocolMaxID + 1, Extended: true}).IsValid())
+}
+
+func TestStandardFrameWinsArbitrationOverExtended(t *testing.T) {
+	// Same base ID: the standard frame has dominant RTR and IDE where the extended one has recessive SRR and IDE
+	standard := (&Frame{Id: 0x123}).ToBits().WithoutStuffing(ProtocolBitStuffingStep)
+	extended := (&Frame{Id: 0x123<<ProtocolExtendedIDSize | 0x3FFFF, Extended: true}).ToBits().WithoutStuffing(ProtocolBitStuffingStep)
+
+	arbitrationEnd := ProtocolSOFSize + ArbitrationFieldSize(false)
+	for i := 0; i < arbitrationEnd; i++ {
+		// Wired-AND: the first bit where the frames differ decides, the dominant (0) bit wins
+		if standard[i] != extended[i] {
+			assert.True(t, standard[i].IsDominant(), "standard frame should win at bit %d", i)
+			return
+		}
+	}
+	t.Fatal("standard and extended frames should differ within the arbitration field")
+}
+
+func TestRemoteFrameToBits(t *testing.T) {
+	frame := &Frame{Id: 0x3E0, Remote: true, DLC: 2}
+	unstuffed := frame.ToBits().WithoutStuffing(ProtocolBitStuffingStep)
+
+	assert.True(t, unstuffed[RTRIndex(false)].IsRecessive(), "RTR should be recessive in remote frames")
+
+	// Remote frame has no data field, CRC follows DLC
+	firstCRCBitIndex := FrameHeaderSize(false, false)
+	crcDelimiterIndex := firstCRCBitIndex + ProtocolCRCSize
+	assert.Equal(t, crcDelimiterIndex+ProtocolCRCDelimiterSize+ProtocolACKSlotSize+ProtocolACKDelimiterSize+ProtocolEOFSize, unstuffed.Len())
+	assert.Equal(t, int(CRC15(unstuffed[:firstCRCBitIndex])), unstuffed[firstCRCBitIndex:crcDelimiterIndex].ToInt())
+
+	decoded, err := FromBits(unstuffed[ProtocolSOFSize:firstCRCBitIndex])
+	assert.NoError(t, err)
+	assert.Equal(t, frame, decoded)
+
+	extended := &Frame{Id: 0x18DB33F1, Extended: true, Remote: true, DLC: 8}
+	unstuffed = extended.ToBits().WithoutStuffing(ProtocolBitStuffingStep)
+	assert.True(t, unstuffed[RTRIndex(true)].IsRecessive())
+
+	decoded, err = FromBits(unstuffed[ProtocolSOFSize:FrameHeaderSize(true, false)])
+	assert.NoError(t, err)
+	assert.Equal(t, extended, decoded)
+}
+
+func TestDataFrameWinsArbitrationOverRemote(t *testing.T) {
+	for _, extended := range []bool{false, true} {
+		data := (&Frame{Id: 0x3E0, Extended: extended, DLC: 1}).ToBits().WithoutStuffing(ProtocolBitStuffingStep)
+		remote := (&Frame{Id: 0x3E0, Extended: extended, Remote: true, DLC: 1}).ToBits().WithoutStuffing(ProtocolBitStuffingStep)
+
+		// Everything up to RTR is the same, RTR decides
+		rtrIndex := RTRIndex(extended)
+		assert.True(t, data[:rtrIndex].Equals(remote[:rtrIndex]))
+		assert.True(t, data[rtrIndex].IsDominant())
+		assert.True(t, remote[rtrIndex].IsRecessive())
+	}
+}
+
+func TestFDCRC(t *testing.T) {
+	var bits Bits
+	for _, b := range []byte("123456789") {
+		bits = bits.WithInt(int(b), 8)
+	}
+
+	// Check values of CRC-17/CAN-FD and CRC-21/CAN-FD (with zero initial value, ISO CAN FD starts with the MSB set)
+	assert.Equal(t, uint32(0x04F03), calculateCRC(ProtocolCRC17Size, ProtocolCRC17Polynomial, 0, bits))
+	assert.Equal(t, uint32(0x0ED841), calculateCRC(ProtocolCRC21Size, ProtocolCRC21Polynomial, 0, bits))
+}
+
+func TestFDDataLength(t *testing.T) {
+	assert.Equal(t, 8, FDDataLength(8))
+	assert.Equal(t, 12, FDDataLength(9))
+	assert.Equal(t, 64, FDDataLength(15))
+
+	dlc, err := FDDLC(17)
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(11), dlc, "17 bytes are padded to 20")
+
+	_, err = FDDLC(65)
+	assert.Error(t, err)
+}
+
+func TestStuffCountBits(t *testing.T) {
+	assert.Equal(t, "0000", StuffCountBits(0).String())
+	assert.Equal(t, "0011", StuffCountBits(1).String())
+	assert.Equal(t, "0101", StuffCountBits(3).String())
+	assert.Equal(t, "1001", StuffCountBits(7).String())
+	assert.Equal(t, StuffCountBits(2), StuffCountBits(10), "stuff count is modulo 8")
+}
+
+func TestFDFrameToBits(t *testing.T) {
+	for _, dataLength := range []int{0, 12, 64} {
+		frame := &Frame{Id: 0x18DA10F1, Extended: true, FD: true, BitRateSwitch: true}
+		dlc, err := FDDLC(dataLength)
+		assert.NoError(t, err)
+		frame.DLC = dlc
+		for i := range dataLength {
+			frame.Data[i] = byte(i)
+		}
+
+		frameBits := frame.ToBits()
+		headerAndData := frame.headerAndDataBits()
+		stuffed := headerAndData.WithDynamicStuffing()
+		assert.True(t, frameBits[:stuffed.Len()].Equals(stuffed), "SOF..Data should be dynamically stuffed")
+		assert.True(t, stuffed.WithoutStuffing(ProtocolBitStuffingStep).Equals(headerAndData))
+
+		// Stuff count and CRC with fixed stuff bits follow the data field
+		crcFieldEnd := stuffed.Len() + FDCRCFieldSize(dataLength)
+		crcField, err := frameBits[stuffed.Len():crcFieldEnd].WithoutFixedStuffing(stuffed[stuffed.Len()-1], ProtocolFDFixedStuffingStep)
+		assert.NoError(t, err)
+
+		stuffCount := crcField[:ProtocolStuffCountSize]
+		assert.Equal(t, StuffCountBits(stuffed.Len()-headerAndData.Len()), stuffCount)
+		assert.Equal(t, FDCRCSize(dataLength), crcField.Len()-ProtocolStuffCountSize)
+		assert.Equal(t, int(FDCRC(stuffed, stuffCount, dataLength)), crcField[ProtocolStuffCountSize:].ToInt())
+		assert.True(t, frameBits[crcFieldEnd:].AllBitsAre(ProtocolRecessiveBit), "CRC delimiter, ACK and EOF should be recessive when transmitted")
+
+		decoded, err := FromBits(headerAndData[ProtocolSOFSize:])
+		assert.NoError(t, err)
+		assert.Equal(t, frame, decoded)
+	}
+
+	assert.Equal(t, 21, FDCRCSize(20))
+	assert.False(t, (&Frame{Id: 0x123, FD: true, Remote: true}).IsValid(), "there are no remote FD frames")
+	assert.False(t, (&Frame{Id: 0x123, BitRateSwitch: true}).IsValid(), "BRS is FD only")
+}
+
+func TestClassicFrameHasDominantFDF(t *testing.T) {
+	for _, extended := range []bool{false, true} {
+		classic := (&Frame{Id: 0x123, Extended: extended, DLC: 1}).ToBits().WithoutStuffing(ProtocolBitStuffingStep)
+		fd := (&Frame{Id: 0x123, Extended: extended, FD: true, DLC: 1}).ToBits().WithoutStuffing(ProtocolBitStuffingStep)
+
+		fdfIndex := FDFIndex(extended)
+		assert.True(t, classic[:fdfIndex].Equals(fd[:fdfIndex]), "arbitration field is the same")
+		assert.True(t, classic[fdfIndex].IsDominant())
+		assert.True(t, fd[fdfIndex].IsRecessive())
+	}
+}
+
+func TestFDFrameDuration(t *testing.T) {
+	frame := &Frame{Id: 0x123, FD: true, DLC: 15}
+	withBRS := &Frame{Id: 0x123, FD: true, BitRateSwitch: true, DLC: 15}
+
+	assert.Equal(t, time.Duration(frame.ToBits().Len())*ProtocolNominalBitTime, frame.Duration())
+	assert.Less(t, withBRS.Duration(), frame.Duration())
+	assert.Greater(t, withBRS.Duration(), time.Duration(withBRS.ToBits().Len())*ProtocolDataBitTime)
+}
+
+func TestFrameDataPhase(t *testing.T) {
+	tests := []struct {
+		name      string
+		frame     *Frame
+		wantEmpty bool
+	}{
+		{
+			name:      "classic frame",
+			frame:     &Frame{Id: 0x123, DLC: 8},
+			wantEmpty: true,
+		},
+		{
+			name:      "FD frame without bit rate switch",
+			frame:     &Frame{Id: 0x123, FD: true, DLC: 15},
+			wantEmpty: true,
+		},
+		{
+			name:  "FD frame with bit rate switch",
+			frame: &Frame{Id: 0x123, FD: true, BitRateSwitch: true, DLC: 15},
+		},
+		{
+			name:  "extended FD frame with bit rate switch",
+			frame: &Frame{Id: 0x18DAF110, Extended: true, FD: true, BitRateSwitch: true, DLC: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, to := tt.frame.DataPhase()
+			frameBits := tt.frame.ToBits()
+			if tt.wantEmpty {
+				assert.Equal(t, from, to)
+				assert.Equal(t, time.Duration(frameBits.Len())*ProtocolNominalBitTime, tt.frame.Duration())
+				return
+			}
+
+			// The data phase starts right after BRS and ends with the CRC field
+			brsIndex := FDFIndex(tt.frame.Extended) + ProtocolFDFSize + ProtocolReservedSize
+			assert.Equal(t, brsIndex+ProtocolBRSSize, frameBits[:from].WithoutStuffing(ProtocolBitStuffingStep).Len())
+			assert.Equal(t, frameBits.Len()-ProtocolCRCDelimiterSize-ProtocolACKSlotSize-ProtocolACKDelimiterSize-ProtocolEOFSize, to)
+			assert.True(t, frameBits[to].IsRecessive(), "CRC delimiter")
+
+			dataPhaseBits := time.Duration(to - from)
+			assert.Equal(t, time.Duration(frameBits.Len())*ProtocolNominalBitTime-dataPhaseBits*(ProtocolNominalBitTime-ProtocolDataBitTime), tt.frame.Duration())
+		})
+	}
+}
+
+func TestParseBitTime(t *testing.T) {
+	tests := []struct {
+		name          string
+		label         string
+		want          time.Duration
+		wantErrString string
+	}{
+		{
+			name:  "nominal bit is not labeled",
+			label: "",
+			want:  ProtocolNominalBitTime,
+		},
+		{
+			name:  "data bit",
+			label: ProtocolDataBitTime.String(),
+			want:  ProtocolDataBitTime,
+		},
+		{
+			name:          "not a duration",
+			label:         "fast",
+			wantErrString: "invalid bit time: fast",
+		},
+		{
+			name:          "not positive",
+			label:         "0s",
+			wantErrString: "invalid bit time: 0s",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseBitTime(tt.label)
+			if tt.wantErrString != "" {
+				assert.ErrorContains(t, err, tt.wantErrString)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package codec
+
+// CRC15 calculates the CAN CRC-15 of the given (unstuffed) bits
+func CRC15(bits Bits) uint16 {
+	return uint16(calculateCRC(ProtocolCRCSize, ProtocolCRCPolynomial, 0, bits))
+}
+
+// CRC17 calculates the CAN FD CRC-17 of the given bits
+func CRC17(bits ...Bits) uint32 {
+	return calculateCRC(ProtocolCRC17Size, ProtocolCRC17Polynomial, 1<<(ProtocolCRC17Size-1), bits...)
+}
+
+// CRC21 calculates the CAN FD CRC-21 of the given bits
+func CRC21(bits ...Bits) uint32 {
+	return calculateCRC(ProtocolCRC21Size, ProtocolCRC21Polynomial, 1<<(ProtocolCRC21Size-1), bits...)
+}
+
+// FDCRC calculates the CRC of FD frame over SOF..Data (including dynamic stuff bits) and the stuff count,
+// CRC-17 protects up to 16 data bytes, CRC-21 protects longer frames
+func FDCRC(stuffedBits Bits, stuffCount Bits, dataBytes int) uint32 {
+	if dataBytes > ProtocolCRC17MaxDataBytes {
+		return CRC21(stuffedBits, stuffCount)
+	}
+	return CRC17(stuffedBits, stuffCount)
+}
+
+// FDCRCSize returns the size of FD frame CRC (without stuff count and fixed stuff bits)
+func FDCRCSize(dataBytes int) int {
+	if dataBytes > ProtocolCRC17MaxDataBytes {
+		return ProtocolCRC21Size
+	}
+	return ProtocolCRC17Size
+}
+
+// calculateCRC shifts all bits (MSB first) through the CRC register of the given size
+func calculateCRC(size int, polynomial, init uint32, bitSlices ...Bits) uint32 {
+	crc := init
+	for _, bits := range bitSlices {
+		for _, bit := range bits {
+			crcNext := bit != Bit((crc>>(size-1))&1 == 1)
+			crc = (crc << 1) & (1<<size - 1)
+			if crcNext {
+				crc ^= polynomial
+			}
+		}
+	}
+	return crc
+}
+
+// WithCRC appends the CRC-15 of the bits (MSB first)
+func (bits Bits) WithCRC() Bits {
+	return bits.WithInt(int(CRC15(bits)), ProtocolCRCSize)
+}
+
+// WithCRCDelimiter appends the recessive CRC delimiter
+func (bits Bits) WithCRCDelimiter() Bits {
+	return append(bits, RepeatBit(ProtocolRecessiveBit, ProtocolCRCDelimiterSize)...)
+}
@@ -0,0 +1,89 @@
+package codec
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// fdDataLengths maps DLC of FD frames to the number of data bytes
+var fdDataLengths = [16]int{0, 1, 2, 3, 4, 5, 6, 7, 8, 12, 16, 20, 24, 32, 48, 64}
+
+// FDDataLength returns the number of data bytes coded by DLC of FD frame
+func FDDataLength(dlc int) int {
+	if dlc < 0 || dlc >= len(fdDataLengths) {
+		return 0
+	}
+	return fdDataLengths[dlc]
+}
+
+// FDDLC returns the smallest DLC of FD frame which fits the given number of data bytes
+// (the data field is padded up to the coded length)
+func FDDLC(length int) (uint8, error) {
+	dlc := slices.IndexFunc(fdDataLengths[:], func(dataLength int) bool {
+		return dataLength >= length
+	})
+	if length < 0 || dlc < 0 {
+		return 0, fmt.Errorf("data length %d does not fit into FD frame", length)
+	}
+	return uint8(dlc), nil
+}
+
+// FDCRCFieldSize returns the number of bits between the data field and the CRC delimiter of FD frame:
+// the stuff count, the CRC and the fixed stuff bits
+func FDCRCFieldSize(dataBytes int) int {
+	fieldSize := ProtocolStuffCountSize + FDCRCSize(dataBytes)
+	fixedStuffBits := (fieldSize + ProtocolFDFixedStuffingStep - 1) / ProtocolFDFixedStuffingStep
+	return fieldSize + fixedStuffBits
+}
+
+// StuffCountBits encodes the number of dynamic stuff bits (modulo 8) in gray code followed by the even parity bit
+func StuffCountBits(stuffBits int) Bits {
+	count := stuffBits % 8
+	grayCode := count ^ (count >> 1)
+	bits := NewBits(0).WithInt(grayCode, ProtocolStuffCountSize-1)
+
+	parity := ProtocolDominantBit
+	for _, bit := range bits {
+		parity = parity != bit
+	}
+	return bits.WithBits(parity)
+}
+
+// WithDynamicStuffing stuffs the bits like WithStuffing does, but never ends with a stuff bit:
+// in FD frames the first fixed stuff bit follows the data field (it is the complement of the last bit anyway)
+func (bits Bits) WithDynamicStuffing() Bits {
+	stuffed := bits.WithStuffing(ProtocolBitStuffingStep)
+	if stuffed.Len() > bits.Len() && stuffed.Len() > ProtocolBitStuffingStep &&
+		stuffed[stuffed.Len()-ProtocolBitStuffingStep-1:stuffed.Len()-1].AllBitsAre(!stuffed[stuffed.Len()-1]) {
+		return stuffed.WithoutLastBit()
+	}
+	return stuffed
+}
+
+// WithFixedStuffing appends the field inserting a fixed stuff bit (the complement of the preceding bit) before each step bits
+func (bits Bits) WithFixedStuffing(field Bits, step int) Bits {
+	for i, bit := range field {
+		if i%step == 0 && bits.Len() > 0 {
+			bits = append(bits, !bits[bits.Len()-1])
+		}
+		bits = append(bits, bit)
+	}
+	return bits
+}
+
+// WithoutFixedStuffing removes fixed stuff bits from the field, precedingBit is the last bit before the field
+func (bits Bits) WithoutFixedStuffing(precedingBit Bit, step int) (Bits, error) {
+	var field Bits
+	for i, bit := range bits {
+		if i%(step+1) == 0 {
+			if bit == precedingBit {
+				return nil, errors.New("fixed stuff bit has the same level as the preceding bit")
+			}
+		} else {
+			field = append(field, bit)
+		}
+		precedingBit = bit
+	}
+	return field, nil
+}
@@ -3,26 +3,103 @@ package codec
 import (
 	"errors"
 	"fmt"
+	"time"
 )
 
 // Frame represents a simplified CAN frame (no memory optimizations)
 type Frame struct {
 	// SOF
-	Id uint32 // CAN node ID (11 bits)
-	// RTR
-	// IDE
-	// r0
-	// r1
-	DLC  uint8                      // Data length code (4 bits)
-	Data [ProtocolMaxDataBytes]byte // Payload
-	// CRC
-	// ACK
+	Id       uint32 // CAN node ID (11 bits, or 29 bits in extended frames)
+	Extended bool   // IDE: extended (CAN 2.0B) frame with 29-bit ID
+	// SRR (extended frames only)
+	Remote bool // RTR: remote frame requesting the data frame with the same ID (has no data field), RRS in FD frames (always dominant)
+	FD     bool // FDF: FD frame (r0 in classic standard frames, r1 in classic extended frames)
+	// r0, res in FD frames
+	// r1 (classic extended frames only)
+	BitRateSwitch       bool                         // BRS: data phase of FD frame is transmitted with the data bit time
+	ErrorStateIndicator bool                         // ESI: transmitter of FD frame is error-passive (set by the controller)
+	DLC                 uint8                        // Data length code (4 bits)
+	Data                [ProtocolMaxFDDataBytes]byte // Payload (classic frames use only the first 8 bytes)
+	// Stuff count (FD frames only)
+	// CRC (calculated when encoding)
+	// ACK (driven by receivers)
 	// EOF
 	// IFS
 }
 
+// FrameHeaderSize returns the number of bits from SOF to DLC (inclusive)
+func FrameHeaderSize(extended bool, fd bool) int {
+	var controlBits int
+	switch {
+	case fd:
+		// FDF | res | BRS | ESI
+		controlBits = ProtocolFDFSize + ProtocolReservedSize + ProtocolBRSSize + ProtocolESISize
+	case extended:
+		// r1 | r0
+		controlBits = 2 * ProtocolReservedSize
+	default:
+		// r0
+		controlBits = ProtocolReservedSize
+	}
+	return ProtocolSOFSize + ArbitrationFieldSize(extended) + controlBits + ProtocolDLCSize
+}
+
+// ArbitrationFieldSize returns the number of bits after SOF which take part in arbitration (up to RTR inclusive)
+// IDE of standard frames is counted as well, as it is written while an extended frame with the same base ID
+// may still be competing (the dominant IDE makes standard frames win)
+func ArbitrationFieldSize(extended bool) int {
+	if extended {
+		return ProtocolIDSize + ProtocolSRRSize + ProtocolIDESize + ProtocolExtendedIDSize + ProtocolRTRSize
+	}
+	return ProtocolIDSize + ProtocolRTRSize + ProtocolIDESize
+}
+
+// RTRIndex returns the position of the RTR bit in the frame (counting from SOF)
+func RTRIndex(extended bool) int {
+	if extended {
+		return ProtocolSOFSize + ArbitrationFieldSize(true) - ProtocolRTRSize
+	}
+	return ProtocolSOFSize + ProtocolIDSize
+}
+
+// FDFIndex returns the position of the FDF bit in the frame (counting from SOF), it follows the arbitration field
+func FDFIndex(extended bool) int {
+	return ProtocolSOFSize + ArbitrationFieldSize(extended)
+}
+
+// DataFieldBytes returns the number of bytes in the data field,
+// remote frames carry the requested data length in DLC, but have no data field
+func DataFieldBytes(dlc int, remote bool, fd bool) int {
+	switch {
+	case fd:
+		return FDDataLength(dlc)
+	case remote:
+		return 0
+	default:
+		return dlc
+	}
+}
+
+// DataLength returns the number of bytes in the data field
+func (frame *Frame) DataLength() int {
+	return DataFieldBytes(int(frame.DLC), frame.Remote, frame.FD)
+}
+
 func (frame *Frame) IsValid() bool {
-	if frame.Id > ProtocolMaxID {
+	if frame.Extended && frame.Id > ProtocolMaxExtendedID {
+		return false
+	}
+
+	if !frame.Extended && frame.Id > ProtocolMaxID {
+		return false
+	}
+
+	if frame.FD {
+		// There are no remote FD frames, DLC codes up to 64 bytes
+		return !frame.Remote && int(frame.DLC) < len(fdDataLengths)
+	}
+
+	if frame.BitRateSwitch || frame.ErrorStateIndicator {
 		return false
 	}
 
@@ -34,90 +111,178 @@ func (frame *Frame) IsValid() bool {
 }
 
 // ToBits encodes the CAN frame into a slice of bits
-// Format: 1 bit SOF| 11 bits ID | 4-bit DLC | DLC * 8-bit Data
+// Remote frames have the recessive RTR bit and no data field
+// Standard format: 1 bit SOF | 11 bits ID | 1 bit RTR | 1 bit IDE | 1 bit r0 | 4-bit DLC | DLC * 8-bit Data | 15-bit CRC | 1 bit CRC delimiter | 1 bit ACK slot | 1 bit ACK delimiter | 7 bits EOF
+// Extended format: 1 bit SOF | 11 bits base ID | 1 bit SRR | 1 bit IDE | 18 bits ID extension | 1 bit RTR | 1 bit r1 | 1 bit r0 | 4-bit DLC | ... (same as standard)
+// The CRC is calculated over SOF..Data, everything up to the CRC delimiter is stuffed
+// FD format: ... 1 bit RRS | 1 bit IDE | ... | 1 bit FDF | 1 bit res | 1 bit BRS | 1 bit ESI | 4-bit DLC | up to 64 bytes Data | 4-bit stuff count | 17 or 21-bit CRC | ... (same as classic)
+// Dynamic stuffing of FD frames ends with the data field, the stuff count and the CRC have fixed stuff bits,
+// the CRC is calculated over stuffed SOF..Data and the stuff count
 func (frame *Frame) ToBits() Bits {
+	bits := frame.headerAndDataBits()
+
+	if frame.FD {
+		stuffed := bits.WithDynamicStuffing()
+		stuffCount := StuffCountBits(stuffed.Len() - bits.Len())
+		crcField := stuffCount.WithInt(int(FDCRC(stuffed, stuffCount, frame.DataLength())), FDCRCSize(frame.DataLength()))
+
+		return stuffed.WithFixedStuffing(crcField, ProtocolFDFixedStuffingStep).WithCRCDelimiter().WithACK().WithEOF()
+	}
+
+	return bits.WithCRC().WithStuffing(ProtocolBitStuffingStep).WithCRCDelimiter().WithACK().WithEOF()
+}
+
+// headerAndDataBits encodes SOF..Data (without stuffing)
+func (frame *Frame) headerAndDataBits() Bits {
 	var bits Bits
 
 	// SOF (Start Of the Frame)
 	bits = append(bits, ProtocolDominantBit)
 
-	// Encode 11-bit CAN ID (MSB first)
-	for i := 10; i >= 0; i-- {
-		idBit := Bit((frame.Id>>i)&1 == 1)
-		bits = append(bits, idBit)
+	if frame.Extended {
+		// Base ID (11 most significant bits of the 29-bit ID), SRR and IDE (both recessive)
+		bits = bits.WithInt(int(frame.Id>>ProtocolExtendedIDSize), ProtocolIDSize).
+			WithBits(ProtocolRecessiveBit, ProtocolRecessiveBit)
+
+		// ID extension (18 least significant bits) and RTR
+		bits = bits.WithInt(int(frame.Id), ProtocolExtendedIDSize).
+			WithBits(Bit(frame.Remote))
+	} else {
+		// 11-bit ID, RTR and IDE (standard frame)
+		bits = bits.WithInt(int(frame.Id), ProtocolIDSize).
+			WithBits(Bit(frame.Remote), ProtocolDominantBit)
 	}
 
-	// Encode 4-bit DLC (Data Length Code)
-	for i := 3; i >= 0; i-- {
-		dlcBit := Bit((frame.DLC>>i)&1 == 1)
-		bits = append(bits, dlcBit)
+	switch {
+	case frame.FD:
+		// FDF, res, BRS and ESI
+		bits = bits.WithBits(ProtocolRecessiveBit, ProtocolDominantBit, Bit(frame.BitRateSwitch), Bit(frame.ErrorStateIndicator))
+	case frame.Extended:
+		// r1 and r0
+		bits = bits.WithBits(ProtocolDominantBit, ProtocolDominantBit)
+	default:
+		// r0
+		bits = bits.WithBits(ProtocolDominantBit)
 	}
 
-	// Encode each data byte (DLC * 8 bits)
-	for i := 0; i < int(frame.DLC); i++ {
-		b := frame.Data[i]
-		for j := 7; j >= 0; j-- {
-			dataBit := Bit((b>>j)&1 == 1)
-			bits = append(bits, dataBit)
-		}
+	// Encode 4-bit DLC (Data Length Code)
+	bits = bits.WithInt(int(frame.DLC), ProtocolDLCSize)
+
+	// Encode each data byte (8 bits each, no data in remote frames)
+	for i := 0; i < frame.DataLength(); i++ {
+		bits = bits.WithInt(int(frame.Data[i]), 8)
 	}
 
-	return bits.WithStuffing(ProtocolBitStuffingStep).WithEOF()
+	return bits
 }
 
-// FromBits decodes a CAN frame from a Bits slice
-func FromBits(bits Bits) (*Frame, error) {
-	if len(bits) < ProtocolIDSize+ProtocolDLCSize {
-		return nil, errors.New("bit slice too short to contain a valid CAN frame")
+// Duration returns the time the frame occupies the bus (SOF..EOF),
+// the data phase of FD frames with bit rate switch (after BRS up to the CRC delimiter) is transmitted with the data bit time
+func (frame *Frame) Duration() time.Duration {
+	from, to := frame.DataPhase()
+	return time.Duration(frame.ToBits().Len()-(to-from))*ProtocolNominalBitTime + time.Duration(to-from)*ProtocolDataBitTime
+}
+
+// DataPhase returns the range [from, to) of frame bits (stuffed, counting from SOF) transmitted with the data bit time:
+// in FD frames with bit rate switch it starts after BRS and ends before the CRC delimiter (the range is empty in other frames)
+func (frame *Frame) DataPhase() (from, to int) {
+	if !frame.FD || !frame.BitRateSwitch {
+		return 0, 0
 	}
 
-	// 1. Decode ID
-	var id uint32
-	for i := range ProtocolIDSize {
-		if bits[i] {
-			id |= 1 << (ProtocolIDSize - 1 - i)
-		}
+	brsIndex := FDFIndex(frame.Extended) + ProtocolFDFSize + ProtocolReservedSize
+	from = frame.headerAndDataBits()[:brsIndex+ProtocolBRSSize].WithDynamicStuffing().Len()
+	to = frame.ToBits().Len() - ProtocolCRCDelimiterSize - ProtocolACKSlotSize - ProtocolACKDelimiterSize - ProtocolEOFSize
+	return from, to
+}
+
+// ParseBitTime parses the bit time the bit on the bus is labeled with (bits without the label take the nominal bit time)
+func ParseBitTime(label string) (time.Duration, error) {
+	if label == "" {
+		return ProtocolNominalBitTime, nil
 	}
 
-	// 2. Decode DLC
-	var dlc uint8
-	for i := range ProtocolDLCSize {
-		if bits[ProtocolIDSize+i] {
-			dlc |= 1 << (ProtocolDLCSize - 1 - i)
-		}
+	bitTime, err := time.ParseDuration(label)
+	if err != nil || bitTime <= 0 {
+		return 0, fmt.Errorf("invalid bit time: %s", label)
 	}
+	return bitTime, nil
+}
 
-	// 3. Validate DLC
-	if dlc > ProtocolMaxDataBytes {
-		return nil, fmt.Errorf("invalid DLC: %d", dlc)
+// FromBits decodes a CAN frame from a Bits slice (unstuffed bits after SOF up to the CRC)
+func FromBits(bits Bits) (*Frame, error) {
+	frame, err := HeaderFromBits(bits)
+	if err != nil {
+		return nil, err
 	}
 
-	// 4. Decode Data
-	expectedBits := ProtocolIDSize + ProtocolDLCSize + int(dlc)*8
+	// Decode Data
+	headerSize := FrameHeaderSize(frame.Extended, frame.FD) - ProtocolSOFSize
+	expectedBits := headerSize + frame.DataLength()*8
 	if len(bits) < expectedBits {
 		return nil, fmt.Errorf("not enough bits for data, expected %d, got %d", expectedBits, len(bits))
 	}
 
-	var data [ProtocolMaxDataBytes]byte
-	offset := ProtocolIDSize + ProtocolDLCSize
-	for i := 0; i < int(dlc); i++ {
-		var b byte
-		for j := range 8 {
-			if bits[offset+i*8+j] {
-				b |= 1 << (7 - j)
-			}
-		}
-		data[i] = b
+	for i := 0; i < frame.DataLength(); i++ {
+		offset := headerSize + i*8
+		frame.Data[i] = byte(bits[offset : offset+8].ToInt())
+	}
+
+	if !frame.IsValid() {
+		return nil, errors.New("decoded frame is invalid")
+	}
+
+	return frame, nil
+}
+
+// HeaderFromBits decodes a CAN frame without data from a Bits slice (unstuffed bits after SOF up to DLC at least)
+func HeaderFromBits(bits Bits) (*Frame, error) {
+	ideIndex := ProtocolIDSize + ProtocolRTRSize
+	if len(bits) <= ideIndex {
+		return nil, errors.New("bit slice too short to contain a valid CAN frame")
+	}
+
+	// 1. Decode frame format (IDE and FDF)
+	extended := bits[ideIndex].IsRecessive()
+	fdfIndex := FDFIndex(extended) - ProtocolSOFSize
+	if len(bits) <= fdfIndex {
+		return nil, errors.New("bit slice too short to contain a valid CAN frame")
+	}
+
+	fd := bits[fdfIndex].IsRecessive()
+	headerSize := FrameHeaderSize(extended, fd) - ProtocolSOFSize
+	if len(bits) < headerSize {
+		return nil, errors.New("bit slice too short to contain a valid CAN frame")
+	}
+
+	// 2. Decode ID and frame type (RTR)
+	id := uint32(bits[:ProtocolIDSize].ToInt())
+	if extended {
+		extendedIDIndex := ideIndex + ProtocolIDESize
+		id = id<<ProtocolExtendedIDSize | uint32(bits[extendedIDIndex:extendedIDIndex+ProtocolExtendedIDSize].ToInt())
+	}
+	remote := bits[RTRIndex(extended)-ProtocolSOFSize].IsRecessive()
+
+	// 3. Decode DLC
+	dlc := uint8(bits[headerSize-ProtocolDLCSize : headerSize].ToInt())
+
+	// 4. Validate DLC
+	if !fd && dlc > ProtocolMaxDataBytes {
+		return nil, fmt.Errorf("invalid DLC: %d", dlc)
 	}
 
 	frame := &Frame{
-		Id:   id,
-		DLC:  dlc,
-		Data: data,
+		Id:       id,
+		Extended: extended,
+		Remote:   remote,
+		FD:       fd,
+		DLC:      dlc,
 	}
 
-	if !frame.IsValid() {
-		return nil, errors.New("decoded frame is invalid")
+	if fd {
+		brsIndex := fdfIndex + ProtocolFDFSize + ProtocolReservedSize
+		frame.BitRateSwitch = bits[brsIndex].IsRecessive()
+		frame.ErrorStateIndicator = bits[brsIndex+ProtocolBRSSize].IsRecessive()
 	}
 
 	return frame, nil
@@ -126,35 +291,51 @@ func FromBits(bits Bits) (*Frame, error) {
 func (frame *Frame) String() string {
 	frameBits := frame.ToBits()
 	frameBitsUnstuffed := frameBits.WithoutStuffing(ProtocolBitStuffingStep)
+	crcFieldSize := ProtocolCRCSize
+
+	if frame.FD {
+		// Only SOF..Data is dynamically stuffed, the CRC field is shown with the stuff count and fixed stuff bits
+		headerAndData := frame.headerAndDataBits()
+		frameBitsUnstuffed = headerAndData.WithBits(frameBits[headerAndData.WithDynamicStuffing().Len():]...)
+		crcFieldSize = FDCRCFieldSize(frame.DataLength())
+	}
 
 	ranges := struct {
-		sof  [2]byte
-		id   [2]byte
-		dlc  [2]byte
-		data [2]byte
-		eof  [2]byte
+		sof         [2]int
+		arbitration [2]int
+		control     [2]int
+		data        [2]int
+		crc         [2]int
+		ack         [2]int
+		eof         [2]int
 	}{
-		sof: [2]byte{0, ProtocolSOFSize},
+		sof: [2]int{0, ProtocolSOFSize},
 	}
 
-	ranges.id = [2]byte{ranges.sof[1], ranges.sof[1] + ProtocolIDSize}
-	ranges.dlc = [2]byte{ranges.id[1], ranges.id[1] + ProtocolDLCSize}
-	ranges.data = [2]byte{ranges.dlc[1], ranges.dlc[1] + frame.DLC*8}
-	ranges.eof = [2]byte{ranges.data[1], ranges.data[1] + ProtocolEOFSize}
+	ranges.arbitration = [2]int{ranges.sof[1], ranges.sof[1] + ArbitrationFieldSize(frame.Extended)}
+	ranges.control = [2]int{ranges.arbitration[1], FrameHeaderSize(frame.Extended, frame.FD)}
+	ranges.data = [2]int{ranges.control[1], ranges.control[1] + frame.DataLength()*8}
+	ranges.crc = [2]int{ranges.data[1], ranges.data[1] + crcFieldSize}
+	ranges.ack = [2]int{ranges.crc[1] + ProtocolCRCDelimiterSize, ranges.crc[1] + ProtocolCRCDelimiterSize + ProtocolACKSlotSize}
+	ranges.eof = [2]int{ranges.ack[1] + ProtocolACKDelimiterSize, ranges.ack[1] + ProtocolACKDelimiterSize + ProtocolEOFSize}
 
 	return fmt.Sprintf("\n \n %#v "+
 		"\n SOF: %s"+
-		"\n ID: %s"+
-		"\n DLC: %s"+
+		"\n Arbitration: %s"+
+		"\n Control: %s"+
 		"\n Data: %s"+
+		"\n CRC: %s"+
+		"\n ACK: %s"+
 		"\n EOF: %s"+
 		"\n unstuffed: %s"+
 		"\n raw: %s \n \n",
 		frame,
 		frameBitsUnstuffed[ranges.sof[0]:ranges.sof[1]],
-		frameBitsUnstuffed[ranges.id[0]:ranges.id[1]],
-		frameBitsUnstuffed[ranges.dlc[0]:ranges.dlc[1]],
+		frameBitsUnstuffed[ranges.arbitration[0]:ranges.arbitration[1]],
+		frameBitsUnstuffed[ranges.control[0]:ranges.control[1]],
 		frameBitsUnstuffed[ranges.data[0]:ranges.data[1]],
+		frameBitsUnstuffed[ranges.crc[0]:ranges.crc[1]],
+		frameBitsUnstuffed[ranges.ack[0]:ranges.ack[1]],
 		frameBitsUnstuffed[ranges.eof[0]:ranges.eof[1]],
 		frameBitsUnstuffed,
 		frameBits)
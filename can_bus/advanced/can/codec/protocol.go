@@ -1,17 +1,54 @@
 package codec
 
+import "time"
+
 const (
 	ProtocolDominantBit  = Bit(false)
 	ProtocolRecessiveBit = Bit(true)
 
 	ProtocolBitStuffingStep = 5
 
-	ProtocolMaxDataBytes = 8
-	ProtocolMaxID        = 0x7FF // 11-bit max
+	ProtocolMaxDataBytes   = 8
+	ProtocolMaxFDDataBytes = 64         // FD frames carry up to 64 bytes (DLC above 8 codes 12, 16, 20, 24, 32, 48 or 64 bytes)
+	ProtocolMaxID          = 0x7FF      // 11-bit max
+	ProtocolMaxExtendedID  = 0x1FFFFFFF // 29-bit max
 
 	ProtocolSOFSize = 1
 	ProtocolIDSize  = 11
 	ProtocolDLCSize = 4
+	ProtocolCRCSize = 15
 	ProtocolEOFSize = 7
 	ProtocolIFSSize = 3
+
+	ProtocolExtendedIDSize = 18 // Identifier extension (the lower bits of the 29-bit ID)
+	ProtocolRTRSize        = 1
+	ProtocolSRRSize        = 1 // Substitute remote request (recessive), takes the place of RTR in extended frames
+	ProtocolIDESize        = 1 // Identifier extension bit: dominant for standard frames, recessive for extended ones
+	ProtocolReservedSize   = 1 // Each of r0, r1 (dominant), res in FD frames
+
+	ProtocolFDFSize             = 1 // FD format bit: recessive in FD frames, takes the place of r0 (standard) or r1 (extended)
+	ProtocolBRSSize             = 1 // Bit rate switch: recessive when the data phase is transmitted with the data bit time
+	ProtocolESISize             = 1 // Error state indicator: recessive when the transmitter is error-passive
+	ProtocolStuffCountSize      = 4 // Number of dynamic stuff bits (modulo 8) in gray code and the parity bit
+	ProtocolFDFixedStuffingStep = 4 // Stuff count and CRC of FD frames have a fixed stuff bit before each 4 bits
+	ProtocolCRC17Size           = 17
+	ProtocolCRC21Size           = 21
+	ProtocolCRC17MaxDataBytes   = 16       // FD frames with more data bytes are protected by CRC-21
+	ProtocolCRC17Polynomial     = 0x1685B  // x^17 + x^16 + x^14 + x^13 + x^11 + x^6 + x^4 + x^3 + x + 1
+	ProtocolCRC21Polynomial     = 0x102899 // x^21 + x^20 + x^13 + x^11 + x^7 + x^4 + x^3 + 1
+
+	ProtocolCRCDelimiterSize = 1
+	ProtocolACKSlotSize      = 1
+	ProtocolACKDelimiterSize = 1
+
+	ProtocolCRCPolynomial = 0x4599 // x^15 + x^14 + x^10 + x^8 + x^7 + x^4 + x^3 + 1
+
+	ProtocolErrorFlagSize              = 6
+	ProtocolErrorDelimiterSize         = 8
+	ProtocolSuspendTransmissionSize    = 8   // Extra recessive bits an error-passive transmitter waits for after intermission
+	ProtocolBusOffRecoverySequenceSize = 11  // Recessive bits in one bus-off recovery sequence
+	ProtocolBusOffRecoverySequences    = 128 // Recovery sequences to observe before leaving bus-off
+
+	ProtocolNominalBitTime = 2 * time.Microsecond  // 500 kbit/s: arbitration phase and classic frames
+	ProtocolDataBitTime    = 500 * time.Nanosecond // 2 Mbit/s: data phase of FD frames with bit rate switch
 )
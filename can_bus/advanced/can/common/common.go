@@ -1,10 +1,22 @@
 package common
 
 const (
-	PortCANTx           = "can_tx"    // Transmit to CAN bus
-	PortCANRx           = "can_rx"    // Receive from CAN bus
-	PortCANH            = "can_h"     // CAN high
-	PortCANL            = "can_l"     // CAN low
-	PortSelfActivation  = "sa"        // Useful to create self-activated components
-	PortControllerState = "ctl_state" // Current state of CAN controller
+	PortCANTx           = "can_tx"         // Transmit to CAN bus
+	PortCANRx           = "can_rx"         // Receive from CAN bus
+	PortCANTxConfirm    = "can_tx_confirm" // Frame is transmitted successfully
+	PortCANTxAbort      = "can_tx_abort"   // Abort pending transmissions
+	PortCANTxStatus     = "can_tx_status"  // Transmission is complete or aborted
+	PortCANH            = "can_h"          // CAN high
+	PortCANL            = "can_l"          // CAN low
+	PortSelfActivation  = "sa"             // Useful to create self-activated components
+	PortControllerState = "ctl_state"      // Current state of CAN controller
+
+	LabelBusBit        = "bus_bit"        // Received frames are labeled with the number of bits seen on the bus so far
+	LabelBusTime       = "bus_time"       // Received frames are labeled with the bus time so far (the time of reception)
+	LabelBitTime       = "bit_time"       // Bits of the data phase of FD frames are labeled with the data bit time (other bits take the nominal one)
+	LabelBusStartBit   = "bus_start_bit"  // Listen-only controllers label received frames with the number of bits seen on the bus at SOF
+	LabelBusDrivers    = "bus_drivers"    // Comma separated units driving the dominant level (voltages and bits), or transmitting the received frame
+	LabelBusContenders = "bus_contenders" // Listen-only controllers label received frames with the units which started arbitration for it
+	LabelRxFilter      = "rx_filter"      // Index of the acceptance filter bank which accepted the received frame
+	LabelRxFIFO        = "rx_fifo"        // Receive FIFO of the acceptance filter bank which accepted the received frame
 )
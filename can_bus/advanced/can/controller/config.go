@@ -0,0 +1,30 @@
+package controller
+
+// Config defines the capabilities of the controller
+type Config struct {
+	// FD enables CAN FD (ISO 11898-1:2015): the controller transmits and receives both classic and FD frames.
+	// Classic controllers flag FD frames with a form error
+	FD bool
+
+	// ListenOnly makes the controller a passive bus monitor: it never drives the bus (no ACK, no error flags),
+	// does not transmit and does not report its state to the bus watchdog (it is not a participant).
+	// Received frames are labeled with SOF time, the transmitter and the contenders of arbitration
+	ListenOnly bool
+
+	// Filters are the acceptance filter banks (the first matching bank accepts the frame),
+	// without banks all frames are passed to MCU. Accepted frames are labeled with the bank index and its FIFO
+	Filters []FilterBank
+
+	// TxMailboxes is the number of frames pending transmission at the same time (zero is unlimited),
+	// frames coming from MCU when all mailboxes are busy are aborted
+	TxMailboxes int
+
+	// TxFIFO makes pending frames go into arbitration in the order they came from MCU,
+	// otherwise the frame with the highest priority (the lowest ID) goes first, like the bus itself would decide
+	TxFIFO bool
+}
+
+var defaultConfig = &Config{
+	FD:         false,
+	ListenOnly: false,
+}
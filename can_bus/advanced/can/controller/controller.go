@@ -3,6 +3,9 @@ package controller
 import (
 	"errors"
 	"fmt"
+	"slices"
+	"strconv"
+	"time"
 
 	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/codec"
 	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/common"
@@ -12,64 +15,133 @@ import (
 )
 
 const (
-	stateKeyTxQueue                          = "tx_queue"
-	stateKeyRxBuffer                         = "rx_buffer"
-	stateKeyControllerState                  = "controller_state"
-	stateKeyConsecutiveRecessiveBitsObserved = "consecutive_recessive_observed"
-	stateKeyBitsExpected                     = "bits_expected"
+	stateKeyTxQueue                            = "tx_queue"
+	stateKeyRxBuffer                           = "rx_buffer"
+	stateKeyControllerState                    = "controller_state"
+	stateKeyConsecutiveRecessiveBitsObserved   = "consecutive_recessive_observed"
+	stateKeyBitsExpected                       = "bits_expected"
+	stateKeyStuffedBitsReceived                = "stuffed_bits_received"
+	stateKeyRxStage                            = "rx_stage"
+	stateKeyConfig                             = "config"
+	stateKeyTEC                                = "tec"
+	stateKeyREC                                = "rec"
+	stateKeyFaultState                         = "fault_state"
+	stateKeyErrorFlagBitsObserved              = "error_flag_bits_observed"
+	stateKeyErrorDelimiterBitsObserved         = "error_delimiter_bits_observed"
+	stateKeyErrorDelimiterDominantBitsObserved = "error_delimiter_dominant_bits_observed"
+	stateKeyTransmitterError                   = "transmitter_error"
+	stateKeyBusOffRecoverySequences            = "bus_off_recovery_sequences"
+	stateKeyBitsObserved                       = "bits_observed"
+	stateKeyBusTime                            = "bus_time"
+	stateKeyRxStartBit                         = "rx_start_bit"
+	stateKeyRxTransmitter                      = "rx_transmitter"
+	stateKeyRxContenders                       = "rx_contenders"
+
+	// SOF, base ID, RTR (SRR in extended frames) and IDE: enough to know the frame format
+	frameFormatBits = codec.ProtocolSOFSize + codec.ProtocolIDSize + codec.ProtocolRTRSize + codec.ProtocolIDESize
+)
+
+// rxStage is the part of the frame the receiver is waiting for (the stage is over when the expected bits are received)
+type rxStage byte
 
-	frameFixedPartBits = codec.ProtocolSOFSize + codec.ProtocolIDSize + codec.ProtocolDLCSize
+const (
+	rxStageFormat    rxStage = iota // SOF, base ID, RTR (or SRR) and IDE
+	rxStageFDF                      // The rest of the arbitration field and FDF
+	rxStageHeader                   // The rest of the control field (up to DLC)
+	rxStageData                     // Data field (FD frames only, the dynamic stuffing is over after it)
+	rxStageCRC                      // CRC field and CRC delimiter
+	rxStageACKAndEOF                // ACK slot, ACK delimiter and EOF
 )
 
 var (
 	errNoBitOnBus = errors.New("no bit set on bus")
 )
 
-// New creates a stateful CAN controller
+// New creates a stateful classic CAN controller
 // which converts frames to bits and vice versa
 func New(unitName string) *component.Component {
+	return NewWithConfig(unitName, defaultConfig)
+}
+
+// NewWithConfig creates a stateful CAN controller with the given config
+func NewWithConfig(unitName string, config *Config) *component.Component {
 	return component.New("can_controller-"+unitName).
-		AddInputs(common.PortCANTx, common.PortCANRx).                              // Frame in, bits in
-		AddOutputs(common.PortCANTx, common.PortCANRx, common.PortControllerState). // Bits out, frame out, notify when bus is idle
+		AddInputs(common.PortCANTx, common.PortCANRx, common.PortCANTxAbort).                                                        // Frame in, bits in, abort requests
+		AddOutputs(common.PortCANTx, common.PortCANRx, common.PortCANTxConfirm, common.PortCANTxStatus, common.PortControllerState). // Bits out, frame out, transmit confirmation, transmit status, notify when bus is idle
 		WithInitialState(func(state component.State) {
 			state.Set(stateKeyTxQueue, TxQueue{})
 			state.Set(stateKeyRxBuffer, codec.NewBits(0))
 			state.Set(stateKeyControllerState, StateIdle)
 			state.Set(stateKeyConsecutiveRecessiveBitsObserved, 0)
 			state.Set(stateKeyBitsExpected, 0)
+			state.Set(stateKeyStuffedBitsReceived, 0)
+			state.Set(stateKeyRxStage, rxStageFormat)
+			state.Set(stateKeyConfig, config)
+			state.Set(stateKeyTEC, 0)
+			state.Set(stateKeyREC, 0)
+			state.Set(stateKeyFaultState, FaultStateErrorActive)
+			state.Set(stateKeyErrorFlagBitsObserved, codec.NewBits(0))
+			state.Set(stateKeyErrorDelimiterBitsObserved, 0)
+			state.Set(stateKeyErrorDelimiterDominantBitsObserved, 0)
+			state.Set(stateKeyTransmitterError, false)
+			state.Set(stateKeyBusOffRecoverySequences, 0)
+			state.Set(stateKeyBitsObserved, 0)
+			state.Set(stateKeyBusTime, time.Duration(0))
+			state.Set(stateKeyRxStartBit, 0)
+			state.Set(stateKeyRxTransmitter, "")
+			state.Set(stateKeyRxContenders, "")
 		}).
-		WithActivationFunc(func(this *component.Component) error {
-			defer func() {
-				// Report current state to bus watchdog
-				ctlState := this.State().Get(stateKeyControllerState).(State)
-				this.OutputByName(common.PortControllerState).PutSignals(signal.New(StateMap{
-					this.Name(): ctlState,
-				}))
-			}()
-
-			refreshLoggerPrefix(this)
-
-			err := handleIncomingFrames(this)
-			if err != nil {
-				return fmt.Errorf("failed to handle incoming frames: %w", err)
-			}
+		WithActivationFunc(activate)
+}
 
-			// Get current bit set on the bus
-			currentBit, err := getCurrentBit(this)
-			if err != nil && errors.Is(err, errNoBitOnBus) {
-				return nil
-			}
-			if err != nil {
-				return fmt.Errorf("failed to determine current bit on the bus: %w", err)
-			}
+// activate handles frames from MCU and the bit set on the bus
+func activate(this *component.Component) error {
+	defer func() {
+		// Listen-only controller is not a participant, the bus may stop regardless of it
+		if this.State().Get(stateKeyConfig).(*Config).ListenOnly {
+			return
+		}
 
-			// Run the main state machine:
-			return runStateMachine(this, currentBit)
-		})
+		// Report current state to bus watchdog
+		ctlState := this.State().Get(stateKeyControllerState).(State)
+		this.OutputByName(common.PortControllerState).PutSignals(signal.New(StateMap{
+			this.Name(): ctlState,
+		}))
+	}()
+
+	refreshLoggerPrefix(this)
+
+	err := handleIncomingFrames(this)
+	if err != nil {
+		return fmt.Errorf("failed to handle incoming frames: %w", err)
+	}
+	wakeUpOnPendingFrames(this)
+
+	// Get current bit set on the bus
+	currentBit, err := getCurrentBit(this)
+	if err != nil && errors.Is(err, errNoBitOnBus) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to determine current bit on the bus: %w", err)
+	}
+
+	err = advanceBusTime(this)
+	if err != nil {
+		return fmt.Errorf("failed to advance bus time: %w", err)
+	}
+
+	// Run the main state machine:
+	return runStateMachine(this, currentBit)
 }
 
-// Enqueue new frames coming from MCU
+// Enqueue new frames coming from MCU (abort requests are handled first, as they are for the frames handed over earlier)
 func handleIncomingFrames(this *component.Component) error {
+	err := handleAbortRequests(this)
+	if err != nil {
+		return err
+	}
+
 	txQueue := this.State().Get(stateKeyTxQueue).(TxQueue)
 	defer func() {
 		this.State().Set(stateKeyTxQueue, txQueue)
@@ -81,17 +153,126 @@ func handleIncomingFrames(this *component.Component) error {
 			return errors.New("received corrupted frame")
 		}
 
-		frameBits := frame.ToBits()
+		config := this.State().Get(stateKeyConfig).(*Config)
+		if config.ListenOnly {
+			return errors.New("listen-only controller can not transmit")
+		}
 
-		txQueue = append(txQueue, &TxQueueItem{
-			// Add IFS and 1 extra recessive bit
-			Buf: codec.NewBitBuffer(frameBits.WithIFS().WithBits(codec.ProtocolRecessiveBit)),
-		})
+		if frame.FD && !config.FD {
+			return errors.New("classic controller can not transmit FD frame")
+		}
+
+		if config.TxMailboxes > 0 && len(txQueue) >= config.TxMailboxes {
+			notifyTxStatus(this, frame, TxResultAborted, "no free mailbox")
+			return nil
+		}
+
+		// ESI is set by the controller, so the frame from MCU is not modified
+		txFrame := *frame
+		txQueue = append(txQueue, newTxQueueItem(&txFrame))
 		this.Logger().Printf("got a frame from MCU to send: %s items in tx-queue: %d", frame, len(txQueue))
 		return nil
 	}).ChainableErr()
 }
 
+// handleAbortRequests drops the pending frames, the frame being arbitrated or transmitted is dropped
+// only when it loses arbitration or fails (the transmission can not be interrupted, so it may still complete)
+func handleAbortRequests(this *component.Component) error {
+	txQueue := this.State().Get(stateKeyTxQueue).(TxQueue)
+	ctlState := this.State().Get(stateKeyControllerState).(State)
+
+	err := this.InputByName(common.PortCANTxAbort).Signals().ForEach(func(sig *signal.Signal) error {
+		req, ok := sig.PayloadOrNil().(*TxAbortRequest)
+		if !ok {
+			return errors.New("received corrupted abort request")
+		}
+
+		onBus := ctlState == StateArbitration || ctlState == StateTransmit
+		var head *TxQueueItem
+		if len(txQueue) > 0 {
+			head = txQueue[0]
+		}
+
+		txQueue = slices.DeleteFunc(txQueue, func(item *TxQueueItem) bool {
+			if !req.matches(item) {
+				return false
+			}
+
+			if item == head && onBus {
+				this.Logger().Printf("abort of 0x%03X is pending: the frame is on the bus", item.Frame.Id)
+				item.AbortRequested = true
+				return false
+			}
+
+			notifyTxStatus(this, item.Frame, TxResultAborted, "aborted by MCU")
+			return true
+		})
+		return nil
+	}).ChainableErr()
+
+	this.State().Set(stateKeyTxQueue, txQueue)
+	return err
+}
+
+// completePendingAbort drops the frame which was aborted while being on the bus (after it lost arbitration or failed)
+func completePendingAbort(this *component.Component) {
+	txQueue := this.State().Get(stateKeyTxQueue).(TxQueue)
+	if len(txQueue) == 0 || !txQueue[0].AbortRequested {
+		return
+	}
+
+	notifyTxStatus(this, txQueue[0].Frame, TxResultAborted, "aborted by MCU")
+	this.State().Set(stateKeyTxQueue, txQueue[1:])
+}
+
+// selectFrameForArbitration moves the pending frame with the highest priority to the head of the queue
+// (in FIFO mode the oldest frame goes first, so the order is kept)
+func selectFrameForArbitration(this *component.Component) {
+	txQueue := this.State().Get(stateKeyTxQueue).(TxQueue)
+	if this.State().Get(stateKeyConfig).(*Config).TxFIFO || len(txQueue) < 2 {
+		return
+	}
+
+	selected := 0
+	for i, item := range txQueue {
+		if item.hasPriorityOver(txQueue[selected]) {
+			selected = i
+		}
+	}
+	if selected == 0 {
+		return
+	}
+
+	this.Logger().Printf("0x%03X goes into arbitration before 0x%03X", txQueue[selected].Frame.Id, txQueue[0].Frame.Id)
+	item := txQueue[selected]
+	txQueue = slices.Delete(txQueue, selected, selected+1)
+	this.State().Set(stateKeyTxQueue, slices.Insert(txQueue, 0, item))
+}
+
+// notifyTxStatus lets MCU know the transmission is over
+func notifyTxStatus(this *component.Component, frame *codec.Frame, result TxResult, reason string) {
+	status := &TxStatus{
+		Frame:  frame,
+		Result: result,
+		Reason: reason,
+	}
+	this.Logger().Println("transmission status:", status)
+	this.OutputByName(common.PortCANTxStatus).PutSignals(signal.New(status))
+}
+
+// wakeUpOnPendingFrames makes the idle controller wait for the bus as soon as it has frames to send,
+// so the watchdog keeps the bus running even if the frame comes when there are no bits on the bus
+func wakeUpOnPendingFrames(this *component.Component) {
+	txQueue := this.State().Get(stateKeyTxQueue).(TxQueue)
+	if this.State().Get(stateKeyControllerState).(State) != StateIdle || len(txQueue) == 0 {
+		return
+	}
+
+	this.Logger().Print("state transition:", StateIdle.To(StateWaitForBusIdle))
+	this.State().Set(stateKeyControllerState, StateWaitForBusIdle)
+	refreshLoggerPrefix(this)
+}
+
 func getCurrentBit(this *component.Component) (codec.Bit, error) {
 	if !this.InputByName(common.PortCANRx).HasSignals() {
 		return codec.ProtocolRecessiveBit, errNoBitOnBus
@@ -104,6 +285,18 @@ func getCurrentBit(this *component.Component) (codec.Bit, error) {
 	return currentBit, nil
 }
 
+// advanceBusTime counts the bit seen on the bus, bits of the data phase of FD frames take the data bit time
+func advanceBusTime(this *component.Component) error {
+	bitTime, err := codec.ParseBitTime(this.InputByName(common.PortCANRx).Signals().First().Labels().ValueOrDefault(common.LabelBitTime, ""))
+	if err != nil {
+		return err
+	}
+
+	this.State().Set(stateKeyBitsObserved, this.State().Get(stateKeyBitsObserved).(int)+1)
+	this.State().Set(stateKeyBusTime, this.State().Get(stateKeyBusTime).(time.Duration)+bitTime)
+	return nil
+}
+
 func runStateMachine(this *component.Component, currentBit codec.Bit) error {
 	currentState := this.State().Get(stateKeyControllerState).(State)
 	previousState := currentState // Track previous state for first iteration
@@ -142,9 +335,15 @@ func getNextState(this *component.Component, previousState, currentState State,
 		return handleArbitrationState(this, previousState, currentBit)
 
 	case StateTransmit:
-		return handleTransmitState(this, previousState)
+		return handleTransmitState(this, previousState, currentBit)
 	case StateReceive:
 		return handleReceiveState(this, previousState, currentBit)
+	case StateErrorFlag:
+		return handleErrorFlagState(this, previousState, currentBit)
+	case StateErrorDelimiter:
+		return handleErrorDelimiterState(this, previousState, currentBit)
+	case StateBusOff:
+		return handleBusOffState(this, previousState, currentBit)
 	default:
 		return currentState, fmt.Errorf("end up in incorrect state: %v", currentState)
 	}
@@ -167,6 +366,11 @@ func handleIdleState(this *component.Component, previousState State, currentBit
 }
 
 func handleWaitForBusIdleState(this *component.Component, previousState State, currentBit codec.Bit) (State, error) {
+	// All pending frames are aborted, nothing to wait for
+	if len(this.State().Get(stateKeyTxQueue).(TxQueue)) == 0 {
+		return StateIdle, nil
+	}
+
 	// Check if some other node started transmitting
 	// SOF detected, became passive listener
 	if currentBit.IsDominant() {
@@ -178,7 +382,13 @@ func handleWaitForBusIdleState(this *component.Component, previousState State, c
 	consecutiveRecessiveBitsObserved++
 	this.State().Set(stateKeyConsecutiveRecessiveBitsObserved, consecutiveRecessiveBitsObserved)
 
-	if consecutiveRecessiveBitsObserved > codec.ProtocolEOFSize+codec.ProtocolIFSSize {
+	recessiveBitsRequired := codec.ProtocolEOFSize + codec.ProtocolIFSSize
+	if this.State().Get(stateKeyFaultState).(FaultState) == FaultStateErrorPassive {
+		// Error-passive controller lets error-active ones transmit first
+		recessiveBitsRequired += codec.ProtocolSuspendTransmissionSize
+	}
+
+	if consecutiveRecessiveBitsObserved > recessiveBitsRequired {
 		this.Logger().Println("i've seen ", consecutiveRecessiveBitsObserved, " recessives")
 		// The bus looks idle. It's time to start transmitting
 		return StateArbitration, nil
@@ -208,10 +418,10 @@ func handleArbitrationState(this *component.Component, previousState State, curr
 
 	// Check if arbitration is won
 	rxUnstuffed := rxBuf.WithoutStuffing(codec.ProtocolBitStuffingStep)
-	if rxUnstuffed.Len() == codec.ProtocolIDSize+1 {
-		idReceived := rxUnstuffed[1:]
-		idTransmitted := txItem.Buf.Bits.WithoutStuffing(codec.ProtocolBitStuffingStep)[1 : codec.ProtocolIDSize+1]
-		wonArbitration := idReceived.Equals(idTransmitted)
+	if rxUnstuffed.Len() == txItem.ArbitrationFieldSize+1 {
+		arbitrationFieldReceived := rxUnstuffed[1:]
+		arbitrationFieldTransmitted := txItem.Buf.Bits.WithoutStuffing(codec.ProtocolBitStuffingStep)[1 : txItem.ArbitrationFieldSize+1]
+		wonArbitration := arbitrationFieldReceived.Equals(arbitrationFieldTransmitted)
 		if wonArbitration {
 			this.Logger().Println("won arbitration")
 			return StateTransmit, nil
@@ -236,7 +446,7 @@ func handleArbitrationState(this *component.Component, previousState State, curr
 
 			// Or bus error happened
 			if currentBit.IsRecessive() && txItem.Buf.PreviousBit().IsDominant() {
-				return StateArbitration, errors.New("bus error, recessive bit won arbitration. backoff")
+				return raiseError(this, ErrorTypeBit, true, "recessive bit won arbitration")
 			}
 
 			txItem.Buf.ResetOffset()                  // Backoff, retry later
@@ -245,9 +455,7 @@ func handleArbitrationState(this *component.Component, previousState State, curr
 		}
 	}
 
-	txBit := txItem.Buf.NextBit()
-
-	this.OutputByName(common.PortCANTx).PutSignals(signal.New(txBit))
+	this.OutputByName(common.PortCANTx).PutSignals(txItem.nextBitSignal())
 	txItem.Buf.IncreaseOffset()
 
 	return StateArbitration, nil
@@ -256,14 +464,21 @@ func handleArbitrationState(this *component.Component, previousState State, curr
 func handleReceiveState(this *component.Component, previousState State, currentBit codec.Bit) (State, error) {
 	rxBuf := this.State().Get(stateKeyRxBuffer).(codec.Bits)
 	bitsExpected := this.State().Get(stateKeyBitsExpected).(int)
+	stuffedBitsReceived := this.State().Get(stateKeyStuffedBitsReceived).(int)
+	stage := this.State().Get(stateKeyRxStage).(rxStage)
+	defer func() {
+		this.State().Set(stateKeyBitsExpected, bitsExpected)
+		this.State().Set(stateKeyStuffedBitsReceived, stuffedBitsReceived)
+		this.State().Set(stateKeyRxStage, stage)
+	}()
 
-	rxUnstuffed := rxBuf.WithoutStuffing(codec.ProtocolBitStuffingStep)
+	rxUnstuffed := unstuffRxBuffer(rxBuf, stuffedBitsReceived)
 	bitsReceived := rxUnstuffed.Len()
 
 	if bitsExpected == 0 {
-		// Nothing is received, let's expect the first 16 fixed bits
-		bitsExpected = frameFixedPartBits
-		this.State().Set(stateKeyBitsExpected, bitsExpected)
+		// Nothing is received, let's expect the bits telling the frame format
+		bitsExpected = frameFormatBits
+		stage = rxStageFormat
 
 		if bitsReceived == 0 {
 			this.Logger().Println("receiving the very first bit, must be SOF: ", currentBit)
@@ -281,41 +496,114 @@ func handleReceiveState(this *component.Component, previousState State, currentB
 		rxBuf = rxBuf.WithBits(currentBit)
 	}
 
-	rxUnstuffed = rxBuf.WithoutStuffing(codec.ProtocolBitStuffingStep)
+	if this.State().Get(stateKeyConfig).(*Config).ListenOnly {
+		trackBusDrivers(this, currentBit, bitsReceived == 0, stage)
+	}
+
+	// Dynamically stuffed part of the frame can not contain more consecutive bits of the same level than the stuffing step
+	if stuffedBitsReceived == 0 && rxBuf.Len() > codec.ProtocolBitStuffingStep &&
+		rxBuf[rxBuf.Len()-codec.ProtocolBitStuffingStep-1:].AllBitsAre(currentBit) {
+		return raiseError(this, ErrorTypeStuff, false, fmt.Sprintf("%d consecutive bits of the same level received", codec.ProtocolBitStuffingStep+1))
+	}
+
+	rxUnstuffed = unstuffRxBuffer(rxBuf, stuffedBitsReceived)
 	bitsReceived = rxUnstuffed.Len()
 
-	// All CAN frames begin with 3 fixed-size fields: SOF (1), ID(11) and DLC
-	// when we have received enough bits - we decode ID and DLC
-	// knowing DLC allows us to know exactly how many data bits we expect
-	if bitsReceived >= frameFixedPartBits && bitsReceived == bitsExpected {
+	// Bits after the CRC delimiter have a fixed form, only the ACK slot can be dominant
+	if stage == rxStageACKAndEOF && currentBit.IsDominant() {
+		ackSlotBitsReceived := bitsExpected - codec.ProtocolEOFSize - codec.ProtocolACKDelimiterSize
+		if bitsReceived != ackSlotBitsReceived {
+			return raiseError(this, ErrorTypeForm, false, "dominant bit in ACK delimiter or EOF")
+		}
+	}
 
-		// Decode ID and DLC
-		if bitsExpected == frameFixedPartBits {
-			idBits := rxUnstuffed[codec.ProtocolSOFSize : codec.ProtocolSOFSize+codec.ProtocolIDSize]
-			dlcBits := rxUnstuffed[codec.ProtocolSOFSize+codec.ProtocolIDSize:]
-			expectedBytes := dlcBits.ToInt()
-			this.Logger().Println("id: ", idBits, " dlc:", dlcBits, " dlc (bytes):", expectedBytes)
+	// All CAN frames begin with SOF, the base ID, RTR (or SRR) and IDE,
+	// IDE tells whether the frame is standard or extended, so we know where FDF is,
+	// FDF tells whether the frame is classic or FD, so we know where the header (ending with DLC) ends,
+	// knowing DLC allows us to know exactly how many data bits we expect.
+	// More than one stage may complete at once, when the bits are already received during arbitration
+	for bitsReceived >= bitsExpected {
+		extended := rxUnstuffed[frameFormatBits-codec.ProtocolIDESize].IsRecessive()
+
+		switch stage {
+		case rxStageFormat:
+			bitsExpected = codec.FDFIndex(extended) + codec.ProtocolFDFSize
+			stage = rxStageFDF
+		case rxStageFDF:
+			fd := rxUnstuffed[codec.FDFIndex(extended)].IsRecessive()
+			if fd && !this.State().Get(stateKeyConfig).(*Config).FD {
+				return raiseError(this, ErrorTypeForm, false, "FD frame received by classic controller")
+			}
 
-			// We know the DLC, let's expect the all bits
-			this.State().Set(stateKeyBitsExpected, frameFixedPartBits+expectedBytes*8+codec.ProtocolEOFSize)
-		} else {
-			// Decode data
-			this.Logger().Println("received all expected data and EOF")
-			// Check for valid EOF
-			firstEOFBitIndex := rxUnstuffed.Len() - codec.ProtocolEOFSize
-			if !rxUnstuffed[firstEOFBitIndex:].AllBitsAre(codec.ProtocolRecessiveBit) {
-				return StateReceive, errors.New("received all expected bits, but do not see correct EOF")
+			bitsExpected = codec.FrameHeaderSize(extended, fd)
+			stage = rxStageHeader
+		case rxStageHeader:
+			// Decode arbitration and control fields
+			header, err := codec.HeaderFromBits(rxUnstuffed[codec.ProtocolSOFSize:bitsExpected])
+			if err != nil {
+				return raiseError(this, ErrorTypeForm, false, err.Error())
+			}
+			this.Logger().Printf("id: 0x%03X extended: %t remote: %t fd: %t brs: %t esi: %t dlc: %d data (bytes): %d",
+				header.Id, header.Extended, header.Remote, header.FD, header.BitRateSwitch, header.ErrorStateIndicator, header.DLC, header.DataLength())
+
+			bitsExpected += header.DataLength() * 8
+			if header.FD {
+				// We know the data length, the dynamically stuffed part ends with the data
+				stage = rxStageData
+				break
+			}
+
+			// We know the DLC, let's expect data (none in remote frames), CRC and CRC delimiter
+			bitsExpected += codec.ProtocolCRCSize + codec.ProtocolCRCDelimiterSize
+			stage = rxStageCRC
+		case rxStageData:
+			// Stuff count and CRC of FD frames have fixed stuff bits, so they are received as is
+			header, err := codec.HeaderFromBits(rxUnstuffed[codec.ProtocolSOFSize:])
+			if err != nil {
+				return raiseError(this, ErrorTypeForm, false, err.Error())
+			}
+			stuffedBitsReceived = rxBuf.Len()
+			bitsExpected += codec.FDCRCFieldSize(header.DataLength()) + codec.ProtocolCRCDelimiterSize
+			stage = rxStageCRC
+		case rxStageCRC:
+			crcDelimiterIndex := bitsExpected - codec.ProtocolCRCDelimiterSize
+
+			// Check for valid CRC delimiter
+			if !rxUnstuffed[crcDelimiterIndex:].AllBitsAre(codec.ProtocolRecessiveBit) {
+				return raiseError(this, ErrorTypeForm, false, "dominant CRC delimiter")
+			}
+
+			nextState, err := verifyCRC(this, rxBuf, rxUnstuffed, stuffedBitsReceived, crcDelimiterIndex)
+			if err != nil || nextState != StateReceive {
+				return nextState, err
+			}
+
+			// The frame is received correctly, acknowledge it (the transmitter sends the ACK slot recessive)
+			if !this.State().Get(stateKeyConfig).(*Config).ListenOnly {
+				this.Logger().Println("received correct CRC, drive dominant ACK")
+				this.OutputByName(common.PortCANTx).PutSignals(signal.New(codec.ProtocolDominantBit))
+			}
+
+			// Bits after the CRC delimiter are not stuffed (in FD frames the dynamic stuffing is over already)
+			if stuffedBitsReceived == 0 {
+				stuffedBitsReceived = rxBuf.Len() - codec.ProtocolCRCDelimiterSize
 			}
+			bitsExpected += codec.ProtocolACKSlotSize + codec.ProtocolACKDelimiterSize + codec.ProtocolEOFSize
+			stage = rxStageACKAndEOF
+		case rxStageACKAndEOF:
+			// ACK delimiter and EOF are already checked bit by bit
+			this.Logger().Println("received all expected data, CRC, ACK and EOF")
 
 			// Assemble CAN frame
-			rxFrame, err := codec.FromBits(rxUnstuffed[1:firstEOFBitIndex])
+			rxFrame, err := codec.FromBits(rxUnstuffed[codec.ProtocolSOFSize:])
 			if err != nil {
-				return StateReceive, fmt.Errorf("failed to assemble frame: %w", err)
+				return raiseError(this, ErrorTypeForm, false, fmt.Sprintf("failed to assemble frame: %s", err))
 			}
 
-			this.Logger().Println("received frame:", rxFrame)
+			this.Logger().Println("received frame:", rxFrame, "duration:", rxFrame.Duration())
+			handleReceiveSuccess(this)
 
-			this.OutputByName(common.PortCANRx).PutSignals(signal.New(rxFrame))
+			deliverFrame(this, rxFrame)
 			return StateIdle, nil
 		}
 	}
@@ -323,7 +611,113 @@ func handleReceiveState(this *component.Component, previousState State, currentB
 	return StateReceive, nil
 }
 
-func handleTransmitState(this *component.Component, previousState State) (State, error) {
+// deliverFrame passes the received frame to MCU, unless it is rejected by acceptance filters
+func deliverFrame(this *component.Component, rxFrame *codec.Frame) {
+	config := this.State().Get(stateKeyConfig).(*Config)
+	filterIndex, accepted := acceptanceFilterIndex(config, rxFrame)
+	if !accepted {
+		this.Logger().Printf("frame 0x%03X is rejected by acceptance filters", rxFrame.Id)
+		return
+	}
+
+	rxSignal := newRxSignal(this, rxFrame)
+	if filterIndex >= 0 {
+		rxSignal.
+			AddLabel(common.LabelRxFilter, strconv.Itoa(filterIndex)).
+			AddLabel(common.LabelRxFIFO, strconv.Itoa(config.Filters[filterIndex].FIFO))
+	}
+	this.OutputByName(common.PortCANRx).PutSignals(rxSignal)
+}
+
+// newRxSignal labels the received frame with the time of reception (and the bus monitoring details in listen-only mode)
+func newRxSignal(this *component.Component, rxFrame *codec.Frame) *signal.Signal {
+	rxSignal := signal.New(rxFrame).
+		AddLabel(common.LabelBusBit, strconv.Itoa(this.State().Get(stateKeyBitsObserved).(int))).
+		AddLabel(common.LabelBusTime, this.State().Get(stateKeyBusTime).(time.Duration).String())
+	if !this.State().Get(stateKeyConfig).(*Config).ListenOnly {
+		return rxSignal
+	}
+
+	return rxSignal.
+		AddLabel(common.LabelBusStartBit, strconv.Itoa(this.State().Get(stateKeyRxStartBit).(int))).
+		AddLabel(common.LabelBusDrivers, this.State().Get(stateKeyRxTransmitter).(string)).
+		AddLabel(common.LabelBusContenders, this.State().Get(stateKeyRxContenders).(string))
+}
+
+// trackBusDrivers remembers who drives the frame being received:
+// all contenders write dominant SOF at once, after arbitration only the winner writes dominant bits until the ACK slot
+// (stuffing guarantees that the winner writes at least one dominant bit in each 6 bits)
+func trackBusDrivers(this *component.Component, currentBit codec.Bit, isSOF bool, stage rxStage) {
+	if isSOF {
+		this.State().Set(stateKeyRxStartBit, this.State().Get(stateKeyBitsObserved).(int))
+	}
+
+	if currentBit.IsRecessive() || stage == rxStageACKAndEOF {
+		return
+	}
+
+	drivers := ""
+	this.InputByName(common.PortCANRx).Signals().ForEach(func(sig *signal.Signal) error {
+		drivers = sig.Labels().ValueOrDefault(common.LabelBusDrivers, "")
+		return nil
+	})
+
+	if isSOF {
+		this.State().Set(stateKeyRxContenders, drivers)
+	}
+	this.State().Set(stateKeyRxTransmitter, drivers)
+}
+
+// verifyCRC checks the CRC field of the received frame (and the stuff count of FD frames)
+func verifyCRC(this *component.Component, rxBuf, rxUnstuffed codec.Bits, stuffedBitsReceived, crcDelimiterIndex int) (State, error) {
+	header, err := codec.HeaderFromBits(rxUnstuffed[codec.ProtocolSOFSize:])
+	if err != nil {
+		return raiseError(this, ErrorTypeForm, false, err.Error())
+	}
+
+	firstCRCBitIndex := codec.FrameHeaderSize(header.Extended, header.FD) + header.DataLength()*8
+
+	if !header.FD {
+		// Verify CRC (calculated over SOF..Data)
+		crcReceived := rxUnstuffed[firstCRCBitIndex:crcDelimiterIndex].ToInt()
+		crcCalculated := int(codec.CRC15(rxUnstuffed[:firstCRCBitIndex]))
+		if crcReceived != crcCalculated {
+			// For simplicity, the error flag is not delayed until the end of the ACK delimiter
+			return raiseError(this, ErrorTypeCRC, false, fmt.Sprintf("received 0x%04X, calculated 0x%04X", crcReceived, crcCalculated))
+		}
+		return StateReceive, nil
+	}
+
+	crcField, err := rxUnstuffed[firstCRCBitIndex:crcDelimiterIndex].WithoutFixedStuffing(rxBuf[stuffedBitsReceived-1], codec.ProtocolFDFixedStuffingStep)
+	if err != nil {
+		return raiseError(this, ErrorTypeStuff, false, err.Error())
+	}
+
+	// Verify stuff count (the number of dynamic stuff bits)
+	stuffCountReceived := crcField[:codec.ProtocolStuffCountSize]
+	stuffCountCalculated := codec.StuffCountBits(stuffedBitsReceived - firstCRCBitIndex)
+	if !stuffCountReceived.Equals(stuffCountCalculated) {
+		return raiseError(this, ErrorTypeCRC, false, fmt.Sprintf("received stuff count %s, calculated %s", stuffCountReceived, stuffCountCalculated))
+	}
+
+	// Verify CRC (calculated over stuffed SOF..Data and the stuff count)
+	crcReceived := crcField[codec.ProtocolStuffCountSize:].ToInt()
+	crcCalculated := int(codec.FDCRC(rxBuf[:stuffedBitsReceived], stuffCountReceived, header.DataLength()))
+	if crcReceived != crcCalculated {
+		return raiseError(this, ErrorTypeCRC, false, fmt.Sprintf("received 0x%06X, calculated 0x%06X", crcReceived, crcCalculated))
+	}
+	return StateReceive, nil
+}
+
+// unstuffRxBuffer removes stuff bits from the received bits, bits after the CRC field are never stuffed
+func unstuffRxBuffer(rxBuf codec.Bits, stuffedBitsReceived int) codec.Bits {
+	if stuffedBitsReceived == 0 {
+		return rxBuf.WithoutStuffing(codec.ProtocolBitStuffingStep)
+	}
+	return rxBuf[:stuffedBitsReceived].WithoutStuffing(codec.ProtocolBitStuffingStep).WithBits(rxBuf[stuffedBitsReceived:]...)
+}
+
+func handleTransmitState(this *component.Component, previousState State, currentBit codec.Bit) (State, error) {
 	txQueue := this.State().Get(stateKeyTxQueue).(TxQueue)
 	defer func() {
 		this.State().Set(stateKeyTxQueue, txQueue)
@@ -331,21 +725,39 @@ func handleTransmitState(this *component.Component, previousState State) (State,
 
 	txItem := txQueue[0]
 
-	if txItem.Buf.Offset <= codec.ProtocolIDSize {
+	if txItem.Buf.Offset <= txItem.ArbitrationFieldSize {
 		return StateTransmit, errors.New("must be in arbitration state")
 	}
 
+	// The current bit on the bus is the one we have written previously (bit monitoring),
+	// only in the ACK slot it must differ: at least one receiver must have overwritten it with a dominant bit.
+	// The frame is complete after EOF, so IFS bits are not monitored
+	sentBitIndex := txItem.Buf.Offset - 1
+	sentBit := txItem.Buf.PreviousBit()
+	eofEndIndex := txItem.AckSlotIndex + codec.ProtocolACKSlotSize + codec.ProtocolACKDelimiterSize + codec.ProtocolEOFSize
+	switch {
+	case sentBitIndex == txItem.AckSlotIndex:
+		if currentBit.IsRecessive() {
+			return raiseError(this, ErrorTypeACK, true, "the frame is not acknowledged by any receiver")
+		}
+	case sentBitIndex < eofEndIndex && currentBit != sentBit:
+		return raiseError(this, ErrorTypeBit, true, fmt.Sprintf("written %s, but read %s", sentBit, currentBit))
+	}
+
 	// Check if we finished transmitting the buffer
 	if txItem.Buf.Available() == 0 {
-		this.Logger().Println("a buffer is successfully transmitted, remove it from the queue")
+		this.Logger().Println("a buffer is successfully transmitted, remove it from the queue, duration:", txItem.Frame.Duration())
 
 		txQueue = txQueue[1:]
+		handleTransmitSuccess(this)
+
+		// Let MCU know the frame is on the bus (transport protocols supervise transmission time)
+		this.OutputByName(common.PortCANTxConfirm).PutSignals(signal.New(txItem.Frame))
+		notifyTxStatus(this, txItem.Frame, TxResultComplete, "")
 		return StateIdle, nil
 	}
 
-	txBit := txItem.Buf.NextBit()
-	//this.Logger().Println("write frame bit:", txBit)
-	this.OutputByName(common.PortCANTx).PutSignals(signal.New(txBit))
+	this.OutputByName(common.PortCANTx).PutSignals(txItem.nextBitSignal())
 	txItem.Buf.IncreaseOffset()
 
 	return StateTransmit, nil
@@ -360,6 +772,7 @@ func handleStateTransition(this *component.Component, previousState, nextState S
 		// The bits we collected during arbitration are valid and part of the winning frame
 		// Reset expectations to let receive state handle it
 		this.State().Set(stateKeyBitsExpected, 0)
+		completePendingAbort(this)
 		return nil
 
 	// Successfully finished transmitting
@@ -367,14 +780,39 @@ func handleStateTransition(this *component.Component, previousState, nextState S
 		this.State().Set(stateKeyRxBuffer, codec.NewBits(0))
 		return nil
 
-	// Wanted to start transmitting, but received SOF
-	case StateWaitForBusIdle.To(StateReceive):
+	// Error detected, the frame (if any) will be retransmitted after error signalling
+	case StateArbitration.To(StateErrorFlag), StateTransmit.To(StateErrorFlag), StateReceive.To(StateErrorFlag):
+		resetFrameProgress(this)
+		completePendingAbort(this)
+		this.State().Set(stateKeyErrorFlagBitsObserved, codec.NewBits(0))
+		this.State().Set(stateKeyErrorDelimiterBitsObserved, 0)
+		this.State().Set(stateKeyErrorDelimiterDominantBitsObserved, 0)
+		return nil
+
+	// Too many errors, leave the bus
+	case StateArbitration.To(StateBusOff), StateTransmit.To(StateBusOff), StateReceive.To(StateBusOff):
+		resetFrameProgress(this)
+		completePendingAbort(this)
+		this.State().Set(stateKeyConsecutiveRecessiveBitsObserved, 0)
+		this.State().Set(stateKeyBusOffRecoverySequences, 0)
+		return nil
+
+	// Wanted to start transmitting, but received SOF (or all pending frames are aborted)
+	case StateWaitForBusIdle.To(StateReceive), StateWaitForBusIdle.To(StateIdle):
 		this.State().Set(stateKeyConsecutiveRecessiveBitsObserved, 0)
 		return nil
 
 	// When decided to start transmitting
 	case StateWaitForBusIdle.To(StateArbitration):
 		this.State().Set(stateKeyConsecutiveRecessiveBitsObserved, 0)
+		selectFrameForArbitration(this)
+		refreshErrorStateIndicator(this)
+		return nil
+
+	// Recovered from bus-off
+	case StateBusOff.To(StateIdle):
+		this.State().Set(stateKeyConsecutiveRecessiveBitsObserved, 0)
+		this.State().Set(stateKeyBusOffRecoverySequences, 0)
 		return nil
 
 	// Successfully received a frame
@@ -382,11 +820,38 @@ func handleStateTransition(this *component.Component, previousState, nextState S
 		// Clear everything, prepare to receive next frame
 		this.State().Set(stateKeyRxBuffer, codec.NewBits(0))
 		this.State().Set(stateKeyBitsExpected, 0)
+		this.State().Set(stateKeyStuffedBitsReceived, 0)
 		return nil
 	}
 	return nil
 }
 
+// resetFrameProgress drops the frame being received or transmitted (the transmitted frame stays in the queue to be retransmitted)
+func resetFrameProgress(this *component.Component) {
+	txQueue := this.State().Get(stateKeyTxQueue).(TxQueue)
+	if len(txQueue) > 0 {
+		txQueue[0].Buf.ResetOffset()
+	}
+
+	this.State().Set(stateKeyRxBuffer, codec.NewBits(0))
+	this.State().Set(stateKeyBitsExpected, 0)
+	this.State().Set(stateKeyStuffedBitsReceived, 0)
+}
+
+// refreshErrorStateIndicator encodes the current fault confinement state into ESI of the FD frame to be transmitted
+func refreshErrorStateIndicator(this *component.Component) {
+	txQueue := this.State().Get(stateKeyTxQueue).(TxQueue)
+	if len(txQueue) == 0 || !txQueue[0].Frame.FD {
+		return
+	}
+
+	errorPassive := this.State().Get(stateKeyFaultState).(FaultState) == FaultStateErrorPassive
+	if txQueue[0].Frame.ErrorStateIndicator != errorPassive {
+		txQueue[0].Frame.ErrorStateIndicator = errorPassive
+		txQueue[0] = newTxQueueItem(txQueue[0].Frame)
+	}
+}
+
 func refreshLoggerPrefix(this *component.Component) {
 	ctlState := this.State().Get(stateKeyControllerState).(State)
 	this.Logger().SetPrefix(fmt.Sprintf("%s [%s] : ", this.Name(), ctlState))
@@ -0,0 +1,537 @@
+package controller
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/codec"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/common"
+	"github.com/hovsep/fmesh/component"
+	"github.com/hovsep/fmesh/signal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// enqueue hands the frames to the controller as MCU would
+func enqueue(t *testing.T, ctl *component.Component, frames ...*codec.Frame) {
+	for _, frame := range frames {
+		ctl.InputByName(common.PortCANTx).PutSignals(signal.New(frame))
+	}
+	require.NoError(t, handleIncomingFrames(ctl))
+	ctl.InputByName(common.PortCANTx).Clear()
+}
+
+// requestAbort sends the abort request as MCU would
+func requestAbort(t *testing.T, ctl *component.Component, id uint32) {
+	ctl.InputByName(common.PortCANTxAbort).PutSignals(signal.New(&TxAbortRequest{Id: id}))
+	require.NoError(t, handleAbortRequests(ctl))
+	ctl.InputByName(common.PortCANTxAbort).Clear()
+}
+
+// queuedIDs returns the IDs of pending frames in the queue order
+func queuedIDs(ctl *component.Component) []uint32 {
+	var ids []uint32
+	for _, item := range ctl.State().Get(stateKeyTxQueue).(TxQueue) {
+		ids = append(ids, item.Frame.Id)
+	}
+	return ids
+}
+
+// takeTxStatuses returns the transmit statuses reported to MCU and clears the output
+func takeTxStatuses(ctl *component.Component) []string {
+	var statuses []string
+	ctl.OutputByName(common.PortCANTxStatus).Signals().ForEach(func(sig *signal.Signal) error {
+		statuses = append(statuses, sig.PayloadOrNil().(*TxStatus).String())
+		return nil
+	})
+	ctl.OutputByName(common.PortCANTxStatus).Clear()
+	return statuses
+}
+
+// testBus is a stub bus: every bit it delivers the wired-AND of the bits written by controllers back to all of them
+type testBus struct {
+	t       *testing.T
+	units   []string
+	nodes   map[string]*component.Component
+	level   codec.Bit
+	bitTime string     // Bit time label of the current bit (empty for nominal bits)
+	drivers string     // Units driving the current bit dominant
+	bits    int        // Bits delivered so far
+	levels  codec.Bits // Levels of all delivered bits
+
+	// fault may corrupt the bit seen by the unit (e.g., to inject errors detected only by some receivers)
+	fault func(unit string, bit int, level codec.Bit) codec.Bit
+
+	received map[string][]*signal.Signal // Frames passed to MCU by each unit
+	statuses map[string][]string         // Transmit statuses reported to MCU by each unit
+	written  map[string][]int            // Bits driven dominant by each unit
+	reports  map[string]int              // States reported to the bus watchdog by each unit
+}
+
+func newTestBus(t *testing.T) *testBus {
+	return &testBus{
+		t:        t,
+		nodes:    make(map[string]*component.Component),
+		level:    codec.ProtocolRecessiveBit,
+		received: make(map[string][]*signal.Signal),
+		statuses: make(map[string][]string),
+		written:  make(map[string][]int),
+		reports:  make(map[string]int),
+	}
+}
+
+// connect adds the controller of the unit to the bus
+func (b *testBus) connect(unit string, config *Config) *component.Component {
+	ctl := NewWithConfig(unit, config)
+	b.units = append(b.units, unit)
+	b.nodes[unit] = ctl
+	return ctl
+}
+
+// send hands the frames to the controller of the unit as MCU would (they are picked up with the next bit)
+func (b *testBus) send(unit string, frames ...*codec.Frame) {
+	for _, frame := range frames {
+		b.nodes[unit].InputByName(common.PortCANTx).PutSignals(signal.New(frame))
+	}
+}
+
+// step delivers the current bit to all controllers and derives the next one from the bits they write
+func (b *testBus) step() {
+	next := codec.ProtocolRecessiveBit
+	nextBitTime := ""
+	var drivers []string
+
+	for _, unit := range b.units {
+		ctl := b.nodes[unit]
+		level := b.level
+		if b.fault != nil {
+			level = b.fault(unit, b.bits, level)
+		}
+
+		rxSignal := signal.New(level).AddLabel(common.LabelBusDrivers, b.drivers)
+		if b.bitTime != "" {
+			rxSignal.AddLabel(common.LabelBitTime, b.bitTime)
+		}
+		ctl.InputByName(common.PortCANRx).PutSignals(rxSignal)
+		require.NoError(b.t, activate(ctl), "unit %s, bit %d", unit, b.bits)
+		for _, p := range []string{common.PortCANTx, common.PortCANRx, common.PortCANTxAbort} {
+			ctl.InputByName(p).Clear()
+		}
+
+		ctl.OutputByName(common.PortCANTx).Signals().ForEach(func(sig *signal.Signal) error {
+			if sig.PayloadOrNil().(codec.Bit).IsDominant() {
+				next = codec.ProtocolDominantBit
+				drivers = append(drivers, unit)
+				b.written[unit] = append(b.written[unit], b.bits+1)
+			}
+			if bitTime := sig.Labels().ValueOrDefault(common.LabelBitTime, ""); bitTime != "" {
+				nextBitTime = bitTime
+			}
+			return nil
+		})
+		b.received[unit] = append(b.received[unit], ctl.OutputByName(common.PortCANRx).Signals().All()...)
+		b.statuses[unit] = append(b.statuses[unit], takeTxStatuses(ctl)...)
+		b.reports[unit] += len(ctl.OutputByName(common.PortControllerState).Signals().All())
+		for _, p := range []string{common.PortCANTx, common.PortCANRx, common.PortCANTxConfirm, common.PortControllerState} {
+			ctl.OutputByName(p).Clear()
+		}
+	}
+
+	slices.Sort(drivers)
+	b.levels = b.levels.WithBits(b.level)
+	b.level, b.bitTime, b.drivers = next, nextBitTime, strings.Join(drivers, ",")
+	b.bits++
+}
+
+// run delivers the given number of bits
+func (b *testBus) run(bits int) {
+	for range bits {
+		b.step()
+	}
+}
+
+// runUntil delivers bits until the condition is met after the bit (fails if it takes more than the given number of bits)
+func (b *testBus) runUntil(maxBits int, cond func() bool) {
+	b.t.Helper()
+	for range maxBits {
+		b.step()
+		if cond() {
+			return
+		}
+	}
+	require.FailNow(b.t, "condition is not met", "after %d bits", maxBits)
+}
+
+// runUntilIdle delivers bits until all controllers are idle and have nothing to send
+func (b *testBus) runUntilIdle(maxBits int) {
+	b.t.Helper()
+	b.runUntil(maxBits, func() bool {
+		for _, ctl := range b.nodes {
+			if b.state(ctl) != StateIdle || len(ctl.State().Get(stateKeyTxQueue).(TxQueue)) > 0 {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+func (b *testBus) state(ctl *component.Component) State {
+	return ctl.State().Get(stateKeyControllerState).(State)
+}
+
+// receivedFrames returns the frames passed to MCU by the unit
+func (b *testBus) receivedFrames(unit string) []*codec.Frame {
+	var frames []*codec.Frame
+	for _, sig := range b.received[unit] {
+		frames = append(frames, sig.PayloadOrNil().(*codec.Frame))
+	}
+	return frames
+}
+
+// errorCounters returns TEC and REC of the controller
+func errorCounters(ctl *component.Component) (int, int) {
+	return ctl.State().Get(stateKeyTEC).(int), ctl.State().Get(stateKeyREC).(int)
+}
+
+func TestSelectFrameForArbitration(t *testing.T) {
+	frames := []*codec.Frame{
+		{Id: 0x300, DLC: 1},
+		{Id: 0x100 << 18, Extended: true, DLC: 1},
+		{Id: 0x200, DLC: 1},
+		{Id: 0x100, DLC: 1}, // Same base ID as the extended one, but wins
+	}
+
+	tests := []struct {
+		name   string
+		config *Config
+		want   []uint32
+	}{
+		{
+			name:   "priority mode",
+			config: &Config{},
+			want:   []uint32{0x100, 0x300, 0x100 << 18, 0x200},
+		},
+		{
+			name:   "FIFO mode",
+			config: &Config{TxFIFO: true},
+			want:   []uint32{0x300, 0x100 << 18, 0x200, 0x100},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctl := NewWithConfig("test", tt.config)
+			enqueue(t, ctl, frames...)
+
+			selectFrameForArbitration(ctl)
+			assert.Equal(t, tt.want, queuedIDs(ctl))
+		})
+	}
+}
+
+func TestTxMailboxes(t *testing.T) {
+	ctl := NewWithConfig("test", &Config{TxMailboxes: 2})
+	enqueue(t, ctl, &codec.Frame{Id: 0x100, DLC: 1}, &codec.Frame{Id: 0x200, DLC: 1}, &codec.Frame{Id: 0x300, DLC: 1})
+
+	assert.Equal(t, []uint32{0x100, 0x200}, queuedIDs(ctl))
+	assert.Equal(t, []string{"0x300 aborted: no free mailbox"}, takeTxStatuses(ctl))
+}
+
+func TestAbortRequests(t *testing.T) {
+	t.Run("pending frames are dropped at once", func(t *testing.T) {
+		ctl := New("test")
+		enqueue(t, ctl, &codec.Frame{Id: 0x100, DLC: 1}, &codec.Frame{Id: 0x200, DLC: 1}, &codec.Frame{Id: 0x100, DLC: 2})
+		ctl.State().Set(stateKeyControllerState, StateWaitForBusIdle)
+
+		requestAbort(t, ctl, 0x100)
+		assert.Equal(t, []uint32{0x200}, queuedIDs(ctl))
+		assert.Equal(t, []string{"0x100 aborted: aborted by MCU", "0x100 aborted: aborted by MCU"}, takeTxStatuses(ctl))
+
+		// Extended frames have their own ID space
+		ctl.InputByName(common.PortCANTxAbort).PutSignals(signal.New(&TxAbortRequest{Id: 0x200, Extended: true}))
+		require.NoError(t, handleAbortRequests(ctl))
+		assert.Equal(t, []uint32{0x200}, queuedIDs(ctl))
+		assert.Empty(t, takeTxStatuses(ctl))
+	})
+
+	t.Run("frame on the bus is dropped when it fails", func(t *testing.T) {
+		ctl := New("test")
+		enqueue(t, ctl, &codec.Frame{Id: 0x100, DLC: 1}, &codec.Frame{Id: 0x200, DLC: 1})
+		ctl.State().Set(stateKeyControllerState, StateTransmit)
+
+		requestAbort(t, ctl, 0x100)
+		txQueue := ctl.State().Get(stateKeyTxQueue).(TxQueue)
+		assert.Equal(t, []uint32{0x100, 0x200}, queuedIDs(ctl))
+		assert.True(t, txQueue[0].AbortRequested)
+		assert.Empty(t, takeTxStatuses(ctl))
+
+		require.NoError(t, handleStateTransition(ctl, StateTransmit, StateErrorFlag))
+		assert.Equal(t, []uint32{0x200}, queuedIDs(ctl))
+		assert.Equal(t, []string{"0x100 aborted: aborted by MCU"}, takeTxStatuses(ctl))
+	})
+
+	t.Run("frame on the bus is dropped when it loses arbitration", func(t *testing.T) {
+		ctl := New("test")
+		enqueue(t, ctl, &codec.Frame{Id: 0x100, DLC: 1})
+		ctl.State().Set(stateKeyControllerState, StateArbitration)
+
+		requestAbort(t, ctl, 0x100)
+		assert.Equal(t, []uint32{0x100}, queuedIDs(ctl))
+
+		require.NoError(t, handleStateTransition(ctl, StateArbitration, StateReceive))
+		assert.Empty(t, queuedIDs(ctl))
+		assert.Equal(t, []string{"0x100 aborted: aborted by MCU"}, takeTxStatuses(ctl))
+	})
+
+	t.Run("frame without pending abort is kept for retransmission", func(t *testing.T) {
+		ctl := New("test")
+		enqueue(t, ctl, &codec.Frame{Id: 0x100, DLC: 1})
+
+		completePendingAbort(ctl)
+		assert.Equal(t, []uint32{0x100}, queuedIDs(ctl))
+		assert.Empty(t, takeTxStatuses(ctl))
+	})
+}
+
+func TestAcknowledgement(t *testing.T) {
+	frame := &codec.Frame{Id: 0x123, DLC: 2, Data: [codec.ProtocolMaxFDDataBytes]byte{0xAB, 0xCD}}
+
+	t.Run("receivers drive dominant ACK slot", func(t *testing.T) {
+		b := newTestBus(t)
+		tx := b.connect("tx", &Config{})
+		b.connect("rx1", &Config{})
+		b.connect("rx2", &Config{})
+
+		b.send("tx", frame)
+		b.runUntilIdle(500)
+
+		ackSlot := b.written["tx"][0] + newTxQueueItem(frame).AckSlotIndex
+		assert.True(t, b.levels[ackSlot].IsDominant())
+		assert.NotContains(t, b.written["tx"], ackSlot, "transmitter sends the ACK slot recessive")
+		assert.Equal(t, []int{ackSlot}, b.written["rx1"], "receivers drive the ACK slot only")
+		assert.Equal(t, []int{ackSlot}, b.written["rx2"])
+
+		assert.Equal(t, []string{"0x123 complete"}, b.statuses["tx"])
+		assert.Equal(t, []*codec.Frame{frame}, b.receivedFrames("rx1"))
+		assert.Equal(t, []*codec.Frame{frame}, b.receivedFrames("rx2"))
+		tec, rec := errorCounters(tx)
+		assert.Zero(t, tec)
+		assert.Zero(t, rec)
+	})
+
+	t.Run("frame is retransmitted until acknowledged", func(t *testing.T) {
+		b := newTestBus(t)
+		tx := b.connect("tx", &Config{})
+
+		b.send("tx", frame)
+		b.runUntil(500, func() bool {
+			return b.state(tx) == StateErrorFlag
+		})
+
+		// Nobody acknowledged the frame
+		ackSlot := b.written["tx"][0] + newTxQueueItem(frame).AckSlotIndex
+		assert.Equal(t, b.bits-1, ackSlot)
+		assert.True(t, b.levels[ackSlot].IsRecessive())
+		assert.Equal(t, []uint32{0x123}, queuedIDs(tx))
+		assert.Empty(t, b.statuses["tx"])
+		tec, _ := errorCounters(tx)
+		assert.Equal(t, transmitErrorCounterDelta, tec)
+
+		// The receiver comes online while the transmitter signals the error
+		b.connect("rx", &Config{})
+		b.runUntilIdle(500)
+
+		assert.Equal(t, []string{"0x123 complete"}, b.statuses["tx"])
+		assert.Equal(t, []*codec.Frame{frame}, b.receivedFrames("rx"))
+		tec, _ = errorCounters(tx)
+		assert.Equal(t, transmitErrorCounterDelta-1, tec)
+	})
+}
+
+func TestArbitration(t *testing.T) {
+	t.Run("data frame wins over the remote frame with the same ID", func(t *testing.T) {
+		data := &codec.Frame{Id: 0x3E0, DLC: 2, Data: [codec.ProtocolMaxFDDataBytes]byte{0x5F, 0x01}}
+		remote := &codec.Frame{Id: 0x3E0, Remote: true, DLC: 2}
+
+		b := newTestBus(t)
+		b.connect("requester", &Config{})
+		b.connect("responder", &Config{})
+		b.connect("rx", &Config{})
+
+		b.send("requester", remote)
+		b.send("responder", data)
+		b.runUntilIdle(1000)
+
+		// Both frames start at once, the dominant RTR bit of the data frame wins
+		assert.Equal(t, b.written["requester"][0], b.written["responder"][0])
+		assert.Equal(t, []*codec.Frame{data, remote}, b.receivedFrames("rx"))
+		assert.Equal(t, []*codec.Frame{data}, b.receivedFrames("requester"))
+		assert.Equal(t, []*codec.Frame{remote}, b.receivedFrames("responder"))
+		assert.Equal(t, []string{"0x3E0 complete"}, b.statuses["requester"])
+		assert.Equal(t, []string{"0x3E0 complete"}, b.statuses["responder"])
+	})
+}
+
+func TestClassicAndFDControllers(t *testing.T) {
+	classicFrame := &codec.Frame{Id: 0x100, DLC: 2, Data: [codec.ProtocolMaxFDDataBytes]byte{0xAB, 0xCD}}
+	fdFrame := &codec.Frame{Id: 0x200, FD: true, DLC: 12, Data: [codec.ProtocolMaxFDDataBytes]byte{0x01, 0x02, 0x03}}
+
+	t.Run("classic frames are exchanged by both", func(t *testing.T) {
+		b := newTestBus(t)
+		b.connect("classic", &Config{})
+		b.connect("fd", &Config{FD: true})
+
+		// FD controllers send classic frames too
+		fdClassicFrame := &codec.Frame{Id: 0x300, DLC: 1, Data: [codec.ProtocolMaxFDDataBytes]byte{0x01}}
+		b.send("classic", classicFrame)
+		b.send("fd", fdClassicFrame)
+		b.runUntilIdle(1000)
+
+		assert.Equal(t, []string{"0x100 complete"}, b.statuses["classic"])
+		assert.Equal(t, []string{"0x300 complete"}, b.statuses["fd"])
+		assert.Equal(t, []*codec.Frame{fdClassicFrame}, b.receivedFrames("classic"))
+		assert.Equal(t, []*codec.Frame{classicFrame}, b.receivedFrames("fd"))
+	})
+
+	t.Run("classic controller flags FD frames", func(t *testing.T) {
+		b := newTestBus(t)
+		classic := b.connect("classic", &Config{})
+		fdTx := b.connect("fd-tx", &Config{FD: true})
+		b.connect("fd-rx", &Config{FD: true})
+
+		b.send("fd-tx", fdFrame)
+		b.runUntil(500, func() bool {
+			return b.state(classic) == StateErrorFlag
+		})
+		_, rec := errorCounters(classic)
+		assert.Equal(t, 1, rec)
+
+		// The error flag destroys the FD frame, so MCU gives up on it
+		b.nodes["fd-tx"].InputByName(common.PortCANTxAbort).PutSignals(signal.New(&TxAbortRequest{Id: fdFrame.Id}))
+		b.runUntilIdle(500)
+		assert.Equal(t, []string{"0x200 aborted: aborted by MCU"}, b.statuses["fd-tx"])
+		assert.Empty(t, b.receivedFrames("fd-rx"))
+		assert.Empty(t, b.receivedFrames("classic"))
+		tec, _ := errorCounters(fdTx)
+		assert.Equal(t, transmitErrorCounterDelta, tec)
+
+		// The bus is still shared by classic frames
+		b.send("classic", classicFrame)
+		b.runUntilIdle(500)
+		assert.Equal(t, []string{"0x100 complete"}, b.statuses["classic"])
+		assert.Equal(t, []*codec.Frame{classicFrame}, b.receivedFrames("fd-tx"))
+		assert.Equal(t, []*codec.Frame{classicFrame}, b.receivedFrames("fd-rx"))
+	})
+
+	t.Run("FD frames are exchanged by FD controllers", func(t *testing.T) {
+		b := newTestBus(t)
+		b.connect("fd-tx", &Config{FD: true})
+		b.connect("fd-rx", &Config{FD: true})
+
+		b.send("fd-tx", fdFrame)
+		b.runUntilIdle(1000)
+		assert.Equal(t, []string{"0x200 complete"}, b.statuses["fd-tx"])
+		assert.Equal(t, []*codec.Frame{fdFrame}, b.receivedFrames("fd-rx"))
+	})
+
+	t.Run("classic controller can not transmit FD frames", func(t *testing.T) {
+		ctl := New("classic")
+		ctl.InputByName(common.PortCANTx).PutSignals(signal.New(fdFrame))
+		assert.ErrorContains(t, handleIncomingFrames(ctl), "classic controller can not transmit FD frame")
+	})
+}
+
+func TestListenOnly(t *testing.T) {
+	frame := &codec.Frame{Id: 0x123, DLC: 2, Data: [codec.ProtocolMaxFDDataBytes]byte{0xAB, 0xCD}}
+
+	t.Run("frames are received without driving the bus", func(t *testing.T) {
+		b := newTestBus(t)
+		b.connect("tx", &Config{})
+		b.connect("rx", &Config{})
+		b.connect("monitor", &Config{ListenOnly: true})
+
+		b.send("tx", frame)
+		b.runUntilIdle(500)
+
+		assert.Equal(t, []*codec.Frame{frame}, b.receivedFrames("monitor"))
+		assert.Empty(t, b.written["monitor"], "no ACK")
+		assert.Positive(t, b.reports["tx"])
+		assert.Zero(t, b.reports["monitor"], "not counted by the bus watchdog")
+	})
+
+	t.Run("frames are labeled with the start bit, the transmitter and the contenders", func(t *testing.T) {
+		b := newTestBus(t)
+		b.connect("ecu-a", &Config{})
+		b.connect("ecu-b", &Config{})
+		b.connect("monitor", &Config{ListenOnly: true})
+
+		low := &codec.Frame{Id: 0x100, DLC: 1, Data: [codec.ProtocolMaxFDDataBytes]byte{0x01}}
+		high := &codec.Frame{Id: 0x200, DLC: 1, Data: [codec.ProtocolMaxFDDataBytes]byte{0x02}}
+		b.send("ecu-a", high)
+		b.send("ecu-b", low)
+		b.runUntilIdle(1000)
+
+		require.Equal(t, []*codec.Frame{low, high}, b.receivedFrames("monitor"))
+		first, second := b.received["monitor"][0].Labels(), b.received["monitor"][1].Labels()
+
+		assert.Equal(t, "ecu-b", first.ValueOrDefault(common.LabelBusDrivers, ""))
+		assert.Equal(t, "ecu-a,ecu-b", first.ValueOrDefault(common.LabelBusContenders, ""))
+		// Bus ticks count the bits seen so far (the labeled bit included)
+		assert.Equal(t, strconv.Itoa(b.written["ecu-b"][0]+1), first.ValueOrDefault(common.LabelBusStartBit, ""))
+
+		// The loser retries alone
+		assert.Equal(t, "ecu-a", second.ValueOrDefault(common.LabelBusDrivers, ""))
+		assert.Equal(t, "ecu-a", second.ValueOrDefault(common.LabelBusContenders, ""))
+		start, err := strconv.Atoi(second.ValueOrDefault(common.LabelBusStartBit, ""))
+		require.NoError(t, err)
+		end, err := strconv.Atoi(first.ValueOrDefault(common.LabelBusBit, ""))
+		require.NoError(t, err)
+		retry := slices.IndexFunc(b.written["ecu-a"], func(bit int) bool {
+			return bit >= end
+		})
+		require.GreaterOrEqual(t, retry, 0)
+		assert.Equal(t, b.written["ecu-a"][retry]+1, start)
+	})
+
+	t.Run("errors are detected without error flags", func(t *testing.T) {
+		b := newTestBus(t)
+		tx := b.connect("tx", &Config{})
+		b.connect("rx", &Config{})
+		monitor := b.connect("monitor", &Config{ListenOnly: true})
+
+		// Only the monitor sees the corrupted bit in the data field
+		b.fault = flipBit(b, "tx", newTxQueueItem(frame).AckSlotIndex-codec.ProtocolCRCDelimiterSize-codec.ProtocolCRCSize-8, "monitor")
+		b.send("tx", frame)
+		b.runUntil(500, func() bool {
+			return b.state(monitor) == StateErrorFlag
+		})
+		b.runUntilIdle(500)
+
+		assert.Empty(t, b.written["monitor"])
+		assert.Equal(t, []string{"0x123 complete"}, b.statuses["tx"])
+		assert.Empty(t, b.receivedFrames("monitor"))
+		tec, _ := errorCounters(tx)
+		assert.Zero(t, tec, "the transmitter did not see any error")
+	})
+
+	t.Run("frame is not acknowledged by the monitor alone", func(t *testing.T) {
+		b := newTestBus(t)
+		tx := b.connect("tx", &Config{})
+		b.connect("monitor", &Config{ListenOnly: true})
+
+		b.send("tx", frame)
+		b.runUntil(500, func() bool {
+			return b.state(tx) == StateErrorFlag
+		})
+		tec, _ := errorCounters(tx)
+		assert.Equal(t, transmitErrorCounterDelta, tec)
+		assert.Empty(t, b.written["monitor"])
+	})
+
+	t.Run("listen-only controller can not transmit", func(t *testing.T) {
+		ctl := NewWithConfig("monitor", &Config{ListenOnly: true})
+		ctl.InputByName(common.PortCANTx).PutSignals(signal.New(frame))
+		assert.ErrorContains(t, handleIncomingFrames(ctl), "listen-only controller can not transmit")
+	})
+}
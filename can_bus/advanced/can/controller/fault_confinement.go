@@ -0,0 +1,238 @@
+package controller
+
+import (
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/codec"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/common"
+	"github.com/hovsep/fmesh/component"
+	"github.com/hovsep/fmesh/signal"
+)
+
+// ErrorType is a CAN protocol error detected by the controller
+type ErrorType byte
+
+// FaultState is the fault confinement state of the controller (driven by TEC and REC)
+type FaultState byte
+
+const (
+	ErrorTypeBit   ErrorType = iota // Transmitter reads a bit different from the one it has written
+	ErrorTypeStuff                  // More than 5 consecutive bits of the same level in the stuffed part of the frame
+	ErrorTypeCRC                    // Received CRC does not match the calculated one
+	ErrorTypeForm                   // Fixed-form field (delimiter, EOF) contains an illegal bit
+	ErrorTypeACK                    // Transmitter does not see a dominant bit in the ACK slot
+)
+
+const (
+	FaultStateErrorActive  FaultState = iota // Signals errors with active (dominant) error flags
+	FaultStateErrorPassive                   // Signals errors with passive (recessive) error flags, suspends transmission
+	FaultStateBusOff                         // Does not participate in bus communication until recovered
+)
+
+const (
+	errorPassiveThreshold     = 127 // TEC or REC above this value make the controller error-passive
+	busOffThreshold           = 255 // TEC above this value makes the controller bus-off
+	transmitErrorCounterDelta = 8   // TEC is increased by 8 on each transmit error, REC is increased by 1 on each receive error
+	primaryErrorCounterDelta  = 8   // REC is increased by 8 when the receiver is the first one signalling an error
+)
+
+var (
+	errorTypeNames = []string{
+		"BIT ERROR",
+		"STUFF ERROR",
+		"CRC ERROR",
+		"FORM ERROR",
+		"ACK ERROR",
+	}
+
+	faultStateNames = []string{
+		"ERROR ACTIVE",
+		"ERROR PASSIVE",
+		"BUS OFF",
+	}
+)
+
+func (errType ErrorType) String() string {
+	return errorTypeNames[errType]
+}
+
+func (faultState FaultState) String() string {
+	return faultStateNames[faultState]
+}
+
+// raiseError updates error counters and starts error signalling (or switches the controller off the bus)
+func raiseError(this *component.Component, errType ErrorType, isTransmitter bool, details string) (State, error) {
+	tec := this.State().Get(stateKeyTEC).(int)
+	rec := this.State().Get(stateKeyREC).(int)
+	faultState := this.State().Get(stateKeyFaultState).(FaultState)
+
+	switch {
+	case isTransmitter && errType == ErrorTypeACK && faultState == FaultStateErrorPassive:
+		// Error-passive transmitter is not punished for missing acknowledgement (e.g., it is alone on the bus)
+	case isTransmitter:
+		tec += transmitErrorCounterDelta
+	default:
+		rec++
+	}
+
+	this.State().Set(stateKeyTransmitterError, isTransmitter)
+	faultState = setErrorCounters(this, tec, rec)
+	this.Logger().Printf("%s: %s (TEC: %d, REC: %d)", errType, details, tec, rec)
+
+	if faultState == FaultStateBusOff {
+		return StateBusOff, nil
+	}
+	return StateErrorFlag, nil
+}
+
+// setErrorCounters saves TEC and REC and returns the resulting fault confinement state
+func setErrorCounters(this *component.Component, tec, rec int) FaultState {
+	this.State().Set(stateKeyTEC, tec)
+	this.State().Set(stateKeyREC, rec)
+
+	previousFaultState := this.State().Get(stateKeyFaultState).(FaultState)
+	faultState := FaultStateErrorActive
+	switch {
+	case tec > busOffThreshold:
+		faultState = FaultStateBusOff
+	case tec > errorPassiveThreshold || rec > errorPassiveThreshold:
+		faultState = FaultStateErrorPassive
+	}
+
+	if faultState != previousFaultState {
+		this.Logger().Printf("fault confinement state: %s->%s", previousFaultState, faultState)
+		this.State().Set(stateKeyFaultState, faultState)
+	}
+	return faultState
+}
+
+// handleTransmitSuccess decreases TEC after a frame is transmitted
+func handleTransmitSuccess(this *component.Component) {
+	tec := this.State().Get(stateKeyTEC).(int)
+	rec := this.State().Get(stateKeyREC).(int)
+
+	if tec > 0 {
+		tec--
+	}
+	setErrorCounters(this, tec, rec)
+}
+
+// handleReceiveSuccess decreases REC after a frame is received
+func handleReceiveSuccess(this *component.Component) {
+	tec := this.State().Get(stateKeyTEC).(int)
+	rec := this.State().Get(stateKeyREC).(int)
+
+	switch {
+	case rec > errorPassiveThreshold:
+		rec = errorPassiveThreshold
+	case rec > 0:
+		rec--
+	}
+	setErrorCounters(this, tec, rec)
+}
+
+// Error flag starts with the next bit after the error is detected:
+// error-active controller writes dominant bits (which violate stuffing, so all other nodes detect an error as well),
+// error-passive controller writes recessive bits (which do not disturb the bus).
+// The flag is complete when 6 consecutive bits of the same level are observed on the bus,
+// so the passive flag may last until other nodes finish their frame
+func handleErrorFlagState(this *component.Component, previousState State, currentBit codec.Bit) (State, error) {
+	errorFlagBitsObserved := this.State().Get(stateKeyErrorFlagBitsObserved).(codec.Bits)
+
+	// When the error is just detected, the current bit is the erroneous one (not a flag bit)
+	if previousState == StateErrorFlag {
+		errorFlagBitsObserved = errorFlagBitsObserved.WithBits(currentBit)
+		this.State().Set(stateKeyErrorFlagBitsObserved, errorFlagBitsObserved)
+	}
+
+	if errorFlagBitsObserved.Len() >= codec.ProtocolErrorFlagSize &&
+		errorFlagBitsObserved[errorFlagBitsObserved.Len()-codec.ProtocolErrorFlagSize:].AllBitsAre(currentBit) {
+		return StateErrorDelimiter, nil
+	}
+
+	// Listen-only controller never drives the bus, it only follows the error signalling of other nodes
+	if this.State().Get(stateKeyConfig).(*Config).ListenOnly {
+		return StateErrorFlag, nil
+	}
+
+	flagBit := codec.ProtocolDominantBit
+	if this.State().Get(stateKeyFaultState).(FaultState) == FaultStateErrorPassive {
+		flagBit = codec.ProtocolRecessiveBit
+	}
+
+	this.OutputByName(common.PortCANTx).PutSignals(signal.New(flagBit))
+	return StateErrorFlag, nil
+}
+
+// Error delimiter: keep writing recessive bits until the error flags of all nodes are over
+// and the bus is recessive for the whole delimiter
+func handleErrorDelimiterState(this *component.Component, previousState State, currentBit codec.Bit) (State, error) {
+	if previousState == StateErrorFlag {
+		// The current bit is the last bit of our own error flag
+		writeErrorDelimiterBit(this)
+		return StateErrorDelimiter, nil
+	}
+
+	errorDelimiterBitsObserved := this.State().Get(stateKeyErrorDelimiterBitsObserved).(int)
+	dominantBitsObserved := this.State().Get(stateKeyErrorDelimiterDominantBitsObserved).(int)
+
+	if currentBit.IsRecessive() {
+		errorDelimiterBitsObserved++
+	} else {
+		isFirstBitAfterErrorFlag := errorDelimiterBitsObserved == 0 && dominantBitsObserved == 0
+		if isFirstBitAfterErrorFlag && !this.State().Get(stateKeyTransmitterError).(bool) {
+			// Other nodes are signalling the error after us, so most likely this receiver is the one which is faulty
+			tec := this.State().Get(stateKeyTEC).(int)
+			rec := this.State().Get(stateKeyREC).(int) + primaryErrorCounterDelta
+			setErrorCounters(this, tec, rec)
+			this.Logger().Printf("dominant bit after own error flag (TEC: %d, REC: %d)", tec, rec)
+		}
+
+		// Other nodes are still writing their error flags
+		dominantBitsObserved++
+		errorDelimiterBitsObserved = 0
+	}
+	this.State().Set(stateKeyErrorDelimiterBitsObserved, errorDelimiterBitsObserved)
+	this.State().Set(stateKeyErrorDelimiterDominantBitsObserved, dominantBitsObserved)
+
+	if errorDelimiterBitsObserved == codec.ProtocolErrorDelimiterSize {
+		this.Logger().Println("error signalling is finished")
+		return StateIdle, nil
+	}
+
+	writeErrorDelimiterBit(this)
+	return StateErrorDelimiter, nil
+}
+
+// writeErrorDelimiterBit writes the recessive bit of the error delimiter (listen-only controller only observes it)
+func writeErrorDelimiterBit(this *component.Component) {
+	if this.State().Get(stateKeyConfig).(*Config).ListenOnly {
+		return
+	}
+	this.OutputByName(common.PortCANTx).PutSignals(signal.New(codec.ProtocolRecessiveBit))
+}
+
+// Bus-off controller only listens, it recovers after observing 128 sequences of 11 consecutive recessive bits
+func handleBusOffState(this *component.Component, previousState State, currentBit codec.Bit) (State, error) {
+	consecutiveRecessiveBitsObserved := this.State().Get(stateKeyConsecutiveRecessiveBitsObserved).(int)
+	recoverySequencesObserved := this.State().Get(stateKeyBusOffRecoverySequences).(int)
+
+	if currentBit.IsRecessive() {
+		consecutiveRecessiveBitsObserved++
+	} else {
+		consecutiveRecessiveBitsObserved = 0
+	}
+
+	if consecutiveRecessiveBitsObserved == codec.ProtocolBusOffRecoverySequenceSize {
+		consecutiveRecessiveBitsObserved = 0
+		recoverySequencesObserved++
+	}
+
+	this.State().Set(stateKeyConsecutiveRecessiveBitsObserved, consecutiveRecessiveBitsObserved)
+	this.State().Set(stateKeyBusOffRecoverySequences, recoverySequencesObserved)
+
+	if recoverySequencesObserved == codec.ProtocolBusOffRecoverySequences {
+		this.Logger().Println("recovered from bus-off")
+		setErrorCounters(this, 0, 0)
+		return StateIdle, nil
+	}
+	return StateBusOff, nil
+}
@@ -0,0 +1,376 @@
+package controller
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/codec"
+	"github.com/hovsep/fmesh/component"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// faultState returns the fault confinement state of the controller
+func faultState(ctl *component.Component) FaultState {
+	return ctl.State().Get(stateKeyFaultState).(FaultState)
+}
+
+// startOfFrameBits returns the bits where frames start: dominant bits after the bus is idle
+func startOfFrameBits(levels codec.Bits) []int {
+	var sofs []int
+	for i := codec.ProtocolEOFSize + codec.ProtocolIFSSize + 1; i < levels.Len(); i++ {
+		if levels[i].IsDominant() && levels[i-codec.ProtocolEOFSize-codec.ProtocolIFSSize-1:i].AllBitsAre(codec.ProtocolRecessiveBit) {
+			sofs = append(sofs, i)
+		}
+	}
+	return sofs
+}
+
+// stuffBitIndex returns the index of the first stuff bit in the encoded frame after the given index
+func stuffBitIndex(t *testing.T, frame *codec.Frame, after int) int {
+	bits := newTxQueueItem(frame).Buf.Bits
+	for i := after + 1; i < bits.Len(); i++ {
+		if bits[i-codec.ProtocolBitStuffingStep:i].AllBitsAre(bits[i-1]) && bits[i] != bits[i-1] {
+			return i
+		}
+	}
+	require.FailNow(t, "no stuff bit in the frame")
+	return 0
+}
+
+// flipBit returns the fault flipping the bit of the frame seen by the units (all units when none given)
+func flipBit(b *testBus, transmitter string, index int, units ...string) func(unit string, bit int, level codec.Bit) codec.Bit {
+	return func(unit string, bit int, level codec.Bit) codec.Bit {
+		written := b.written[transmitter]
+		if len(written) == 0 || bit != written[0]+index {
+			return level
+		}
+		if len(units) > 0 && !slices.Contains(units, unit) {
+			return level
+		}
+		if level.IsDominant() {
+			return codec.ProtocolRecessiveBit
+		}
+		return codec.ProtocolDominantBit
+	}
+}
+
+func TestRaiseError(t *testing.T) {
+	tests := []struct {
+		name          string
+		tec, rec      int
+		errType       ErrorType
+		isTransmitter bool
+		wantTEC       int
+		wantREC       int
+		wantFault     FaultState
+		wantState     State
+	}{
+		{
+			name:          "transmit error",
+			errType:       ErrorTypeBit,
+			isTransmitter: true,
+			wantTEC:       8,
+			wantFault:     FaultStateErrorActive,
+			wantState:     StateErrorFlag,
+		},
+		{
+			name:      "receive error",
+			errType:   ErrorTypeStuff,
+			wantREC:   1,
+			wantFault: FaultStateErrorActive,
+			wantState: StateErrorFlag,
+		},
+		{
+			name:          "TEC at the error-passive threshold",
+			tec:           119,
+			errType:       ErrorTypeBit,
+			isTransmitter: true,
+			wantTEC:       127,
+			wantFault:     FaultStateErrorActive,
+			wantState:     StateErrorFlag,
+		},
+		{
+			name:          "TEC above the error-passive threshold",
+			tec:           120,
+			errType:       ErrorTypeBit,
+			isTransmitter: true,
+			wantTEC:       128,
+			wantFault:     FaultStateErrorPassive,
+			wantState:     StateErrorFlag,
+		},
+		{
+			name:      "REC above the error-passive threshold",
+			rec:       127,
+			errType:   ErrorTypeCRC,
+			wantREC:   128,
+			wantFault: FaultStateErrorPassive,
+			wantState: StateErrorFlag,
+		},
+		{
+			name:          "ACK error of error-active transmitter",
+			tec:           96,
+			errType:       ErrorTypeACK,
+			isTransmitter: true,
+			wantTEC:       104,
+			wantFault:     FaultStateErrorActive,
+			wantState:     StateErrorFlag,
+		},
+		{
+			name:          "ACK error of error-passive transmitter is not counted",
+			tec:           128,
+			errType:       ErrorTypeACK,
+			isTransmitter: true,
+			wantTEC:       128,
+			wantFault:     FaultStateErrorPassive,
+			wantState:     StateErrorFlag,
+		},
+		{
+			name:          "TEC at the bus-off threshold",
+			tec:           247,
+			errType:       ErrorTypeForm,
+			isTransmitter: true,
+			wantTEC:       255,
+			wantFault:     FaultStateErrorPassive,
+			wantState:     StateErrorFlag,
+		},
+		{
+			name:          "TEC above the bus-off threshold",
+			tec:           248,
+			errType:       ErrorTypeBit,
+			isTransmitter: true,
+			wantTEC:       256,
+			wantFault:     FaultStateBusOff,
+			wantState:     StateBusOff,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctl := New("test")
+			setErrorCounters(ctl, tt.tec, tt.rec)
+
+			state, err := raiseError(ctl, tt.errType, tt.isTransmitter, "test")
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantState, state)
+			tec, rec := errorCounters(ctl)
+			assert.Equal(t, tt.wantTEC, tec)
+			assert.Equal(t, tt.wantREC, rec)
+			assert.Equal(t, tt.wantFault, faultState(ctl))
+			assert.Equal(t, tt.isTransmitter, ctl.State().Get(stateKeyTransmitterError))
+		})
+	}
+}
+
+func TestSuccessDecreasesErrorCounters(t *testing.T) {
+	ctl := New("test")
+	setErrorCounters(ctl, 128, 0)
+	require.Equal(t, FaultStateErrorPassive, faultState(ctl))
+
+	handleTransmitSuccess(ctl)
+	tec, _ := errorCounters(ctl)
+	assert.Equal(t, 127, tec)
+	assert.Equal(t, FaultStateErrorActive, faultState(ctl))
+
+	// REC above the threshold drops right below it
+	setErrorCounters(ctl, 0, 140)
+	require.Equal(t, FaultStateErrorPassive, faultState(ctl))
+	handleReceiveSuccess(ctl)
+	_, rec := errorCounters(ctl)
+	assert.Equal(t, 127, rec)
+	assert.Equal(t, FaultStateErrorActive, faultState(ctl))
+
+	handleReceiveSuccess(ctl)
+	_, rec = errorCounters(ctl)
+	assert.Equal(t, 126, rec)
+
+	// Counters never go below zero
+	setErrorCounters(ctl, 0, 0)
+	handleTransmitSuccess(ctl)
+	handleReceiveSuccess(ctl)
+	tec, rec = errorCounters(ctl)
+	assert.Zero(t, tec)
+	assert.Zero(t, rec)
+}
+
+func TestErrorSignalling(t *testing.T) {
+	frame := &codec.Frame{Id: 0x123, DLC: 2, Data: [codec.ProtocolMaxFDDataBytes]byte{0x55, 0x55}}
+
+	t.Run("bit error: active error flag and delimiter", func(t *testing.T) {
+		b := newTestBus(t)
+		tx := b.connect("tx", &Config{})
+		rx := b.connect("rx", &Config{})
+
+		// The bit in the control field is flipped on the bus, so all units see it
+		const errorIndex = 16
+		b.fault = flipBit(b, "tx", errorIndex)
+		b.send("tx", frame)
+		b.runUntil(500, func() bool {
+			return b.state(tx) == StateErrorFlag
+		})
+		errorBit := b.written["tx"][0] + errorIndex
+		require.Equal(t, errorBit, b.bits-1)
+		tec, _ := errorCounters(tx)
+		assert.Equal(t, transmitErrorCounterDelta, tec)
+
+		b.runUntil(100, func() bool {
+			return b.state(tx) == StateWaitForBusIdle
+		})
+		assert.Equal(t, StateIdle, b.state(rx))
+
+		// Error flag of the transmitter, the receiver detects the stuff error at its end and adds its own flag,
+		// then the error delimiter
+		flagEnd := errorBit + 1
+		for b.levels[flagEnd].IsDominant() {
+			flagEnd++
+		}
+		assert.Equal(t, 2*codec.ProtocolErrorFlagSize, flagEnd-errorBit-1)
+		assert.True(t, b.levels[flagEnd:].AllBitsAre(codec.ProtocolRecessiveBit))
+		assert.Equal(t, flagEnd+codec.ProtocolErrorDelimiterSize-1, b.bits-1, "the transmitter waits for bus idle after the delimiter")
+		_, rec := errorCounters(rx)
+		assert.Equal(t, 1, rec)
+
+		// The frame is retransmitted
+		b.runUntilIdle(500)
+		assert.Equal(t, []string{"0x123 complete"}, b.statuses["tx"])
+		assert.Equal(t, []*codec.Frame{frame}, b.receivedFrames("rx"))
+		tec, _ = errorCounters(tx)
+		_, rec = errorCounters(rx)
+		assert.Equal(t, transmitErrorCounterDelta-1, tec)
+		assert.Zero(t, rec)
+	})
+
+	tests := []struct {
+		name       string
+		errorIndex func(t *testing.T) int
+		wantError  string
+	}{
+		{
+			name: "stuff error",
+			errorIndex: func(t *testing.T) int {
+				// The first stuff bit after the arbitration field
+				return stuffBitIndex(t, frame, codec.ProtocolSOFSize+codec.ArbitrationFieldSize(false)+1)
+			},
+		},
+		{
+			name: "CRC error",
+			errorIndex: func(t *testing.T) int {
+				// The data bit in the middle of 0x55 (does not break stuffing)
+				return newTxQueueItem(frame).AckSlotIndex - codec.ProtocolCRCDelimiterSize - codec.ProtocolCRCSize - 12
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name+" of the receiver", func(t *testing.T) {
+			b := newTestBus(t)
+			tx := b.connect("tx", &Config{})
+			rx := b.connect("rx", &Config{})
+			b.connect("other", &Config{})
+
+			// Only the receiver sees the corrupted bit
+			b.fault = flipBit(b, "tx", tt.errorIndex(t), "rx")
+			b.send("tx", frame)
+			b.runUntil(500, func() bool {
+				return b.state(rx) == StateErrorFlag
+			})
+			tec, _ := errorCounters(tx)
+			_, rec := errorCounters(rx)
+			assert.Zero(t, tec)
+			assert.Equal(t, 1, rec)
+
+			// The transmitter sees the error flag of the receiver, its own flag follows the flag of the receiver,
+			// so the receiver sees a dominant bit after its flag: it is the one which is faulty
+			b.runUntil(100, func() bool {
+				return b.state(rx) == StateIdle
+			})
+			tec, _ = errorCounters(tx)
+			_, rec = errorCounters(rx)
+			assert.Equal(t, transmitErrorCounterDelta, tec)
+			assert.Equal(t, 1+primaryErrorCounterDelta, rec)
+			_, rec = errorCounters(b.nodes["other"])
+			assert.Equal(t, 1, rec)
+
+			b.runUntilIdle(500)
+			assert.Equal(t, []string{"0x123 complete"}, b.statuses["tx"])
+			assert.Equal(t, []*codec.Frame{frame}, b.receivedFrames("rx"))
+			assert.Equal(t, []*codec.Frame{frame}, b.receivedFrames("other"))
+		})
+	}
+
+	t.Run("error-passive transmitter suspends transmission", func(t *testing.T) {
+		b := newTestBus(t)
+		tx := b.connect("tx", &Config{})
+
+		// Nobody acknowledges the frame
+		b.send("tx", frame)
+		b.runUntil(5000, func() bool {
+			return faultState(tx) == FaultStateErrorPassive
+		})
+		tec, _ := errorCounters(tx)
+		assert.Equal(t, 128, tec)
+		attempts := len(startOfFrameBits(b.levels.WithBits(b.level)))
+		assert.Equal(t, 128/transmitErrorCounterDelta, attempts)
+
+		b.run(1000)
+		tec, _ = errorCounters(tx)
+		assert.Equal(t, 128, tec, "ACK errors of error-passive transmitter are not counted")
+
+		// Passive error flags do not disturb the bus, and the transmitter waits longer before the next attempt
+		sofs := startOfFrameBits(b.levels)
+		require.Greater(t, len(sofs), attempts+2)
+		activePeriod := sofs[1] - sofs[0]
+		passivePeriod := sofs[attempts+1] - sofs[attempts]
+		assert.Equal(t, codec.ProtocolSuspendTransmissionSize, passivePeriod-activePeriod)
+		ackSlot := sofs[attempts] + newTxQueueItem(frame).AckSlotIndex
+		assert.True(t, b.levels[ackSlot:sofs[attempts+1]].AllBitsAre(codec.ProtocolRecessiveBit))
+	})
+
+	t.Run("bus-off and recovery", func(t *testing.T) {
+		b := newTestBus(t)
+		tx := b.connect("tx", &Config{})
+		b.connect("rx", &Config{})
+		setErrorCounters(tx, 248, 0)
+
+		b.fault = flipBit(b, "tx", 16)
+		b.send("tx", frame)
+		b.runUntil(500, func() bool {
+			return b.state(tx) == StateBusOff
+		})
+		busOffBit := b.bits - 1
+		tec, _ := errorCounters(tx)
+		assert.Equal(t, 256, tec)
+		assert.Equal(t, FaultStateBusOff, faultState(tx))
+		assert.Equal(t, []uint32{0x123}, queuedIDs(tx), "the frame waits for recovery")
+
+		// Dominant bit seen by the controller in bus-off restarts the current recovery sequence
+		dominantBit := busOffBit + 105
+		b.fault = func(unit string, bit int, level codec.Bit) codec.Bit {
+			if unit == "tx" && bit == dominantBit {
+				return codec.ProtocolDominantBit
+			}
+			return level
+		}
+		written := len(b.written["tx"])
+		b.run(dominantBit - busOffBit - 1)
+		sequences := tx.State().Get(stateKeyBusOffRecoverySequences).(int)
+		assert.Positive(t, sequences)
+		assert.Positive(t, tx.State().Get(stateKeyConsecutiveRecessiveBitsObserved))
+
+		b.step()
+		assert.Equal(t, sequences, tx.State().Get(stateKeyBusOffRecoverySequences))
+		assert.Zero(t, tx.State().Get(stateKeyConsecutiveRecessiveBitsObserved))
+
+		b.runUntil(2000, func() bool {
+			return b.state(tx) != StateBusOff
+		})
+		assert.Equal(t, written, len(b.written["tx"]), "bus-off controller does not drive the bus")
+		recoveryBits := (codec.ProtocolBusOffRecoverySequences - sequences) * codec.ProtocolBusOffRecoverySequenceSize
+		assert.Equal(t, dominantBit+recoveryBits, b.bits-1)
+		tec, rec := errorCounters(tx)
+		assert.Zero(t, tec)
+		assert.Zero(t, rec)
+		assert.Equal(t, FaultStateErrorActive, faultState(tx))
+
+		b.runUntilIdle(500)
+		assert.Equal(t, []string{"0x123 complete"}, b.statuses["tx"])
+	})
+}
@@ -0,0 +1,55 @@
+package controller
+
+import (
+	"slices"
+
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/codec"
+)
+
+// FilterMode defines how the acceptance filter bank matches IDs
+type FilterMode byte
+
+const (
+	FilterModeMask FilterMode = iota // ID matches if the bits selected by the mask are equal to the filter ID
+	FilterModeList                   // ID matches if it is one of the listed IDs
+)
+
+// FilterBank is the hardware acceptance filter: frames not matched by any bank never reach MCU
+// (they are still received and acknowledged, as the acknowledgement only confirms the frame is correct)
+type FilterBank struct {
+	Mode     FilterMode
+	Extended bool     // Standard and extended IDs are different ID spaces, so each bank matches only one of them
+	Id       uint32   // Filter ID (mask mode)
+	Mask     uint32   // Bits of ID to compare, zero bits are "don't care" (mask mode)
+	Ids      []uint32 // Accepted IDs (list mode)
+	FIFO     int      // Receive FIFO of the accepted frames (MCU may handle FIFOs with different priority)
+}
+
+// Matches reports whether the bank accepts the frame
+func (bank *FilterBank) Matches(frame *codec.Frame) bool {
+	if bank.Extended != frame.Extended {
+		return false
+	}
+
+	switch bank.Mode {
+	case FilterModeMask:
+		return frame.Id&bank.Mask == bank.Id&bank.Mask
+	case FilterModeList:
+		return slices.Contains(bank.Ids, frame.Id)
+	default:
+		return false
+	}
+}
+
+// acceptanceFilterIndex returns the index of the first bank accepting the frame (-1 if rejected).
+// Without configured banks all frames are accepted
+func acceptanceFilterIndex(config *Config, frame *codec.Frame) (int, bool) {
+	if len(config.Filters) == 0 {
+		return -1, true
+	}
+
+	index := slices.IndexFunc(config.Filters, func(bank FilterBank) bool {
+		return bank.Matches(frame)
+	})
+	return index, index >= 0
+}
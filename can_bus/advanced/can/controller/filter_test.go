@@ -0,0 +1,150 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/codec"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterBankMatches(t *testing.T) {
+	tests := []struct {
+		name  string
+		bank  FilterBank
+		frame *codec.Frame
+		want  bool
+	}{
+		{
+			name:  "mask mode: exact match",
+			bank:  FilterBank{Mode: FilterModeMask, Id: 0x7E8, Mask: 0x7FF},
+			frame: &codec.Frame{Id: 0x7E8},
+			want:  true,
+		},
+		{
+			name:  "mask mode: don't care bits",
+			bank:  FilterBank{Mode: FilterModeMask, Id: 0x7E8, Mask: 0x7F8},
+			frame: &codec.Frame{Id: 0x7EF},
+			want:  true,
+		},
+		{
+			name:  "mask mode: compared bit differs",
+			bank:  FilterBank{Mode: FilterModeMask, Id: 0x7E8, Mask: 0x7F8},
+			frame: &codec.Frame{Id: 0x7DF},
+			want:  false,
+		},
+		{
+			name:  "mask mode: zero mask accepts all standard frames",
+			bank:  FilterBank{Mode: FilterModeMask},
+			frame: &codec.Frame{Id: 0x123},
+			want:  true,
+		},
+		{
+			name:  "list mode: listed ID",
+			bank:  FilterBank{Mode: FilterModeList, Ids: []uint32{0x100, 0x7DF}},
+			frame: &codec.Frame{Id: 0x7DF},
+			want:  true,
+		},
+		{
+			name:  "list mode: not listed ID",
+			bank:  FilterBank{Mode: FilterModeList, Ids: []uint32{0x100, 0x7DF}},
+			frame: &codec.Frame{Id: 0x101},
+			want:  false,
+		},
+		{
+			name:  "list mode: empty list",
+			bank:  FilterBank{Mode: FilterModeList},
+			frame: &codec.Frame{Id: 0x0},
+			want:  false,
+		},
+		{
+			name:  "standard bank rejects extended frame with the same ID",
+			bank:  FilterBank{Mode: FilterModeMask, Mask: 0},
+			frame: &codec.Frame{Id: 0x7E8, Extended: true},
+			want:  false,
+		},
+		{
+			name:  "extended bank rejects standard frame with the same ID",
+			bank:  FilterBank{Mode: FilterModeList, Extended: true, Ids: []uint32{0x7E8}},
+			frame: &codec.Frame{Id: 0x7E8},
+			want:  false,
+		},
+		{
+			name:  "extended bank: mask mode",
+			bank:  FilterBank{Mode: FilterModeMask, Extended: true, Id: 0x18DAF100, Mask: 0x1FFFFF00},
+			frame: &codec.Frame{Id: 0x18DAF110, Extended: true},
+			want:  true,
+		},
+		{
+			name:  "unknown mode",
+			bank:  FilterBank{Mode: FilterModeList + 1},
+			frame: &codec.Frame{Id: 0x7E8},
+			want:  false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.bank.Matches(tt.frame))
+		})
+	}
+}
+
+func TestAcceptanceFilterIndex(t *testing.T) {
+	config := &Config{
+		Filters: []FilterBank{
+			{Mode: FilterModeList, Ids: []uint32{0x7DF}, FIFO: 0},
+			{Mode: FilterModeMask, Id: 0x7E0, Mask: 0x7F0, FIFO: 1},
+			{Mode: FilterModeMask, Extended: true, Mask: 0, FIFO: 1},
+		},
+	}
+
+	tests := []struct {
+		name         string
+		config       *Config
+		frame        *codec.Frame
+		wantIndex    int
+		wantAccepted bool
+	}{
+		{
+			name:         "no banks accept all frames",
+			config:       &Config{},
+			frame:        &codec.Frame{Id: 0x123},
+			wantIndex:    -1,
+			wantAccepted: true,
+		},
+		{
+			name:         "first bank",
+			config:       config,
+			frame:        &codec.Frame{Id: 0x7DF},
+			wantIndex:    0,
+			wantAccepted: true,
+		},
+		{
+			name:         "second bank",
+			config:       config,
+			frame:        &codec.Frame{Id: 0x7E8},
+			wantIndex:    1,
+			wantAccepted: true,
+		},
+		{
+			name:         "extended frames go to the extended bank",
+			config:       config,
+			frame:        &codec.Frame{Id: 0x7DF, Extended: true},
+			wantIndex:    2,
+			wantAccepted: true,
+		},
+		{
+			name:         "rejected",
+			config:       config,
+			frame:        &codec.Frame{Id: 0x123},
+			wantIndex:    -1,
+			wantAccepted: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			index, accepted := acceptanceFilterIndex(tt.config, tt.frame)
+			assert.Equal(t, tt.wantIndex, index)
+			assert.Equal(t, tt.wantAccepted, accepted)
+		})
+	}
+}
@@ -16,6 +16,9 @@ const (
 	StateArbitration
 	StateTransmit
 	StateReceive
+	StateErrorFlag
+	StateErrorDelimiter
+	StateBusOff
 )
 
 var (
@@ -25,6 +28,9 @@ var (
 		"ARBITRATION",
 		"TRANSMIT",
 		"RECEIVE",
+		"ERROR FLAG",
+		"ERROR DELIMITER",
+		"BUS OFF",
 	}
 )
 
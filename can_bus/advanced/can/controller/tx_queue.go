@@ -1,10 +1,112 @@
 package controller
 
-import "github.com/hovsep/fmesh-examples/can_bus/advanced/can/codec"
+import (
+	"fmt"
+
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/codec"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/common"
+	"github.com/hovsep/fmesh/signal"
+)
 
 type TxQueueItem struct {
-	Buf *codec.BitBuffer // Binary encoded frame, wih SOF, EOF, IFS and 1 extra bit
+	Frame                *codec.Frame     // The frame being transmitted (a copy of the one received from MCU)
+	Buf                  *codec.BitBuffer // Binary encoded frame, wih SOF, EOF, IFS and 1 extra bit
+	AckSlotIndex         int              // Position of the ACK slot in Buf (the bus must be dominant there)
+	ArbitrationFieldSize int              // Unstuffed bits after SOF to win before the transmission is exclusive
+	DataPhaseStart       int              // Position of the first bit in Buf transmitted with the data bit time (FD frames with BRS)
+	DataPhaseEnd         int              // Position of the first bit in Buf transmitted with the nominal bit time again
+	AbortRequested       bool             // MCU aborted the frame while it was on the bus (it is dropped unless the transmission succeeds)
 }
 
-// TxQueue represents the queue of frames to be transmitted
+// TxQueue represents the transmit mailboxes: frames pending transmission.
+// The first item is the one selected for arbitration (it stays first until it is transmitted, lost or failed)
 type TxQueue []*TxQueueItem
+
+// TxResult is the outcome of the transmission reported to MCU
+type TxResult byte
+
+const (
+	TxResultComplete TxResult = iota // The frame is transmitted successfully
+	TxResultAborted                  // The frame is dropped without being transmitted
+)
+
+var txResultNames = []string{
+	"complete",
+	"aborted",
+}
+
+// TxStatus notifies MCU about the end of the transmission
+type TxStatus struct {
+	Frame  *codec.Frame
+	Result TxResult
+	Reason string // Why the frame is aborted
+}
+
+// TxAbortRequest asks the controller to abort pending transmissions of frames with the given ID
+// (only frames handed to the controller before the request are aborted)
+type TxAbortRequest struct {
+	Id       uint32
+	Extended bool
+}
+
+// newTxQueueItem encodes the frame to be transmitted
+func newTxQueueItem(frame *codec.Frame) *TxQueueItem {
+	frameBits := frame.ToBits()
+	dataPhaseStart, dataPhaseEnd := frame.DataPhase()
+
+	return &TxQueueItem{
+		Frame: frame,
+		// Add IFS and 1 extra recessive bit
+		Buf:                  codec.NewBitBuffer(frameBits.WithIFS().WithBits(codec.ProtocolRecessiveBit)),
+		AckSlotIndex:         frameBits.Len() - codec.ProtocolEOFSize - codec.ProtocolACKDelimiterSize - codec.ProtocolACKSlotSize,
+		ArbitrationFieldSize: codec.ArbitrationFieldSize(frame.Extended),
+		DataPhaseStart:       dataPhaseStart,
+		DataPhaseEnd:         dataPhaseEnd,
+	}
+}
+
+// nextBitSignal returns the next bit to write, bits of the data phase are labeled with the data bit time
+func (item *TxQueueItem) nextBitSignal() *signal.Signal {
+	bitSignal := signal.New(item.Buf.NextBit())
+	if item.Buf.Offset >= item.DataPhaseStart && item.Buf.Offset < item.DataPhaseEnd {
+		bitSignal.AddLabel(common.LabelBitTime, codec.ProtocolDataBitTime.String())
+	}
+	return bitSignal
+}
+
+// arbitrationField returns the unstuffed bits of the arbitration field (without SOF)
+func (item *TxQueueItem) arbitrationField() codec.Bits {
+	return item.Buf.Bits.WithoutStuffing(codec.ProtocolBitStuffingStep)[codec.ProtocolSOFSize : item.ArbitrationFieldSize+codec.ProtocolSOFSize]
+}
+
+// hasPriorityOver reports whether the item would win arbitration against the other one:
+// the first differing bit decides and the dominant one wins, so the lower ID goes first
+// (with the same base ID standard frames win over extended ones and data frames over remote ones)
+func (item *TxQueueItem) hasPriorityOver(other *TxQueueItem) bool {
+	bits, otherBits := item.arbitrationField(), other.arbitrationField()
+	for i := 0; i < min(bits.Len(), otherBits.Len()); i++ {
+		if bits[i] != otherBits[i] {
+			return bits[i].IsDominant()
+		}
+	}
+	return false
+}
+
+// matches reports whether the abort request is for the item
+func (req *TxAbortRequest) matches(item *TxQueueItem) bool {
+	return item.Frame.Id == req.Id && item.Frame.Extended == req.Extended
+}
+
+func (result TxResult) String() string {
+	if int(result) >= len(txResultNames) {
+		return "unknown"
+	}
+	return txResultNames[result]
+}
+
+func (status *TxStatus) String() string {
+	if status.Reason == "" {
+		return fmt.Sprintf("0x%03X %s", status.Frame.Id, status.Result)
+	}
+	return fmt.Sprintf("0x%03X %s: %s", status.Frame.Id, status.Result, status.Reason)
+}
@@ -0,0 +1,77 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/codec"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTxQueueItemHasPriorityOver(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame *codec.Frame
+		other *codec.Frame
+		want  bool
+	}{
+		{
+			name:  "lower ID wins",
+			frame: &codec.Frame{Id: 0x100, DLC: 1},
+			other: &codec.Frame{Id: 0x101, DLC: 1},
+			want:  true,
+		},
+		{
+			name:  "higher ID loses",
+			frame: &codec.Frame{Id: 0x7E8, DLC: 1},
+			other: &codec.Frame{Id: 0x7DF, DLC: 1},
+			want:  false,
+		},
+		{
+			name:  "standard frame wins over extended one with the same base ID",
+			frame: &codec.Frame{Id: 0x123, DLC: 1},
+			other: &codec.Frame{Id: 0x123 << 18, Extended: true, DLC: 1},
+			want:  true,
+		},
+		{
+			name:  "extended frame loses to standard one with the same base ID",
+			frame: &codec.Frame{Id: 0x123 << 18, Extended: true, DLC: 1},
+			other: &codec.Frame{Id: 0x123, DLC: 1},
+			want:  false,
+		},
+		{
+			name:  "extended frame with lower base ID wins",
+			frame: &codec.Frame{Id: 0x122<<18 | 0x3FFFF, Extended: true, DLC: 1},
+			other: &codec.Frame{Id: 0x123, DLC: 1},
+			want:  true,
+		},
+		{
+			name:  "data frame wins over remote one",
+			frame: &codec.Frame{Id: 0x123, DLC: 1},
+			other: &codec.Frame{Id: 0x123, Remote: true, DLC: 1},
+			want:  true,
+		},
+		{
+			name:  "remote frame loses to data one",
+			frame: &codec.Frame{Id: 0x123, Remote: true, DLC: 1},
+			other: &codec.Frame{Id: 0x123, DLC: 1},
+			want:  false,
+		},
+		{
+			name:  "same arbitration field",
+			frame: &codec.Frame{Id: 0x123, DLC: 1},
+			other: &codec.Frame{Id: 0x123, DLC: 8},
+			want:  false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, newTxQueueItem(tt.frame).hasPriorityOver(newTxQueueItem(tt.other)))
+		})
+	}
+}
+
+func TestTxResultString(t *testing.T) {
+	assert.Equal(t, "complete", TxResultComplete.String())
+	assert.Equal(t, "aborted", TxResultAborted.String())
+	assert.Equal(t, "unknown", TxResult(2).String())
+}
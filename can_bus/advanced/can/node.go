@@ -10,6 +10,7 @@ import (
 
 // The Node consists of multiple components
 type Node struct {
+	UnitName    string               // Name of the unit (transceivers label the voltages with it)
 	MCU         *component.Component // Main logic operates with ISO-TP messages
 	Controller  *component.Component // Converts frames to bits and vice versa
 	Transceiver *component.Component // Converts bits to voltages
@@ -18,19 +19,30 @@ type Node struct {
 // Nodes hold multiple nodes without any guarantees of order
 type Nodes []*Node
 
-// NewNode creates a new CAN node
+// NewNode creates a new CAN node with a classic CAN controller
 func NewNode(unitName string, mcuInitState func(state component.State), mcuActivationFunction component.ActivationFunc) *Node {
+	return newNode(unitName, controller.New(unitName), mcuInitState, mcuActivationFunction)
+}
+
+// NewNodeWithConfig creates a new CAN node with the controller configured by the given config (e.g., FD-capable)
+func NewNodeWithConfig(unitName string, ctlConfig *controller.Config, mcuInitState func(state component.State), mcuActivationFunction component.ActivationFunc) *Node {
+	return newNode(unitName, controller.NewWithConfig(unitName, ctlConfig), mcuInitState, mcuActivationFunction)
+}
+
+func newNode(unitName string, ctl *component.Component, mcuInitState func(state component.State), mcuActivationFunction component.ActivationFunc) *Node {
 	// Create electronic components
 	mcu := microcontroller.New(unitName, mcuInitState, mcuActivationFunction)
-	ctl := controller.New(unitName)
 	trsv := NewTransceiver(unitName)
 
 	// Wiring : mcu <--> controller <--> transceiver
 
 	// mcu -> controller:
 	mcu.OutputByName(common.PortCANTx).PipeTo(ctl.InputByName(common.PortCANTx))
+	mcu.OutputByName(common.PortCANTxAbort).PipeTo(ctl.InputByName(common.PortCANTxAbort))
 	// mcu <- controller
 	ctl.OutputByName(common.PortCANRx).PipeTo(mcu.InputByName(common.PortCANRx))
+	ctl.OutputByName(common.PortCANTxConfirm).PipeTo(mcu.InputByName(common.PortCANTxConfirm))
+	ctl.OutputByName(common.PortCANTxStatus).PipeTo(mcu.InputByName(common.PortCANTxStatus))
 
 	// controller -> transceiver
 	ctl.OutputByName(common.PortCANTx).PipeTo(trsv.InputByName(common.PortCANTx))
@@ -38,6 +50,7 @@ func NewNode(unitName string, mcuInitState func(state component.State), mcuActiv
 	trsv.OutputByName(common.PortCANRx).PipeTo(ctl.InputByName(common.PortCANRx))
 
 	return &Node{
+		UnitName:    unitName,
 		MCU:         mcu,
 		Controller:  ctl,
 		Transceiver: trsv,
@@ -56,15 +69,16 @@ func (nodes Nodes) GetAllComponents() []*component.Component {
 // ConnectToBus connect all nodes to the given bus
 func (nodes Nodes) ConnectToBus(b *bus.Bus) {
 	for _, node := range nodes {
-		// transceiver -> bus:
-		node.Transceiver.OutputByName(common.PortCANL).PipeTo(b.Wires.InputByName(common.PortCANL))
-		node.Transceiver.OutputByName(common.PortCANH).PipeTo(b.Wires.InputByName(common.PortCANH))
+		// transceiver -> bus (through the disturbance if any):
+		node.Transceiver.OutputByName(common.PortCANL).PipeTo(b.Input().InputByName(common.PortCANL))
+		node.Transceiver.OutputByName(common.PortCANH).PipeTo(b.Input().InputByName(common.PortCANH))
 
-		// transceiver <- bus:
-		b.Wires.OutputByName(common.PortCANL).PipeTo(node.Transceiver.InputByName(common.PortCANL))
-		b.Wires.OutputByName(common.PortCANH).PipeTo(node.Transceiver.InputByName(common.PortCANH))
+		// transceiver <- bus (voltages seen at the node position):
+		lowPort, highPort := b.Output(node.UnitName)
+		b.Wires.OutputByName(lowPort).PipeTo(node.Transceiver.InputByName(common.PortCANL))
+		b.Wires.OutputByName(highPort).PipeTo(node.Transceiver.InputByName(common.PortCANH))
 
-		// ctl -> bus watchdog
+		// ctl -> bus watchdog (listen-only controllers never report)
 		node.Controller.OutputByName(common.PortControllerState).PipeTo(b.Watchdog.InputByName(common.PortControllerState))
 
 	}
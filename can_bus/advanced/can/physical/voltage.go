@@ -10,11 +10,15 @@ const (
 	DominantLowVoltage  = Voltage(1.5)
 
 	RecessiveVoltage = Voltage(2.5)
+
+	// DominantDifferentialThreshold is the minimal CAN_H - CAN_L voltage read as dominant (ISO 11898-2 receiver),
+	// so the common mode offset does not change the bit
+	DominantDifferentialThreshold = Voltage(0.9)
 )
 
 // VoltageToBit converts voltages to bit
 func VoltageToBit(vLow, vHigh Voltage) codec.Bit {
-	if vLow == DominantLowVoltage && vHigh == DominantHighVoltage {
+	if vHigh-vLow >= DominantDifferentialThreshold {
 		return codec.ProtocolDominantBit
 	}
 
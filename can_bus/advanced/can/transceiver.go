@@ -19,7 +19,7 @@ func NewTransceiver(unitName string) *component.Component {
 		AddOutputs(common.PortCANRx, common.PortCANH, common.PortCANL). // Bits out (read from bus), voltage out (write to bus)
 		WithLogger(common.NewNoopLogger()).
 		WithActivationFunc(func(this *component.Component) error {
-			err := handleTxPath(this)
+			err := handleTxPath(this, unitName)
 			if err != nil {
 				return fmt.Errorf("failed to handle tx path: %w", err)
 			}
@@ -32,8 +32,8 @@ func NewTransceiver(unitName string) *component.Component {
 		})
 }
 
-// Write path: transceiver -> bus
-func handleTxPath(this *component.Component) error {
+// Write path: transceiver -> bus (voltages are labeled with the unit, so the bus knows who drives it)
+func handleTxPath(this *component.Component, unitName string) error {
 	return this.InputByName(common.PortCANTx).Signals().ForEach(func(sig *signal.Signal) error {
 		bit, ok := sig.PayloadOrNil().(codec.Bit)
 		if !ok {
@@ -48,8 +48,16 @@ func handleTxPath(this *component.Component) error {
 			resultingLVoltage, resultingHVoltage = physical.DominantLowVoltage, physical.DominantHighVoltage
 		}
 
-		this.OutputByName(common.PortCANL).PutSignals(signal.New(resultingLVoltage))
-		this.OutputByName(common.PortCANH).PutSignals(signal.New(resultingHVoltage))
+		lowSignal := signal.New(resultingLVoltage).AddLabel(common.LabelBusDrivers, unitName)
+		highSignal := signal.New(resultingHVoltage).AddLabel(common.LabelBusDrivers, unitName)
+		if bitTime := sig.Labels().ValueOrDefault(common.LabelBitTime, ""); bitTime != "" {
+			// The bit is shorter in the data phase of FD frames
+			lowSignal.AddLabel(common.LabelBitTime, bitTime)
+			highSignal.AddLabel(common.LabelBitTime, bitTime)
+		}
+
+		this.OutputByName(common.PortCANL).PutSignals(lowSignal)
+		this.OutputByName(common.PortCANH).PutSignals(highSignal)
 
 		this.Logger().Printf("convert bit: %s to voltages L:%v / H:%v", bit, resultingLVoltage, resultingHVoltage)
 		return nil
@@ -75,7 +83,19 @@ func handleRxPath(this *component.Component) error {
 
 		bitRead := physical.VoltageToBit(vLow.(physical.Voltage), vHigh.(physical.Voltage))
 		this.Logger().Printf("convert voltages L:%v / H:%v to bit: %s", vLow, vHigh, bitRead)
-		this.OutputByName(common.PortCANRx).PutSignals(signal.New(bitRead))
+
+		// Pass on who drives the dominant level (for bus monitoring) and the bit time
+		bitSignal := signal.New(bitRead)
+		this.InputByName(common.PortCANL).Signals().ForEach(func(sig *signal.Signal) error {
+			if drivers := sig.Labels().ValueOrDefault(common.LabelBusDrivers, ""); drivers != "" {
+				bitSignal.AddLabel(common.LabelBusDrivers, drivers)
+			}
+			if bitTime := sig.Labels().ValueOrDefault(common.LabelBitTime, ""); bitTime != "" {
+				bitSignal.AddLabel(common.LabelBitTime, bitTime)
+			}
+			return nil
+		})
+		this.OutputByName(common.PortCANRx).PutSignals(bitSignal)
 	}
 	return nil
 }
@@ -0,0 +1,246 @@
+package candump
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/codec"
+)
+
+// Entry is one line of SocketCAN log (candump -l), e.g.: (1436509052.249713) can0 7DF#02010C0000000000
+type Entry struct {
+	Timestamp time.Duration // Since Unix epoch (the simulation starts at the epoch)
+	Interface string
+	Frame     *codec.Frame
+}
+
+const (
+	// DefaultInterface is the name of the simulated bus in logs
+	DefaultInterface = "can0"
+
+	// Flags of FD frames (as in linux/can.h)
+	fdFlagBRS = 0x01
+	fdFlagESI = 0x02
+
+	errorFrameFlag = 0x20000000 // Error frames are logged with this bit set in the ID
+)
+
+// String returns the line in candump -l format
+func (entry *Entry) String() string {
+	frame := entry.Frame
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "(%010d.%06d) %s ", entry.Timestamp/time.Second, (entry.Timestamp%time.Second)/time.Microsecond, entry.Interface)
+
+	if frame.Extended {
+		fmt.Fprintf(&sb, "%08X", frame.Id)
+	} else {
+		fmt.Fprintf(&sb, "%03X", frame.Id)
+	}
+
+	switch {
+	case frame.FD:
+		flags := 0
+		if frame.BitRateSwitch {
+			flags |= fdFlagBRS
+		}
+		if frame.ErrorStateIndicator {
+			flags |= fdFlagESI
+		}
+		fmt.Fprintf(&sb, "##%X%X", flags, frame.Data[:frame.DataLength()])
+	case frame.Remote:
+		// The requested length is logged only if it is not zero
+		sb.WriteString("#R")
+		if frame.DLC > 0 {
+			fmt.Fprintf(&sb, "%X", frame.DLC)
+		}
+	default:
+		fmt.Fprintf(&sb, "#%X", frame.Data[:frame.DataLength()])
+	}
+
+	return sb.String()
+}
+
+// ParseEntry parses the line of candump -l log
+func ParseEntry(line string) (*Entry, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 3 {
+		return nil, fmt.Errorf("expected timestamp, interface and frame, got: %q", line)
+	}
+
+	timestamp, err := parseTimestamp(fields[0])
+	if err != nil {
+		return nil, err
+	}
+
+	frame, err := parseFrame(fields[2])
+	if err != nil {
+		return nil, err
+	}
+
+	return &Entry{
+		Timestamp: timestamp,
+		Interface: fields[1],
+		Frame:     frame,
+	}, nil
+}
+
+// ReadLog parses all lines of candump -l log (empty lines are skipped)
+func ReadLog(r io.Reader) ([]*Entry, error) {
+	var entries []*Entry
+	scanner := bufio.NewScanner(r)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		entry, err := ParseEntry(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// parseTimestamp parses "(seconds.microseconds)"
+func parseTimestamp(field string) (time.Duration, error) {
+	if !strings.HasPrefix(field, "(") || !strings.HasSuffix(field, ")") {
+		return 0, fmt.Errorf("invalid timestamp: %q", field)
+	}
+
+	seconds, fraction, ok := strings.Cut(field[1:len(field)-1], ".")
+	if !ok || len(fraction) != 6 {
+		return 0, fmt.Errorf("invalid timestamp: %q", field)
+	}
+
+	s, err := strconv.ParseInt(seconds, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timestamp seconds: %w", err)
+	}
+
+	us, err := strconv.ParseInt(fraction, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timestamp microseconds: %w", err)
+	}
+
+	return time.Duration(s)*time.Second + time.Duration(us)*time.Microsecond, nil
+}
+
+// parseFrame parses "ID#DATA", "ID#R[len]" or "ID##<flags>DATA"
+func parseFrame(field string) (*codec.Frame, error) {
+	idPart, dataPart, ok := strings.Cut(field, "#")
+	if !ok {
+		return nil, fmt.Errorf("missing '#' in frame: %q", field)
+	}
+
+	id, err := strconv.ParseUint(idPart, 16, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID: %w", err)
+	}
+
+	frame := &codec.Frame{
+		Id: uint32(id),
+	}
+
+	switch len(idPart) {
+	case 3:
+		if frame.Id > codec.ProtocolMaxID {
+			return nil, fmt.Errorf("standard ID 0x%X is out of range", frame.Id)
+		}
+	case 8:
+		if frame.Id&errorFrameFlag != 0 {
+			return nil, errors.New("error frames are not supported")
+		}
+		if frame.Id > codec.ProtocolMaxExtendedID {
+			return nil, fmt.Errorf("extended ID 0x%X is out of range", frame.Id)
+		}
+		frame.Extended = true
+	default:
+		return nil, fmt.Errorf("ID must have 3 or 8 hex digits, got: %q", idPart)
+	}
+
+	switch {
+	case strings.HasPrefix(dataPart, "#"):
+		err = parseFDData(frame, dataPart[1:])
+	case strings.HasPrefix(dataPart, "R"):
+		err = parseRemoteLength(frame, dataPart[1:])
+	default:
+		err = parseClassicData(frame, dataPart)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !frame.IsValid() {
+		return nil, fmt.Errorf("invalid frame: %q", field)
+	}
+	return frame, nil
+}
+
+func parseClassicData(frame *codec.Frame, dataPart string) error {
+	data, err := hex.DecodeString(dataPart)
+	if err != nil {
+		return fmt.Errorf("invalid data: %w", err)
+	}
+
+	if len(data) > codec.ProtocolMaxDataBytes {
+		return fmt.Errorf("classic frame carries up to %d bytes, got %d", codec.ProtocolMaxDataBytes, len(data))
+	}
+
+	frame.DLC = uint8(len(data))
+	copy(frame.Data[:], data)
+	return nil
+}
+
+func parseRemoteLength(frame *codec.Frame, lengthPart string) error {
+	frame.Remote = true
+	if lengthPart == "" {
+		return nil
+	}
+
+	length, err := strconv.ParseUint(lengthPart, 16, 8)
+	if err != nil || length > codec.ProtocolMaxDataBytes {
+		return fmt.Errorf("invalid length of remote frame: %q", lengthPart)
+	}
+	frame.DLC = uint8(length)
+	return nil
+}
+
+func parseFDData(frame *codec.Frame, dataPart string) error {
+	if dataPart == "" {
+		return errors.New("missing flags of FD frame")
+	}
+
+	flags, err := strconv.ParseUint(dataPart[:1], 16, 8)
+	if err != nil {
+		return fmt.Errorf("invalid flags of FD frame: %w", err)
+	}
+
+	data, err := hex.DecodeString(dataPart[1:])
+	if err != nil {
+		return fmt.Errorf("invalid data: %w", err)
+	}
+
+	dlc, err := codec.FDDLC(len(data))
+	if err != nil {
+		return err
+	}
+	if codec.FDDataLength(int(dlc)) != len(data) {
+		return fmt.Errorf("%d bytes is not a valid length of FD frame", len(data))
+	}
+
+	frame.FD = true
+	frame.BitRateSwitch = flags&fdFlagBRS != 0
+	frame.ErrorStateIndicator = flags&fdFlagESI != 0
+	frame.DLC = dlc
+	copy(frame.Data[:], data)
+	return nil
+}
@@ -0,0 +1,120 @@
+package candump
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/codec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEntryRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		line  string
+		entry *Entry
+	}{
+		{
+			name: "standard data frame",
+			line: "(1436509052.249713) can0 7DF#02010C0000000000",
+			entry: &Entry{
+				Timestamp: 1436509052*time.Second + 249713*time.Microsecond,
+				Interface: "can0",
+				Frame:     &codec.Frame{Id: 0x7DF, DLC: 8, Data: [codec.ProtocolMaxFDDataBytes]byte{0x02, 0x01, 0x0C}},
+			},
+		},
+		{
+			name: "empty data frame",
+			line: "(0000000000.000268) vcan0 123#",
+			entry: &Entry{
+				Timestamp: 268 * time.Microsecond,
+				Interface: "vcan0",
+				Frame:     &codec.Frame{Id: 0x123},
+			},
+		},
+		{
+			name: "extended frame",
+			line: "(0000000001.000000) can0 18DAF110#0201",
+			entry: &Entry{
+				Timestamp: time.Second,
+				Interface: "can0",
+				Frame:     &codec.Frame{Id: 0x18DAF110, Extended: true, DLC: 2, Data: [codec.ProtocolMaxFDDataBytes]byte{0x02, 0x01}},
+			},
+		},
+		{
+			name: "remote frame with length",
+			line: "(0000000000.003002) can0 3E0#R1",
+			entry: &Entry{
+				Timestamp: 3002 * time.Microsecond,
+				Interface: "can0",
+				Frame:     &codec.Frame{Id: 0x3E0, Remote: true, DLC: 1},
+			},
+		},
+		{
+			name: "remote frame without length",
+			line: "(0000000000.003002) can0 3E0#R",
+			entry: &Entry{
+				Timestamp: 3002 * time.Microsecond,
+				Interface: "can0",
+				Frame:     &codec.Frame{Id: 0x3E0, Remote: true},
+			},
+		},
+		{
+			name: "FD frame with bit rate switch",
+			line: "(0000000000.000100) can0 7E8##1" + strings.Repeat("AB", 12),
+			entry: &Entry{
+				Timestamp: 100 * time.Microsecond,
+				Interface: "can0",
+				Frame: &codec.Frame{Id: 0x7E8, FD: true, BitRateSwitch: true, DLC: 9, Data: [codec.ProtocolMaxFDDataBytes]byte{
+					0xAB, 0xAB, 0xAB, 0xAB, 0xAB, 0xAB, 0xAB, 0xAB, 0xAB, 0xAB, 0xAB, 0xAB,
+				}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry, err := ParseEntry(tt.line)
+			require.NoError(t, err)
+			assert.Equal(t, tt.entry, entry)
+			assert.Equal(t, tt.line, entry.String())
+		})
+	}
+}
+
+func TestParseEntryErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+	}{
+		{name: "missing frame", line: "(0000000000.000100) can0"},
+		{name: "invalid timestamp", line: "0000000000.000100 can0 123#00"},
+		{name: "missing separator", line: "(0000000000.000100) can0 12300"},
+		{name: "standard ID out of range", line: "(0000000000.000100) can0 800#00"},
+		{name: "ID of unexpected length", line: "(0000000000.000100) can0 1234#00"},
+		{name: "error frame", line: "(0000000000.000100) can0 20000080#0000000000000000"},
+		{name: "classic frame too long", line: "(0000000000.000100) can0 123#000000000000000000"},
+		{name: "odd number of data digits", line: "(0000000000.000100) can0 123#001"},
+		{name: "invalid FD length", line: "(0000000000.000100) can0 123##0" + strings.Repeat("00", 9)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseEntry(tt.line)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestReadLog(t *testing.T) {
+	log := "(0000000000.000268) can0 7E0#0203000000000000\n\n(0000000000.000522) can0 7E8#10084303010C0300\n"
+	entries, err := ReadLog(strings.NewReader(log))
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, uint32(0x7E8), entries[1].Frame.Id)
+
+	_, err = ReadLog(strings.NewReader("(0000000000.000268) can0 7E0#02\nbroken line\n"))
+	assert.ErrorContains(t, err, "line 2")
+}
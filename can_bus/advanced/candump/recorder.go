@@ -0,0 +1,59 @@
+package candump
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/codec"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/common"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/controller"
+	"github.com/hovsep/fmesh/component"
+	"github.com/hovsep/fmesh/signal"
+)
+
+const (
+	RecorderUnitName = "candump"
+	ReplayUnitName   = "canplayer"
+
+	// DumpLogEnv is the environment variable with the path of the log to record the bus traffic to
+	DumpLogEnv = "CAN_DUMP_LOG"
+
+	// ReplayLogEnv is the environment variable with the path of the log to replay into the bus
+	ReplayLogEnv = "CAN_REPLAY_LOG"
+)
+
+// NewRecorderNode creates a CAN node which writes every frame observed on the bus to the log,
+// like a real interface it acknowledges frames, but never transmits
+func NewRecorderNode(iface string, log io.Writer) *can.Node {
+	// FD-capable, so FD frames are recorded too
+	return can.NewNodeWithConfig(RecorderUnitName, &controller.Config{FD: true}, func(state component.State) {
+	}, func(this *component.Component) error {
+		return this.InputByName(common.PortCANRx).Signals().ForEach(func(sig *signal.Signal) error {
+			frame, ok := sig.PayloadOrNil().(*codec.Frame)
+			if !ok {
+				return errors.New("failed to cast payload to CAN frame")
+			}
+
+			// The bus clock stops together with the bus when all controllers are idle, so idle gaps are not counted
+			busTime, err := time.ParseDuration(sig.Labels().ValueOrDefault(common.LabelBusTime, "0s"))
+			if err != nil {
+				return fmt.Errorf("invalid time of reception: %w", err)
+			}
+
+			entry := &Entry{
+				Timestamp: busTime,
+				Interface: iface,
+				Frame:     frame,
+			}
+
+			_, err = fmt.Fprintln(log, entry)
+			if err != nil {
+				return fmt.Errorf("failed to write log: %w", err)
+			}
+			return nil
+		}).ChainableErr()
+	})
+}
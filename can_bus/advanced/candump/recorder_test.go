@@ -0,0 +1,76 @@
+package candump
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/hovsep/fmesh"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/bus"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/codec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordReplayed replays the entries into the bus and returns the entries recorded by another node
+func recordReplayed(t *testing.T, entries ...*Entry) []*Entry {
+	log := &bytes.Buffer{}
+	nodes := can.Nodes{
+		NewReplayNode(entries),
+		NewRecorderNode(DefaultInterface, log),
+	}
+
+	b := bus.New("test-bus")
+	nodes.ConnectToBus(b)
+
+	_, err := fmesh.New("candump_test").
+		AddComponents(b.GetAllComponents()...).
+		AddComponents(nodes.GetAllComponents()...).
+		Run()
+	require.NoError(t, err)
+
+	recorded, err := ReadLog(log)
+	require.NoError(t, err)
+	return recorded
+}
+
+func TestRecorderNode(t *testing.T) {
+	t.Run("frames are recorded in order with the bus time", func(t *testing.T) {
+		first := &codec.Frame{Id: 0x7E0, DLC: 8, Data: [codec.ProtocolMaxFDDataBytes]byte{0x02, 0x01, 0x0C}}
+		second := &codec.Frame{Id: 0x7E8, DLC: 2, Data: [codec.ProtocolMaxFDDataBytes]byte{0x41, 0x0C}}
+
+		recorded := recordReplayed(t,
+			&Entry{Timestamp: 0, Interface: "can0", Frame: first},
+			&Entry{Timestamp: time.Millisecond, Interface: "can0", Frame: second},
+		)
+
+		require.Len(t, recorded, 2)
+		assert.Equal(t, DefaultInterface, recorded[0].Interface)
+		assert.Equal(t, first, recorded[0].Frame)
+		assert.Equal(t, second, recorded[1].Frame)
+
+		// Frames are recorded after EOF, the bus is stopped between them, so the gap is not counted
+		assert.GreaterOrEqual(t, recorded[0].Timestamp, first.Duration())
+		assert.GreaterOrEqual(t, recorded[1].Timestamp-recorded[0].Timestamp, second.Duration())
+		assert.Less(t, recorded[1].Timestamp-recorded[0].Timestamp, time.Millisecond)
+	})
+
+	t.Run("data phase of FD frames with bit rate switch takes the data bit time", func(t *testing.T) {
+		frame := &codec.Frame{Id: 0x123, FD: true, DLC: 15}
+		for i := range frame.Data {
+			frame.Data[i] = 0xAA
+		}
+		withBRS := *frame
+		withBRS.BitRateSwitch = true
+
+		nominal := recordReplayed(t, &Entry{Interface: "can0", Frame: frame})
+		fast := recordReplayed(t, &Entry{Interface: "can0", Frame: &withBRS})
+		require.Len(t, nominal, 1)
+		require.Len(t, fast, 1)
+
+		// Timestamps of candump logs are in microseconds
+		assert.Equal(t, (nominal[0].Timestamp - (frame.Duration() - withBRS.Duration())).Truncate(time.Microsecond), fast[0].Timestamp)
+		assert.Equal(t, &withBRS, fast[0].Frame)
+	})
+}
@@ -0,0 +1,64 @@
+package candump
+
+import (
+	"slices"
+
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/common"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/controller"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/microcontroller"
+	"github.com/hovsep/fmesh/component"
+	"github.com/hovsep/fmesh/signal"
+)
+
+const (
+	stateKeyNextEntry = "next_entry"
+	stateKeyStartTick = "start_tick"
+)
+
+// NewReplayNode creates a CAN node which transmits the logged frames keeping the intervals between them
+// (the first frame is sent immediately), frames wait in the controller while the bus is busy.
+// The intervals are counted in MCU time, which matches the bus time of the log only on the bus without disturbance
+func NewReplayNode(entries []*Entry) *can.Node {
+	// FD-capable only if needed, so the node behaves as the logged interface
+	hasFDFrames := slices.ContainsFunc(entries, func(entry *Entry) bool {
+		return entry.Frame.FD
+	})
+
+	node := can.NewNodeWithConfig(ReplayUnitName, &controller.Config{FD: hasFDFrames}, func(state component.State) {
+		state.Set(stateKeyNextEntry, 0)
+		state.Set(stateKeyStartTick, 0)
+	}, func(this *component.Component) error {
+		next := this.State().Get(stateKeyNextEntry).(int)
+		if next >= len(entries) {
+			return nil
+		}
+
+		now := microcontroller.CurrentTick(this)
+		if next == 0 {
+			this.State().Set(stateKeyStartTick, now)
+		}
+		startTick := this.State().Get(stateKeyStartTick).(int)
+
+		for ; next < len(entries); next++ {
+			dueTick := startTick + microcontroller.DurationToTicks(entries[next].Timestamp-entries[0].Timestamp)
+			if now < dueTick {
+				break
+			}
+
+			this.Logger().Printf("replaying: %s", entries[next])
+			this.OutputByName(common.PortCANTx).PutSignals(signal.New(entries[next].Frame))
+		}
+		this.State().Set(stateKeyNextEntry, next)
+
+		if next < len(entries) {
+			microcontroller.KeepTicking(this)
+		}
+		return nil
+	})
+
+	// Power on: the first activation starts the replay
+	node.MCU.InputByName(common.PortSelfActivation).PutSignals(signal.New(true))
+
+	return node
+}
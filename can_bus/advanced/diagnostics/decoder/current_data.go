@@ -0,0 +1,68 @@
+package decoder
+
+import (
+	"fmt"
+
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/microcontroller"
+)
+
+// currentDataParam describes how to decode the parameter of service 0x01
+type currentDataParam struct {
+	name   string
+	unit   string
+	length int // Number of data bytes (A, B, ...)
+	decode func(data []byte) any
+}
+
+// Standard PIDs of service 0x01 (SAE J1979)
+var currentDataParams = map[microcontroller.ParameterID]currentDataParam{
+	0x04: {name: "Calculated engine load", unit: "%", length: 1, decode: func(data []byte) any { return DecodePercentage(data[0]) }},
+	0x05: {name: "Engine coolant temperature", unit: "°C", length: 1, decode: func(data []byte) any { return DecodeTemperature(data[0]) }},
+	0x0B: {name: "Intake manifold absolute pressure", unit: "kPa", length: 1, decode: func(data []byte) any { return int(data[0]) }},
+	0x0C: {name: "Engine speed", unit: "rpm", length: 2, decode: func(data []byte) any { return DecodeRPM(data[0], data[1]) }},
+	0x0D: {name: "Vehicle speed", unit: "km/h", length: 1, decode: func(data []byte) any { return int(data[0]) }},
+	0x0F: {name: "Intake air temperature", unit: "°C", length: 1, decode: func(data []byte) any { return DecodeTemperature(data[0]) }},
+	0x11: {name: "Throttle position", unit: "%", length: 1, decode: func(data []byte) any { return DecodePercentage(data[0]) }},
+	0x2F: {name: "Fuel tank level input", unit: "%", length: 1, decode: func(data []byte) any { return DecodePercentage(data[0]) }},
+	0x46: {name: "Ambient air temperature", unit: "°C", length: 1, decode: func(data []byte) any { return DecodeTemperature(data[0]) }},
+	0x5C: {name: "Engine oil temperature", unit: "°C", length: 1, decode: func(data []byte) any { return DecodeTemperature(data[0]) }},
+}
+
+// DecodeCurrentData decodes the parameter of service 0x01, unknown (manufacturer specific) parameters keep raw bytes only
+func DecodeCurrentData(pid microcontroller.ParameterID, data []byte) (*Response, error) {
+	resp := &Response{
+		Service: microcontroller.ServiceShowCurrentData,
+		PID:     pid,
+		Raw:     data,
+	}
+
+	param, ok := currentDataParams[pid]
+	if !ok {
+		resp.Name = fmt.Sprintf("PID 0x%02X", pid)
+		return resp, nil
+	}
+
+	if len(data) < param.length {
+		return nil, fmt.Errorf("%s: expected %d data bytes, got %d", param.name, param.length, len(data))
+	}
+
+	resp.Name = param.name
+	resp.Unit = param.unit
+	resp.Value = param.decode(data)
+	return resp, nil
+}
+
+// DecodeRPM decodes engine speed: (A*256+B)/4
+func DecodeRPM(a, b byte) float64 {
+	return float64(int(a)*256+int(b)) / 4
+}
+
+// DecodeTemperature decodes temperatures with -40°C offset: A-40
+func DecodeTemperature(a byte) int {
+	return int(a) - 40
+}
+
+// DecodePercentage decodes percentages: A*100/255
+func DecodePercentage(a byte) float64 {
+	return float64(a) * 100 / 255
+}
@@ -0,0 +1,91 @@
+package decoder
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/microcontroller"
+)
+
+// Response is the decoded OBD-II response (the reassembled ISO-TP payload)
+type Response struct {
+	Service microcontroller.ServiceID   // Service of the request (response service ID minus 0x40)
+	PID     microcontroller.ParameterID // Parameter ID (service 0x03 has none)
+	Name    string                      // Human-readable name of the parameter
+	Value   any                         // Decoded value: number, string or []DTC
+	Unit    string                      // Unit of numeric values
+	Raw     []byte                      // Data bytes the value is decoded from
+}
+
+// ErrNotOBDResponse is returned for payloads of other protocols (e.g., UDS responses)
+var ErrNotOBDResponse = errors.New("not an OBD-II response")
+
+// Decode decodes the response of service 0x01, 0x03 or 0x09
+func Decode(payload []byte) (*Response, error) {
+	if len(payload) == 0 {
+		return nil, errors.New("empty payload")
+	}
+
+	responseSID := microcontroller.ServiceID(payload[0])
+	if responseSID != microcontroller.ResponseShowCurrentData &&
+		responseSID != microcontroller.ResponseReadStoredDiagnosticCodes &&
+		responseSID != microcontroller.ResponseVehicleInformation {
+		return nil, fmt.Errorf("%w: service ID 0x%02X", ErrNotOBDResponse, responseSID)
+	}
+
+	if len(payload) < 2 {
+		return nil, fmt.Errorf("payload too short to contain service and PID, length: %d", len(payload))
+	}
+
+	pid := microcontroller.ParameterID(payload[1])
+	data := payload[2:]
+
+	switch responseSID {
+	case microcontroller.ResponseShowCurrentData:
+		return DecodeCurrentData(pid, data)
+	case microcontroller.ResponseReadStoredDiagnosticCodes:
+		// The number of DTCs takes the place of PID
+		dtcs, err := DecodeDTCs(int(pid), data)
+		if err != nil {
+			return nil, err
+		}
+		return &Response{
+			Service: microcontroller.ServiceReadStoredDiagnosticCodes,
+			Name:    "Stored DTCs",
+			Value:   dtcs,
+			Raw:     data,
+		}, nil
+	default:
+		return DecodeVehicleInformation(pid, data)
+	}
+}
+
+// String returns the value with unit (e.g., "1984 rpm")
+func (resp *Response) String() string {
+	switch value := resp.Value.(type) {
+	case []DTC:
+		if len(value) == 0 {
+			return fmt.Sprintf("%s: none", resp.Name)
+		}
+		codes := make([]string, 0, len(value))
+		for _, dtc := range value {
+			codes = append(codes, dtc.String())
+		}
+		return fmt.Sprintf("%s: %s", resp.Name, strings.Join(codes, "; "))
+	case string:
+		return fmt.Sprintf("%s: %s", resp.Name, value)
+	case nil:
+		return fmt.Sprintf("%s: % X", resp.Name, resp.Raw)
+	case float64:
+		// Rounded to hundredths (resolution of OBD-II scaling)
+		return fmt.Sprintf("%s: %s %s", resp.Name, strconv.FormatFloat(math.Round(value*100)/100, 'f', -1, 64), resp.Unit)
+	default:
+		if resp.Unit == "" {
+			return fmt.Sprintf("%s: %v", resp.Name, value)
+		}
+		return fmt.Sprintf("%s: %v %s", resp.Name, value, resp.Unit)
+	}
+}
@@ -0,0 +1,142 @@
+package decoder
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/microcontroller"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name        string
+		payload     []byte
+		expected    any
+		expectedStr string
+	}{
+		{
+			name:        "engine speed",
+			payload:     []byte{0x41, 0x0C, 0x1F, 0x00},
+			expected:    1984.0,
+			expectedStr: "Engine speed: 1984 rpm",
+		},
+		{
+			name:        "engine speed with fraction",
+			payload:     []byte{0x41, 0x0C, 0x1A, 0xF9},
+			expected:    1726.25,
+			expectedStr: "Engine speed: 1726.25 rpm",
+		},
+		{
+			name:        "coolant temperature below zero",
+			payload:     []byte{0x41, 0x05, 0x1E},
+			expected:    -10,
+			expectedStr: "Engine coolant temperature: -10 °C",
+		},
+		{
+			name:        "unknown PID keeps raw data",
+			payload:     []byte{0x41, 0xA0, 0x58},
+			expected:    nil,
+			expectedStr: "PID 0xA0: 58",
+		},
+		{
+			name:    "stored DTCs",
+			payload: []byte{0x43, 0x02, 0x03, 0x00, 0xC1, 0x00},
+			expected: []DTC{
+				{Code: "P0300", Description: "Random/Multiple Cylinder Misfire Detected"},
+				{Code: "U0100", Description: "Lost Communication With ECM/PCM"},
+			},
+			expectedStr: "Stored DTCs: P0300 Random/Multiple Cylinder Misfire Detected; U0100 Lost Communication With ECM/PCM",
+		},
+		{
+			name:        "no stored DTCs",
+			payload:     []byte{0x43, 0x00},
+			expected:    []DTC{},
+			expectedStr: "Stored DTCs: none",
+		},
+		{
+			name:        "VIN",
+			payload:     append([]byte{0x49, 0x02, 0x01}, "VF1AB000123456789"...),
+			expected:    "VF1AB000123456789",
+			expectedStr: "VIN: VF1AB000123456789",
+		},
+		{
+			name:        "calibration ID padded with zeros",
+			payload:     append(append([]byte{0x49, 0x04, 0x01}, "ECM-A1234"...), 0x00, 0x00),
+			expected:    "ECM-A1234",
+			expectedStr: "Calibration ID: ECM-A1234",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := Decode(tt.payload)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, resp.Value)
+			assert.Equal(t, tt.expectedStr, resp.String())
+		})
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []struct {
+		name           string
+		payload        []byte
+		notOBDResponse bool
+	}{
+		{
+			name:           "UDS positive response",
+			payload:        []byte{0x54},
+			notOBDResponse: true,
+		},
+		{
+			name:           "negative response",
+			payload:        []byte{0x7F, 0x22, 0x31},
+			notOBDResponse: true,
+		},
+		{
+			name:    "missing data byte",
+			payload: []byte{0x41, 0x0C, 0x1F},
+		},
+		{
+			name:    "missing DTC bytes",
+			payload: []byte{0x43, 0x02, 0x03, 0x00},
+		},
+		{
+			name:    "VIN too short",
+			payload: append([]byte{0x49, 0x02, 0x01}, "VF1AB"...),
+		},
+		{
+			name:    "VIN with forbidden letter",
+			payload: append([]byte{0x49, 0x02, 0x01}, "VF1AB000I23456789"...),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Decode(tt.payload)
+			require.Error(t, err)
+			assert.Equal(t, tt.notOBDResponse, errors.Is(err, ErrNotOBDResponse))
+		})
+	}
+}
+
+func TestDecodeDTC(t *testing.T) {
+	tests := []struct {
+		raw      microcontroller.DTC
+		expected string
+	}{
+		{raw: microcontroller.DTC{0x01, 0x0C}, expected: "P010C"},
+		{raw: microcontroller.DTC{0x07, 0x10}, expected: "P0710"},
+		{raw: microcontroller.DTC{0x41, 0x23}, expected: "C0123"},
+		{raw: microcontroller.DTC{0x92, 0x34}, expected: "B1234"},
+		{raw: microcontroller.DTC{0xFF, 0xFF}, expected: "U3FFF"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expected, func(t *testing.T) {
+			assert.Equal(t, tt.expected, DecodeDTC(tt.raw).Code)
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package decoder
+
+import (
+	"fmt"
+
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/microcontroller"
+)
+
+// DTC is the decoded diagnostic trouble code
+type DTC struct {
+	Code        string // E.g., "P0300"
+	Description string
+}
+
+// The highest 2 bits of DTC tell the system the code belongs to
+var dtcSystems = []byte{'P', 'C', 'B', 'U'} // Powertrain, chassis, body, network
+
+// Known descriptions (generic SAE J2012 codes)
+var dtcDescriptions = map[string]string{
+	"P0100": "Mass or Volume Air Flow Circuit Malfunction",
+	"P0101": "Mass or Volume Air Flow Circuit Range/Performance Problem",
+	"P010C": "Mass or Volume Air Flow Circuit High Input",
+	"P0115": "Engine Coolant Temperature Circuit Malfunction",
+	"P0171": "System Too Lean (Bank 1)",
+	"P0172": "System Too Rich (Bank 1)",
+	"P0300": "Random/Multiple Cylinder Misfire Detected",
+	"P0301": "Cylinder 1 Misfire Detected",
+	"P0420": "Catalyst System Efficiency Below Threshold (Bank 1)",
+	"P0500": "Vehicle Speed Sensor Malfunction",
+	"P0700": "Transmission Control System Malfunction",
+	"P0705": "Transmission Range Sensor Circuit Malfunction",
+	"P0710": "Transmission Fluid Temperature Sensor Circuit Malfunction",
+	"U0100": "Lost Communication With ECM/PCM",
+}
+
+// DecodeDTC turns 2 bytes of the code into the string (e.g., 0x03 0x00 is P0300)
+func DecodeDTC(raw microcontroller.DTC) DTC {
+	code := fmt.Sprintf("%c%d%X%02X", dtcSystems[raw[0]>>6], (raw[0]>>4)&0x03, raw[0]&0x0F, raw[1])
+
+	description, ok := dtcDescriptions[code]
+	if !ok {
+		description = "Unknown (manufacturer specific)"
+	}
+
+	return DTC{
+		Code:        code,
+		Description: description,
+	}
+}
+
+// DecodeDTCs decodes the given number of codes of service 0x03 response
+func DecodeDTCs(count int, data []byte) ([]DTC, error) {
+	if len(data) < count*2 {
+		return nil, fmt.Errorf("expected %d DTCs, got %d data bytes", count, len(data))
+	}
+
+	dtcs := make([]DTC, 0, count)
+	for i := 0; i < count; i++ {
+		dtcs = append(dtcs, DecodeDTC(microcontroller.DTC{data[2*i], data[2*i+1]}))
+	}
+	return dtcs, nil
+}
+
+func (dtc DTC) String() string {
+	return fmt.Sprintf("%s %s", dtc.Code, dtc.Description)
+}
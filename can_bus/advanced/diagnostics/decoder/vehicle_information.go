@@ -0,0 +1,70 @@
+package decoder
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/microcontroller"
+)
+
+const (
+	PIDVIN           microcontroller.ParameterID = 0x02
+	PIDCalibrationID microcontroller.ParameterID = 0x04
+	PIDECUName       microcontroller.ParameterID = 0x0A
+
+	VINLength = 17
+)
+
+var vehicleInformationNames = map[microcontroller.ParameterID]string{
+	PIDVIN:           "VIN",
+	PIDCalibrationID: "Calibration ID",
+	PIDECUName:       "ECU name",
+}
+
+// DecodeVehicleInformation decodes the text item of service 0x09 (the first data byte is the number of items)
+func DecodeVehicleInformation(pid microcontroller.ParameterID, data []byte) (*Response, error) {
+	resp := &Response{
+		Service: microcontroller.ServiceVehicleInformation,
+		PID:     pid,
+		Raw:     data,
+	}
+
+	name, ok := vehicleInformationNames[pid]
+	if !ok {
+		resp.Name = fmt.Sprintf("info type 0x%02X", pid)
+		return resp, nil
+	}
+	resp.Name = name
+
+	if len(data) < 2 {
+		return nil, fmt.Errorf("%s: no data items", name)
+	}
+
+	if pid == PIDVIN {
+		vin, err := AssembleVIN(data[1:])
+		if err != nil {
+			return nil, err
+		}
+		resp.Value = vin
+		return resp, nil
+	}
+
+	resp.Value = string(bytes.Trim(data[1:], "\x00"))
+	return resp, nil
+}
+
+// AssembleVIN returns VIN from the response data, some ECUs pad it with leading zeros
+func AssembleVIN(data []byte) (string, error) {
+	vin := bytes.TrimLeft(data, "\x00")
+	if len(vin) != VINLength {
+		return "", fmt.Errorf("VIN must have %d characters, got %d", VINLength, len(vin))
+	}
+
+	for _, char := range vin {
+		// Letters I, O and Q are not used
+		if !(char >= '0' && char <= '9' || char >= 'A' && char <= 'Z') || char == 'I' || char == 'O' || char == 'Q' {
+			return "", fmt.Errorf("invalid VIN character: %q", char)
+		}
+	}
+	return string(vin), nil
+}
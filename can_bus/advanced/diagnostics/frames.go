@@ -10,7 +10,7 @@ var (
 	FrameGetRPM = &codec.Frame{
 		Id:  0x7DF,
 		DLC: 8,
-		Data: [8]byte{
+		Data: [codec.ProtocolMaxFDDataBytes]byte{
 			0x02,                         // Number of additional data bytes (service + PID)
 			0x01,                         // Service ID: Show Current Data
 			0x0C,                         // PID: Engine RPM
@@ -21,7 +21,7 @@ var (
 	FrameGetSpeed = &codec.Frame{
 		Id:  0x7DF,
 		DLC: 8,
-		Data: [8]byte{
+		Data: [codec.ProtocolMaxFDDataBytes]byte{
 			0x02,
 			0x01,
 			0x0D,
@@ -32,7 +32,7 @@ var (
 	FrameGetCoolantTemperature = &codec.Frame{
 		Id:  0x7DF,
 		DLC: 8,
-		Data: [8]byte{
+		Data: [codec.ProtocolMaxFDDataBytes]byte{
 			0x02,
 			0x01,
 			0x05,
@@ -43,7 +43,7 @@ var (
 	FrameGetEngineDTCs = &codec.Frame{
 		Id:  0x7E0, // Physical address of the engine ECU (not functional broadcast)
 		DLC: 8,
-		Data: [8]byte{
+		Data: [codec.ProtocolMaxFDDataBytes]byte{
 			0x02,
 			0x03,
 			0x00,
@@ -54,7 +54,7 @@ var (
 	FrameGetVIN = &codec.Frame{
 		Id:  0x7DF,
 		DLC: 8,
-		Data: [8]byte{
+		Data: [codec.ProtocolMaxFDDataBytes]byte{
 			0x02,
 			0x09,
 			0x02,
@@ -65,7 +65,7 @@ var (
 	FrameGetCalibrationID = &codec.Frame{
 		Id:  0x7DF,
 		DLC: 8,
-		Data: [8]byte{
+		Data: [codec.ProtocolMaxFDDataBytes]byte{
 			0x02,
 			0x09,
 			0x04,
@@ -76,11 +76,122 @@ var (
 	FrameGetTransmissionFluidTemperature = &codec.Frame{
 		Id:  0x7E1,
 		DLC: 8,
-		Data: [8]byte{
+		Data: [codec.ProtocolMaxFDDataBytes]byte{
 			0x02,
 			0x01,
 			0xA0,
 			0x00, 0x00, 0x00, 0x00, 0x00,
 		},
 	}
+
+	FramePollCoolantTemperature = &codec.Frame{
+		Id:     0x3E0, // Legacy coolant temperature frame of the engine ECU
+		Remote: true,  // Remote frame: the owner of the ID answers with the data frame
+		DLC:    1,     // Requested data length
+	}
+
+	// UDS requests of workshop tool (physically addressed to the engine ECU)
+
+	FrameStartExtendedSession = &codec.Frame{
+		Id:  0x7E0,
+		DLC: 8,
+		Data: [codec.ProtocolMaxFDDataBytes]byte{
+			0x02,
+			0x10, // Service ID: Diagnostic Session Control
+			0x03, // Extended diagnostic session
+			0x00, 0x00, 0x00, 0x00, 0x00,
+		},
+	}
+
+	FrameRequestSeed = &codec.Frame{
+		Id:  0x7E0,
+		DLC: 8,
+		Data: [codec.ProtocolMaxFDDataBytes]byte{
+			0x02,
+			0x27, // Service ID: Security Access
+			0x01, // Request seed
+			0x00, 0x00, 0x00, 0x00, 0x00,
+		},
+	}
+
+	FrameSendKey = &codec.Frame{
+		Id:  0x7E0,
+		DLC: 8,
+		Data: [codec.ProtocolMaxFDDataBytes]byte{
+			0x04,
+			0x27,       // Service ID: Security Access
+			0x02,       // Send key
+			0x13, 0xD1, // Key for the first seed of the engine ECU (0xD30F)
+			0x00, 0x00, 0x00,
+		},
+	}
+
+	FrameWriteIdleRPMTarget = &codec.Frame{
+		Id:  0x7E0,
+		DLC: 8,
+		Data: [codec.ProtocolMaxFDDataBytes]byte{
+			0x05,
+			0x2E,       // Service ID: Write Data By Identifier
+			0x01, 0x00, // DID: idle RPM target
+			0x03, 0x20, // 800 RPM
+			0x00, 0x00,
+		},
+	}
+
+	FrameReadIdleRPMTargetAndVIN = &codec.Frame{
+		Id:  0x7E0,
+		DLC: 8,
+		Data: [codec.ProtocolMaxFDDataBytes]byte{
+			0x05,
+			0x22,       // Service ID: Read Data By Identifier
+			0x01, 0x00, // DID: idle RPM target
+			0xF1, 0x90, // DID: VIN (the response is segmented)
+			0x00, 0x00,
+		},
+	}
+
+	FrameReadDTCsByStatus = &codec.Frame{
+		Id:  0x7E0,
+		DLC: 8,
+		Data: [codec.ProtocolMaxFDDataBytes]byte{
+			0x03,
+			0x19, // Service ID: Read DTC Information
+			0x02, // Report DTCs by status mask
+			0x09, // Test failed or confirmed
+			0x00, 0x00, 0x00, 0x00,
+		},
+	}
+
+	FrameClearAllDTCs = &codec.Frame{
+		Id:  0x7E0,
+		DLC: 8,
+		Data: [codec.ProtocolMaxFDDataBytes]byte{
+			0x04,
+			0x14,             // Service ID: Clear Diagnostic Information
+			0xFF, 0xFF, 0xFF, // All groups
+			0x00, 0x00, 0x00,
+		},
+	}
+
+	FrameTesterPresent = &codec.Frame{
+		Id:  0x7E0,
+		DLC: 8,
+		Data: [codec.ProtocolMaxFDDataBytes]byte{
+			0x02,
+			0x3E, // Service ID: Tester Present
+			0x80, // Suppress positive response
+			0x00, 0x00, 0x00, 0x00, 0x00,
+		},
+	}
+
+	FrameHardReset = &codec.Frame{
+		Id:  0x7E0,
+		DLC: 8,
+		Data: [codec.ProtocolMaxFDDataBytes]byte{
+			0x02,
+			0x11, // Service ID: ECU Reset
+			0x01, // Hard reset (back to the default session)
+			0x00, 0x00, 0x00, 0x00, 0x00,
+		},
+	}
 )
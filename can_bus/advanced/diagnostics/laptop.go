@@ -1,8 +1,13 @@
 package diagnostics
 
 import (
+	"errors"
+
 	"github.com/hovsep/fmesh-examples/can_bus/advanced/can"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/codec"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/diagnostics/decoder"
 	"github.com/hovsep/fmesh-examples/can_bus/advanced/ecu/obd"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/microcontroller"
 	"github.com/hovsep/fmesh/component"
 	"github.com/hovsep/fmesh/signal"
 )
@@ -17,6 +22,10 @@ const (
 	portProgrammaticIn = "pr_in"
 	labelTo            = "send_to"
 	labelUSB           = "usb"
+
+	stateKeyPendingRequests = "pending_requests"
+	stateKeyReassemblies    = "reassemblies"
+	stateKeyReportEntries   = "report_entries"
 )
 
 func NewLaptop(name string) *Laptop {
@@ -24,12 +33,27 @@ func NewLaptop(name string) *Laptop {
 		laptopComponent: component.New(name).
 			AddInputs(portUSBIn, portProgrammaticIn).
 			AddOutputs(portUSBOut).
+			WithInitialState(func(state component.State) {
+				state.Set(stateKeyPendingRequests, []*pendingRequest{})
+				state.Set(stateKeyReassemblies, reassemblyMap{})
+				state.Set(stateKeyReportEntries, []*ReportEntry{})
+			}).
 			WithActivationFunc(func(this *component.Component) error {
 
 				// Process programmatic commands
 				this.InputByName(portProgrammaticIn).Signals().ForEach(func(sig *signal.Signal) error {
 					// Handle signals routed to usb port
 					if sig.Labels().ValueIs(labelTo, labelUSB) {
+						// Remember OBD-II requests, so responses can be matched to them
+						if frame, ok := sig.PayloadOrNil().(*codec.Frame); ok {
+							if request, ok := parseRequest(frame); ok {
+								pending := this.State().Get(stateKeyPendingRequests).([]*pendingRequest)
+								this.State().Set(stateKeyPendingRequests, append(pending, &pendingRequest{
+									request:    request,
+									answeredBy: make(map[uint32]bool),
+								}))
+							}
+						}
 						this.OutputByName(portUSBOut).PutSignals(sig)
 					}
 					return nil
@@ -37,8 +61,14 @@ func NewLaptop(name string) *Laptop {
 
 				// Process incoming usb data
 				this.InputByName(portUSBIn).Signals().ForEach(func(sig *signal.Signal) error {
-					// Just print everything to STDOUT
 					this.Logger().Printf("Got data on USB port: %v", sig.PayloadOrNil())
+
+					frame, ok := sig.PayloadOrNil().(*codec.Frame)
+					if !ok || frame.Extended || frame.Remote || frame.Id < microcontroller.FirstResponseID || frame.Id > microcontroller.LastResponseID {
+						return nil
+					}
+
+					handleResponseFrame(this, frame)
 					return nil
 				})
 
@@ -57,6 +87,51 @@ func (l *Laptop) SendDataToUSB(payloads ...any) {
 		)
 }
 
+// Report returns decoded responses matched to the requests sent so far
+func (l *Laptop) Report() *Report {
+	state := l.laptopComponent.State()
+	report := &Report{
+		Entries: state.Get(stateKeyReportEntries).([]*ReportEntry),
+	}
+
+	for _, p := range state.Get(stateKeyPendingRequests).([]*pendingRequest) {
+		if len(p.answeredBy) == 0 {
+			report.Unanswered = append(report.Unanswered, p.request)
+		}
+	}
+	return report
+}
+
+// handleResponseFrame reassembles the response of ECU, decodes it and adds it to the report
+func handleResponseFrame(this *component.Component, frame *codec.Frame) {
+	payload, err := reassemble(this.State().Get(stateKeyReassemblies).(reassemblyMap), frame)
+	if err != nil {
+		this.Logger().Printf("failed to reassemble response from 0x%03X: %s", frame.Id, err)
+		return
+	}
+	if payload == nil {
+		return
+	}
+
+	resp, err := decoder.Decode(payload)
+	if errors.Is(err, decoder.ErrNotOBDResponse) {
+		this.Logger().Printf("response from 0x%03X is not decoded: % X", frame.Id, payload)
+		return
+	}
+	if err != nil {
+		this.Logger().Printf("failed to decode response from 0x%03X: %s", frame.Id, err)
+		return
+	}
+
+	entry := &ReportEntry{
+		Request:    matchRequest(this.State().Get(stateKeyPendingRequests).([]*pendingRequest), frame.Id, resp),
+		ECUAddress: frame.Id,
+		Response:   resp,
+	}
+	this.Logger().Printf("decoded response from 0x%03X: %s", frame.Id, resp)
+	this.State().Set(stateKeyReportEntries, append(this.State().Get(stateKeyReportEntries).([]*ReportEntry), entry))
+}
+
 func (l *Laptop) ConnectToOBD(OBDSocket *can.Node) error {
 	l.laptopComponent.OutputByName(portUSBOut).PipeTo(OBDSocket.MCU.InputByName(obd.PortOBDIn))
 	OBDSocket.MCU.OutputByName(obd.PortOBDOut).PipeTo(l.laptopComponent.InputByName(portUSBIn))
@@ -0,0 +1,62 @@
+package diagnostics
+
+import (
+	"fmt"
+
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/codec"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/microcontroller"
+)
+
+// reassembly is the segmented response being received from one ECU
+type reassembly struct {
+	length         int
+	sequenceNumber byte // Expected sequence number of the next consecutive frame
+	payload        []byte
+}
+
+// reassemblyMap maps response IDs to the responses being received
+type reassemblyMap map[uint32]*reassembly
+
+// reassemble collects ISO-TP frames of responses passively (the OBD adapter sends flow control),
+// it returns the payload once the response is complete
+func reassemble(reassemblies reassemblyMap, frame *codec.Frame) ([]byte, error) {
+	isoFrame, err := microcontroller.ParseISOTPFrame(frame)
+	if err != nil {
+		return nil, err
+	}
+
+	switch isoFrame.Type {
+	case microcontroller.ISOTPSingleFrame:
+		delete(reassemblies, frame.Id)
+		return isoFrame.Data, nil
+	case microcontroller.ISOTPFirstFrame:
+		reassemblies[frame.Id] = &reassembly{
+			length:         isoFrame.Length,
+			sequenceNumber: 1,
+			payload:        append([]byte{}, isoFrame.Data...),
+		}
+		return nil, nil
+	case microcontroller.ISOTPConsecutiveFrame:
+		r, ok := reassemblies[frame.Id]
+		if !ok {
+			return nil, fmt.Errorf("unexpected consecutive frame from 0x%03X", frame.Id)
+		}
+
+		if isoFrame.SequenceNumber != r.sequenceNumber {
+			delete(reassemblies, frame.Id)
+			return nil, fmt.Errorf("wrong sequence number from 0x%03X: expected %d, got %d", frame.Id, r.sequenceNumber, isoFrame.SequenceNumber)
+		}
+		r.sequenceNumber = (r.sequenceNumber + 1) & 0x0F
+
+		r.payload = append(r.payload, isoFrame.Data...)
+		if len(r.payload) < r.length {
+			return nil, nil
+		}
+
+		delete(reassemblies, frame.Id)
+		return r.payload[:r.length], nil
+	default:
+		// Flow control is not a part of the response
+		return nil, nil
+	}
+}
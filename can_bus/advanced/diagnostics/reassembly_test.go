@@ -0,0 +1,123 @@
+package diagnostics
+
+import (
+	"testing"
+
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/codec"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/microcontroller"
+	"github.com/stretchr/testify/assert"
+)
+
+// isoTPFrame returns the full-length CAN frame with the given data (the rest is padded)
+func isoTPFrame(id uint32, data ...byte) *codec.Frame {
+	frame := &codec.Frame{
+		Id:  id,
+		DLC: microcontroller.ValidISOTPFrameDLC,
+	}
+	copy(frame.Data[:], data)
+	return frame
+}
+
+// reassembled is the result of passing one frame to reassemble
+type reassembled struct {
+	payload []byte
+	err     string
+}
+
+func TestReassemble(t *testing.T) {
+	tests := []struct {
+		name   string
+		frames []*codec.Frame
+		want   []reassembled
+	}{
+		{
+			name:   "single frame",
+			frames: []*codec.Frame{isoTPFrame(0x7E8, 0x04, 0x41, 0x0C, 0x1F, 0x00)},
+			want:   []reassembled{{payload: []byte{0x41, 0x0C, 0x1F, 0x00}}},
+		},
+		{
+			name: "segmented response, flow control is ignored",
+			frames: []*codec.Frame{
+				isoTPFrame(0x7E8, 0x10, 0x0E, 0x49, 0x02, 0x01, 0x31, 0x32, 0x33),
+				isoTPFrame(0x7E0, 0x30, 0x00, 0x00),
+				isoTPFrame(0x7E8, 0x21, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39, 0x41),
+				isoTPFrame(0x7E8, 0x22, 0x42, 0x43, 0x44, 0xAA, 0xAA, 0xAA, 0xAA),
+			},
+			want: []reassembled{{}, {}, {}, {payload: []byte{0x49, 0x02, 0x01, 0x31, 0x32, 0x33, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39, 0x41, 0x42}}},
+		},
+		{
+			name: "responses of two ECUs are interleaved",
+			frames: []*codec.Frame{
+				isoTPFrame(0x7E8, 0x10, 0x08, 0x49, 0x02, 0x01, 0x31, 0x32, 0x33),
+				isoTPFrame(0x7E9, 0x10, 0x08, 0x49, 0x02, 0x01, 0x41, 0x42, 0x43),
+				isoTPFrame(0x7E9, 0x21, 0x44, 0x45),
+				isoTPFrame(0x7E8, 0x21, 0x34, 0x35),
+			},
+			want: []reassembled{
+				{},
+				{},
+				{payload: []byte{0x49, 0x02, 0x01, 0x41, 0x42, 0x43, 0x44, 0x45}},
+				{payload: []byte{0x49, 0x02, 0x01, 0x31, 0x32, 0x33, 0x34, 0x35}},
+			},
+		},
+		{
+			name: "wrong sequence number aborts reassembly",
+			frames: []*codec.Frame{
+				isoTPFrame(0x7E8, 0x10, 0x0E, 0x49, 0x02, 0x01, 0x31, 0x32, 0x33),
+				isoTPFrame(0x7E8, 0x22, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39, 0x41),
+				isoTPFrame(0x7E8, 0x21, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39, 0x41),
+			},
+			want: []reassembled{
+				{},
+				{err: "wrong sequence number from 0x7E8: expected 1, got 2"},
+				{err: "unexpected consecutive frame from 0x7E8"},
+			},
+		},
+		{
+			name: "new first frame restarts reassembly",
+			frames: []*codec.Frame{
+				isoTPFrame(0x7E8, 0x10, 0x08, 0x49, 0x02, 0x01, 0x31, 0x32, 0x33),
+				isoTPFrame(0x7E8, 0x10, 0x08, 0x49, 0x02, 0x01, 0x41, 0x42, 0x43),
+				isoTPFrame(0x7E8, 0x21, 0x44, 0x45),
+			},
+			want: []reassembled{{}, {}, {payload: []byte{0x49, 0x02, 0x01, 0x41, 0x42, 0x43, 0x44, 0x45}}},
+		},
+		{
+			name:   "invalid frame",
+			frames: []*codec.Frame{{Id: 0x7E8, DLC: 2, Data: [codec.ProtocolMaxFDDataBytes]byte{0x01, 0x41}}},
+			want:   []reassembled{{err: "given frame is not valid ISO-TP frame"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reassemblies := reassemblyMap{}
+			var got []reassembled
+			for _, frame := range tt.frames {
+				payload, err := reassemble(reassemblies, frame)
+				result := reassembled{payload: payload}
+				if err != nil {
+					result.err = err.Error()
+				}
+				got = append(got, result)
+			}
+
+			assert.Equal(t, tt.want, got)
+			assert.Empty(t, reassemblies)
+		})
+	}
+
+	t.Run("sequence number wraps around", func(t *testing.T) {
+		reassemblies := reassemblyMap{}
+		payload, err := reassemble(reassemblies, isoTPFrame(0x7E8, 0x10, 0x70, 0x49, 0x02, 0x01, 0x00, 0x00, 0x00))
+		assert.NoError(t, err)
+		assert.Nil(t, payload)
+
+		// 16 consecutive frames carry the rest of 112 bytes, the last one has sequence number 0
+		for i := 1; i <= 16; i++ {
+			payload, err = reassemble(reassemblies, isoTPFrame(0x7E8, 0x20|byte(i&0x0F), byte(i)))
+			assert.NoError(t, err)
+		}
+		assert.Len(t, payload, 0x70)
+		assert.Empty(t, reassemblies)
+	})
+}
@@ -0,0 +1,109 @@
+package diagnostics
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/codec"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/diagnostics/decoder"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/microcontroller"
+)
+
+// Request is the OBD-II request sent by the laptop
+type Request struct {
+	Id      uint32 // Functional (0x7DF) or physical address of ECU
+	Service microcontroller.ServiceID
+	PID     microcontroller.ParameterID
+	Payload []byte
+}
+
+// ReportEntry is the decoded response matched to its request
+type ReportEntry struct {
+	Request    *Request // Nil when the response matches no request
+	ECUAddress uint32   // Response ID of the responding ECU
+	Response   *decoder.Response
+}
+
+// Report is the structured result of the diagnostic session
+type Report struct {
+	Entries    []*ReportEntry
+	Unanswered []*Request
+}
+
+// pendingRequest is the request waiting for responses (functional requests are answered by many ECUs)
+type pendingRequest struct {
+	request    *Request
+	answeredBy map[uint32]bool
+}
+
+// parseRequest returns OBD-II request carried by the frame (other frames are not reported)
+func parseRequest(frame *codec.Frame) (*Request, bool) {
+	if frame.Extended || frame.Remote {
+		return nil, false
+	}
+
+	if frame.Id != microcontroller.FunctionalRequestID &&
+		(frame.Id < microcontroller.FirstResponseID-microcontroller.ResponseAddressOffset || frame.Id >= microcontroller.FirstResponseID) {
+		return nil, false
+	}
+
+	isoFrame, err := microcontroller.ParseISOTPFrame(frame)
+	if err != nil || isoFrame.Type != microcontroller.ISOTPSingleFrame {
+		return nil, false
+	}
+
+	service := microcontroller.ServiceID(isoFrame.Data[0])
+	if service != microcontroller.ServiceShowCurrentData &&
+		service != microcontroller.ServiceReadStoredDiagnosticCodes &&
+		service != microcontroller.ServiceVehicleInformation {
+		return nil, false
+	}
+
+	request := &Request{
+		Id:      frame.Id,
+		Service: service,
+		Payload: isoFrame.Data,
+	}
+	if len(isoFrame.Data) > 1 && service != microcontroller.ServiceReadStoredDiagnosticCodes {
+		request.PID = microcontroller.ParameterID(isoFrame.Data[1])
+	}
+	return request, true
+}
+
+// matchRequest finds the oldest request the ECU has not answered yet
+func matchRequest(pending []*pendingRequest, ecuAddress uint32, resp *decoder.Response) *Request {
+	for _, p := range pending {
+		if p.answeredBy[ecuAddress] || p.request.Service != resp.Service || p.request.PID != resp.PID {
+			continue
+		}
+
+		if p.request.Id != microcontroller.FunctionalRequestID && p.request.Id+microcontroller.ResponseAddressOffset != ecuAddress {
+			continue
+		}
+
+		p.answeredBy[ecuAddress] = true
+		return p.request
+	}
+	return nil
+}
+
+func (req *Request) String() string {
+	return fmt.Sprintf("0x%03X [% X]", req.Id, req.Payload)
+}
+
+func (r *Report) String() string {
+	var sb strings.Builder
+	sb.WriteString("Diagnostic report:\n")
+	for _, entry := range r.Entries {
+		request := "unsolicited"
+		if entry.Request != nil {
+			request = entry.Request.String()
+		}
+		fmt.Fprintf(&sb, "  ECU 0x%03X <- %s: %s\n", entry.ECUAddress, request, entry.Response)
+	}
+
+	for _, request := range r.Unanswered {
+		fmt.Fprintf(&sb, "  no response <- %s\n", request)
+	}
+	return sb.String()
+}
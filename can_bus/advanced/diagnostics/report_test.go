@@ -0,0 +1,109 @@
+package diagnostics
+
+import (
+	"testing"
+
+	"github.com/hovsep/fmesh"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/codec"
+	"github.com/hovsep/fmesh/signal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// getReport sends the requests through the laptop, passes the responses back to it and returns its report
+func getReport(t *testing.T, requests []*codec.Frame, responses []*codec.Frame) *Report {
+	laptop := NewLaptop("test-laptop")
+	for _, request := range requests {
+		laptop.SendDataToUSB(request)
+	}
+	for _, response := range responses {
+		laptop.laptopComponent.InputByName(portUSBIn).PutSignals(signal.New(response))
+	}
+
+	_, err := fmesh.New("report_test").AddComponents(laptop.GetAllComponents()...).Run()
+	require.NoError(t, err)
+	return laptop.Report()
+}
+
+func TestReport(t *testing.T) {
+	getRPM := isoTPFrame(0x7DF, 0x02, 0x01, 0x0C)
+	getRPMFromECM := isoTPFrame(0x7E0, 0x02, 0x01, 0x0C)
+	getCoolantFromTCM := isoTPFrame(0x7E1, 0x02, 0x01, 0x05)
+	rpmFromECM := isoTPFrame(0x7E8, 0x04, 0x41, 0x0C, 0x1F, 0x00)
+	rpmFromTCM := isoTPFrame(0x7E9, 0x04, 0x41, 0x0C, 0x1A, 0xF9)
+	coolantFromECM := isoTPFrame(0x7E8, 0x03, 0x41, 0x05, 0x1E)
+
+	tests := []struct {
+		name           string
+		requests       []*codec.Frame
+		responses      []*codec.Frame
+		want           string
+		wantUnanswered []uint32
+	}{
+		{
+			name:      "functional request answered by two ECUs",
+			requests:  []*codec.Frame{getRPM},
+			responses: []*codec.Frame{rpmFromECM, rpmFromTCM},
+			want: "Diagnostic report:\n" +
+				"  ECU 0x7E8 <- 0x7DF [01 0C]: Engine speed: 1984 rpm\n" +
+				"  ECU 0x7E9 <- 0x7DF [01 0C]: Engine speed: 1726.25 rpm\n",
+		},
+		{
+			name:      "physical request is matched only to its own response ID",
+			requests:  []*codec.Frame{getRPMFromECM},
+			responses: []*codec.Frame{rpmFromTCM, rpmFromECM},
+			want: "Diagnostic report:\n" +
+				"  ECU 0x7E9 <- unsolicited: Engine speed: 1726.25 rpm\n" +
+				"  ECU 0x7E8 <- 0x7E0 [01 0C]: Engine speed: 1984 rpm\n",
+		},
+		{
+			name:      "each ECU answers the oldest request it has not answered yet",
+			requests:  []*codec.Frame{getRPM, getRPM},
+			responses: []*codec.Frame{rpmFromECM, rpmFromECM, rpmFromECM},
+			want: "Diagnostic report:\n" +
+				"  ECU 0x7E8 <- 0x7DF [01 0C]: Engine speed: 1984 rpm\n" +
+				"  ECU 0x7E8 <- 0x7DF [01 0C]: Engine speed: 1984 rpm\n" +
+				"  ECU 0x7E8 <- unsolicited: Engine speed: 1984 rpm\n",
+		},
+		{
+			name:      "unanswered requests",
+			requests:  []*codec.Frame{getRPMFromECM, getCoolantFromTCM, getRPM},
+			responses: []*codec.Frame{coolantFromECM, rpmFromECM},
+			want: "Diagnostic report:\n" +
+				"  ECU 0x7E8 <- unsolicited: Engine coolant temperature: -10 °C\n" +
+				"  ECU 0x7E8 <- 0x7E0 [01 0C]: Engine speed: 1984 rpm\n" +
+				"  no response <- 0x7E1 [01 05]\n" +
+				"  no response <- 0x7DF [01 0C]\n",
+			wantUnanswered: []uint32{0x7E1, 0x7DF},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := getReport(t, tt.requests, tt.responses)
+			assert.Equal(t, tt.want, report.String())
+
+			var unanswered []uint32
+			for _, request := range report.Unanswered {
+				unanswered = append(unanswered, request.Id)
+			}
+			assert.Equal(t, tt.wantUnanswered, unanswered)
+		})
+	}
+
+	t.Run("segmented response", func(t *testing.T) {
+		report := getReport(t,
+			[]*codec.Frame{isoTPFrame(0x7DF, 0x02, 0x09, 0x02)},
+			[]*codec.Frame{
+				isoTPFrame(0x7E8, 0x10, 0x14, 0x49, 0x02, 0x01, 0x31, 0x47, 0x31),
+				isoTPFrame(0x7E8, 0x21, 0x4A, 0x43, 0x35, 0x34, 0x34, 0x34, 0x52),
+				isoTPFrame(0x7E8, 0x22, 0x37, 0x32, 0x35, 0x32, 0x33, 0x36, 0x37),
+			},
+		)
+
+		require.Len(t, report.Entries, 1)
+		assert.Equal(t, &Request{Id: 0x7DF, Service: 0x09, PID: 0x02, Payload: []byte{0x09, 0x02}}, report.Entries[0].Request)
+		assert.Equal(t, uint32(0x7E8), report.Entries[0].ECUAddress)
+		assert.Equal(t, "1G1JC5444R7252367", report.Entries[0].Response.Value)
+		assert.Empty(t, report.Unanswered)
+	})
+}
@@ -1,7 +1,12 @@
 package engine
 
 import (
+	"encoding/binary"
+	"time"
+
 	"github.com/hovsep/fmesh-examples/can_bus/advanced/can"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/codec"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/controller"
 	"github.com/hovsep/fmesh-examples/can_bus/advanced/microcontroller"
 	"github.com/hovsep/fmesh/component"
 )
@@ -10,23 +15,42 @@ const (
 	ECMUnitName        = "ecm"
 	ECMPhysicalAddress = 0x7E0
 
+	// ECMCoolantTemperatureID is the ID of the data frame with coolant temperature, legacy nodes poll it with remote frames
+	ECMCoolantTemperatureID = 0x3E0
+
+	// Cyclic messages broadcast to other ECUs (the background load of the powertrain bus), periods are in MCU time
+	ECMEngineSpeedID   = 0x0C0 // Engine RPM (encoded like OBD PID 0x0C), every 20000 MCU ticks
+	ECMCoolantStatusID = 0x3E8 // Coolant temperature (encoded like OBD PID 0x05), every 200000 MCU ticks
+
+	// The engine broadcasts while running, it is stopped after a while, so the simulation can stop too
+	ecmRunningTime = 100 * time.Millisecond
+
 	ecmPIDRPM                microcontroller.ParameterID = 0x0C
 	ecmPIDVehicleSpeed       microcontroller.ParameterID = 0x0D
 	ecmPIDVIN                microcontroller.ParameterID = 0x02
 	ecmPIDCalibrationID      microcontroller.ParameterID = 0x04
 	ecmPIDCoolantTemperature microcontroller.ParameterID = 0x05
 
-	stateKeyParams = "params"
-	stateKeyDTCs   = "dtcs"
+	ecmDIDIdleRPMTarget microcontroller.DataIdentifier = 0x0100 // Manufacturer specific, writable in the extended session
+	ecmDIDCalibrationID microcontroller.DataIdentifier = 0xF181
+	ecmDIDVIN           microcontroller.DataIdentifier = 0xF190
+
+	stateKeyParams        = "params"
+	stateKeyDTCs          = "dtcs"
+	stateKeyIdleRPMTarget = "idle_rpm_target"
+
+	// ecmSecurityMask is the secret of security access (the key is the seed masked with it)
+	ecmSecurityMask = 0xC0DE
 )
 
 var (
 	// Supported trouble codes
 	dtcP010C = microcontroller.DTC{0x01, 0x0C} // Mass or Volume Air Flow Circuit High Input
 	dtcP0300 = microcontroller.DTC{0x03, 0x00} // Random/Multiple Cylinder Misfire
+	dtcP0171 = microcontroller.DTC{0x01, 0x71} // System Too Lean (Bank 1)
 
 	// The "brain" of this unit
-	logicDescriptor = &microcontroller.LogicDescriptor{
+	logicDescriptor = (&microcontroller.LogicDescriptor{
 		PhysicalAddress: ECMPhysicalAddress,
 		Table: microcontroller.LogicMap{
 			microcontroller.FunctionalAddressing: {
@@ -58,11 +82,37 @@ var (
 				},
 			},
 		},
-	}
+		// Workshop tools talk UDS
+		UDS: microcontroller.NewUDSServer(getSecurityKey).
+			WithDataIdentifier(ecmDIDVIN, microcontroller.DataIdentifierDescriptor{
+				Read: readVIN,
+			}).
+			WithDataIdentifier(ecmDIDCalibrationID, microcontroller.DataIdentifierDescriptor{
+				Read: readCalibrationID,
+			}).
+			WithDataIdentifier(ecmDIDIdleRPMTarget, microcontroller.DataIdentifierDescriptor{
+				Read:        readIdleRPMTarget,
+				Write:       writeIdleRPMTarget,
+				WriteLength: 2,
+			}).
+			WithDTCs(readDTCs, clearDTCs),
+		Scheduler: microcontroller.NewScheduler(ecmRunningTime).
+			WithMessage(&microcontroller.CyclicMessage{
+				Id:      ECMEngineSpeedID,
+				Period:  10 * time.Millisecond,
+				Payload: buildEngineSpeed,
+			}).
+			WithMessage(&microcontroller.CyclicMessage{
+				Id:      ECMCoolantStatusID,
+				Period:  100 * time.Millisecond,
+				Payload: buildCoolantStatus,
+			}),
+	}).WithRemoteResponder(ECMCoolantTemperatureID, getRemoteCoolantTemp)
 )
 
+// NewNode creates the ECM node, its controller passes to MCU only the frames handled by the logic
 func NewNode() *can.Node {
-	return can.NewNode(ECMUnitName, func(state component.State) {
+	node := can.NewNodeWithConfig(ECMUnitName, &controller.Config{Filters: logicDescriptor.AcceptanceFilters()}, func(state component.State) {
 		// Current state of params
 		paramsState := microcontroller.ParamsState{
 			ecmPIDRPM:                1984,
@@ -74,16 +124,22 @@ func NewNode() *can.Node {
 
 		state.Set(stateKeyParams, paramsState)
 
-		// Current state of DTCs.
-		// Due to limitations of this example we support
-		// only 2 DTC's maximum, so they can fit into a single frame
+		// Current state of DTCs (the report does not fit into a single frame, so it is segmented by ISO-TP)
 		DTCsState := []microcontroller.DTC{
 			dtcP010C,
 			dtcP0300,
+			dtcP0171,
 		}
 
 		state.Set(stateKeyDTCs, DTCsState)
+
+		// Calibration values adjustable by workshop tools
+		state.Set(stateKeyIdleRPMTarget, 750)
 	}, logicDescriptor.ToActivationFunc())
+
+	// The engine is running, so the cyclic messages start right away
+	microcontroller.PowerOn(node.MCU)
+	return node
 }
 
 func getSpeedParam(mode microcontroller.AddressingMode, request *microcontroller.ISOTPMessage, mcu *component.Component) (*microcontroller.ISOTPMessage, error) {
@@ -124,18 +180,25 @@ func getCoolantTempParam(mode microcontroller.AddressingMode, request *microcont
 	}, nil
 }
 
-func getStoredDTCs(mode microcontroller.AddressingMode, request *microcontroller.ISOTPMessage, mcu *component.Component) (*microcontroller.ISOTPMessage, error) {
-	dtcs := mcu.State().Get(stateKeyDTCs).([]microcontroller.DTC)
+func buildEngineSpeed(mcu *component.Component) ([]byte, error) {
+	paramsState := mcu.State().Get(stateKeyParams).(microcontroller.ParamsState)
+	rpmHi, rpmLow := encodeRPM(paramsState[ecmPIDRPM].(int))
+	return []byte{rpmHi, rpmLow}, nil
+}
 
-	var dtcData []byte
-	for _, dtc := range dtcs {
-		dtcData = append(dtcData, dtc[0], dtc[1])
-	}
+func buildCoolantStatus(mcu *component.Component) ([]byte, error) {
+	paramsState := mcu.State().Get(stateKeyParams).(microcontroller.ParamsState)
+	return []byte{paramsState[ecmPIDCoolantTemperature].(byte)}, nil
+}
 
-	return &microcontroller.ISOTPMessage{
-		ServiceID: microcontroller.ResponseReadStoredDiagnosticCodes,
-		Data:      dtcData,
-	}, nil
+func getRemoteCoolantTemp(request *codec.Frame, mcu *component.Component) ([]byte, error) {
+	paramsState := mcu.State().Get(stateKeyParams).(microcontroller.ParamsState)
+	return []byte{paramsState[ecmPIDCoolantTemperature].(byte)}, nil
+}
+
+func getStoredDTCs(mode microcontroller.AddressingMode, request *microcontroller.ISOTPMessage, mcu *component.Component) (*microcontroller.ISOTPMessage, error) {
+	dtcs := mcu.State().Get(stateKeyDTCs).([]microcontroller.DTC)
+	return microcontroller.StoredDiagnosticCodesResponse(dtcs), nil
 }
 
 func getVIN(mode microcontroller.AddressingMode, request *microcontroller.ISOTPMessage, mcu *component.Component) (*microcontroller.ISOTPMessage, error) {
@@ -144,7 +207,7 @@ func getVIN(mode microcontroller.AddressingMode, request *microcontroller.ISOTPM
 	return &microcontroller.ISOTPMessage{
 		ServiceID: microcontroller.ResponseVehicleInformation,
 		PID:       ecmPIDVIN,
-		Data:      microcontroller.FitDataIntoSingleFrame(vin),
+		Data:      microcontroller.VehicleInformationData(vin),
 	}, nil
 }
 
@@ -154,6 +217,39 @@ func getCalibrationID(mode microcontroller.AddressingMode, request *microcontrol
 	return &microcontroller.ISOTPMessage{
 		ServiceID: microcontroller.ResponseVehicleInformation,
 		PID:       ecmPIDCalibrationID,
-		Data:      microcontroller.FitDataIntoSingleFrame(id),
+		Data:      microcontroller.VehicleInformationData(id),
 	}, nil
 }
+
+func getSecurityKey(seed uint16) uint16 {
+	return seed ^ ecmSecurityMask
+}
+
+func readVIN(mcu *component.Component) []byte {
+	paramsState := mcu.State().Get(stateKeyParams).(microcontroller.ParamsState)
+	return paramsState[ecmPIDVIN].([]byte)
+}
+
+func readCalibrationID(mcu *component.Component) []byte {
+	paramsState := mcu.State().Get(stateKeyParams).(microcontroller.ParamsState)
+	return paramsState[ecmPIDCalibrationID].([]byte)
+}
+
+func readIdleRPMTarget(mcu *component.Component) []byte {
+	return binary.BigEndian.AppendUint16(nil, uint16(mcu.State().Get(stateKeyIdleRPMTarget).(int)))
+}
+
+func writeIdleRPMTarget(mcu *component.Component, data []byte) {
+	idleRPMTarget := int(binary.BigEndian.Uint16(data))
+	mcu.Logger().Printf("idle RPM target: %d->%d", mcu.State().Get(stateKeyIdleRPMTarget).(int), idleRPMTarget)
+	mcu.State().Set(stateKeyIdleRPMTarget, idleRPMTarget)
+}
+
+func readDTCs(mcu *component.Component) []microcontroller.DTC {
+	return mcu.State().Get(stateKeyDTCs).([]microcontroller.DTC)
+}
+
+func clearDTCs(mcu *component.Component) {
+	mcu.Logger().Println("DTCs cleared")
+	mcu.State().Set(stateKeyDTCs, []microcontroller.DTC{})
+}
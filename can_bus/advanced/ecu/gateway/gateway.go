@@ -0,0 +1,151 @@
+package gateway
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/bus"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/codec"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/common"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/controller"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/microcontroller"
+	"github.com/hovsep/fmesh/component"
+	"github.com/hovsep/fmesh/signal"
+)
+
+const (
+	GatewayUnitName = "gateway"
+
+	stateKeyLastForwarded = "last_forwarded"
+)
+
+// Gateway is the ECU attached to multiple buses: one MCU with a controller and a transceiver per bus
+type Gateway struct {
+	MCU      *component.Component
+	unitName string
+	links    can.Nodes // Controller and transceiver of each bus (MCU is shared, so it is not set)
+	busNames []string
+}
+
+// New creates the gateway forwarding frames by the given routes (connect it to the buses before running the mesh)
+func New(unitName string, routes []*Route) *Gateway {
+	g := &Gateway{
+		unitName: unitName,
+	}
+
+	g.MCU = microcontroller.New(unitName, func(state component.State) {
+		// Bus time of the last frame forwarded by each route (for rate limits)
+		state.Set(stateKeyLastForwarded, make(map[*Route]time.Duration))
+	}, func(this *component.Component) error {
+		var errs []error
+		for _, busName := range g.busNames {
+			errs = append(errs, this.InputByName(busPort(common.PortCANRx, busName)).Signals().ForEach(func(sig *signal.Signal) error {
+				frame, ok := sig.PayloadOrNil().(*codec.Frame)
+				if !ok {
+					return errors.New("failed to cast payload to CAN frame")
+				}
+
+				busTime, err := time.ParseDuration(sig.Labels().ValueOrDefault(common.LabelBusTime, "0s"))
+				if err != nil {
+					return fmt.Errorf("invalid time of reception: %w", err)
+				}
+
+				return g.forward(this, routes, busName, frame, busTime)
+			}).ChainableErr())
+		}
+		return errors.Join(errs...)
+	})
+
+	return g
+}
+
+// ConnectToBus attaches the gateway to one more bus (with its own controller and transceiver)
+func (g *Gateway) ConnectToBus(b *bus.Bus) error {
+	if slices.Contains(g.busNames, b.Name) {
+		return fmt.Errorf("gateway is already connected to %s", b.Name)
+	}
+
+	linkName := g.LinkUnitName(b.Name)
+	ctl := controller.NewWithConfig(linkName, &controller.Config{FD: true}) // Gateways forward FD frames too
+	trsv := can.NewTransceiver(linkName)
+
+	g.MCU.AddInputs(busPort(common.PortCANRx, b.Name)).AddOutputs(busPort(common.PortCANTx, b.Name))
+
+	// Wiring : mcu <--> controller <--> transceiver (like in any node, but MCU ports are named by the bus)
+	g.MCU.OutputByName(busPort(common.PortCANTx, b.Name)).PipeTo(ctl.InputByName(common.PortCANTx))
+	ctl.OutputByName(common.PortCANRx).PipeTo(g.MCU.InputByName(busPort(common.PortCANRx, b.Name)))
+	ctl.OutputByName(common.PortCANTx).PipeTo(trsv.InputByName(common.PortCANTx))
+	trsv.OutputByName(common.PortCANRx).PipeTo(ctl.InputByName(common.PortCANRx))
+
+	if g.MCU.HasChainableErr() {
+		return g.MCU.ChainableErr()
+	}
+
+	link := &can.Node{
+		UnitName:    linkName,
+		Controller:  ctl,
+		Transceiver: trsv,
+	}
+	can.Nodes{link}.ConnectToBus(b)
+
+	g.links = append(g.links, link)
+	g.busNames = append(g.busNames, b.Name)
+	return nil
+}
+
+// forward sends the frame to the destination bus of the first matching route
+func (g *Gateway) forward(this *component.Component, routes []*Route, busName string, frame *codec.Frame, receivedAt time.Duration) error {
+	routeIndex := slices.IndexFunc(routes, func(route *Route) bool {
+		return route.Matches(busName, frame)
+	})
+	if routeIndex < 0 {
+		this.Logger().Printf("filtered out 0x%03X from %s: no route", frame.Id, busName)
+		return nil
+	}
+	route := routes[routeIndex]
+
+	if !slices.Contains(g.busNames, route.To) {
+		return fmt.Errorf("route %s leads to unknown bus", route)
+	}
+
+	lastForwarded := this.State().Get(stateKeyLastForwarded).(map[*Route]time.Duration)
+	if last, ok := lastForwarded[route]; ok && route.MinInterval > 0 && receivedAt-last < route.MinInterval {
+		this.Logger().Printf("dropped 0x%03X by rate limit of %s: %s since the last frame", frame.Id, route, receivedAt-last)
+		return nil
+	}
+	lastForwarded[route] = receivedAt
+	this.State().Set(stateKeyLastForwarded, lastForwarded)
+
+	forwarded := *frame
+	forwarded.Id = route.Rewrite(frame.Id)
+	if !forwarded.IsValid() {
+		this.Logger().Printf("dropped 0x%03X by %s: rewritten ID 0x%X is invalid", frame.Id, route, forwarded.Id)
+		return nil
+	}
+
+	this.Logger().Printf("forwarding 0x%03X as 0x%03X by %s", frame.Id, forwarded.Id, route)
+	this.OutputByName(busPort(common.PortCANTx, route.To)).PutSignals(signal.New(&forwarded))
+	return nil
+}
+
+// LinkUnitName returns the unit name of the gateway controller and transceiver on the given bus
+func (g *Gateway) LinkUnitName(busName string) string {
+	return g.unitName + "-" + busName
+}
+
+// busPort returns the name of MCU port connected to the controller of the given bus
+func busPort(port, busName string) string {
+	return port + "-" + busName
+}
+
+// GetAllComponents returns all fmesh components of the gateway
+func (g *Gateway) GetAllComponents() []*component.Component {
+	all := []*component.Component{g.MCU}
+	for _, link := range g.links {
+		all = append(all, link.Controller, link.Transceiver)
+	}
+	return all
+}
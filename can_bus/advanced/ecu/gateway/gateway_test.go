@@ -0,0 +1,99 @@
+package gateway
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/bus"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/codec"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/common"
+	"github.com/hovsep/fmesh/signal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// received is a frame received by the gateway from the bus at the given bus time
+type received struct {
+	busName string
+	at      time.Duration
+	frame   *codec.Frame
+}
+
+func TestGatewayForward(t *testing.T) {
+	rateLimited := &Route{Name: "rate limited", From: "body", To: "powertrain", Id: 0x100, Mask: MaskStandardID, MinInterval: 10 * time.Millisecond}
+	rewriting := &Route{Name: "rewriting", From: "body", To: "powertrain", Id: 0x200, Mask: 0x700, RewriteId: 0x500, RewriteMask: 0x700}
+	invalid := &Route{Name: "invalid", From: "body", To: "powertrain", Id: 0x300, Mask: MaskStandardID, RewriteId: 0x800, RewriteMask: 0x800}
+	routes := append([]*Route{rateLimited, rewriting, invalid}, DiagnosticRoutes("tester", "powertrain")...)
+
+	tests := []struct {
+		name     string
+		received []received
+		want     map[string][]uint32 // Forwarded IDs by destination bus
+	}{
+		{
+			name: "diagnostic request and response",
+			received: []received{
+				{busName: "tester", frame: &codec.Frame{Id: 0x7DF, DLC: 8}},
+				{busName: "powertrain", frame: &codec.Frame{Id: 0x7E8, DLC: 8}},
+			},
+			want: map[string][]uint32{"powertrain": {0x7DF}, "tester": {0x7E8}},
+		},
+		{
+			name: "no route",
+			received: []received{
+				{busName: "tester", frame: &codec.Frame{Id: 0x100, DLC: 8}},
+				{busName: "powertrain", frame: &codec.Frame{Id: 0x7DF, DLC: 8}},
+				{busName: "body", frame: &codec.Frame{Id: 0x7DF, DLC: 8}},
+			},
+			want: map[string][]uint32{},
+		},
+		{
+			name: "rate limit",
+			received: []received{
+				{busName: "body", at: 0, frame: &codec.Frame{Id: 0x100, DLC: 1}},
+				{busName: "body", at: 9 * time.Millisecond, frame: &codec.Frame{Id: 0x100, DLC: 2}},
+				{busName: "body", at: 10 * time.Millisecond, frame: &codec.Frame{Id: 0x100, DLC: 3}},
+				{busName: "body", at: 15 * time.Millisecond, frame: &codec.Frame{Id: 0x100, DLC: 4}},
+				{busName: "body", at: 25 * time.Millisecond, frame: &codec.Frame{Id: 0x100, DLC: 5}},
+			},
+			want: map[string][]uint32{"powertrain": {0x100, 0x100, 0x100}},
+		},
+		{
+			name: "rewritten IDs",
+			received: []received{
+				{busName: "body", frame: &codec.Frame{Id: 0x234, DLC: 8}},
+				{busName: "body", frame: &codec.Frame{Id: 0x300, DLC: 8}},
+			},
+			want: map[string][]uint32{"powertrain": {0x534}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := New(GatewayUnitName, routes)
+			for _, busName := range []string{"tester", "powertrain", "body"} {
+				require.NoError(t, g.ConnectToBus(bus.New(busName)))
+			}
+
+			for _, r := range tt.received {
+				require.NoError(t, g.forward(g.MCU, routes, r.busName, r.frame, r.at))
+			}
+
+			forwarded := make(map[string][]uint32)
+			for _, busName := range g.busNames {
+				g.MCU.OutputByName(busPort(common.PortCANTx, busName)).Signals().ForEach(func(sig *signal.Signal) error {
+					forwarded[busName] = append(forwarded[busName], sig.PayloadOrNil().(*codec.Frame).Id)
+					return nil
+				})
+			}
+			assert.Equal(t, tt.want, forwarded)
+		})
+	}
+
+	t.Run("route to unknown bus", func(t *testing.T) {
+		g := New(GatewayUnitName, routes)
+		require.NoError(t, g.ConnectToBus(bus.New("body")))
+
+		err := g.forward(g.MCU, routes, "body", &codec.Frame{Id: 0x100, DLC: 8}, 0)
+		assert.ErrorContains(t, err, "route rate limited (body -> powertrain) leads to unknown bus")
+	})
+}
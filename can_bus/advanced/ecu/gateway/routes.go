@@ -0,0 +1,80 @@
+package gateway
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/codec"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/microcontroller"
+)
+
+// Route forwards the matching frames from one bus to another, frames not matched by any route are filtered out
+type Route struct {
+	Name     string
+	From     string // Source bus name
+	To       string // Destination bus name
+	Id       uint32 // Frame matches if its ID masked with Mask equals Id masked with Mask
+	Mask     uint32
+	Extended bool // Standard and extended IDs are different ID spaces
+
+	// Rewrite replaces the bits of ID selected by RewriteMask with the bits of RewriteId (no rewriting when the mask is zero)
+	RewriteId   uint32
+	RewriteMask uint32
+
+	// MinInterval is the rate limit: frames arriving sooner than this after the last forwarded one are dropped (zero is unlimited)
+	MinInterval time.Duration
+}
+
+const (
+	// Masks of the whole ID
+	MaskStandardID = codec.ProtocolMaxID
+	MaskExtendedID = codec.ProtocolMaxExtendedID
+
+	// Physical request and response IDs of ISO 15765-4 (up to 8 ECUs)
+	maskDiagnosticIDs    = 0x7F8
+	firstPhysicalRequest = microcontroller.FirstResponseID - microcontroller.ResponseAddressOffset
+)
+
+// Matches reports whether the route forwards the frame received from the given bus
+func (route *Route) Matches(busName string, frame *codec.Frame) bool {
+	return route.From == busName &&
+		route.Extended == frame.Extended &&
+		frame.Id&route.Mask == route.Id&route.Mask
+}
+
+// Rewrite returns the ID of the forwarded frame
+func (route *Route) Rewrite(id uint32) uint32 {
+	return id&^route.RewriteMask | route.RewriteId&route.RewriteMask
+}
+
+func (route *Route) String() string {
+	return fmt.Sprintf("%s (%s -> %s)", route.Name, route.From, route.To)
+}
+
+// DiagnosticRoutes lets the tester on one bus talk to ECUs on another one:
+// functional and physical OBD/UDS requests go to ECUs, responses come back to the tester
+func DiagnosticRoutes(testerBus, ecuBus string) []*Route {
+	return []*Route{
+		{
+			Name: "functional requests",
+			From: testerBus,
+			To:   ecuBus,
+			Id:   microcontroller.FunctionalRequestID,
+			Mask: MaskStandardID,
+		},
+		{
+			Name: "physical requests",
+			From: testerBus,
+			To:   ecuBus,
+			Id:   firstPhysicalRequest,
+			Mask: maskDiagnosticIDs,
+		},
+		{
+			Name: "responses",
+			From: ecuBus,
+			To:   testerBus,
+			Id:   microcontroller.FirstResponseID,
+			Mask: maskDiagnosticIDs,
+		},
+	}
+}
@@ -0,0 +1,129 @@
+package gateway
+
+import (
+	"testing"
+
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/codec"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouteMatches(t *testing.T) {
+	diagnostic := DiagnosticRoutes("tester", "powertrain")
+	extended := &Route{Name: "extended", From: "body", To: "powertrain", Id: 0x18DA0000, Mask: 0x1FFF0000, Extended: true}
+
+	tests := []struct {
+		name    string
+		route   *Route
+		busName string
+		frame   *codec.Frame
+		want    bool
+	}{
+		{
+			name:    "functional request",
+			route:   diagnostic[0],
+			busName: "tester",
+			frame:   &codec.Frame{Id: 0x7DF},
+			want:    true,
+		},
+		{
+			name:    "functional request from another bus",
+			route:   diagnostic[0],
+			busName: "powertrain",
+			frame:   &codec.Frame{Id: 0x7DF},
+			want:    false,
+		},
+		{
+			name:    "first physical request",
+			route:   diagnostic[1],
+			busName: "tester",
+			frame:   &codec.Frame{Id: 0x7E0},
+			want:    true,
+		},
+		{
+			name:    "last physical request",
+			route:   diagnostic[1],
+			busName: "tester",
+			frame:   &codec.Frame{Id: 0x7E7},
+			want:    true,
+		},
+		{
+			name:    "response is not a physical request",
+			route:   diagnostic[1],
+			busName: "tester",
+			frame:   &codec.Frame{Id: 0x7E8},
+			want:    false,
+		},
+		{
+			name:    "response",
+			route:   diagnostic[2],
+			busName: "powertrain",
+			frame:   &codec.Frame{Id: 0x7EF},
+			want:    true,
+		},
+		{
+			name:    "extended frame with the same base ID",
+			route:   diagnostic[1],
+			busName: "tester",
+			frame:   &codec.Frame{Id: 0x7E0, Extended: true},
+			want:    false,
+		},
+		{
+			name:    "extended route",
+			route:   extended,
+			busName: "body",
+			frame:   &codec.Frame{Id: 0x18DA10F1, Extended: true},
+			want:    true,
+		},
+		{
+			name:    "standard frame on extended route",
+			route:   extended,
+			busName: "body",
+			frame:   &codec.Frame{Id: 0x0},
+			want:    false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.route.Matches(tt.busName, tt.frame))
+		})
+	}
+}
+
+func TestRouteRewrite(t *testing.T) {
+	tests := []struct {
+		name  string
+		route *Route
+		id    uint32
+		want  uint32
+	}{
+		{
+			name:  "no rewriting",
+			route: &Route{},
+			id:    0x7E8,
+			want:  0x7E8,
+		},
+		{
+			name:  "whole ID",
+			route: &Route{RewriteId: 0x123, RewriteMask: MaskStandardID},
+			id:    0x7E8,
+			want:  0x123,
+		},
+		{
+			name:  "only masked bits",
+			route: &Route{RewriteId: 0x600, RewriteMask: 0x700},
+			id:    0x7E8,
+			want:  0x6E8,
+		},
+		{
+			name:  "bits of rewritten ID outside the mask are ignored",
+			route: &Route{RewriteId: 0x1FFFFFFF, RewriteMask: 0xFF},
+			id:    0x18DA10F1,
+			want:  0x18DA10FF,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.route.Rewrite(tt.id))
+		})
+	}
+}
@@ -4,9 +4,12 @@ import (
 	"errors"
 
 	"github.com/hovsep/fmesh-examples/can_bus/advanced/can"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/codec"
 	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/common"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/microcontroller"
 	"github.com/hovsep/fmesh/component"
 	"github.com/hovsep/fmesh/port"
+	"github.com/hovsep/fmesh/signal"
 )
 
 const (
@@ -19,16 +22,29 @@ const (
 // in real life OBD socket is not a can node, but for simplicity
 // we simulate OBD socket with plugged-in OBD adapter as a single CAN node
 func NewNode() *can.Node {
+	// Like real adapters, OBD handles flow control of segmented responses, so the laptop does not need to
+	transport := microcontroller.NewISOTPTransport(microcontroller.DefaultISOTPConfig())
+
 	obdDevice := can.NewNode(OBDUnitName, func(state component.State) {
 	},
 		func(this *component.Component) error {
+			transport.Tick(this)
+
+			errFlowControl := this.InputByName(common.PortCANRx).Signals().ForEach(func(sig *signal.Signal) error {
+				frame, ok := sig.PayloadOrNil().(*codec.Frame)
+				if !ok {
+					return errors.New("failed to cast payload to CAN frame")
+				}
+				handleResponseFrame(this, transport, frame)
+				return nil
+			}).ChainableErr()
 
 			errRx := port.ForwardSignals(this.InputByName(common.PortCANRx), this.OutputByName(PortOBDOut))
 
 			// Everything received by OBD interface goes to can bus (todo: make it realistic, process only first signal, as OBD can not receive multiple frames at the same time)
 			errTx := port.ForwardSignals(this.InputByName(PortOBDIn), this.OutputByName(common.PortCANTx))
 
-			return errors.Join(errRx, errTx)
+			return errors.Join(errFlowControl, errRx, errTx)
 		})
 
 	// Add custom ports
@@ -39,3 +55,21 @@ func NewNode() *can.Node {
 
 	return obdDevice
 }
+
+// handleResponseFrame passes ECU responses to ISO-TP transport, which answers first frames with flow control
+func handleResponseFrame(this *component.Component, transport *microcontroller.ISOTPTransport, frame *codec.Frame) {
+	if frame.Extended || frame.Remote || frame.Id < microcontroller.FirstResponseID || frame.Id > microcontroller.LastResponseID {
+		return
+	}
+
+	isoFrame, err := microcontroller.ParseISOTPFrame(frame)
+	if err != nil {
+		this.Logger().Printf("skipping response from 0x%03X: %s", frame.Id, err)
+		return
+	}
+
+	payload := transport.Receive(this, frame.Id, isoFrame, frame.Id-microcontroller.ResponseAddressOffset)
+	if payload != nil {
+		this.Logger().Printf("received ISO-TP response from 0x%03X: % X", frame.Id, payload)
+	}
+}
@@ -2,6 +2,7 @@ package transmission
 
 import (
 	"github.com/hovsep/fmesh-examples/can_bus/advanced/can"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/controller"
 	"github.com/hovsep/fmesh-examples/can_bus/advanced/microcontroller"
 	"github.com/hovsep/fmesh/component"
 )
@@ -15,8 +16,14 @@ const (
 	tcmPIDVIN           microcontroller.ParameterID = 0x02
 	tcmPIDCalibrationID microcontroller.ParameterID = 0x04
 
+	tcmDIDCalibrationID microcontroller.DataIdentifier = 0xF181
+	tcmDIDVIN           microcontroller.DataIdentifier = 0xF190
+
 	tcmStateKeyParams = "params"
 	tcmStateKeyDTCs   = "dtcs"
+
+	// tcmSecurityMask is the secret of security access (the key is the seed masked with it)
+	tcmSecurityMask = 0x7C3A
 )
 
 var (
@@ -53,11 +60,21 @@ var (
 				},
 			},
 		},
+		// Workshop tools talk UDS
+		UDS: microcontroller.NewUDSServer(getSecurityKey).
+			WithDataIdentifier(tcmDIDVIN, microcontroller.DataIdentifierDescriptor{
+				Read: readVIN,
+			}).
+			WithDataIdentifier(tcmDIDCalibrationID, microcontroller.DataIdentifierDescriptor{
+				Read: readCalibrationID,
+			}).
+			WithDTCs(readDTCs, clearDTCs),
 	}
 )
 
+// NewNode creates the TCM node, its controller passes to MCU only the frames handled by the logic
 func NewNode() *can.Node {
-	return can.NewNode(TCMUnitName, func(state component.State) {
+	return can.NewNodeWithConfig(TCMUnitName, &controller.Config{Filters: tcmLogic.AcceptanceFilters()}, func(state component.State) {
 		// Set parameter values
 		paramState := microcontroller.ParamsState{
 			tcmPIDFluidTemp:     byte(88),
@@ -98,16 +115,7 @@ func getGearPosition(mode microcontroller.AddressingMode, req *microcontroller.I
 
 func getDTCs(mode microcontroller.AddressingMode, req *microcontroller.ISOTPMessage, mcu *component.Component) (*microcontroller.ISOTPMessage, error) {
 	dtcs := mcu.State().Get(tcmStateKeyDTCs).([]microcontroller.DTC)
-
-	var data []byte
-	for _, dtc := range dtcs {
-		data = append(data, dtc[0], dtc[1])
-	}
-
-	return &microcontroller.ISOTPMessage{
-		ServiceID: microcontroller.ResponseReadStoredDiagnosticCodes,
-		Data:      data,
-	}, nil
+	return microcontroller.StoredDiagnosticCodesResponse(dtcs), nil
 }
 
 func getVIN(mode microcontroller.AddressingMode, req *microcontroller.ISOTPMessage, mcu *component.Component) (*microcontroller.ISOTPMessage, error) {
@@ -116,7 +124,7 @@ func getVIN(mode microcontroller.AddressingMode, req *microcontroller.ISOTPMessa
 	return &microcontroller.ISOTPMessage{
 		ServiceID: microcontroller.ResponseVehicleInformation,
 		PID:       tcmPIDVIN,
-		Data:      microcontroller.FitDataIntoSingleFrame(vin),
+		Data:      microcontroller.VehicleInformationData(vin),
 	}, nil
 }
 
@@ -126,6 +134,29 @@ func getCalibrationID(mode microcontroller.AddressingMode, req *microcontroller.
 	return &microcontroller.ISOTPMessage{
 		ServiceID: microcontroller.ResponseVehicleInformation,
 		PID:       tcmPIDCalibrationID,
-		Data:      microcontroller.FitDataIntoSingleFrame(id),
+		Data:      microcontroller.VehicleInformationData(id),
 	}, nil
 }
+
+func getSecurityKey(seed uint16) uint16 {
+	return seed ^ tcmSecurityMask
+}
+
+func readVIN(mcu *component.Component) []byte {
+	state := mcu.State().Get(tcmStateKeyParams).(microcontroller.ParamsState)
+	return state[tcmPIDVIN].([]byte)
+}
+
+func readCalibrationID(mcu *component.Component) []byte {
+	state := mcu.State().Get(tcmStateKeyParams).(microcontroller.ParamsState)
+	return state[tcmPIDCalibrationID].([]byte)
+}
+
+func readDTCs(mcu *component.Component) []microcontroller.DTC {
+	return mcu.State().Get(tcmStateKeyDTCs).([]microcontroller.DTC)
+}
+
+func clearDTCs(mcu *component.Component) {
+	mcu.Logger().Println("DTCs cleared")
+	mcu.State().Set(tcmStateKeyDTCs, []microcontroller.DTC{})
+}
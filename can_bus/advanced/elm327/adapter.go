@@ -0,0 +1,83 @@
+package elm327
+
+import (
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/codec"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/ecu/obd"
+	"github.com/hovsep/fmesh/component"
+	"github.com/hovsep/fmesh/port"
+	"github.com/hovsep/fmesh/signal"
+)
+
+// Adapter is the simulated side of ELM327 dongle: it puts requests into OBD socket and collects frames coming back
+type Adapter struct {
+	adapterComponent *component.Component
+}
+
+const (
+	portOBDRx     = "obd_rx"
+	portOBDTx     = "obd_tx"
+	portRequestIn = "request_in"
+
+	stateKeyReceivedFrames = "received_frames"
+)
+
+func NewAdapter() *Adapter {
+	return &Adapter{
+		adapterComponent: component.New("elm327").
+			AddInputs(portOBDRx, portRequestIn).
+			AddOutputs(portOBDTx).
+			WithInitialState(func(state component.State) {
+				state.Set(stateKeyReceivedFrames, []*codec.Frame{})
+			}).
+			WithActivationFunc(func(this *component.Component) error {
+				// Requests typed by the user go to OBD socket
+				err := port.ForwardSignals(this.InputByName(portRequestIn), this.OutputByName(portOBDTx))
+				if err != nil {
+					return err
+				}
+
+				received := this.State().Get(stateKeyReceivedFrames).([]*codec.Frame)
+				this.InputByName(portOBDRx).Signals().ForEach(func(sig *signal.Signal) error {
+					if frame, ok := sig.PayloadOrNil().(*codec.Frame); ok {
+						received = append(received, frame)
+					}
+					return nil
+				})
+				this.State().Set(stateKeyReceivedFrames, received)
+				return nil
+			}),
+	}
+}
+
+// send queues the request for OBD socket (it reaches the bus when the mesh runs)
+func (a *Adapter) send(frame *codec.Frame) {
+	a.adapterComponent.InputByName(portRequestIn).PutSignals(signal.New(frame))
+}
+
+// takeReceived returns the frames received since the last call
+func (a *Adapter) takeReceived() []*codec.Frame {
+	received := a.adapterComponent.State().Get(stateKeyReceivedFrames).([]*codec.Frame)
+	a.adapterComponent.State().Set(stateKeyReceivedFrames, []*codec.Frame{})
+	return received
+}
+
+func (a *Adapter) ConnectToOBD(OBDSocket *can.Node) error {
+	a.adapterComponent.OutputByName(portOBDTx).PipeTo(OBDSocket.MCU.InputByName(obd.PortOBDIn))
+	OBDSocket.MCU.OutputByName(obd.PortOBDOut).PipeTo(a.adapterComponent.InputByName(portOBDRx))
+	if a.adapterComponent.HasChainableErr() {
+		return a.adapterComponent.ChainableErr()
+	}
+
+	if OBDSocket.MCU.HasChainableErr() {
+		return OBDSocket.MCU.ChainableErr()
+	}
+
+	return nil
+}
+
+func (a *Adapter) GetAllComponents() []*component.Component {
+	return []*component.Component{
+		a.adapterComponent,
+	}
+}
@@ -0,0 +1,244 @@
+package elm327
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/codec"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/microcontroller"
+)
+
+// RequestFunc puts the request frame on the bus and returns all frames received until the bus is quiet
+type RequestFunc func(request *codec.Frame) ([]*codec.Frame, error)
+
+// Settings are the options changed by AT commands
+type Settings struct {
+	Echo      bool   // ATE: repeat the command line
+	Headers   bool   // ATH: show CAN IDs and PCI bytes
+	Linefeeds bool   // ATL: end lines with CR LF instead of CR
+	Spaces    bool   // ATS: separate bytes with spaces
+	Protocol  byte   // ATSP: '0' (automatic) or '6' (ISO 15765-4 CAN 11/500)
+	Header    uint32 // ATSH: ID of request frames
+}
+
+// Interpreter is the command interpreter of ELM327: AT commands configure the adapter, hex lines are OBD requests
+type Interpreter struct {
+	settings Settings
+}
+
+const (
+	Version = "ELM327 v1.5"
+	Prompt  = ">"
+
+	protocolAutomatic  = '0'
+	protocolCAN11Bit   = '6'
+	protocolCAN11BitID = "ISO 15765-4 (CAN 11/500)"
+
+	responseOK       = "OK"
+	responseUnknown  = "?"
+	responseNoData   = "NO DATA"
+	responseCANError = "CAN ERROR"
+)
+
+// DefaultSettings returns the settings after reset (ATZ)
+func DefaultSettings() Settings {
+	return Settings{
+		Echo:     true,
+		Spaces:   true,
+		Protocol: protocolAutomatic,
+		Header:   microcontroller.FunctionalRequestID,
+	}
+}
+
+func NewInterpreter() *Interpreter {
+	return &Interpreter{
+		settings: DefaultSettings(),
+	}
+}
+
+// Greeting is printed when the adapter is powered up
+func (i *Interpreter) Greeting() string {
+	return i.format([]string{Version})
+}
+
+// Execute runs the command line and returns the output terminated by the prompt
+func (i *Interpreter) Execute(line string, request RequestFunc) string {
+	// Echo uses the settings before the command (ATE0 is still echoed)
+	var echo string
+	if i.settings.Echo {
+		echo = line + "\r"
+	}
+
+	command := strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(line), " ", ""))
+	if strings.HasPrefix(command, "AT") {
+		return echo + i.format(i.executeAT(command[2:]))
+	}
+	return echo + i.format(i.executeRequest(command, request))
+}
+
+// executeAT changes the settings, commands having no effect in the simulation (e.g., timeouts) are acknowledged
+func (i *Interpreter) executeAT(command string) []string {
+	switch {
+	case command == "Z" || command == "WS":
+		i.settings = DefaultSettings()
+		return []string{"", Version}
+	case command == "I":
+		return []string{Version}
+	case command == "D":
+		i.settings = DefaultSettings()
+		return []string{responseOK}
+	case command == "DP":
+		if i.settings.Protocol == protocolAutomatic {
+			return []string{"AUTO, " + protocolCAN11BitID}
+		}
+		return []string{protocolCAN11BitID}
+	case command == "DPN":
+		if i.settings.Protocol == protocolAutomatic {
+			return []string{"A" + string(protocolCAN11Bit)}
+		}
+		return []string{string(protocolCAN11Bit)}
+	case strings.HasPrefix(command, "SP") || strings.HasPrefix(command, "TP"):
+		// The simulated bus speaks only one protocol
+		protocol := strings.TrimPrefix(command[2:], "A")
+		if protocol != string(protocolAutomatic) && protocol != string(protocolCAN11Bit) {
+			return []string{responseUnknown}
+		}
+		i.settings.Protocol = protocol[0]
+		return []string{responseOK}
+	case strings.HasPrefix(command, "SH"):
+		header, err := strconv.ParseUint(command[2:], 16, 32)
+		if err != nil || len(command[2:]) != 3 || header > codec.ProtocolMaxID {
+			return []string{responseUnknown}
+		}
+		i.settings.Header = uint32(header)
+		return []string{responseOK}
+	case strings.HasPrefix(command, "AT") || strings.HasPrefix(command, "ST") || command == "CAF1" || command == "M0" || command == "M1":
+		// Timing and memory options: the simulated ECUs answer immediately, nothing is stored
+		return []string{responseOK}
+	}
+
+	// On/off switches
+	if len(command) == 2 && (command[1] == '0' || command[1] == '1') {
+		on := command[1] == '1'
+		switch command[0] {
+		case 'E':
+			i.settings.Echo = on
+		case 'H':
+			i.settings.Headers = on
+		case 'L':
+			i.settings.Linefeeds = on
+		case 'S':
+			i.settings.Spaces = on
+		default:
+			return []string{responseUnknown}
+		}
+		return []string{responseOK}
+	}
+
+	return []string{responseUnknown}
+}
+
+// executeRequest sends OBD request (e.g., "010C") as a single frame and formats the responses
+func (i *Interpreter) executeRequest(command string, request RequestFunc) []string {
+	// The optional last digit limits the number of responses, the simulation waits until the bus is quiet anyway
+	if len(command)%2 == 1 {
+		command = command[:len(command)-1]
+	}
+
+	data, err := hex.DecodeString(command)
+	if err != nil || len(data) == 0 || len(data) > microcontroller.MaxSingleFramePayload {
+		return []string{responseUnknown}
+	}
+
+	isoFrame := &microcontroller.ISOTPFrame{
+		Type:   microcontroller.ISOTPSingleFrame,
+		Length: len(data),
+		Data:   data,
+	}
+
+	frames, err := request(isoFrame.ToCANFrame(i.settings.Header))
+	if err != nil {
+		return []string{responseCANError}
+	}
+
+	var lines []string
+	for _, frame := range frames {
+		if !i.isResponse(frame) {
+			continue
+		}
+		lines = append(lines, i.formatFrame(frame)...)
+	}
+
+	if len(lines) == 0 {
+		return []string{responseNoData}
+	}
+	return lines
+}
+
+// isResponse tells whether the frame passes the receive filter: functional requests are answered by any ECU,
+// physical ones only by the addressed ECU
+func (i *Interpreter) isResponse(frame *codec.Frame) bool {
+	if frame.Extended || frame.Remote {
+		return false
+	}
+
+	if i.settings.Header == microcontroller.FunctionalRequestID {
+		return frame.Id >= microcontroller.FirstResponseID && frame.Id <= microcontroller.LastResponseID
+	}
+	return frame.Id == i.settings.Header+microcontroller.ResponseAddressOffset
+}
+
+// formatFrame formats the response frame as ELM327 does with CAN auto formatting:
+// with headers the ID and all data bytes are shown, otherwise single frames show only the message
+// and segmented messages show the length followed by numbered lines
+func (i *Interpreter) formatFrame(frame *codec.Frame) []string {
+	data := frame.Data[:frame.DLC]
+	if i.settings.Headers {
+		return []string{fmt.Sprintf("%03X", frame.Id) + i.separator() + i.formatBytes(data)}
+	}
+
+	isoFrame, err := microcontroller.ParseISOTPFrame(frame)
+	if err != nil {
+		return []string{i.formatBytes(data)}
+	}
+
+	switch isoFrame.Type {
+	case microcontroller.ISOTPSingleFrame:
+		return []string{i.formatBytes(isoFrame.Data)}
+	case microcontroller.ISOTPFirstFrame:
+		return []string{
+			fmt.Sprintf("%03X", isoFrame.Length),
+			"0:" + i.separator() + i.formatBytes(isoFrame.Data),
+		}
+	case microcontroller.ISOTPConsecutiveFrame:
+		return []string{fmt.Sprintf("%X:", isoFrame.SequenceNumber) + i.separator() + i.formatBytes(isoFrame.Data)}
+	default:
+		// Flow control frames of other nodes are not shown
+		return nil
+	}
+}
+
+func (i *Interpreter) formatBytes(data []byte) string {
+	if !i.settings.Spaces {
+		return fmt.Sprintf("%X", data)
+	}
+	return fmt.Sprintf("% X", data)
+}
+
+func (i *Interpreter) separator() string {
+	if !i.settings.Spaces {
+		return ""
+	}
+	return " "
+}
+
+// format terminates the lines and adds the empty line and the prompt
+func (i *Interpreter) format(lines []string) string {
+	eol := "\r"
+	if i.settings.Linefeeds {
+		eol = "\r\n"
+	}
+	return strings.Join(lines, eol) + eol + eol + Prompt
+}
@@ -0,0 +1,127 @@
+package elm327
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/codec"
+	"github.com/stretchr/testify/assert"
+)
+
+func responseFrame(id uint32, data ...byte) *codec.Frame {
+	frame := &codec.Frame{
+		Id:  id,
+		DLC: 8,
+	}
+	copy(frame.Data[:], data)
+	return frame
+}
+
+// fakeBus answers any request with the given frames and remembers the request
+func fakeBus(sent **codec.Frame, frames ...*codec.Frame) RequestFunc {
+	return func(request *codec.Frame) ([]*codec.Frame, error) {
+		*sent = request
+		return frames, nil
+	}
+}
+
+func TestInterpreterExecute(t *testing.T) {
+	vinFrames := []*codec.Frame{
+		responseFrame(0x7E8, 0x10, 0x14, 0x49, 0x02, 0x01, 0x56, 0x46, 0x31),
+		responseFrame(0x7E0, 0x30, 0x00, 0x00), // Flow control of the tester is not shown
+		responseFrame(0x7E8, 0x21, 0x41, 0x42, 0x30, 0x30, 0x30, 0x31, 0x32),
+		responseFrame(0x7E8, 0x22, 0x33, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39),
+	}
+
+	tests := []struct {
+		name            string
+		setup           []string
+		line            string
+		frames          []*codec.Frame
+		expected        string
+		expectedRequest *codec.Frame
+	}{
+		{
+			name:     "reset is echoed",
+			line:     "ATZ",
+			expected: "ATZ\r\rELM327 v1.5\r\r>",
+		},
+		{
+			name:     "echo off",
+			line:     "ate0",
+			expected: "ate0\rOK\r\r>",
+		},
+		{
+			name:     "unknown command",
+			setup:    []string{"ATE0"},
+			line:     "ATXYZ",
+			expected: "?\r\r>",
+		},
+		{
+			name:     "unsupported protocol",
+			setup:    []string{"ATE0"},
+			line:     "ATSP3",
+			expected: "?\r\r>",
+		},
+		{
+			name:            "single frame response",
+			setup:           []string{"ATE0"},
+			line:            "01 0C",
+			frames:          []*codec.Frame{responseFrame(0x7E8, 0x04, 0x41, 0x0C, 0x1F, 0x00)},
+			expected:        "41 0C 1F 00\r\r>",
+			expectedRequest: responseFrame(0x7DF, 0x02, 0x01, 0x0C),
+		},
+		{
+			name:            "headers without spaces and physical addressing",
+			setup:           []string{"ATE0", "ATH1", "ATS0", "ATL1", "ATSH7E0"},
+			line:            "0105",
+			frames:          []*codec.Frame{responseFrame(0x7E8, 0x03, 0x41, 0x05, 0x5F)},
+			expected:        "7E80341055F00000000\r\n\r\n>",
+			expectedRequest: responseFrame(0x7E0, 0x02, 0x01, 0x05),
+		},
+		{
+			name:            "segmented response",
+			setup:           []string{"ATE0"},
+			line:            "0902",
+			frames:          vinFrames,
+			expected:        "014\r0: 49 02 01 56 46 31\r1: 41 42 30 30 30 31 32\r2: 33 34 35 36 37 38 39\r\r>",
+			expectedRequest: responseFrame(0x7DF, 0x02, 0x09, 0x02),
+		},
+		{
+			name:     "response of other ECU is filtered out",
+			setup:    []string{"ATE0", "ATSH7E1"},
+			line:     "0105",
+			frames:   []*codec.Frame{responseFrame(0x7E8, 0x03, 0x41, 0x05, 0x5F)},
+			expected: "NO DATA\r\r>",
+		},
+		{
+			name:     "invalid request",
+			setup:    []string{"ATE0"},
+			line:     "01 0C 00 00 00 00 00 00",
+			expected: "?\r\r>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			interpreter := NewInterpreter()
+			var sent *codec.Frame
+			for _, line := range tt.setup {
+				interpreter.Execute(line, fakeBus(&sent))
+			}
+
+			assert.Equal(t, tt.expected, interpreter.Execute(tt.line, fakeBus(&sent, tt.frames...)))
+			if tt.expectedRequest != nil {
+				assert.Equal(t, tt.expectedRequest, sent)
+			}
+		})
+	}
+}
+
+func TestInterpreterBusError(t *testing.T) {
+	interpreter := NewInterpreter()
+	output := interpreter.Execute("0100", func(request *codec.Frame) ([]*codec.Frame, error) {
+		return nil, errors.New("bus is broken")
+	})
+	assert.Equal(t, "0100\rCAN ERROR\r\r>", output)
+}
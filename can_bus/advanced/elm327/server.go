@@ -0,0 +1,99 @@
+package elm327
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/hovsep/fmesh"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/codec"
+)
+
+// AddressEnv is the environment variable with the TCP address of the emulator (e.g., "localhost:35000"),
+// the serial port of scanner software can be bridged to it, e.g.: socat pty,link=/tmp/elm327,raw tcp:localhost:35000
+const AddressEnv = "CAN_ELM327_ADDR"
+
+// Server exposes ELM327 interface over TCP, each request runs the mesh until the bus is quiet
+type Server struct {
+	fm      *fmesh.FMesh
+	adapter *Adapter
+}
+
+func NewServer(fm *fmesh.FMesh, adapter *Adapter) *Server {
+	return &Server{
+		fm:      fm,
+		adapter: adapter,
+	}
+}
+
+// ListenAndServe accepts clients one by one (there is one vehicle and one dongle)
+func (s *Server) ListenAndServe(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+	defer listener.Close()
+
+	fmt.Println("ELM327 emulator is listening on", listener.Addr())
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return fmt.Errorf("failed to accept: %w", err)
+		}
+
+		fmt.Println("Client connected:", conn.RemoteAddr())
+		s.Serve(conn)
+		conn.Close()
+		fmt.Println("Client disconnected:", conn.RemoteAddr())
+	}
+}
+
+// Serve runs the command interpreter until the client disconnects, the settings are reset for each client
+func (s *Server) Serve(conn io.ReadWriter) {
+	interpreter := NewInterpreter()
+
+	_, err := io.WriteString(conn, interpreter.Greeting())
+	if err != nil {
+		return
+	}
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Split(scanCommandLines)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		_, err = io.WriteString(conn, interpreter.Execute(line, s.request))
+		if err != nil {
+			return
+		}
+	}
+}
+
+// request runs the mesh with the request frame and returns the frames received by the adapter
+func (s *Server) request(frame *codec.Frame) ([]*codec.Frame, error) {
+	s.adapter.send(frame)
+	_, err := s.fm.Run()
+	return s.adapter.takeReceived(), err
+}
+
+// scanCommandLines splits the input into lines terminated by CR (as ELM327 expects) or LF (as terminals send)
+func scanCommandLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
@@ -2,24 +2,32 @@ package main
 
 import (
 	"fmt"
+	"math"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/hovsep/fmesh"
 	"github.com/hovsep/fmesh-examples/can_bus/advanced/can"
 	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/bus"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/candump"
 	"github.com/hovsep/fmesh-examples/can_bus/advanced/diagnostics"
 	"github.com/hovsep/fmesh-examples/can_bus/advanced/ecu/engine"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/ecu/gateway"
 	"github.com/hovsep/fmesh-examples/can_bus/advanced/ecu/obd"
 	"github.com/hovsep/fmesh-examples/can_bus/advanced/ecu/transmission"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/elm327"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/sniffer"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/waveform"
 	"github.com/hovsep/fmesh-examples/internal"
+	"github.com/hovsep/fmesh/component"
 )
 
 // This demo simulates a CAN bus system with a laptop connected via a USB–OBD interface.
 //
-// The simulated bus has three connected nodes:
-//   - Engine Control Unit (ECU)
-//   - Transmission Control Unit (TCU)
-//   - On-Board Diagnostics (OBD) socket
+// The vehicle has two buses connected by the gateway ECU, which routes only diagnostic frames between them:
+//   - Powertrain bus (PT-CAN): Engine Control Unit (ECU), Transmission Control Unit (TCU) and a passive sniffer
+//   - Body bus (BODY-CAN): On-Board Diagnostics (OBD) socket
 //
 // Each node consists of:
 //   - A Microcontroller Unit (MCU) running high-level application logic
@@ -39,22 +47,38 @@ import (
 //   2. The laptop forwards any "USB-labeled" frames to its USB port.
 //   3. The USB connection routes data to the OBD socket.
 //   4. The OBD node simply relays received data to the CAN bus, and forwards bus data to its output.
-//   5. Once diagnostic frames reach the bus, all connected ECUs receive them.
+//   5. Once diagnostic frames reach the body bus, the gateway forwards them to the powertrain bus, where all connected ECUs receive them.
 //   6. The receive path in any node is: Transceiver (voltages) → Controller (bits) → MCU (frames).
 //      The transmit path is the reverse.
-//   7. MCUs may optionally run higher-layer protocols on top of CAN (e.g., ISO-TP).
+//   7. MCUs may optionally run higher-layer protocols on top of CAN (e.g., ISO-TP, UDS), the engine ECU also broadcasts cyclic messages.
 //   8. Depending on the addressing mode (functional vs physical), requests may be answered by multiple ECUs (e.g., VIN request) or by a single ECU (e.g., gear position).
 //
 // Notes:
-//   - This is a simplified model: CAN frames here omit CRC and ACK fields.
-//   - However, essential behaviors such as bit stuffing, arbitration, and wired-AND logic are implemented.
+//   - This is a simplified model: overload frames are not implemented.
+//   - However, essential behaviors such as bit stuffing, CRC, acknowledgement, arbitration, error signalling and wired-AND logic are implemented.
 //   - Powered by F-Mesh, all nodes run concurrently without explicitly using goroutines— even components within the same node can run in parallel.
-//   - The architecture is modular: you can add more nodes, noise generators, or even virtual instruments (e.g., a voltmeter to plot bus waveforms).
+//   - The architecture is modular: you can add more nodes, noise generators, or more virtual instruments.
+//   - Environment variables enable the ELM327 emulator, candump logs, waveforms, noise and bus length (see README.md).
 
-var laptopInstance *diagnostics.Laptop
+// cyclesLimit bounds the run: the scripted session takes about 200k cycles,
+// while on the bus longer than its max length corrupted frames are retransmitted forever
+const cyclesLimit = 1_000_000
+
+var (
+	laptopInstance *diagnostics.Laptop
+	elmAdapter     *elm327.Adapter
+	dumpLog        *os.File
+	vcdFile        *os.File
+)
 
 func main() {
 	fm := getMesh()
+	if dumpLog != nil {
+		defer dumpLog.Close()
+	}
+	if vcdFile != nil {
+		defer vcdFile.Close()
+	}
 
 	// Generate graphs if needed
 	err := internal.HandleGraphFlag(fm, true)
@@ -63,6 +87,16 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Serve scanner software over ELM327 interface instead of the scripted diagnostic session
+	if address := os.Getenv(elm327.AddressEnv); address != "" {
+		err = elm327.NewServer(fm, elmAdapter).ListenAndServe(address)
+		if err != nil {
+			fmt.Println("ELM327 emulator stopped with error: ", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Initialize the mesh: set diagnostic frames to USB port, so the laptop will send them
 	laptopInstance.SendDataToUSB(
 		diagnostics.FrameGetEngineDTCs,
@@ -72,9 +106,21 @@ func main() {
 		diagnostics.FrameGetCalibrationID,
 		diagnostics.FrameGetVIN,
 		diagnostics.FrameGetTransmissionFluidTemperature,
+		diagnostics.FramePollCoolantTemperature,
+		diagnostics.FrameStartExtendedSession,
+		diagnostics.FrameRequestSeed,
+		diagnostics.FrameSendKey,
+		diagnostics.FrameWriteIdleRPMTarget,
+		diagnostics.FrameReadIdleRPMTargetAndVIN,
+		diagnostics.FrameReadDTCsByStatus,
+		diagnostics.FrameClearAllDTCs,
+		diagnostics.FrameTesterPresent,
+		diagnostics.FrameHardReset,
 	)
 
+	// Report whatever was answered, even when the run is stopped by the cycles limit
 	runResult, err := fm.Run()
+	fmt.Print(laptopInstance.Report())
 	if err != nil {
 		fmt.Println("The mesh finished with error: ", err)
 		os.Exit(1)
@@ -83,20 +129,189 @@ func main() {
 	fmt.Printf("Mesh stopped after %d cycles and %s", runResult.Cycles.Len(), runResult.Duration())
 }
 
+// newBus creates the bus with propagation delays if the length is set and noisy if any fault is set
+func newBus(name string) *bus.Bus {
+	options := &bus.Options{
+		Disturbance: newDisturbanceConfig(),
+	}
+	if length := os.Getenv(bus.BusLengthEnv); length != "" {
+		options.Timing = newTiming(length)
+	}
+
+	b, err := bus.NewWithOptions(name, options)
+	if err != nil {
+		panic("Failed to create the bus: " + err.Error())
+	}
+
+	if options.Timing != nil {
+		fmt.Printf("%s is %g m long, sample point is at %d/%d time quanta: the longest bus for this bit timing is %.0f m\n",
+			name, options.Timing.Length, options.Timing.SamplePoint, options.Timing.TimeQuanta, options.Timing.MaxLength())
+		if options.Timing.Length > options.Timing.MaxLength() {
+			fmt.Printf("%s is too long: frames will be corrupted, the run is stopped after %d cycles\n", name, cyclesLimit)
+		}
+	}
+	return b
+}
+
+// newDisturbanceConfig returns the faults set in the environment (nil when there are none)
+func newDisturbanceConfig() *bus.DisturbanceConfig {
+	probability := os.Getenv(bus.BitFlipProbabilityEnv)
+	stuckDominant := os.Getenv(bus.StuckDominantEnv)
+	stuckRecessive := os.Getenv(bus.StuckRecessiveEnv)
+	if probability == "" && stuckDominant == "" && stuckRecessive == "" {
+		return nil
+	}
+
+	config := &bus.DisturbanceConfig{
+		Seed: 1,
+	}
+
+	var err error
+	if probability != "" {
+		config.BitFlipProbability, err = strconv.ParseFloat(probability, 64)
+		if err != nil {
+			panic("Invalid bit flip probability: " + err.Error())
+		}
+	}
+
+	if seed := os.Getenv(bus.NoiseSeedEnv); seed != "" {
+		config.Seed, err = strconv.ParseInt(seed, 10, 64)
+		if err != nil {
+			panic("Invalid noise seed: " + err.Error())
+		}
+	}
+
+	if stuckDominant != "" {
+		config.StuckDominant, err = bus.ParseWindows(stuckDominant)
+		if err != nil {
+			panic("Invalid stuck dominant windows: " + err.Error())
+		}
+	}
+
+	if stuckRecessive != "" {
+		config.StuckRecessive, err = bus.ParseWindows(stuckRecessive)
+		if err != nil {
+			panic("Invalid stuck recessive windows: " + err.Error())
+		}
+	}
+
+	return config
+}
+
+// newTiming returns the bit timing of the bus with the given length (the sample point is 87.5% unless set)
+func newTiming(length string) *bus.Timing {
+	meters, err := strconv.ParseFloat(length, 64)
+	if err != nil {
+		panic("Invalid bus length: " + err.Error())
+	}
+	timing := bus.DefaultTiming(meters)
+
+	if samplePoint := os.Getenv(bus.SamplePointEnv); samplePoint != "" {
+		percent, err := strconv.ParseFloat(samplePoint, 64)
+		if err != nil {
+			panic("Invalid sample point: " + err.Error())
+		}
+		timing.SamplePoint = int(math.Round(percent / 100 * float64(timing.TimeQuanta)))
+	}
+	return timing
+}
+
 func getMesh() *fmesh.FMesh {
 	// Create components:
-	ptBus := bus.New("PT-CAN")                                   // Modern vehicles have multiple buses, this one is called "powertrain bus"
+	ptBus := newBus("PT-CAN")                                    // Modern vehicles have multiple buses, this one is called "powertrain bus"
+	bodyBus := bus.New("BODY-CAN")                               // Body bus with the OBD socket, separated from the powertrain by the gateway
 	laptopInstance = diagnostics.NewLaptop("lenovo-ideapad-340") // Laptop running diagnostic software and connected to vehicle via OBD socket
+	elmAdapter = elm327.NewAdapter()                             // ELM327 dongle plugged into the same OBD socket (used only when the emulator is enabled)
 
 	// Build CAN nodes:
 	obdDevice := obd.NewNode() // putting this into a variable, so we can connect it to the laptop
 	allCanNodes := can.Nodes{
 		engine.NewNode(),       // Engine Control Module
 		transmission.NewNode(), // Transmission Control Module
-		obdDevice,              // On Board Diagnostics
+		sniffer.NewNode(),      // Bus monitor (listen-only, logs every frame with its transmitter and timing)
+	}
+	bodyCanNodes := can.Nodes{
+		obdDevice, // On Board Diagnostics
+	}
+
+	// Central gateway: diagnostic routing between the OBD socket and ECUs,
+	// legacy coolant temperature polling is allowed too (the answers are rate limited)
+	routes := append(gateway.DiagnosticRoutes(bodyBus.Name, ptBus.Name),
+		&gateway.Route{
+			Name: "coolant temperature polls",
+			From: bodyBus.Name,
+			To:   ptBus.Name,
+			Id:   engine.ECMCoolantTemperatureID,
+			Mask: gateway.MaskStandardID,
+		},
+		&gateway.Route{
+			Name:        "coolant temperature",
+			From:        ptBus.Name,
+			To:          bodyBus.Name,
+			Id:          engine.ECMCoolantTemperatureID,
+			Mask:        gateway.MaskStandardID,
+			MinInterval: 10 * time.Millisecond,
+		},
+	)
+	centralGateway := gateway.New(gateway.GatewayUnitName, routes)
+
+	// Optional tools: record the traffic to candump log and/or replay the log into the bus
+	if path := os.Getenv(candump.DumpLogEnv); path != "" {
+		var err error
+		dumpLog, err = os.Create(path)
+		if err != nil {
+			panic("Failed to create candump log: " + err.Error())
+		}
+		allCanNodes = append(allCanNodes, candump.NewRecorderNode(candump.DefaultInterface, dumpLog))
+	}
+
+	if path := os.Getenv(candump.ReplayLogEnv); path != "" {
+		replayLog, err := os.Open(path)
+		if err != nil {
+			panic("Failed to open candump log: " + err.Error())
+		}
+		entries, err := candump.ReadLog(replayLog)
+		replayLog.Close()
+		if err != nil {
+			panic("Failed to read candump log: " + err.Error())
+		}
+		allCanNodes = append(allCanNodes, candump.NewReplayNode(entries))
+	}
+
+	if ptBus.Timing != nil {
+		// ECUs are at the opposite ends of the bus, the gateway and the bus monitor are in the middle
+		ptBus.Timing.Positions[engine.ECMUnitName] = 0
+		ptBus.Timing.Positions[transmission.TCMUnitName] = ptBus.Timing.Length
+		ptBus.Timing.Positions[centralGateway.LinkUnitName(ptBus.Name)] = ptBus.Timing.Length / 2
+		ptBus.Timing.Positions[sniffer.SnifferUnitName] = ptBus.Timing.Length / 2
 	}
 
 	allCanNodes.ConnectToBus(ptBus)
+	bodyCanNodes.ConnectToBus(bodyBus)
+
+	for _, b := range []*bus.Bus{ptBus, bodyBus} {
+		err := centralGateway.ConnectToBus(b)
+		if err != nil {
+			panic("Failed to connect gateway to " + b.Name + ": " + err.Error())
+		}
+	}
+
+	// Optional instrument: capture the waveforms to VCD file
+	var instruments []*component.Component
+	if path := os.Getenv(waveform.VCDFileEnv); path != "" {
+		var err error
+		vcdFile, err = os.Create(path)
+		if err != nil {
+			panic("Failed to create VCD file: " + err.Error())
+		}
+
+		capture := waveform.NewCapture("vcd-capture", vcdFile)
+		err = capture.ConnectToBus(ptBus, allCanNodes)
+		if err != nil {
+			panic("Failed to connect VCD capture to the bus: " + err.Error())
+		}
+		instruments = append(instruments, capture.GetAllComponents()...)
+	}
 
 	// Connect laptop to OBD socket
 	err := laptopInstance.ConnectToOBD(obdDevice)
@@ -104,12 +319,24 @@ func getMesh() *fmesh.FMesh {
 		panic("Failed to connect laptop to OBD: " + err.Error())
 	}
 
+	// Connect ELM327 dongle to OBD socket
+	err = elmAdapter.ConnectToOBD(obdDevice)
+	if err != nil {
+		panic("Failed to connect ELM327 to OBD: " + err.Error())
+	}
+
 	// Build the mesh
 	return fmesh.NewWithConfig("can_bus_sim_v1", &fmesh.Config{
 		ErrorHandlingStrategy: fmesh.StopOnFirstErrorOrPanic,
+		CyclesLimit:           cyclesLimit,
 		Debug:                 false,
 	}).
 		AddComponents(laptopInstance.GetAllComponents()...).
+		AddComponents(elmAdapter.GetAllComponents()...).
 		AddComponents(ptBus.GetAllComponents()...).
-		AddComponents(allCanNodes.GetAllComponents()...)
+		AddComponents(bodyBus.GetAllComponents()...).
+		AddComponents(allCanNodes.GetAllComponents()...).
+		AddComponents(bodyCanNodes.GetAllComponents()...).
+		AddComponents(centralGateway.GetAllComponents()...).
+		AddComponents(instruments...)
 }
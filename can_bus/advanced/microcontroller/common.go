@@ -17,6 +17,8 @@ const (
 
 	FunctionalRequestID   = 0x7DF
 	ResponseAddressOffset = 0x08
+	FirstResponseID       = 0x7E8 // ISO 15765-4 reserves response IDs for up to 8 ECUs
+	LastResponseID        = 0x7EF
 
 	ServiceShowCurrentData           ServiceID = 0x01
 	ServiceReadStoredDiagnosticCodes ServiceID = 0x03
@@ -31,6 +33,29 @@ const (
 	NoPID ParameterID = 0x00
 )
 
+// StoredDiagnosticCodesResponse builds the response of service 0x03: the number of DTCs (in place of PID) followed by the codes
+func StoredDiagnosticCodesResponse(dtcs []DTC) *ISOTPMessage {
+	var data []byte
+	for _, dtc := range dtcs {
+		data = append(data, dtc[0], dtc[1])
+	}
+
+	return &ISOTPMessage{
+		ServiceID: ResponseReadStoredDiagnosticCodes,
+		PID:       ParameterID(len(dtcs)),
+		Data:      data,
+	}
+}
+
+// VehicleInformationData prepends the number of data items to the vehicle information (e.g., VIN) as service 0x09 responses do
+func VehicleInformationData(items ...[]byte) []byte {
+	data := []byte{byte(len(items))}
+	for _, item := range items {
+		data = append(data, item...)
+	}
+	return data
+}
+
 func (mode AddressingMode) String() string {
 	switch mode {
 	case FunctionalAddressing:
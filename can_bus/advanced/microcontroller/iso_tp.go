@@ -3,105 +3,206 @@ package microcontroller
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/codec"
 )
 
-// ISOTPMessage represents a simplified iso-15765 message (transport protocol over CAN-frames)
-// for simplicity we support only single-frame messages
+// ISOTPMessage represents an iso-15765 message (the payload transported over one or more CAN-frames)
 type ISOTPMessage struct {
 	ServiceID ServiceID
 	PID       ParameterID // Parameter ID
 	Data      []byte
 }
 
+// ISOTPFrameType is the type of ISO-TP frame (the high nibble of the protocol control information byte)
+type ISOTPFrameType byte
+
+// FlowStatus tells the sender whether it may continue sending consecutive frames
+type FlowStatus byte
+
+// ISOTPFrame is a CAN frame interpreted as ISO-TP frame
+type ISOTPFrame struct {
+	Type           ISOTPFrameType
+	Length         int        // Length of the whole message (single and first frames)
+	SequenceNumber byte       // 4-bit counter of consecutive frames (starts with 1 after the first frame)
+	FlowStatus     FlowStatus // Flow control frames only
+	BlockSize      byte       // Number of consecutive frames to send before waiting for the next flow control (0 means no limit)
+	STmin          byte       // Minimum separation time between consecutive frames (encoded as in flow control frame)
+	Data           []byte     // Message bytes carried by this frame (consecutive frames may carry padding at the end)
+}
+
 const (
-	ValidISOTPFrameDLC   = 8
-	MaxBytesInISOTPFrame = 5
+	ISOTPSingleFrame      ISOTPFrameType = 0x0
+	ISOTPFirstFrame       ISOTPFrameType = 0x1
+	ISOTPConsecutiveFrame ISOTPFrameType = 0x2
+	ISOTPFlowControlFrame ISOTPFrameType = 0x3
+
+	FlowStatusContinueToSend FlowStatus = 0x0
+	FlowStatusWait           FlowStatus = 0x1
+	FlowStatusOverflow       FlowStatus = 0x2
+
+	ValidISOTPFrameDLC        = 8
+	MaxSingleFramePayload     = 7     // PCI takes 1 byte
+	FirstFramePayload         = 6     // PCI takes 2 bytes (type and 12-bit message length)
+	ConsecutiveFramePayload   = 7     // PCI takes 1 byte (type and sequence number)
+	MaxISOTPMessageLength     = 0xFFF // 12-bit message length of the first frame
+	isoTPPaddingByte          = 0x00
+	isoTPSequenceNumberModulo = 0x10
 )
 
-func NewISOTPMessage() *ISOTPMessage {
-	return &ISOTPMessage{}
-}
-
-func (msg *ISOTPMessage) FromCANFrame(frame *codec.Frame) (*ISOTPMessage, error) {
-	if frame.DLC == 0 {
-		return nil, errors.New("frame has zero DLC")
+var (
+	isoTPFrameTypeNames = []string{
+		"single frame",
+		"first frame",
+		"consecutive frame",
+		"flow control",
 	}
 
-	if frame.DLC != ValidISOTPFrameDLC {
-		return nil, errors.New("given frame is not valid ISO-TP frame")
+	flowStatusNames = []string{
+		"continue to send",
+		"wait",
+		"overflow",
 	}
+)
 
-	pci := frame.Data[0]
-	frameType := pci >> 4
-	if frameType != 0 {
-		return nil, fmt.Errorf("unsupported ISO-TP frame type: %d (only single frame supported)", frameType)
+func (frameType ISOTPFrameType) String() string {
+	if int(frameType) >= len(isoTPFrameTypeNames) {
+		return "unknown"
 	}
+	return isoTPFrameTypeNames[frameType]
+}
 
-	payloadLen := pci & 0x0F
-	if payloadLen == 0 || payloadLen > 7 {
-		return nil, fmt.Errorf("invalid single frame payload length: %d", payloadLen)
+func (status FlowStatus) String() string {
+	if int(status) >= len(flowStatusNames) {
+		return "unknown"
 	}
+	return flowStatusNames[status]
+}
 
-	if int(payloadLen)+1 > int(frame.DLC) {
-		return nil, fmt.Errorf("frame DLC (%d) less than expected payload size (%d)", frame.DLC, payloadLen+1)
-	}
+func NewISOTPMessage() *ISOTPMessage {
+	return &ISOTPMessage{}
+}
 
-	// payload bytes start from Data[1]
-	if payloadLen < 2 {
-		return nil, fmt.Errorf("payload too short to contain service and PID, length: %d", payloadLen)
+// FromPayload parses the reassembled message: service ID, PID and data
+// (requests of services without parameters, e.g. 0x03, may consist of the service ID only)
+func (msg *ISOTPMessage) FromPayload(payload []byte) (*ISOTPMessage, error) {
+	if len(payload) == 0 {
+		return nil, errors.New("empty payload")
 	}
 
-	serviceID := frame.Data[1]
-	pid := frame.Data[2]
-
-	dataLen := int(payloadLen) - 2
-	if dataLen < 0 {
-		return nil, fmt.Errorf("payload length too short for ServiceID and PID: %d", payloadLen)
+	if len(payload) == 1 {
+		return &ISOTPMessage{
+			ServiceID: ServiceID(payload[0]),
+			PID:       NoPID,
+			Data:      []byte{},
+		}, nil
 	}
 
-	dataBytes := make([]byte, dataLen)
-	copy(dataBytes, frame.Data[3:3+dataLen])
+	dataBytes := make([]byte, len(payload)-2)
+	copy(dataBytes, payload[2:])
 
 	return &ISOTPMessage{
-		ServiceID: ServiceID(serviceID),
-		PID:       ParameterID(pid),
+		ServiceID: ServiceID(payload[0]),
+		PID:       ParameterID(payload[1]),
 		Data:      dataBytes,
 	}, nil
 }
 
-func (msg *ISOTPMessage) ToCANFrame(id uint32) (*codec.Frame, error) {
+// ToPayload returns the bytes to be transported: service ID, PID and data
+func (msg *ISOTPMessage) ToPayload() ([]byte, error) {
 	if msg == nil {
 		return nil, errors.New("nil ISOTPMessage")
 	}
 
-	baseLen := 2 // ServiceID + PID
-	totalLen := baseLen + len(msg.Data)
+	payload := append([]byte{byte(msg.ServiceID), byte(msg.PID)}, msg.Data...)
+	if len(payload) > MaxISOTPMessageLength {
+		return nil, fmt.Errorf("payload length too long for ISO-TP (max %d), got %d", MaxISOTPMessageLength, len(payload))
+	}
+	return payload, nil
+}
 
-	if totalLen > 7 {
-		return nil, fmt.Errorf("payload length too long for single-frame ISO-TP (max 7), got %d", totalLen)
+// ParseISOTPFrame decodes the protocol control information of the CAN frame
+func ParseISOTPFrame(frame *codec.Frame) (*ISOTPFrame, error) {
+	if frame.DLC == 0 {
+		return nil, errors.New("frame has zero DLC")
 	}
 
-	frame := &codec.Frame{
-		Id:  id,
-		DLC: 8, // Full CAN frame length
+	if frame.DLC != ValidISOTPFrameDLC {
+		return nil, errors.New("given frame is not valid ISO-TP frame")
+	}
+
+	data := frame.Data[:ValidISOTPFrameDLC]
+	isoFrame := &ISOTPFrame{
+		Type: ISOTPFrameType(data[0] >> 4),
 	}
 
-	// PCI byte: single frame (0x0) + length of payload
-	frame.Data[0] = byte(0x0<<4) | byte(totalLen)
+	switch isoFrame.Type {
+	case ISOTPSingleFrame:
+		isoFrame.Length = int(data[0] & 0x0F)
+		if isoFrame.Length == 0 || isoFrame.Length > MaxSingleFramePayload {
+			return nil, fmt.Errorf("invalid single frame payload length: %d", isoFrame.Length)
+		}
+		isoFrame.Data = data[1 : 1+isoFrame.Length]
+	case ISOTPFirstFrame:
+		isoFrame.Length = int(data[0]&0x0F)<<8 | int(data[1])
+		if isoFrame.Length <= MaxSingleFramePayload {
+			return nil, fmt.Errorf("first frame message length %d fits into single frame", isoFrame.Length)
+		}
+		isoFrame.Data = data[2:]
+	case ISOTPConsecutiveFrame:
+		isoFrame.SequenceNumber = data[0] & 0x0F
+		isoFrame.Data = data[1:]
+	case ISOTPFlowControlFrame:
+		isoFrame.FlowStatus = FlowStatus(data[0] & 0x0F)
+		if isoFrame.FlowStatus > FlowStatusOverflow {
+			return nil, fmt.Errorf("invalid flow status: %d", isoFrame.FlowStatus)
+		}
+		isoFrame.BlockSize = data[1]
+		isoFrame.STmin = data[2]
+	default:
+		return nil, fmt.Errorf("unsupported ISO-TP frame type: %d", isoFrame.Type)
+	}
 
-	// Service ID and PID
-	frame.Data[1] = byte(msg.ServiceID)
-	frame.Data[2] = byte(msg.PID)
+	return isoFrame, nil
+}
 
-	// Additional data
-	copy(frame.Data[3:], msg.Data)
+// ToCANFrame encodes the ISO-TP frame into the CAN frame padded to full length
+func (isoFrame *ISOTPFrame) ToCANFrame(id uint32) *codec.Frame {
+	frame := &codec.Frame{
+		Id:  id,
+		DLC: ValidISOTPFrameDLC, // Full CAN frame length
+	}
 
-	return frame, nil
+	var pci []byte
+	switch isoFrame.Type {
+	case ISOTPSingleFrame:
+		pci = []byte{byte(ISOTPSingleFrame)<<4 | byte(isoFrame.Length)}
+	case ISOTPFirstFrame:
+		pci = []byte{byte(ISOTPFirstFrame)<<4 | byte(isoFrame.Length>>8), byte(isoFrame.Length)}
+	case ISOTPConsecutiveFrame:
+		pci = []byte{byte(ISOTPConsecutiveFrame)<<4 | isoFrame.SequenceNumber}
+	case ISOTPFlowControlFrame:
+		pci = []byte{byte(ISOTPFlowControlFrame)<<4 | byte(isoFrame.FlowStatus), isoFrame.BlockSize, isoFrame.STmin}
+	}
+
+	n := copy(frame.Data[:], pci)
+	n += copy(frame.Data[n:ValidISOTPFrameDLC], isoFrame.Data)
+	for i := n; i < ValidISOTPFrameDLC; i++ {
+		frame.Data[i] = isoTPPaddingByte
+	}
+	return frame
 }
 
-// FitDataIntoSingleFrame is a helper function which allows to truncate data exceeding 1 frame
-func FitDataIntoSingleFrame(data []byte) []byte {
-	return data[:MaxBytesInISOTPFrame]
+// STminToDuration decodes the minimum separation time: 0x00-0x7F are milliseconds, 0xF1-0xF9 are 100-900 microseconds,
+// reserved values are treated as the longest separation time
+func STminToDuration(stMin byte) time.Duration {
+	switch {
+	case stMin <= 0x7F:
+		return time.Duration(stMin) * time.Millisecond
+	case stMin >= 0xF1 && stMin <= 0xF9:
+		return time.Duration(stMin-0xF0) * 100 * time.Microsecond
+	default:
+		return 0x7F * time.Millisecond
+	}
 }
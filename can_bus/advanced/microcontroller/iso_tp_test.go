@@ -0,0 +1,171 @@
+package microcontroller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/codec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// canFrame returns the full-length CAN frame with the given data (the rest is padded)
+func canFrame(id uint32, data ...byte) *codec.Frame {
+	frame := &codec.Frame{
+		Id:  id,
+		DLC: ValidISOTPFrameDLC,
+	}
+	copy(frame.Data[:], data)
+	return frame
+}
+
+func TestISOTPFrameRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		isoFrame *ISOTPFrame
+		wantData []byte
+	}{
+		{
+			name: "single frame",
+			isoFrame: &ISOTPFrame{
+				Type:   ISOTPSingleFrame,
+				Length: 3,
+				Data:   []byte{0x22, 0xF1, 0x90},
+			},
+			wantData: []byte{0x03, 0x22, 0xF1, 0x90, 0x00, 0x00, 0x00, 0x00},
+		},
+		{
+			name: "first frame",
+			isoFrame: &ISOTPFrame{
+				Type:   ISOTPFirstFrame,
+				Length: 0x123,
+				Data:   []byte{0x62, 0xF1, 0x90, 0x56, 0x46, 0x31},
+			},
+			wantData: []byte{0x11, 0x23, 0x62, 0xF1, 0x90, 0x56, 0x46, 0x31},
+		},
+		{
+			name: "consecutive frame",
+			isoFrame: &ISOTPFrame{
+				Type:           ISOTPConsecutiveFrame,
+				SequenceNumber: 0xF,
+				Data:           []byte{0x41, 0x42, 0x30, 0x30, 0x30, 0x31, 0x32},
+			},
+			wantData: []byte{0x2F, 0x41, 0x42, 0x30, 0x30, 0x30, 0x31, 0x32},
+		},
+		{
+			name: "flow control",
+			isoFrame: &ISOTPFrame{
+				Type:       ISOTPFlowControlFrame,
+				FlowStatus: FlowStatusWait,
+				BlockSize:  8,
+				STmin:      0xF3,
+			},
+			wantData: []byte{0x31, 0x08, 0xF3, 0x00, 0x00, 0x00, 0x00, 0x00},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frame := tt.isoFrame.ToCANFrame(0x7E0)
+			assert.Equal(t, uint32(0x7E0), frame.Id)
+			assert.Equal(t, uint8(ValidISOTPFrameDLC), frame.DLC)
+			assert.Equal(t, tt.wantData, frame.Data[:ValidISOTPFrameDLC])
+
+			parsed, err := ParseISOTPFrame(frame)
+			require.NoError(t, err)
+			assert.Equal(t, tt.isoFrame, parsed)
+		})
+	}
+}
+
+func TestParseISOTPFrame(t *testing.T) {
+	tests := []struct {
+		name          string
+		frame         *codec.Frame
+		want          *ISOTPFrame
+		wantErrString string
+	}{
+		{
+			name:          "zero DLC",
+			frame:         &codec.Frame{Id: 0x7E8},
+			wantErrString: "frame has zero DLC",
+		},
+		{
+			name:          "short frame",
+			frame:         &codec.Frame{Id: 0x7E8, DLC: 7},
+			wantErrString: "given frame is not valid ISO-TP frame",
+		},
+		{
+			name:          "empty single frame",
+			frame:         canFrame(0x7E8, 0x00),
+			wantErrString: "invalid single frame payload length: 0",
+		},
+		{
+			name:          "single frame longer than the frame",
+			frame:         canFrame(0x7E8, 0x08),
+			wantErrString: "invalid single frame payload length: 8",
+		},
+		{
+			name:          "first frame of the message fitting into single frame",
+			frame:         canFrame(0x7E8, 0x10, 0x07),
+			wantErrString: "first frame message length 7 fits into single frame",
+		},
+		{
+			name:  "first frame of the shortest segmented message",
+			frame: canFrame(0x7E8, 0x10, 0x08, 1, 2, 3, 4, 5, 6),
+			want: &ISOTPFrame{
+				Type:   ISOTPFirstFrame,
+				Length: 8,
+				Data:   []byte{1, 2, 3, 4, 5, 6},
+			},
+		},
+		{
+			name:  "first frame of the longest message",
+			frame: canFrame(0x7E8, 0x1F, 0xFF, 1, 2, 3, 4, 5, 6),
+			want: &ISOTPFrame{
+				Type:   ISOTPFirstFrame,
+				Length: MaxISOTPMessageLength,
+				Data:   []byte{1, 2, 3, 4, 5, 6},
+			},
+		},
+		{
+			name:          "invalid flow status",
+			frame:         canFrame(0x7E8, 0x33),
+			wantErrString: "invalid flow status: 3",
+		},
+		{
+			name:          "unsupported frame type",
+			frame:         canFrame(0x7E8, 0x40),
+			wantErrString: "unsupported ISO-TP frame type: 4",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseISOTPFrame(tt.frame)
+			if tt.wantErrString != "" {
+				require.Error(t, err)
+				assert.ErrorContains(t, err, tt.wantErrString)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestSTminToDuration(t *testing.T) {
+	tests := []struct {
+		stMin byte
+		want  time.Duration
+	}{
+		{stMin: 0x00, want: 0},
+		{stMin: 0x7F, want: 127 * time.Millisecond},
+		{stMin: 0xF1, want: 100 * time.Microsecond},
+		{stMin: 0xF9, want: 900 * time.Microsecond},
+		{stMin: 0x80, want: 127 * time.Millisecond},
+		{stMin: 0xFA, want: 127 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, STminToDuration(tt.stMin), "STmin 0x%02X", tt.stMin)
+	}
+}
@@ -0,0 +1,350 @@
+package microcontroller
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/codec"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/common"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/controller"
+	"github.com/hovsep/fmesh/component"
+	"github.com/hovsep/fmesh/signal"
+)
+
+const (
+	stateKeyISOTPTxSessions = "iso_tp_tx_sessions"
+	stateKeyISOTPRxSessions = "iso_tp_rx_sessions"
+)
+
+// ISOTPConfig defines flow control parameters and timeouts of ISO-TP transport (timeouts are measured in MCU ticks)
+type ISOTPConfig struct {
+	BlockSize    byte // Number of consecutive frames the sender may send before waiting for the next flow control (0 means no limit)
+	STmin        byte // Minimum separation time between consecutive frames requested from the sender (encoded as in flow control frame)
+	RxBufferSize int  // Longer messages are rejected with overflow flow status
+	TimeoutAs    int  // N_As: the sender waits for its frame to be transmitted on the bus
+	TimeoutBs    int  // N_Bs: the sender waits for the flow control frame
+	TimeoutCr    int  // N_Cr: the receiver waits for the next consecutive frame
+}
+
+// isoTPTxStep is what the sender of the segmented message is waiting for
+type isoTPTxStep byte
+
+const (
+	isoTPTxWaitConfirmation isoTPTxStep = iota // The frame is handed to the controller
+	isoTPTxWaitFlowControl                     // The first frame or the last frame of the block is transmitted
+	isoTPTxWaitSeparation                      // STmin must pass before the next consecutive frame
+)
+
+// isoTPTxSession is an outgoing message, messages to the same CAN ID are sent one after another
+type isoTPTxSession struct {
+	TxID              uint32 // CAN ID of the message frames
+	FlowControlID     uint32 // CAN ID of the flow control frames sent back by the receiver
+	Payload           []byte
+	Offset            int  // Number of payload bytes handed to the controller
+	SequenceNumber    byte // Sequence number of the next consecutive frame
+	BlockSize         byte // Block size requested by the receiver
+	FramesLeftInBlock int
+	SeparationTicks   int // STmin requested by the receiver
+	Step              isoTPTxStep
+	Deadline          int // Tick when the current wait times out (N_As or N_Bs)
+	NextFrameTick     int // Tick when the next consecutive frame may be sent
+}
+
+// isoTPRxSession is an incoming segmented message being reassembled
+type isoTPRxSession struct {
+	FlowControlID     uint32 // CAN ID of the flow control frames sent to the sender
+	Payload           []byte
+	Length            int  // Message length announced by the first frame
+	SequenceNumber    byte // Expected sequence number of the next consecutive frame
+	FramesLeftInBlock int
+	Deadline          int // Tick when N_Cr times out
+}
+
+type isoTPTxSessions map[uint32][]*isoTPTxSession
+
+type isoTPRxSessions map[uint32]*isoTPRxSession
+
+// ISOTPTransport implements ISO 15765-2 segmentation, reassembly and flow control on top of CAN frames.
+// Sessions are kept in the state of MCU, timers are driven by MCU ticks (MCU self-activates while any session is open)
+type ISOTPTransport struct {
+	config *ISOTPConfig
+}
+
+// DefaultISOTPConfig returns no block size limit, no separation time and timeouts of ISO 15765-4 (OBD on CAN) in MCU time
+func DefaultISOTPConfig() *ISOTPConfig {
+	return &ISOTPConfig{
+		BlockSize:    0,
+		STmin:        0,
+		RxBufferSize: MaxISOTPMessageLength,
+		TimeoutAs:    DurationToTicks(25 * time.Millisecond),
+		TimeoutBs:    DurationToTicks(75 * time.Millisecond),
+		TimeoutCr:    DurationToTicks(150 * time.Millisecond),
+	}
+}
+
+// NewISOTPTransport creates a transport with the given config
+func NewISOTPTransport(config *ISOTPConfig) *ISOTPTransport {
+	return &ISOTPTransport{
+		config: config,
+	}
+}
+
+func initISOTPState(state component.State) {
+	state.Set(stateKeyISOTPTxSessions, make(isoTPTxSessions))
+	state.Set(stateKeyISOTPRxSessions, make(isoTPRxSessions))
+}
+
+// Send transmits the payload in a single frame or segmented into the first and consecutive frames,
+// the message waits until previous messages with the same CAN ID are sent
+func (t *ISOTPTransport) Send(mcu *component.Component, txID, flowControlID uint32, payload []byte) error {
+	if len(payload) == 0 || len(payload) > MaxISOTPMessageLength {
+		return fmt.Errorf("invalid ISO-TP message length: %d", len(payload))
+	}
+
+	txSessions := mcu.State().Get(stateKeyISOTPTxSessions).(isoTPTxSessions)
+	txSessions[txID] = append(txSessions[txID], &isoTPTxSession{
+		TxID:          txID,
+		FlowControlID: flowControlID,
+		Payload:       payload,
+	})
+
+	if len(txSessions[txID]) == 1 {
+		t.startTxSession(mcu, txSessions[txID][0])
+	} else {
+		mcu.Logger().Printf("ISO-TP message to 0x%03X is queued, messages ahead: %d", txID, len(txSessions[txID])-1)
+	}
+	KeepTicking(mcu)
+	return nil
+}
+
+// Receive handles the ISO-TP frame received with the given CAN ID and returns the payload once the message is complete.
+// First and consecutive frames are answered by flow control frames sent to flowControlID,
+// flow control frames drive the outgoing messages waiting for them
+func (t *ISOTPTransport) Receive(mcu *component.Component, rxID uint32, isoFrame *ISOTPFrame, flowControlID uint32) []byte {
+	rxSessions := mcu.State().Get(stateKeyISOTPRxSessions).(isoTPRxSessions)
+	session, inProgress := rxSessions[rxID]
+
+	switch isoFrame.Type {
+	case ISOTPSingleFrame:
+		if inProgress {
+			mcu.Logger().Printf("ISO-TP reception from 0x%03X is aborted by single frame", rxID)
+			delete(rxSessions, rxID)
+		}
+		return isoFrame.Data
+	case ISOTPFirstFrame:
+		if inProgress {
+			mcu.Logger().Printf("ISO-TP reception from 0x%03X is aborted by first frame", rxID)
+			delete(rxSessions, rxID)
+		}
+
+		if isoFrame.Length > t.config.RxBufferSize {
+			mcu.Logger().Printf("ISO-TP message from 0x%03X is too long: %d bytes", rxID, isoFrame.Length)
+			t.sendFlowControl(mcu, flowControlID, FlowStatusOverflow)
+			return nil
+		}
+
+		rxSessions[rxID] = &isoTPRxSession{
+			FlowControlID:     flowControlID,
+			Payload:           append([]byte{}, isoFrame.Data...),
+			Length:            isoFrame.Length,
+			SequenceNumber:    1,
+			FramesLeftInBlock: int(t.config.BlockSize),
+			Deadline:          CurrentTick(mcu) + t.config.TimeoutCr,
+		}
+		mcu.Logger().Printf("ISO-TP first frame from 0x%03X, message length: %d", rxID, isoFrame.Length)
+		t.sendFlowControl(mcu, flowControlID, FlowStatusContinueToSend)
+		KeepTicking(mcu)
+		return nil
+	case ISOTPConsecutiveFrame:
+		if !inProgress {
+			mcu.Logger().Printf("skipping unexpected ISO-TP consecutive frame from 0x%03X", rxID)
+			return nil
+		}
+
+		if isoFrame.SequenceNumber != session.SequenceNumber {
+			mcu.Logger().Printf("ISO-TP reception from 0x%03X is aborted: wrong sequence number %d (expected %d)", rxID, isoFrame.SequenceNumber, session.SequenceNumber)
+			delete(rxSessions, rxID)
+			return nil
+		}
+
+		bytesLeft := session.Length - len(session.Payload)
+		session.Payload = append(session.Payload, isoFrame.Data[:min(bytesLeft, len(isoFrame.Data))]...)
+		session.SequenceNumber = (session.SequenceNumber + 1) % isoTPSequenceNumberModulo
+		session.Deadline = CurrentTick(mcu) + t.config.TimeoutCr
+
+		if len(session.Payload) == session.Length {
+			delete(rxSessions, rxID)
+			return session.Payload
+		}
+
+		if t.config.BlockSize > 0 {
+			session.FramesLeftInBlock--
+			if session.FramesLeftInBlock == 0 {
+				session.FramesLeftInBlock = int(t.config.BlockSize)
+				t.sendFlowControl(mcu, session.FlowControlID, FlowStatusContinueToSend)
+			}
+		}
+		return nil
+	case ISOTPFlowControlFrame:
+		t.handleFlowControl(mcu, rxID, isoFrame)
+		return nil
+	}
+	return nil
+}
+
+// Tick runs the timers: handles transmit confirmations, timeouts and consecutive frames waiting for separation time,
+// must be called in every activation of MCU
+func (t *ISOTPTransport) Tick(mcu *component.Component) {
+	mcu.InputByName(common.PortCANTxConfirm).Signals().ForEach(func(sig *signal.Signal) error {
+		if frame, ok := sig.PayloadOrNil().(*codec.Frame); ok {
+			t.handleConfirmation(mcu, frame)
+		}
+		return nil
+	})
+
+	tick := CurrentTick(mcu)
+	txSessions := mcu.State().Get(stateKeyISOTPTxSessions).(isoTPTxSessions)
+	for _, txID := range slices.Sorted(maps.Keys(txSessions)) {
+		session := txSessions[txID][0]
+		switch {
+		case session.Step == isoTPTxWaitConfirmation && tick > session.Deadline:
+			mcu.Logger().Printf("ISO-TP transmission to 0x%03X is aborted: N_As timeout", txID)
+			// The frame is still pending in the controller, it must not reach the receiver after the message is abandoned
+			mcu.OutputByName(common.PortCANTxAbort).PutSignals(signal.New(&controller.TxAbortRequest{Id: txID}))
+			t.finishTxSession(mcu, txID)
+		case session.Step == isoTPTxWaitFlowControl && tick > session.Deadline:
+			mcu.Logger().Printf("ISO-TP transmission to 0x%03X is aborted: N_Bs timeout", txID)
+			t.finishTxSession(mcu, txID)
+		case session.Step == isoTPTxWaitSeparation && tick >= session.NextFrameTick:
+			t.sendConsecutiveFrame(mcu, session)
+		}
+	}
+
+	rxSessions := mcu.State().Get(stateKeyISOTPRxSessions).(isoTPRxSessions)
+	for _, rxID := range slices.Sorted(maps.Keys(rxSessions)) {
+		if tick > rxSessions[rxID].Deadline {
+			mcu.Logger().Printf("ISO-TP reception from 0x%03X is aborted: N_Cr timeout", rxID)
+			delete(rxSessions, rxID)
+		}
+	}
+
+	if len(txSessions) > 0 || len(rxSessions) > 0 {
+		KeepTicking(mcu)
+	}
+}
+
+func (t *ISOTPTransport) startTxSession(mcu *component.Component, session *isoTPTxSession) {
+	if len(session.Payload) <= MaxSingleFramePayload {
+		session.Offset = len(session.Payload)
+		t.sendFrame(mcu, session, &ISOTPFrame{
+			Type:   ISOTPSingleFrame,
+			Length: len(session.Payload),
+			Data:   session.Payload,
+		})
+		return
+	}
+
+	session.Offset = FirstFramePayload
+	session.SequenceNumber = 1
+	t.sendFrame(mcu, session, &ISOTPFrame{
+		Type:   ISOTPFirstFrame,
+		Length: len(session.Payload),
+		Data:   session.Payload[:FirstFramePayload],
+	})
+	mcu.Logger().Printf("ISO-TP first frame to 0x%03X, message length: %d", session.TxID, len(session.Payload))
+}
+
+func (t *ISOTPTransport) sendConsecutiveFrame(mcu *component.Component, session *isoTPTxSession) {
+	end := min(session.Offset+ConsecutiveFramePayload, len(session.Payload))
+	t.sendFrame(mcu, session, &ISOTPFrame{
+		Type:           ISOTPConsecutiveFrame,
+		SequenceNumber: session.SequenceNumber,
+		Data:           session.Payload[session.Offset:end],
+	})
+
+	session.Offset = end
+	session.SequenceNumber = (session.SequenceNumber + 1) % isoTPSequenceNumberModulo
+	if session.BlockSize > 0 {
+		session.FramesLeftInBlock--
+	}
+}
+
+// sendFrame hands the frame to the controller and starts N_As
+func (t *ISOTPTransport) sendFrame(mcu *component.Component, session *isoTPTxSession, isoFrame *ISOTPFrame) {
+	mcu.OutputByName(common.PortCANTx).PutSignals(signal.New(isoFrame.ToCANFrame(session.TxID)))
+	session.Step = isoTPTxWaitConfirmation
+	session.Deadline = CurrentTick(mcu) + t.config.TimeoutAs
+}
+
+func (t *ISOTPTransport) sendFlowControl(mcu *component.Component, flowControlID uint32, status FlowStatus) {
+	fc := &ISOTPFrame{
+		Type:       ISOTPFlowControlFrame,
+		FlowStatus: status,
+		BlockSize:  t.config.BlockSize,
+		STmin:      t.config.STmin,
+	}
+	mcu.OutputByName(common.PortCANTx).PutSignals(signal.New(fc.ToCANFrame(flowControlID)))
+	mcu.Logger().Printf("ISO-TP flow control to 0x%03X: %s, block size: %d, STmin: 0x%02X", flowControlID, status, fc.BlockSize, fc.STmin)
+}
+
+// handleConfirmation moves the outgoing message forward when its frame is transmitted
+func (t *ISOTPTransport) handleConfirmation(mcu *component.Component, frame *codec.Frame) {
+	txSessions := mcu.State().Get(stateKeyISOTPTxSessions).(isoTPTxSessions)
+	queue, ok := txSessions[frame.Id]
+	if !ok || queue[0].Step != isoTPTxWaitConfirmation {
+		// Not a transport frame (e.g., flow control or answer to remote frame)
+		return
+	}
+
+	session := queue[0]
+	switch {
+	case session.Offset == len(session.Payload):
+		mcu.Logger().Printf("ISO-TP message to 0x%03X is sent, length: %d", session.TxID, len(session.Payload))
+		t.finishTxSession(mcu, session.TxID)
+	case session.Offset == FirstFramePayload, session.BlockSize > 0 && session.FramesLeftInBlock == 0:
+		session.Step = isoTPTxWaitFlowControl
+		session.Deadline = CurrentTick(mcu) + t.config.TimeoutBs
+	default:
+		session.Step = isoTPTxWaitSeparation
+		session.NextFrameTick = CurrentTick(mcu) + session.SeparationTicks
+	}
+}
+
+// handleFlowControl lets the outgoing message waiting for the flow control continue, wait or abort
+func (t *ISOTPTransport) handleFlowControl(mcu *component.Component, rxID uint32, fc *ISOTPFrame) {
+	txSessions := mcu.State().Get(stateKeyISOTPTxSessions).(isoTPTxSessions)
+	for _, txID := range slices.Sorted(maps.Keys(txSessions)) {
+		session := txSessions[txID][0]
+		if session.FlowControlID != rxID || session.Step != isoTPTxWaitFlowControl {
+			continue
+		}
+
+		switch fc.FlowStatus {
+		case FlowStatusContinueToSend:
+			session.BlockSize = fc.BlockSize
+			session.FramesLeftInBlock = int(fc.BlockSize)
+			session.SeparationTicks = DurationToTicks(STminToDuration(fc.STmin))
+			t.sendConsecutiveFrame(mcu, session)
+		case FlowStatusWait:
+			session.Deadline = CurrentTick(mcu) + t.config.TimeoutBs
+		case FlowStatusOverflow:
+			mcu.Logger().Printf("ISO-TP transmission to 0x%03X is aborted: the receiver reported overflow", txID)
+			t.finishTxSession(mcu, txID)
+		}
+		return
+	}
+	mcu.Logger().Printf("skipping unexpected ISO-TP flow control from 0x%03X", rxID)
+}
+
+// finishTxSession removes the current message and starts the next one queued for the same CAN ID
+func (t *ISOTPTransport) finishTxSession(mcu *component.Component, txID uint32) {
+	txSessions := mcu.State().Get(stateKeyISOTPTxSessions).(isoTPTxSessions)
+	txSessions[txID] = txSessions[txID][1:]
+	if len(txSessions[txID]) == 0 {
+		delete(txSessions, txID)
+		return
+	}
+	t.startTxSession(mcu, txSessions[txID][0])
+}
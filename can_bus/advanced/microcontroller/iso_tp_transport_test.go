@@ -0,0 +1,257 @@
+package microcontroller
+
+import (
+	"testing"
+
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/codec"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/common"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/controller"
+	"github.com/hovsep/fmesh/component"
+	"github.com/hovsep/fmesh/signal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// getTestMCU returns MCU without application logic, tests call the protocol handlers directly
+func getTestMCU() *component.Component {
+	return New("test", func(state component.State) {}, func(this *component.Component) error {
+		return nil
+	})
+}
+
+// setTick moves the MCU clock
+func setTick(mcu *component.Component, tick int) {
+	mcu.State().Set(stateKeyTicks, tick)
+}
+
+// takeOutput returns the payloads put on the output port and clears it, as the mesh does after the activation
+func takeOutput[T any](t *testing.T, mcu *component.Component, portName string) []T {
+	var payloads []T
+	mcu.OutputByName(portName).Signals().ForEach(func(sig *signal.Signal) error {
+		payload, ok := sig.PayloadOrNil().(T)
+		require.True(t, ok, "unexpected payload: %v", sig.PayloadOrNil())
+		payloads = append(payloads, payload)
+		return nil
+	})
+	mcu.OutputByName(portName).Clear()
+	return payloads
+}
+
+// takeSentISOTPFrames returns the ISO-TP frames handed to the controller
+func takeSentISOTPFrames(t *testing.T, mcu *component.Component) []*ISOTPFrame {
+	var isoFrames []*ISOTPFrame
+	for _, frame := range takeOutput[*codec.Frame](t, mcu, common.PortCANTx) {
+		isoFrame, err := ParseISOTPFrame(frame)
+		require.NoError(t, err)
+		isoFrames = append(isoFrames, isoFrame)
+	}
+	return isoFrames
+}
+
+// confirmTransmission lets the transport know the frames are on the bus and runs its timers
+func confirmTransmission(transport *ISOTPTransport, mcu *component.Component, frames ...*codec.Frame) {
+	for _, frame := range frames {
+		mcu.InputByName(common.PortCANTxConfirm).PutSignals(signal.New(frame))
+	}
+	transport.Tick(mcu)
+	mcu.InputByName(common.PortCANTxConfirm).Clear()
+}
+
+func testConfig() *ISOTPConfig {
+	return &ISOTPConfig{
+		RxBufferSize: MaxISOTPMessageLength,
+		TimeoutAs:    10,
+		TimeoutBs:    20,
+		TimeoutCr:    30,
+	}
+}
+
+func TestISOTPTransportReceive(t *testing.T) {
+	const rxID, flowControlID = 0x7E8, 0x7E0
+	message := []byte("1HGCM82633A004352XYZ-ABCDEF")
+
+	t.Run("segmented message is reassembled", func(t *testing.T) {
+		mcu := getTestMCU()
+		config := testConfig()
+		config.BlockSize = 2
+		transport := NewISOTPTransport(config)
+
+		assert.Nil(t, transport.Receive(mcu, rxID, &ISOTPFrame{Type: ISOTPFirstFrame, Length: len(message), Data: message[:6]}, flowControlID))
+		assert.Equal(t, []*ISOTPFrame{{Type: ISOTPFlowControlFrame, FlowStatus: FlowStatusContinueToSend, BlockSize: 2}}, takeSentISOTPFrames(t, mcu))
+
+		assert.Nil(t, transport.Receive(mcu, rxID, &ISOTPFrame{Type: ISOTPConsecutiveFrame, SequenceNumber: 1, Data: message[6:13]}, flowControlID))
+		assert.Empty(t, takeSentISOTPFrames(t, mcu))
+
+		// The block is over, the sender waits for the next flow control
+		assert.Nil(t, transport.Receive(mcu, rxID, &ISOTPFrame{Type: ISOTPConsecutiveFrame, SequenceNumber: 2, Data: message[13:20]}, flowControlID))
+		assert.Len(t, takeSentISOTPFrames(t, mcu), 1)
+
+		assert.Equal(t, message, transport.Receive(mcu, rxID, &ISOTPFrame{Type: ISOTPConsecutiveFrame, SequenceNumber: 3, Data: message[20:27]}, flowControlID))
+		assert.Empty(t, mcu.State().Get(stateKeyISOTPRxSessions).(isoTPRxSessions))
+	})
+
+	t.Run("last consecutive frame completes the message", func(t *testing.T) {
+		mcu := getTestMCU()
+		transport := NewISOTPTransport(testConfig())
+
+		transport.Receive(mcu, rxID, &ISOTPFrame{Type: ISOTPFirstFrame, Length: 10, Data: message[:6]}, flowControlID)
+		payload := transport.Receive(mcu, rxID, &ISOTPFrame{Type: ISOTPConsecutiveFrame, SequenceNumber: 1, Data: append(message[6:10:10], 0xAA, 0xAA, 0xAA)}, flowControlID)
+		assert.Equal(t, message[:10], payload)
+	})
+
+	t.Run("out of order sequence number aborts reception", func(t *testing.T) {
+		mcu := getTestMCU()
+		transport := NewISOTPTransport(testConfig())
+
+		transport.Receive(mcu, rxID, &ISOTPFrame{Type: ISOTPFirstFrame, Length: len(message), Data: message[:6]}, flowControlID)
+		require.Contains(t, mcu.State().Get(stateKeyISOTPRxSessions).(isoTPRxSessions), uint32(rxID))
+
+		assert.Nil(t, transport.Receive(mcu, rxID, &ISOTPFrame{Type: ISOTPConsecutiveFrame, SequenceNumber: 2, Data: message[13:20]}, flowControlID))
+		assert.Empty(t, mcu.State().Get(stateKeyISOTPRxSessions).(isoTPRxSessions))
+
+		// The rest of the message is ignored
+		assert.Nil(t, transport.Receive(mcu, rxID, &ISOTPFrame{Type: ISOTPConsecutiveFrame, SequenceNumber: 1, Data: message[6:13]}, flowControlID))
+		assert.Empty(t, mcu.State().Get(stateKeyISOTPRxSessions).(isoTPRxSessions))
+	})
+
+	t.Run("too long message is rejected with overflow", func(t *testing.T) {
+		mcu := getTestMCU()
+		config := testConfig()
+		config.RxBufferSize = 16
+		transport := NewISOTPTransport(config)
+
+		assert.Nil(t, transport.Receive(mcu, rxID, &ISOTPFrame{Type: ISOTPFirstFrame, Length: len(message), Data: message[:6]}, flowControlID))
+		assert.Equal(t, []*ISOTPFrame{{Type: ISOTPFlowControlFrame, FlowStatus: FlowStatusOverflow}}, takeSentISOTPFrames(t, mcu))
+		assert.Empty(t, mcu.State().Get(stateKeyISOTPRxSessions).(isoTPRxSessions))
+	})
+
+	t.Run("missing consecutive frame ends reception after N_Cr ticks", func(t *testing.T) {
+		mcu := getTestMCU()
+		transport := NewISOTPTransport(testConfig())
+
+		setTick(mcu, 100)
+		transport.Receive(mcu, rxID, &ISOTPFrame{Type: ISOTPFirstFrame, Length: len(message), Data: message[:6]}, flowControlID)
+
+		setTick(mcu, 130)
+		transport.Tick(mcu)
+		assert.Len(t, mcu.State().Get(stateKeyISOTPRxSessions).(isoTPRxSessions), 1)
+
+		setTick(mcu, 131)
+		transport.Tick(mcu)
+		assert.Empty(t, mcu.State().Get(stateKeyISOTPRxSessions).(isoTPRxSessions))
+	})
+}
+
+func TestISOTPTransportSend(t *testing.T) {
+	const txID, flowControlID = 0x7E8, 0x7E0
+	message := []byte("1HGCM82633A004352XYZ-ABCDEF")
+
+	t.Run("single frame", func(t *testing.T) {
+		mcu := getTestMCU()
+		transport := NewISOTPTransport(testConfig())
+
+		require.NoError(t, transport.Send(mcu, txID, flowControlID, message[:7]))
+		frames := takeOutput[*codec.Frame](t, mcu, common.PortCANTx)
+		require.Len(t, frames, 1)
+
+		confirmTransmission(transport, mcu, frames...)
+		assert.Empty(t, mcu.State().Get(stateKeyISOTPTxSessions).(isoTPTxSessions))
+	})
+
+	t.Run("invalid length", func(t *testing.T) {
+		mcu := getTestMCU()
+		transport := NewISOTPTransport(testConfig())
+
+		assert.ErrorContains(t, transport.Send(mcu, txID, flowControlID, nil), "invalid ISO-TP message length: 0")
+		assert.ErrorContains(t, transport.Send(mcu, txID, flowControlID, make([]byte, MaxISOTPMessageLength+1)), "invalid ISO-TP message length: 4096")
+	})
+
+	t.Run("segmented message follows flow control", func(t *testing.T) {
+		mcu := getTestMCU()
+		transport := NewISOTPTransport(testConfig())
+
+		require.NoError(t, transport.Send(mcu, txID, flowControlID, message))
+		frames := takeOutput[*codec.Frame](t, mcu, common.PortCANTx)
+		require.Len(t, frames, 1)
+		confirmTransmission(transport, mcu, frames...)
+
+		// Block of one frame with 1 ms separation
+		transport.Receive(mcu, flowControlID, &ISOTPFrame{Type: ISOTPFlowControlFrame, FlowStatus: FlowStatusContinueToSend, BlockSize: 1, STmin: 0x01}, txID)
+		frames = takeOutput[*codec.Frame](t, mcu, common.PortCANTx)
+		require.Len(t, frames, 1)
+		confirmTransmission(transport, mcu, frames...)
+		assert.Empty(t, takeOutput[*codec.Frame](t, mcu, common.PortCANTx), "the sender waits for the next flow control")
+
+		transport.Receive(mcu, flowControlID, &ISOTPFrame{Type: ISOTPFlowControlFrame, FlowStatus: FlowStatusContinueToSend, STmin: 0x01}, txID)
+		frames = takeOutput[*codec.Frame](t, mcu, common.PortCANTx)
+		require.Len(t, frames, 1)
+		confirmTransmission(transport, mcu, frames...)
+
+		// The last frame is sent after the separation time
+		separationTicks := DurationToTicks(STminToDuration(0x01))
+		setTick(mcu, separationTicks-1)
+		transport.Tick(mcu)
+		assert.Empty(t, takeOutput[*codec.Frame](t, mcu, common.PortCANTx))
+
+		setTick(mcu, separationTicks)
+		transport.Tick(mcu)
+		frames = takeOutput[*codec.Frame](t, mcu, common.PortCANTx)
+		require.Len(t, frames, 1)
+		last, err := ParseISOTPFrame(frames[0])
+		require.NoError(t, err)
+		assert.Equal(t, byte(3), last.SequenceNumber)
+
+		confirmTransmission(transport, mcu, frames...)
+		assert.Empty(t, mcu.State().Get(stateKeyISOTPTxSessions).(isoTPTxSessions))
+	})
+
+	t.Run("missing flow control ends the session after N_Bs ticks", func(t *testing.T) {
+		mcu := getTestMCU()
+		transport := NewISOTPTransport(testConfig())
+
+		require.NoError(t, transport.Send(mcu, txID, flowControlID, message))
+		require.NoError(t, transport.Send(mcu, txID, flowControlID, message[:3]))
+		frames := takeOutput[*codec.Frame](t, mcu, common.PortCANTx)
+		require.Len(t, frames, 1, "the second message waits for the first one")
+
+		setTick(mcu, 5)
+		confirmTransmission(transport, mcu, frames...)
+
+		setTick(mcu, 25)
+		transport.Tick(mcu)
+		assert.Empty(t, takeOutput[*codec.Frame](t, mcu, common.PortCANTx))
+
+		setTick(mcu, 26)
+		transport.Tick(mcu)
+
+		// The queued message goes next
+		next := takeSentISOTPFrames(t, mcu)
+		assert.Equal(t, []*ISOTPFrame{{Type: ISOTPSingleFrame, Length: 3, Data: message[:3]}}, next)
+		assert.Len(t, mcu.State().Get(stateKeyISOTPTxSessions).(isoTPTxSessions)[txID], 1)
+	})
+
+	t.Run("unconfirmed frame is aborted after N_As ticks", func(t *testing.T) {
+		mcu := getTestMCU()
+		transport := NewISOTPTransport(testConfig())
+
+		require.NoError(t, transport.Send(mcu, txID, flowControlID, message))
+		takeOutput[*codec.Frame](t, mcu, common.PortCANTx)
+
+		setTick(mcu, 11)
+		transport.Tick(mcu)
+		assert.Equal(t, []*controller.TxAbortRequest{{Id: txID}}, takeOutput[*controller.TxAbortRequest](t, mcu, common.PortCANTxAbort))
+		assert.Empty(t, mcu.State().Get(stateKeyISOTPTxSessions).(isoTPTxSessions))
+	})
+
+	t.Run("overflow reported by the receiver ends the session", func(t *testing.T) {
+		mcu := getTestMCU()
+		transport := NewISOTPTransport(testConfig())
+
+		require.NoError(t, transport.Send(mcu, txID, flowControlID, message))
+		confirmTransmission(transport, mcu, takeOutput[*codec.Frame](t, mcu, common.PortCANTx)...)
+
+		transport.Receive(mcu, flowControlID, &ISOTPFrame{Type: ISOTPFlowControlFrame, FlowStatus: FlowStatusOverflow}, txID)
+		assert.Empty(t, takeOutput[*codec.Frame](t, mcu, common.PortCANTx))
+		assert.Empty(t, mcu.State().Get(stateKeyISOTPTxSessions).(isoTPTxSessions))
+	})
+}
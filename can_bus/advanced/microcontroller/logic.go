@@ -3,9 +3,11 @@ package microcontroller
 import (
 	"errors"
 	"fmt"
+	"slices"
 
 	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/codec"
 	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/common"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/controller"
 	"github.com/hovsep/fmesh/component"
 	"github.com/hovsep/fmesh/signal"
 )
@@ -22,14 +24,84 @@ type ServiceMap map[ServiceID]ParamsMap
 // LogicMap maps addressing modes to allowed services
 type LogicMap map[AddressingMode]ServiceMap
 
+// RemoteResponder provides the data requested by a remote frame
+type RemoteResponder func(request *codec.Frame, mcu *component.Component) ([]byte, error)
+
+// RemoteResponderMap maps requested CAN IDs to respective responder
+type RemoteResponderMap map[uint32]RemoteResponder
+
 // LogicDescriptor contains the whole MCU behavior
 type LogicDescriptor struct {
-	PhysicalAddress uint32
-	Table           LogicMap
+	PhysicalAddress  uint32
+	Table            LogicMap
+	RemoteResponders RemoteResponderMap // Automatic answers to remote frames (used by legacy nodes polling values)
+	ISOTPConfig      *ISOTPConfig       // Flow control parameters and timeouts (DefaultISOTPConfig is used when not set)
+	UDS              *UDSServer         // Diagnostic server answering UDS requests of workshop tools (optional)
+	Scheduler        *Scheduler         // Cyclic messages broadcast by the unit (optional, MCU must be powered on to start it)
+}
+
+// WithRemoteResponder registers the responder which answers remote frames with the given ID by a data frame with the same ID
+func (ld *LogicDescriptor) WithRemoteResponder(id uint32, responder RemoteResponder) *LogicDescriptor {
+	if ld.RemoteResponders == nil {
+		ld.RemoteResponders = make(RemoteResponderMap)
+	}
+	ld.RemoteResponders[id] = responder
+	return ld
+}
+
+// AcceptanceFilters returns the controller filter banks passing only the frames handled by the logic:
+// functional and physical requests (with flow control of segmented responses) go to FIFO 0, remote frames to FIFO 1
+func (ld *LogicDescriptor) AcceptanceFilters() []controller.FilterBank {
+	requestIds := []uint32{ld.PhysicalAddress}
+	if _, ok := ld.Table[FunctionalAddressing]; ok || ld.UDS != nil {
+		requestIds = append(requestIds, FunctionalRequestID)
+	}
+
+	filters := []controller.FilterBank{
+		{
+			Mode: controller.FilterModeList,
+			Ids:  requestIds,
+			FIFO: 0,
+		},
+	}
+
+	if len(ld.RemoteResponders) > 0 {
+		var remoteIds []uint32
+		for id := range ld.RemoteResponders {
+			remoteIds = append(remoteIds, id)
+		}
+		slices.Sort(remoteIds)
+
+		filters = append(filters, controller.FilterBank{
+			Mode: controller.FilterModeList,
+			Ids:  remoteIds,
+			FIFO: 1,
+		})
+	}
+
+	return filters
 }
 
 func (ld LogicDescriptor) ToActivationFunc() component.ActivationFunc {
+	isoTPConfig := ld.ISOTPConfig
+	if isoTPConfig == nil {
+		isoTPConfig = DefaultISOTPConfig()
+	}
+	transport := NewISOTPTransport(isoTPConfig)
+	responseAddress := ld.PhysicalAddress + ResponseAddressOffset
+
 	af := func(this *component.Component) error {
+		transport.Tick(this)
+		if ld.UDS != nil {
+			ld.UDS.tick(this)
+		}
+		if ld.Scheduler != nil {
+			err := ld.Scheduler.tick(this)
+			if err != nil {
+				return fmt.Errorf("failed to run scheduler: %w", err)
+			}
+		}
+
 		return this.InputByName(common.PortCANRx).Signals().ForEach(func(sig *signal.Signal) error {
 			// Validate CAN frame
 			frame, ok := sig.PayloadOrNil().(*codec.Frame)
@@ -37,10 +109,14 @@ func (ld LogicDescriptor) ToActivationFunc() component.ActivationFunc {
 				return errors.New("failed to cast payload to CAN frame")
 			}
 
-			// Convert CAN frame to ISO-TP message (the request)
-			isoReq, err := NewISOTPMessage().FromCANFrame(frame)
-			if err != nil {
-				return fmt.Errorf("failed to parse ISO-TP message: %w", err)
+			if frame.Remote {
+				return ld.handleRemoteFrame(this, frame)
+			}
+
+			// OBD-II requests use 11-bit identifiers
+			if frame.Extended {
+				this.Logger().Printf("skipping extended frame: 0x%08X", frame.Id)
+				return nil
 			}
 
 			// Resolve request address
@@ -49,8 +125,8 @@ func (ld LogicDescriptor) ToActivationFunc() component.ActivationFunc {
 			if frame.Id == FunctionalRequestID {
 				addressingMode = FunctionalAddressing
 			}
-			this.Logger().Printf("received ISO-TP request: addressing mode: %s, req address: 0x%02X, sid: 0x%02X(%s), pid: 0x%02X(%s)", addressingMode, frame.Id, isoReq.ServiceID, isoReq.ServiceID.ToString(), isoReq.PID, isoReq.PID.ToString())
 
+			// Frames addressed to other nodes are skipped before parsing (they are not necessarily ISO-TP, e.g. answers to remote frames)
 			if addressingMode == PhysicalAddressing && frame.Id != ld.PhysicalAddress {
 				this.Logger().Printf(
 					"skipping request: frame ID 0x%03X does not match physical address 0x%02X(AddressingMode: %v)",
@@ -59,16 +135,57 @@ func (ld LogicDescriptor) ToActivationFunc() component.ActivationFunc {
 				return nil
 			}
 
+			isoFrame, err := ParseISOTPFrame(frame)
+			if err != nil {
+				return fmt.Errorf("failed to parse ISO-TP frame: %w", err)
+			}
+
+			// Functional requests must fit into a single frame (ISO 15765-4), as many ECUs may answer
+			if addressingMode == FunctionalAddressing && isoFrame.Type != ISOTPSingleFrame {
+				this.Logger().Printf("skipping functional request: %s is not allowed", isoFrame.Type)
+				return nil
+			}
+
+			// Reassemble the request (flow control frames sent back to us are consumed by the transport)
+			payload := transport.Receive(this, frame.Id, isoFrame, responseAddress)
+			if payload == nil {
+				return nil
+			}
+
+			// UDS requests are answered by the diagnostic server
+			if ld.UDS != nil && isUDSRequest(payload) {
+				respPayload := ld.UDS.handleRequest(this, addressingMode, payload)
+				if respPayload == nil {
+					return nil
+				}
+
+				err = transport.Send(this, responseAddress, ld.PhysicalAddress, respPayload)
+				if err != nil {
+					return fmt.Errorf("failed to send UDS response: %w", err)
+				}
+				this.Logger().Printf("sending UDS response: addressing mode: %s, req address: 0x%03X, data: % X", addressingMode, responseAddress, respPayload)
+				return nil
+			}
+
+			// Convert payload to ISO-TP message (the request)
+			isoReq, err := NewISOTPMessage().FromPayload(payload)
+			if err != nil {
+				return fmt.Errorf("failed to parse ISO-TP message: %w", err)
+			}
+			this.Logger().Printf("received ISO-TP request: addressing mode: %s, req address: 0x%02X, sid: 0x%02X(%s), pid: 0x%02X(%s)", addressingMode, frame.Id, isoReq.ServiceID, isoReq.ServiceID.ToString(), isoReq.PID, isoReq.PID.ToString())
+
 			// Check if addressing mode is supported
 			services, ok := ld.Table[addressingMode]
 			if !ok {
-				return errors.New("addressing mode is not supported")
+				this.Logger().Printf("skipping request: addressing mode %s is not supported", addressingMode)
+				return nil
 			}
 
-			// Check if the service is supported
+			// Check if the service is supported (requests come from the outside world, so they must not break the unit)
 			params, ok := services[isoReq.ServiceID]
 			if !ok {
-				return errors.New("service is not supported")
+				this.Logger().Printf("skipping request: service 0x%02X (%s) is not supported", isoReq.ServiceID, isoReq.ServiceID.ToString())
+				return nil
 			}
 
 			// Check if parameter is supported
@@ -83,15 +200,18 @@ func (ld LogicDescriptor) ToActivationFunc() component.ActivationFunc {
 			if err != nil {
 				return fmt.Errorf("failed to apply MCU logic: %w", err)
 			}
-			// For simplicity this demo supports only single frame responses, so any data that does not fit will be truncated:
 
-			// Return response down to CAN controller
-			respCANFrame, err := isoResp.ToCANFrame(ld.PhysicalAddress + ResponseAddressOffset)
+			// Return response down to CAN controller (segmented if it does not fit into a single frame)
+			respPayload, err := isoResp.ToPayload()
 			if err != nil {
-				return fmt.Errorf("failed to convert ISOTP to CAN frame: %w", err)
+				return fmt.Errorf("failed to convert ISO-TP message to payload: %w", err)
 			}
-			this.OutputByName(common.PortCANTx).PutSignals(signal.New(respCANFrame))
-			this.Logger().Printf("sending ISO-TP response: addressing mode: %s, req address: 0x%03X, sid: 0x%02X, pid: 0x%02X", addressingMode, respCANFrame.Id, isoResp.ServiceID, isoResp.PID)
+
+			err = transport.Send(this, responseAddress, ld.PhysicalAddress, respPayload)
+			if err != nil {
+				return fmt.Errorf("failed to send ISO-TP response: %w", err)
+			}
+			this.Logger().Printf("sending ISO-TP response: addressing mode: %s, req address: 0x%03X, sid: 0x%02X, pid: 0x%02X, length: %d", addressingMode, responseAddress, isoResp.ServiceID, isoResp.PID, len(respPayload))
 
 			return nil
 		}).ChainableErr()
@@ -99,3 +219,29 @@ func (ld LogicDescriptor) ToActivationFunc() component.ActivationFunc {
 
 	return af
 }
+
+// handleRemoteFrame answers the remote frame if there is a responder registered for the requested ID
+func (ld LogicDescriptor) handleRemoteFrame(this *component.Component, request *codec.Frame) error {
+	responder, ok := ld.RemoteResponders[request.Id]
+	if !ok {
+		this.Logger().Printf("skipping remote frame: no responder for ID 0x%03X", request.Id)
+		return nil
+	}
+
+	data, err := responder(request, this)
+	if err != nil {
+		return fmt.Errorf("failed to respond to remote frame: %w", err)
+	}
+
+	// The data frame has the same ID and the length requested by the remote frame
+	response := &codec.Frame{
+		Id:       request.Id,
+		Extended: request.Extended,
+		DLC:      request.DLC,
+	}
+	copy(response.Data[:response.DLC], data)
+
+	this.OutputByName(common.PortCANTx).PutSignals(signal.New(response))
+	this.Logger().Printf("answering remote frame: ID 0x%03X, data: % X", response.Id, response.Data[:response.DLC])
+	return nil
+}
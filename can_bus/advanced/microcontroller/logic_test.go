@@ -0,0 +1,113 @@
+package microcontroller
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/codec"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/common"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/controller"
+	"github.com/hovsep/fmesh/component"
+	"github.com/hovsep/fmesh/signal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// staticResponder returns the responder answering with the constant data
+func staticResponder(data ...byte) RemoteResponder {
+	return func(request *codec.Frame, mcu *component.Component) ([]byte, error) {
+		return data, nil
+	}
+}
+
+func TestLogicDescriptorAcceptanceFilters(t *testing.T) {
+	tests := []struct {
+		name string
+		ld   *LogicDescriptor
+		want []controller.FilterBank
+	}{
+		{
+			name: "physical requests only",
+			ld:   &LogicDescriptor{PhysicalAddress: 0x7E0},
+			want: []controller.FilterBank{
+				{Mode: controller.FilterModeList, Ids: []uint32{0x7E0}, FIFO: 0},
+			},
+		},
+		{
+			name: "functional requests",
+			ld:   &LogicDescriptor{PhysicalAddress: 0x7E0, Table: LogicMap{FunctionalAddressing: ServiceMap{}}},
+			want: []controller.FilterBank{
+				{Mode: controller.FilterModeList, Ids: []uint32{0x7E0, FunctionalRequestID}, FIFO: 0},
+			},
+		},
+		{
+			name: "remote frames go to FIFO 1",
+			ld: (&LogicDescriptor{PhysicalAddress: 0x7E1}).
+				WithRemoteResponder(0x3E0, staticResponder(0x5F)).
+				WithRemoteResponder(0x1A0, staticResponder(0x01)),
+			want: []controller.FilterBank{
+				{Mode: controller.FilterModeList, Ids: []uint32{0x7E1}, FIFO: 0},
+				{Mode: controller.FilterModeList, Ids: []uint32{0x1A0, 0x3E0}, FIFO: 1},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.ld.AcceptanceFilters())
+		})
+	}
+}
+
+func TestLogicDescriptorRemoteFrames(t *testing.T) {
+	ld := (&LogicDescriptor{PhysicalAddress: 0x7E0}).
+		WithRemoteResponder(0x3E0, staticResponder(0x5F, 0x01)).
+		WithRemoteResponder(0x3E1, func(request *codec.Frame, mcu *component.Component) ([]byte, error) {
+			return nil, errors.New("sensor failure")
+		})
+
+	tests := []struct {
+		name    string
+		request *codec.Frame
+		want    []*codec.Frame
+		wantErr string
+	}{
+		{
+			name:    "answered with the requested length",
+			request: &codec.Frame{Id: 0x3E0, Remote: true, DLC: 4},
+			want:    []*codec.Frame{{Id: 0x3E0, DLC: 4, Data: [codec.ProtocolMaxFDDataBytes]byte{0x5F, 0x01}}},
+		},
+		{
+			name:    "data is truncated to the requested length",
+			request: &codec.Frame{Id: 0x3E0, Remote: true, DLC: 1},
+			want:    []*codec.Frame{{Id: 0x3E0, DLC: 1, Data: [codec.ProtocolMaxFDDataBytes]byte{0x5F}}},
+		},
+		{
+			name:    "extended ID",
+			request: &codec.Frame{Id: 0x3E0, Extended: true, Remote: true, DLC: 2},
+			want:    []*codec.Frame{{Id: 0x3E0, Extended: true, DLC: 2, Data: [codec.ProtocolMaxFDDataBytes]byte{0x5F, 0x01}}},
+		},
+		{
+			name:    "unregistered ID is skipped",
+			request: &codec.Frame{Id: 0x3E2, Remote: true, DLC: 2},
+		},
+		{
+			name:    "responder error",
+			request: &codec.Frame{Id: 0x3E1, Remote: true, DLC: 2},
+			wantErr: "failed to respond to remote frame: sensor failure",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mcu := getTestMCU()
+			mcu.InputByName(common.PortCANRx).PutSignals(signal.New(tt.request))
+
+			err := ld.ToActivationFunc()(mcu)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, takeOutput[*codec.Frame](t, mcu, common.PortCANTx))
+		})
+	}
+}
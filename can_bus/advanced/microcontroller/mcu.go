@@ -1,15 +1,66 @@
 package microcontroller
 
 import (
+	"time"
+
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/codec"
 	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/common"
 	"github.com/hovsep/fmesh/component"
+	"github.com/hovsep/fmesh/signal"
+)
+
+const (
+	stateKeyTicks = "ticks"
+
+	// TickDuration is the simulated time of one MCU tick (one mesh cycle while MCU is self-activated):
+	// a bit takes 4 cycles to travel wires -> transceiver -> controller -> transceiver -> wires.
+	// MCU timers count cycles, so they run at the nominal bit rate in the data phase of FD frames too (bus time does not).
+	// The bus with disturbance takes 5 cycles per bit (see bus.Bus.CyclesPerBit), so there MCU time runs 5/4 faster than the bus:
+	// durations converted to ticks are in MCU time, e.g. the period of 10 ms is 8 ms of bus time
+	TickDuration = codec.ProtocolNominalBitTime / 4
 )
 
 // New creates a microcontroller unit component
 func New(name string, initState func(state component.State), af component.ActivationFunc) *component.Component {
-	return component.New("mcu-" + name).
-		AddInputs(common.PortCANRx).  // Frame in
-		AddOutputs(common.PortCANTx). // Frame out
-		WithInitialState(initState).
-		WithActivationFunc(af)
+	mcu := component.New("mcu-"+name).
+		AddInputs(common.PortCANRx, common.PortCANTxConfirm, common.PortCANTxStatus, common.PortSelfActivation). // Frame in, transmitted frame in, transmit status, timer tick
+		AddOutputs(common.PortCANTx, common.PortCANTxAbort, common.PortSelfActivation).                          // Frame out, abort requests, timer tick
+		WithInitialState(func(state component.State) {
+			state.Set(stateKeyTicks, 0)
+			initISOTPState(state)
+			initUDSState(state)
+			initSchedulerState(state)
+			initState(state)
+		}).
+		WithActivationFunc(func(this *component.Component) error {
+			// Each activation is a tick of MCU timers
+			this.State().Set(stateKeyTicks, CurrentTick(this)+1)
+			return af(this)
+		})
+
+	mcu.OutputByName(common.PortSelfActivation).PipeTo(mcu.InputByName(common.PortSelfActivation))
+
+	return mcu
+}
+
+// PowerOn activates MCU in the first cycle, so its timers start without waiting for a frame (e.g., to send cyclic messages)
+func PowerOn(mcu *component.Component) {
+	mcu.InputByName(common.PortSelfActivation).PutSignals(signal.New(true))
+}
+
+// DurationToTicks converts the duration in MCU time to MCU ticks (rounding up)
+func DurationToTicks(duration time.Duration) int {
+	return int((duration + TickDuration - 1) / TickDuration)
+}
+
+// CurrentTick returns the number of MCU activations so far (the MCU clock)
+func CurrentTick(mcu *component.Component) int {
+	return mcu.State().Get(stateKeyTicks).(int)
+}
+
+// KeepTicking activates MCU in the next cycle, so the ticks follow the simulated time (timers are running)
+func KeepTicking(mcu *component.Component) {
+	if !mcu.OutputByName(common.PortSelfActivation).HasSignals() {
+		mcu.OutputByName(common.PortSelfActivation).PutSignals(signal.New(true))
+	}
 }
@@ -0,0 +1,118 @@
+package microcontroller
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/codec"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/common"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/controller"
+	"github.com/hovsep/fmesh/component"
+	"github.com/hovsep/fmesh/signal"
+)
+
+const (
+	stateKeySchedulerNextTicks = "scheduler_next_ticks" // Tick of the next transmission of each cyclic message (by index)
+	stateKeySchedulerPending   = "scheduler_pending"    // Cyclic frames handed to the controller and not transmitted yet (by ID)
+)
+
+// PayloadBuilder provides the data of the cyclic message (up to 8 bytes)
+type PayloadBuilder func(mcu *component.Component) ([]byte, error)
+
+// CyclicMessage is the data frame transmitted periodically (e.g., sensor values broadcast to other ECUs)
+type CyclicMessage struct {
+	Id          uint32
+	Extended    bool
+	Period      time.Duration // In MCU time, converted to MCU ticks (ignored when PeriodTicks is set)
+	PeriodTicks int
+	Payload     PayloadBuilder
+}
+
+// Scheduler transmits cyclic messages: the first time right after power-on, then once per period.
+// Like a hardware mailbox, the frame still waiting for the bus is replaced by the new one (the old one is aborted)
+type Scheduler struct {
+	Messages  []*CyclicMessage
+	StopAfter int // Ticks since power-on when the scheduler stops, so the mesh can stop too (zero runs forever)
+}
+
+// NewScheduler creates the scheduler running for the given MCU time since power-on (zero runs forever)
+func NewScheduler(stopAfter time.Duration) *Scheduler {
+	return &Scheduler{
+		StopAfter: DurationToTicks(stopAfter),
+	}
+}
+
+// WithMessage registers the cyclic message
+func (s *Scheduler) WithMessage(msg *CyclicMessage) *Scheduler {
+	s.Messages = append(s.Messages, msg)
+	return s
+}
+
+// Ticks returns the period of the message in MCU ticks
+func (msg *CyclicMessage) Ticks() int {
+	if msg.PeriodTicks > 0 {
+		return msg.PeriodTicks
+	}
+	return max(1, DurationToTicks(msg.Period))
+}
+
+func initSchedulerState(state component.State) {
+	state.Set(stateKeySchedulerNextTicks, make(map[int]int))
+	state.Set(stateKeySchedulerPending, make(map[uint32]int))
+}
+
+// tick transmits the messages which are due, MCU keeps ticking until the scheduler stops
+func (s *Scheduler) tick(mcu *component.Component) error {
+	pending := mcu.State().Get(stateKeySchedulerPending).(map[uint32]int)
+	mcu.InputByName(common.PortCANTxStatus).Signals().ForEach(func(sig *signal.Signal) error {
+		if status, ok := sig.PayloadOrNil().(*controller.TxStatus); ok && pending[status.Frame.Id] > 0 {
+			pending[status.Frame.Id]--
+		}
+		return nil
+	})
+
+	tick := CurrentTick(mcu)
+	if len(s.Messages) == 0 || s.StopAfter > 0 && tick > s.StopAfter {
+		return nil
+	}
+
+	nextTicks := mcu.State().Get(stateKeySchedulerNextTicks).(map[int]int)
+	for i, msg := range s.Messages {
+		if next, ok := nextTicks[i]; ok && tick < next {
+			continue
+		}
+		nextTicks[i] = tick + msg.Ticks()
+
+		data, err := msg.Payload(mcu)
+		if err != nil {
+			return fmt.Errorf("failed to build cyclic message 0x%03X: %w", msg.Id, err)
+		}
+
+		if len(data) > codec.ProtocolMaxDataBytes {
+			return fmt.Errorf("cyclic message 0x%03X has %d data bytes", msg.Id, len(data))
+		}
+
+		frame := &codec.Frame{
+			Id:       msg.Id,
+			Extended: msg.Extended,
+			DLC:      uint8(len(data)),
+		}
+		copy(frame.Data[:], data)
+		if !frame.IsValid() {
+			return fmt.Errorf("cyclic message 0x%03X is not a valid frame", msg.Id)
+		}
+
+		// The previous frame missed its slot, the receivers need the fresh value
+		if pending[msg.Id] > 0 {
+			mcu.Logger().Printf("cyclic message 0x%03X is still pending, replacing it", msg.Id)
+			mcu.OutputByName(common.PortCANTxAbort).PutSignals(signal.New(&controller.TxAbortRequest{Id: msg.Id, Extended: msg.Extended}))
+		}
+		pending[msg.Id]++
+
+		mcu.OutputByName(common.PortCANTx).PutSignals(signal.New(frame))
+		mcu.Logger().Printf("sending cyclic message 0x%03X: % X", msg.Id, data)
+	}
+
+	KeepTicking(mcu)
+	return nil
+}
@@ -0,0 +1,204 @@
+package microcontroller
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/codec"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/common"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/controller"
+	"github.com/hovsep/fmesh/component"
+	"github.com/hovsep/fmesh/signal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// staticPayload returns the builder of the constant payload
+func staticPayload(data ...byte) PayloadBuilder {
+	return func(mcu *component.Component) ([]byte, error) {
+		return data, nil
+	}
+}
+
+// runSchedulerTick runs the scheduler in the given tick with the transmit statuses reported by the controller,
+// returns IDs of the sent frames and of the abort requests
+func runSchedulerTick(t *testing.T, s *Scheduler, mcu *component.Component, tick int, statuses ...*controller.TxStatus) ([]uint32, []uint32) {
+	setTick(mcu, tick)
+	for _, status := range statuses {
+		mcu.InputByName(common.PortCANTxStatus).PutSignals(signal.New(status))
+	}
+	require.NoError(t, s.tick(mcu))
+	mcu.InputByName(common.PortCANTxStatus).Clear()
+
+	var sent, aborted []uint32
+	for _, frame := range takeOutput[*codec.Frame](t, mcu, common.PortCANTx) {
+		sent = append(sent, frame.Id)
+	}
+	for _, req := range takeOutput[*controller.TxAbortRequest](t, mcu, common.PortCANTxAbort) {
+		aborted = append(aborted, req.Id)
+	}
+	return sent, aborted
+}
+
+// completed reports the successful transmission of the frames
+func completed(ids ...uint32) []*controller.TxStatus {
+	var statuses []*controller.TxStatus
+	for _, id := range ids {
+		statuses = append(statuses, &controller.TxStatus{Frame: &codec.Frame{Id: id}, Result: controller.TxResultComplete})
+	}
+	return statuses
+}
+
+func TestCyclicMessageTicks(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  *CyclicMessage
+		want int
+	}{
+		{
+			name: "period in time",
+			msg:  &CyclicMessage{Period: 10 * time.Millisecond},
+			want: 20000,
+		},
+		{
+			name: "period is rounded up to whole ticks",
+			msg:  &CyclicMessage{Period: TickDuration + 1},
+			want: 2,
+		},
+		{
+			name: "zero period is one tick",
+			msg:  &CyclicMessage{},
+			want: 1,
+		},
+		{
+			name: "period in ticks takes precedence",
+			msg:  &CyclicMessage{Period: 10 * time.Millisecond, PeriodTicks: 7},
+			want: 7,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.msg.Ticks())
+		})
+	}
+}
+
+func TestSchedulerTick(t *testing.T) {
+	t.Run("messages are sent at power-on and once per period", func(t *testing.T) {
+		s := NewScheduler(0).
+			WithMessage(&CyclicMessage{Id: 0x100, PeriodTicks: 3, Payload: staticPayload(0x01)}).
+			WithMessage(&CyclicMessage{Id: 0x200, PeriodTicks: 5, Payload: staticPayload(0x02, 0x03)})
+		mcu := getTestMCU()
+
+		sentByTick := make(map[int][]uint32)
+		var lastSent []uint32
+		for tick := 1; tick <= 11; tick++ {
+			sent, aborted := runSchedulerTick(t, s, mcu, tick, completed(lastSent...)...)
+			assert.Empty(t, aborted)
+			if len(sent) > 0 {
+				sentByTick[tick] = sent
+			}
+			lastSent = sent
+		}
+
+		assert.Equal(t, map[int][]uint32{
+			1:  {0x100, 0x200},
+			4:  {0x100},
+			6:  {0x200},
+			7:  {0x100},
+			10: {0x100},
+			11: {0x200},
+		}, sentByTick)
+		assert.True(t, mcu.OutputByName(common.PortSelfActivation).HasSignals(), "the scheduler keeps MCU ticking")
+	})
+
+	t.Run("scheduler stops after the given ticks", func(t *testing.T) {
+		s := &Scheduler{StopAfter: 4}
+		s.WithMessage(&CyclicMessage{Id: 0x100, PeriodTicks: 2, Payload: staticPayload(0x01)})
+		mcu := getTestMCU()
+
+		sent, _ := runSchedulerTick(t, s, mcu, 3)
+		assert.Equal(t, []uint32{0x100}, sent)
+
+		mcu.OutputByName(common.PortSelfActivation).Clear()
+		sent, _ = runSchedulerTick(t, s, mcu, 4)
+		assert.Empty(t, sent)
+		assert.True(t, mcu.OutputByName(common.PortSelfActivation).HasSignals())
+
+		mcu.OutputByName(common.PortSelfActivation).Clear()
+		sent, _ = runSchedulerTick(t, s, mcu, 5, completed(0x100)...)
+		assert.Empty(t, sent)
+		assert.False(t, mcu.OutputByName(common.PortSelfActivation).HasSignals())
+	})
+
+	t.Run("pending frame is replaced by the next one", func(t *testing.T) {
+		s := NewScheduler(0).
+			WithMessage(&CyclicMessage{Id: 0x100, PeriodTicks: 2, Payload: staticPayload(0x01)})
+		mcu := getTestMCU()
+		pending := func() int {
+			return mcu.State().Get(stateKeySchedulerPending).(map[uint32]int)[0x100]
+		}
+
+		sent, aborted := runSchedulerTick(t, s, mcu, 1)
+		assert.Equal(t, []uint32{0x100}, sent)
+		assert.Empty(t, aborted)
+		assert.Equal(t, 1, pending())
+
+		// The bus is busy, the frame is still pending when the next one is due
+		sent, aborted = runSchedulerTick(t, s, mcu, 3)
+		assert.Equal(t, []uint32{0x100}, sent)
+		assert.Equal(t, []uint32{0x100}, aborted)
+		assert.Equal(t, 2, pending())
+
+		// The controller reports the abort of the old frame and the transmission of the new one
+		_, _ = runSchedulerTick(t, s, mcu, 4, &controller.TxStatus{Frame: &codec.Frame{Id: 0x100}, Result: controller.TxResultAborted})
+		assert.Equal(t, 1, pending())
+		_, _ = runSchedulerTick(t, s, mcu, 4, completed(0x100)...)
+		assert.Equal(t, 0, pending())
+
+		// Statuses of other frames do not change the bookkeeping
+		_, _ = runSchedulerTick(t, s, mcu, 4, completed(0x7E8)...)
+		assert.Equal(t, 0, pending())
+
+		sent, aborted = runSchedulerTick(t, s, mcu, 5)
+		assert.Equal(t, []uint32{0x100}, sent)
+		assert.Empty(t, aborted)
+	})
+}
+
+func TestSchedulerTickErrors(t *testing.T) {
+	tests := []struct {
+		name          string
+		msg           *CyclicMessage
+		wantErrString string
+	}{
+		{
+			name: "payload builder fails",
+			msg: &CyclicMessage{Id: 0x100, PeriodTicks: 1, Payload: func(mcu *component.Component) ([]byte, error) {
+				return nil, errors.New("sensor is not ready")
+			}},
+			wantErrString: "failed to build cyclic message 0x100: sensor is not ready",
+		},
+		{
+			name:          "payload is too long",
+			msg:           &CyclicMessage{Id: 0x100, PeriodTicks: 1, Payload: staticPayload(1, 2, 3, 4, 5, 6, 7, 8, 9)},
+			wantErrString: "cyclic message 0x100 has 9 data bytes",
+		},
+		{
+			name:          "invalid ID",
+			msg:           &CyclicMessage{Id: 0x800, PeriodTicks: 1, Payload: staticPayload(0x01)},
+			wantErrString: "cyclic message 0x800 is not a valid frame",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mcu := getTestMCU()
+			setTick(mcu, 1)
+
+			err := NewScheduler(0).WithMessage(tt.msg).tick(mcu)
+			assert.ErrorContains(t, err, tt.wantErrString)
+			assert.False(t, mcu.OutputByName(common.PortCANTx).HasSignals())
+		})
+	}
+}
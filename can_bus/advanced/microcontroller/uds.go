@@ -0,0 +1,471 @@
+package microcontroller
+
+import (
+	"encoding/binary"
+	"slices"
+	"time"
+
+	"github.com/hovsep/fmesh/component"
+)
+
+// DiagnosticSession is the UDS session of ECU, the services available to the tester depend on it
+type DiagnosticSession byte
+
+// NegativeResponseCode tells the tester why the request is rejected
+type NegativeResponseCode byte
+
+// DataIdentifier identifies a data record read or written by UDS services (e.g., 0xF190 is VIN)
+type DataIdentifier uint16
+
+// DataIdentifierDescriptor defines access to the data record
+type DataIdentifierDescriptor struct {
+	Read        func(mcu *component.Component) []byte
+	Write       func(mcu *component.Component, data []byte) // Nil for read-only records, writing requires unlocked security access
+	WriteLength int                                         // Exact length of data to write
+}
+
+// DataIdentifierMap maps data identifiers to respective records
+type DataIdentifierMap map[DataIdentifier]DataIdentifierDescriptor
+
+// ServiceSessionMap maps UDS services to the sessions they are available in
+type ServiceSessionMap map[ServiceID][]DiagnosticSession
+
+// SecurityKeyFunc is the ECU secret: it calculates the key expected for the seed
+type SecurityKeyFunc func(seed uint16) uint16
+
+// UDSServer answers requests of workshop tools (ISO 14229) on top of ISO-TP,
+// the session and security state are kept in the state of MCU
+type UDSServer struct {
+	DataIdentifiers DataIdentifierMap
+	ServiceSessions ServiceSessionMap
+	SecurityKey     SecurityKeyFunc
+	ReadDTCs        func(mcu *component.Component) []DTC
+	ClearDTCs       func(mcu *component.Component)
+	SessionTimeout  int // S3: non-default session ends when the tester is silent for this number of ticks
+	MaxKeyAttempts  int // Invalid keys allowed before security access is delayed
+	SecurityDelay   int // Ticks to wait after too many invalid keys
+}
+
+// udsHandler handles the request of one service and returns the positive response (without the service ID) or NRC
+type udsHandler func(mcu *component.Component, request []byte) ([]byte, NegativeResponseCode)
+
+const (
+	DefaultSession            DiagnosticSession = 0x01
+	ProgrammingSession        DiagnosticSession = 0x02
+	ExtendedDiagnosticSession DiagnosticSession = 0x03
+
+	ServiceDiagnosticSessionControl   ServiceID = 0x10
+	ServiceECUReset                   ServiceID = 0x11
+	ServiceClearDiagnosticInformation ServiceID = 0x14
+	ServiceReadDTCInformation         ServiceID = 0x19
+	ServiceReadDataByIdentifier       ServiceID = 0x22
+	ServiceSecurityAccess             ServiceID = 0x27
+	ServiceWriteDataByIdentifier      ServiceID = 0x2E
+	ServiceTesterPresent              ServiceID = 0x3E
+	NegativeResponseServiceID         ServiceID = 0x7F
+
+	NRCServiceNotSupported                   NegativeResponseCode = 0x11
+	NRCSubFunctionNotSupported               NegativeResponseCode = 0x12
+	NRCIncorrectMessageLengthOrInvalidFormat NegativeResponseCode = 0x13
+	NRCRequestSequenceError                  NegativeResponseCode = 0x24
+	NRCRequestOutOfRange                     NegativeResponseCode = 0x31
+	NRCSecurityAccessDenied                  NegativeResponseCode = 0x33
+	NRCInvalidKey                            NegativeResponseCode = 0x35
+	NRCExceededNumberOfAttempts              NegativeResponseCode = 0x36
+	NRCRequiredTimeDelayNotExpired           NegativeResponseCode = 0x37
+	NRCServiceNotSupportedInActiveSession    NegativeResponseCode = 0x7F
+	nrcPositiveResponse                      NegativeResponseCode = 0x00
+
+	udsFirstServiceID           = ServiceDiagnosticSessionControl // OBD services have lower IDs
+	suppressPositiveResponseBit = 0x80                            // The highest bit of the sub-function byte
+
+	// Sub-functions
+	resetTypeHard                 = 0x01
+	resetTypeKeyOffOn             = 0x02
+	resetTypeSoft                 = 0x03
+	securityRequestSeed           = 0x01
+	securitySendKey               = 0x02
+	reportNumberOfDTCByStatusMask = 0x01
+	reportDTCByStatusMask         = 0x02
+
+	// DTC reports
+	dtcFormatISO14229         = 0x01
+	dtcStatusTestFailed       = 0x01
+	dtcStatusConfirmed        = 0x08
+	dtcStatusAvailabilityMask = dtcStatusTestFailed | dtcStatusConfirmed
+	storedDTCStatus           = dtcStatusTestFailed | dtcStatusConfirmed // All stored DTCs are confirmed and failed
+	allDTCGroups              = 0xFFFFFF
+
+	// P2 and P2* server timings reported to the tester (in 1ms and 10ms units)
+	p2ServerMax     = 50
+	p2StarServerMax = 500
+
+	// The seed generator is deterministic, so the simulation is reproducible
+	initialSeedGeneratorState uint16 = 0xACE1
+
+	stateKeyUDSSession             = "uds_session"
+	stateKeyUDSSecurityUnlocked    = "uds_security_unlocked"
+	stateKeyUDSSeed                = "uds_seed"
+	stateKeyUDSSeedGenerator       = "uds_seed_generator"
+	stateKeyUDSFailedKeyAttempts   = "uds_failed_key_attempts"
+	stateKeyUDSSecurityDelayedTill = "uds_security_delayed_till"
+	stateKeyUDSLastRequestTick     = "uds_last_request_tick"
+)
+
+// Services which have the sub-function byte (its highest bit asks the server not to send positive response)
+var udsServicesWithSubFunction = []ServiceID{
+	ServiceDiagnosticSessionControl,
+	ServiceECUReset,
+	ServiceReadDTCInformation,
+	ServiceSecurityAccess,
+	ServiceTesterPresent,
+}
+
+// Negative responses not sent to functional requests (the request is just not for this ECU)
+var udsNRCsSuppressedOnFunctionalRequest = []NegativeResponseCode{
+	NRCServiceNotSupported,
+	NRCSubFunctionNotSupported,
+	NRCRequestOutOfRange,
+	NRCServiceNotSupportedInActiveSession,
+}
+
+// DefaultServiceSessions returns the usual availability: reading and clearing diagnostic data outside of programming session,
+// security access in non-default sessions and writing only in the extended session
+func DefaultServiceSessions() ServiceSessionMap {
+	allSessions := []DiagnosticSession{DefaultSession, ProgrammingSession, ExtendedDiagnosticSession}
+	return ServiceSessionMap{
+		ServiceDiagnosticSessionControl:   allSessions,
+		ServiceECUReset:                   allSessions,
+		ServiceTesterPresent:              allSessions,
+		ServiceReadDataByIdentifier:       {DefaultSession, ExtendedDiagnosticSession},
+		ServiceReadDTCInformation:         {DefaultSession, ExtendedDiagnosticSession},
+		ServiceClearDiagnosticInformation: {DefaultSession, ExtendedDiagnosticSession},
+		ServiceSecurityAccess:             {ProgrammingSession, ExtendedDiagnosticSession},
+		ServiceWriteDataByIdentifier:      {ExtendedDiagnosticSession},
+	}
+}
+
+// NewUDSServer creates a diagnostic server with default service availability and timings
+func NewUDSServer(securityKey SecurityKeyFunc) *UDSServer {
+	return &UDSServer{
+		DataIdentifiers: make(DataIdentifierMap),
+		ServiceSessions: DefaultServiceSessions(),
+		SecurityKey:     securityKey,
+		SessionTimeout:  DurationToTicks(5 * time.Second),
+		MaxKeyAttempts:  3,
+		SecurityDelay:   DurationToTicks(10 * time.Second),
+	}
+}
+
+// WithDataIdentifier registers the data record readable (and optionally writable) by the tester
+func (s *UDSServer) WithDataIdentifier(did DataIdentifier, descriptor DataIdentifierDescriptor) *UDSServer {
+	s.DataIdentifiers[did] = descriptor
+	return s
+}
+
+// WithDTCs gives the server access to the stored trouble codes
+func (s *UDSServer) WithDTCs(readDTCs func(mcu *component.Component) []DTC, clearDTCs func(mcu *component.Component)) *UDSServer {
+	s.ReadDTCs = readDTCs
+	s.ClearDTCs = clearDTCs
+	return s
+}
+
+func (session DiagnosticSession) String() string {
+	switch session {
+	case DefaultSession:
+		return "default"
+	case ProgrammingSession:
+		return "programming"
+	case ExtendedDiagnosticSession:
+		return "extended diagnostic"
+	default:
+		return "unknown"
+	}
+}
+
+func initUDSState(state component.State) {
+	state.Set(stateKeyUDSSession, DefaultSession)
+	state.Set(stateKeyUDSSecurityUnlocked, false)
+	state.Set(stateKeyUDSSeed, uint16(0))
+	state.Set(stateKeyUDSSeedGenerator, initialSeedGeneratorState)
+	state.Set(stateKeyUDSFailedKeyAttempts, 0)
+	state.Set(stateKeyUDSSecurityDelayedTill, 0)
+	state.Set(stateKeyUDSLastRequestTick, 0)
+}
+
+// isUDSRequest tells whether the request is for UDS server (OBD services are handled by the logic table)
+func isUDSRequest(payload []byte) bool {
+	return len(payload) > 0 && ServiceID(payload[0]) >= udsFirstServiceID
+}
+
+// tick ends the non-default session when the tester is silent for too long (S3 timeout)
+func (s *UDSServer) tick(mcu *component.Component) {
+	if mcu.State().Get(stateKeyUDSSession).(DiagnosticSession) == DefaultSession {
+		return
+	}
+
+	if CurrentTick(mcu)-mcu.State().Get(stateKeyUDSLastRequestTick).(int) > s.SessionTimeout {
+		mcu.Logger().Println("UDS session timeout, back to default session")
+		s.switchSession(mcu, DefaultSession)
+		return
+	}
+	KeepTicking(mcu)
+}
+
+// handleRequest returns the response to be sent to the tester (nil when the response is suppressed)
+func (s *UDSServer) handleRequest(mcu *component.Component, mode AddressingMode, request []byte) []byte {
+	sid := ServiceID(request[0])
+	mcu.State().Set(stateKeyUDSLastRequestTick, CurrentTick(mcu))
+	mcu.Logger().Printf("received UDS request: addressing mode: %s, sid: 0x%02X, data: % X", mode, sid, request[1:])
+
+	suppressPositiveResponse := false
+	if slices.Contains(udsServicesWithSubFunction, sid) && len(request) > 1 {
+		suppressPositiveResponse = request[1]&suppressPositiveResponseBit != 0
+		request = append([]byte{request[0], request[1] &^ suppressPositiveResponseBit}, request[2:]...)
+	}
+
+	response, nrc := s.dispatch(mcu, sid, request)
+
+	// Non-default session is supervised by S3 timer
+	if mcu.State().Get(stateKeyUDSSession).(DiagnosticSession) != DefaultSession {
+		KeepTicking(mcu)
+	}
+
+	if nrc != nrcPositiveResponse {
+		if mode == FunctionalAddressing && slices.Contains(udsNRCsSuppressedOnFunctionalRequest, nrc) {
+			return nil
+		}
+		mcu.Logger().Printf("UDS negative response: sid: 0x%02X, NRC: 0x%02X", sid, nrc)
+		return []byte{byte(NegativeResponseServiceID), byte(sid), byte(nrc)}
+	}
+
+	if suppressPositiveResponse {
+		return nil
+	}
+	return append([]byte{byte(sid + ResponseServiceIDOffset)}, response...)
+}
+
+func (s *UDSServer) dispatch(mcu *component.Component, sid ServiceID, request []byte) ([]byte, NegativeResponseCode) {
+	handlers := map[ServiceID]udsHandler{
+		ServiceDiagnosticSessionControl:   s.handleDiagnosticSessionControl,
+		ServiceECUReset:                   s.handleECUReset,
+		ServiceClearDiagnosticInformation: s.handleClearDiagnosticInformation,
+		ServiceReadDTCInformation:         s.handleReadDTCInformation,
+		ServiceReadDataByIdentifier:       s.handleReadDataByIdentifier,
+		ServiceSecurityAccess:             s.handleSecurityAccess,
+		ServiceWriteDataByIdentifier:      s.handleWriteDataByIdentifier,
+		ServiceTesterPresent:              s.handleTesterPresent,
+	}
+
+	handler, ok := handlers[sid]
+	if !ok {
+		return nil, NRCServiceNotSupported
+	}
+
+	session := mcu.State().Get(stateKeyUDSSession).(DiagnosticSession)
+	if !slices.Contains(s.ServiceSessions[sid], session) {
+		return nil, NRCServiceNotSupportedInActiveSession
+	}
+
+	if slices.Contains(udsServicesWithSubFunction, sid) && len(request) < 2 {
+		return nil, NRCIncorrectMessageLengthOrInvalidFormat
+	}
+	return handler(mcu, request)
+}
+
+func (s *UDSServer) handleDiagnosticSessionControl(mcu *component.Component, request []byte) ([]byte, NegativeResponseCode) {
+	session := DiagnosticSession(request[1])
+	if session != DefaultSession && session != ProgrammingSession && session != ExtendedDiagnosticSession {
+		return nil, NRCSubFunctionNotSupported
+	}
+	if len(request) != 2 {
+		return nil, NRCIncorrectMessageLengthOrInvalidFormat
+	}
+
+	s.switchSession(mcu, session)
+	return binary.BigEndian.AppendUint16(binary.BigEndian.AppendUint16([]byte{byte(session)}, p2ServerMax), p2StarServerMax), nrcPositiveResponse
+}
+
+func (s *UDSServer) handleECUReset(mcu *component.Component, request []byte) ([]byte, NegativeResponseCode) {
+	resetType := request[1]
+	if resetType != resetTypeHard && resetType != resetTypeKeyOffOn && resetType != resetTypeSoft {
+		return nil, NRCSubFunctionNotSupported
+	}
+	if len(request) != 2 {
+		return nil, NRCIncorrectMessageLengthOrInvalidFormat
+	}
+
+	// After reset ECU starts in the default session with security locked
+	mcu.Logger().Printf("ECU reset, type: 0x%02X", resetType)
+	s.switchSession(mcu, DefaultSession)
+	return []byte{resetType}, nrcPositiveResponse
+}
+
+func (s *UDSServer) handleClearDiagnosticInformation(mcu *component.Component, request []byte) ([]byte, NegativeResponseCode) {
+	if len(request) != 4 {
+		return nil, NRCIncorrectMessageLengthOrInvalidFormat
+	}
+
+	// Only clearing of all groups is supported
+	group := int(request[1])<<16 | int(request[2])<<8 | int(request[3])
+	if group != allDTCGroups || s.ClearDTCs == nil {
+		return nil, NRCRequestOutOfRange
+	}
+
+	s.ClearDTCs(mcu)
+	return []byte{}, nrcPositiveResponse
+}
+
+func (s *UDSServer) handleReadDTCInformation(mcu *component.Component, request []byte) ([]byte, NegativeResponseCode) {
+	reportType := request[1]
+	if reportType != reportNumberOfDTCByStatusMask && reportType != reportDTCByStatusMask {
+		return nil, NRCSubFunctionNotSupported
+	}
+	if len(request) != 3 {
+		return nil, NRCIncorrectMessageLengthOrInvalidFormat
+	}
+
+	var dtcs []DTC
+	if s.ReadDTCs != nil && request[2]&storedDTCStatus != 0 {
+		dtcs = s.ReadDTCs(mcu)
+	}
+
+	response := []byte{reportType, dtcStatusAvailabilityMask}
+	if reportType == reportNumberOfDTCByStatusMask {
+		response = append(response, dtcFormatISO14229)
+		return binary.BigEndian.AppendUint16(response, uint16(len(dtcs))), nrcPositiveResponse
+	}
+
+	for _, dtc := range dtcs {
+		// OBD code and the failure type byte (not specified)
+		response = append(response, dtc[0], dtc[1], 0x00, storedDTCStatus)
+	}
+	return response, nrcPositiveResponse
+}
+
+func (s *UDSServer) handleReadDataByIdentifier(mcu *component.Component, request []byte) ([]byte, NegativeResponseCode) {
+	if len(request) < 3 || len(request)%2 != 1 {
+		return nil, NRCIncorrectMessageLengthOrInvalidFormat
+	}
+
+	var response []byte
+	for i := 1; i < len(request); i += 2 {
+		did := DataIdentifier(binary.BigEndian.Uint16(request[i:]))
+		descriptor, ok := s.DataIdentifiers[did]
+		if !ok || descriptor.Read == nil {
+			return nil, NRCRequestOutOfRange
+		}
+		response = binary.BigEndian.AppendUint16(response, uint16(did))
+		response = append(response, descriptor.Read(mcu)...)
+	}
+
+	if len(response)+1 > MaxISOTPMessageLength {
+		return nil, NRCIncorrectMessageLengthOrInvalidFormat
+	}
+	return response, nrcPositiveResponse
+}
+
+func (s *UDSServer) handleWriteDataByIdentifier(mcu *component.Component, request []byte) ([]byte, NegativeResponseCode) {
+	if len(request) < 4 {
+		return nil, NRCIncorrectMessageLengthOrInvalidFormat
+	}
+
+	did := DataIdentifier(binary.BigEndian.Uint16(request[1:]))
+	descriptor, ok := s.DataIdentifiers[did]
+	if !ok || descriptor.Write == nil {
+		return nil, NRCRequestOutOfRange
+	}
+
+	data := request[3:]
+	if len(data) != descriptor.WriteLength {
+		return nil, NRCIncorrectMessageLengthOrInvalidFormat
+	}
+
+	if !mcu.State().Get(stateKeyUDSSecurityUnlocked).(bool) {
+		return nil, NRCSecurityAccessDenied
+	}
+
+	descriptor.Write(mcu, data)
+	return binary.BigEndian.AppendUint16(nil, uint16(did)), nrcPositiveResponse
+}
+
+func (s *UDSServer) handleSecurityAccess(mcu *component.Component, request []byte) ([]byte, NegativeResponseCode) {
+	switch request[1] {
+	case securityRequestSeed:
+		if len(request) != 2 {
+			return nil, NRCIncorrectMessageLengthOrInvalidFormat
+		}
+
+		if CurrentTick(mcu) < mcu.State().Get(stateKeyUDSSecurityDelayedTill).(int) {
+			return nil, NRCRequiredTimeDelayNotExpired
+		}
+
+		// Zero seed tells the tester the security is already unlocked
+		seed := uint16(0)
+		if !mcu.State().Get(stateKeyUDSSecurityUnlocked).(bool) {
+			seed = nextSeed(mcu)
+		}
+		mcu.State().Set(stateKeyUDSSeed, seed)
+		return binary.BigEndian.AppendUint16([]byte{securityRequestSeed}, seed), nrcPositiveResponse
+	case securitySendKey:
+		if len(request) != 4 {
+			return nil, NRCIncorrectMessageLengthOrInvalidFormat
+		}
+
+		seed := mcu.State().Get(stateKeyUDSSeed).(uint16)
+		if seed == 0 {
+			return nil, NRCRequestSequenceError
+		}
+		// The seed is valid for one key only
+		mcu.State().Set(stateKeyUDSSeed, uint16(0))
+
+		key := binary.BigEndian.Uint16(request[2:])
+		if s.SecurityKey == nil || key != s.SecurityKey(seed) {
+			failedAttempts := mcu.State().Get(stateKeyUDSFailedKeyAttempts).(int) + 1
+			if failedAttempts >= s.MaxKeyAttempts {
+				mcu.State().Set(stateKeyUDSFailedKeyAttempts, 0)
+				mcu.State().Set(stateKeyUDSSecurityDelayedTill, CurrentTick(mcu)+s.SecurityDelay)
+				return nil, NRCExceededNumberOfAttempts
+			}
+			mcu.State().Set(stateKeyUDSFailedKeyAttempts, failedAttempts)
+			return nil, NRCInvalidKey
+		}
+
+		mcu.Logger().Println("UDS security access is unlocked")
+		mcu.State().Set(stateKeyUDSFailedKeyAttempts, 0)
+		mcu.State().Set(stateKeyUDSSecurityUnlocked, true)
+		return []byte{securitySendKey}, nrcPositiveResponse
+	default:
+		return nil, NRCSubFunctionNotSupported
+	}
+}
+
+func (s *UDSServer) handleTesterPresent(mcu *component.Component, request []byte) ([]byte, NegativeResponseCode) {
+	if request[1] != 0x00 {
+		return nil, NRCSubFunctionNotSupported
+	}
+	if len(request) != 2 {
+		return nil, NRCIncorrectMessageLengthOrInvalidFormat
+	}
+
+	// Nothing to do, the request itself keeps the session alive
+	return []byte{0x00}, nrcPositiveResponse
+}
+
+// switchSession changes the session, security access is locked again on any session change
+func (s *UDSServer) switchSession(mcu *component.Component, session DiagnosticSession) {
+	mcu.Logger().Printf("UDS session: %s->%s", mcu.State().Get(stateKeyUDSSession).(DiagnosticSession), session)
+	mcu.State().Set(stateKeyUDSSession, session)
+	mcu.State().Set(stateKeyUDSSecurityUnlocked, false)
+	mcu.State().Set(stateKeyUDSSeed, uint16(0))
+}
+
+// nextSeed generates the next non-zero seed (xorshift)
+func nextSeed(mcu *component.Component) uint16 {
+	seed := mcu.State().Get(stateKeyUDSSeedGenerator).(uint16)
+	seed ^= seed << 7
+	seed ^= seed >> 9
+	seed ^= seed << 8
+	mcu.State().Set(stateKeyUDSSeedGenerator, seed)
+	return seed
+}
@@ -0,0 +1,186 @@
+package microcontroller
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/hovsep/fmesh/component"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testDID         DataIdentifier = 0x0100
+	testSecretMask  uint16         = 0x5A5A
+	testUDSTimeout                 = 100
+	testUDSDelay                   = 50
+	stateKeyTestDID                = "test_did"
+)
+
+// udsStep is a request sent in the given tick and the expected response
+type udsStep struct {
+	tick    int
+	mode    AddressingMode
+	request []byte
+	want    []byte
+}
+
+func getTestUDSServer() *UDSServer {
+	server := NewUDSServer(func(seed uint16) uint16 {
+		return seed ^ testSecretMask
+	}).WithDataIdentifier(testDID, DataIdentifierDescriptor{
+		Read: func(mcu *component.Component) []byte {
+			return mcu.State().Get(stateKeyTestDID).([]byte)
+		},
+		Write: func(mcu *component.Component, data []byte) {
+			mcu.State().Set(stateKeyTestDID, data)
+		},
+		WriteLength: 2,
+	})
+	server.SessionTimeout = testUDSTimeout
+	server.SecurityDelay = testUDSDelay
+	return server
+}
+
+func getTestUDSMCU() *component.Component {
+	mcu := getTestMCU()
+	mcu.State().Set(stateKeyTestDID, []byte{0x00, 0x00})
+	return mcu
+}
+
+// expectedSeeds returns the seeds generated by a fresh MCU
+func expectedSeeds(n int) []uint16 {
+	mcu := getTestMCU()
+	seeds := make([]uint16, n)
+	for i := range seeds {
+		seeds[i] = nextSeed(mcu)
+	}
+	return seeds
+}
+
+func seedResponse(seed uint16) []byte {
+	return binary.BigEndian.AppendUint16([]byte{0x67, securityRequestSeed}, seed)
+}
+
+func sendKeyRequest(key uint16) []byte {
+	return binary.BigEndian.AppendUint16([]byte{0x27, securitySendKey}, key)
+}
+
+func TestUDSServerHandleRequest(t *testing.T) {
+	seeds := expectedSeeds(4)
+	enterExtendedSession := udsStep{
+		mode:    PhysicalAddressing,
+		request: []byte{0x10, 0x03},
+		want:    []byte{0x50, 0x03, 0x00, p2ServerMax, p2StarServerMax >> 8, p2StarServerMax & 0xFF},
+	}
+
+	tests := []struct {
+		name  string
+		steps []udsStep
+	}{
+		{
+			name: "unsupported service",
+			steps: []udsStep{
+				{mode: PhysicalAddressing, request: []byte{0x31, 0x01}, want: []byte{0x7F, 0x31, 0x11}},
+				{mode: FunctionalAddressing, request: []byte{0x31, 0x01}, want: nil},
+			},
+		},
+		{
+			name: "security access in default session",
+			steps: []udsStep{
+				{mode: PhysicalAddressing, request: []byte{0x27, 0x01}, want: []byte{0x7F, 0x27, 0x7F}},
+				{mode: FunctionalAddressing, request: []byte{0x27, 0x01}, want: nil},
+			},
+		},
+		{
+			name: "tester present",
+			steps: []udsStep{
+				{mode: PhysicalAddressing, request: []byte{0x3E, 0x00}, want: []byte{0x7E, 0x00}},
+				{mode: PhysicalAddressing, request: []byte{0x3E, 0x80}, want: nil},
+				{mode: PhysicalAddressing, request: []byte{0x3E, 0x01}, want: []byte{0x7F, 0x3E, 0x12}},
+				{mode: PhysicalAddressing, request: []byte{0x3E}, want: []byte{0x7F, 0x3E, 0x13}},
+			},
+		},
+		{
+			name: "write while security is locked",
+			steps: []udsStep{
+				enterExtendedSession,
+				{mode: PhysicalAddressing, request: []byte{0x2E, 0x01, 0x00, 0xAA, 0xBB}, want: []byte{0x7F, 0x2E, 0x33}},
+				{mode: PhysicalAddressing, request: []byte{0x22, 0x01, 0x00}, want: []byte{0x62, 0x01, 0x00, 0x00, 0x00}},
+			},
+		},
+		{
+			name: "write after security is unlocked",
+			steps: []udsStep{
+				enterExtendedSession,
+				{mode: PhysicalAddressing, request: []byte{0x27, 0x01}, want: seedResponse(seeds[0])},
+				{mode: PhysicalAddressing, request: sendKeyRequest(seeds[0] ^ testSecretMask), want: []byte{0x67, 0x02}},
+				// Zero seed means the security is already unlocked
+				{mode: PhysicalAddressing, request: []byte{0x27, 0x01}, want: seedResponse(0)},
+				{mode: PhysicalAddressing, request: []byte{0x2E, 0x01, 0x00, 0xAA}, want: []byte{0x7F, 0x2E, 0x13}},
+				{mode: PhysicalAddressing, request: []byte{0x2E, 0x01, 0x01, 0xAA, 0xBB}, want: []byte{0x7F, 0x2E, 0x31}},
+				{mode: PhysicalAddressing, request: []byte{0x2E, 0x01, 0x00, 0xAA, 0xBB}, want: []byte{0x6E, 0x01, 0x00}},
+				{mode: PhysicalAddressing, request: []byte{0x22, 0x01, 0x00}, want: []byte{0x62, 0x01, 0x00, 0xAA, 0xBB}},
+				// Security is locked again on session change
+				enterExtendedSession,
+				{mode: PhysicalAddressing, request: []byte{0x2E, 0x01, 0x00, 0xCC, 0xDD}, want: []byte{0x7F, 0x2E, 0x33}},
+			},
+		},
+		{
+			name: "key without seed",
+			steps: []udsStep{
+				enterExtendedSession,
+				{mode: PhysicalAddressing, request: sendKeyRequest(seeds[0] ^ testSecretMask), want: []byte{0x7F, 0x27, 0x24}},
+				{mode: PhysicalAddressing, request: []byte{0x27, 0x01}, want: seedResponse(seeds[0])},
+				{mode: PhysicalAddressing, request: sendKeyRequest(0), want: []byte{0x7F, 0x27, 0x35}},
+				// The seed is valid for one key only
+				{mode: PhysicalAddressing, request: sendKeyRequest(seeds[0] ^ testSecretMask), want: []byte{0x7F, 0x27, 0x24}},
+			},
+		},
+		{
+			name: "too many invalid keys delay security access",
+			steps: []udsStep{
+				enterExtendedSession,
+				{mode: PhysicalAddressing, request: []byte{0x27, 0x01}, want: seedResponse(seeds[0])},
+				{mode: PhysicalAddressing, request: sendKeyRequest(0), want: []byte{0x7F, 0x27, 0x35}},
+				{mode: PhysicalAddressing, request: []byte{0x27, 0x01}, want: seedResponse(seeds[1])},
+				{mode: PhysicalAddressing, request: sendKeyRequest(0), want: []byte{0x7F, 0x27, 0x35}},
+				{mode: PhysicalAddressing, request: []byte{0x27, 0x01}, want: seedResponse(seeds[2])},
+				{tick: 10, mode: PhysicalAddressing, request: sendKeyRequest(0), want: []byte{0x7F, 0x27, 0x36}},
+				{tick: 10 + testUDSDelay - 1, mode: PhysicalAddressing, request: []byte{0x27, 0x01}, want: []byte{0x7F, 0x27, 0x37}},
+				{tick: 10 + testUDSDelay, mode: PhysicalAddressing, request: []byte{0x27, 0x01}, want: seedResponse(seeds[3])},
+				{tick: 10 + testUDSDelay, mode: PhysicalAddressing, request: sendKeyRequest(seeds[3] ^ testSecretMask), want: []byte{0x67, 0x02}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := getTestUDSServer()
+			mcu := getTestUDSMCU()
+			for i, step := range tt.steps {
+				setTick(mcu, step.tick)
+				assert.Equal(t, step.want, server.handleRequest(mcu, step.mode, step.request), "step %d: request % X", i, step.request)
+			}
+		})
+	}
+}
+
+func TestUDSServerSessionTimeout(t *testing.T) {
+	server := getTestUDSServer()
+	mcu := getTestUDSMCU()
+
+	server.handleRequest(mcu, PhysicalAddressing, []byte{0x10, 0x03})
+
+	// Tester present keeps the session alive
+	setTick(mcu, testUDSTimeout)
+	server.tick(mcu)
+	server.handleRequest(mcu, PhysicalAddressing, []byte{0x3E, 0x80})
+
+	setTick(mcu, 2*testUDSTimeout)
+	server.tick(mcu)
+	assert.Equal(t, ExtendedDiagnosticSession, mcu.State().Get(stateKeyUDSSession))
+
+	setTick(mcu, 2*testUDSTimeout+1)
+	server.tick(mcu)
+	assert.Equal(t, DefaultSession, mcu.State().Get(stateKeyUDSSession))
+	assert.Equal(t, []byte{0x7F, 0x2E, 0x7F}, server.handleRequest(mcu, PhysicalAddressing, []byte{0x2E, 0x01, 0x00, 0xAA, 0xBB}))
+}
@@ -0,0 +1,112 @@
+package sniffer
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/codec"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/common"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/controller"
+	"github.com/hovsep/fmesh/component"
+	"github.com/hovsep/fmesh/signal"
+)
+
+const (
+	PortObservations = "observations"
+	SnifferUnitName  = "sniffer"
+)
+
+// Observation is a frame seen on the bus with the bus monitoring details
+type Observation struct {
+	Frame           *codec.Frame
+	StartTick       int      // Bus tick (bits seen on the bus so far) of SOF
+	EndTick         int      // Bus tick of the last EOF bit
+	Transmitter     string   // The unit which won arbitration (comma separated if multiple units sent identical frames)
+	LostArbitration []string // Units which started arbitration for this frame, but lost it (they retry later)
+}
+
+// NewNode creates a passive CAN node (bus monitor), which never drives the bus and is ignored by the bus watchdog.
+// Every frame seen on the bus goes to the observations port of MCU
+func NewNode() *can.Node {
+	// FD-capable, so FD frames are observed too
+	snifferDevice := can.NewNodeWithConfig(SnifferUnitName, &controller.Config{FD: true, ListenOnly: true}, func(state component.State) {
+	}, func(this *component.Component) error {
+		return this.InputByName(common.PortCANRx).Signals().ForEach(func(sig *signal.Signal) error {
+			frame, ok := sig.PayloadOrNil().(*codec.Frame)
+			if !ok {
+				return errors.New("failed to cast payload to CAN frame")
+			}
+
+			startTick, err := strconv.Atoi(sig.Labels().ValueOrDefault(common.LabelBusStartBit, "0"))
+			if err != nil {
+				return fmt.Errorf("invalid start of frame: %w", err)
+			}
+
+			endTick, err := strconv.Atoi(sig.Labels().ValueOrDefault(common.LabelBusBit, "0"))
+			if err != nil {
+				return fmt.Errorf("invalid end of frame: %w", err)
+			}
+
+			transmitter := sig.Labels().ValueOrDefault(common.LabelBusDrivers, "")
+			observation := &Observation{
+				Frame:           frame,
+				StartTick:       startTick,
+				EndTick:         endTick,
+				Transmitter:     transmitter,
+				LostArbitration: lostArbitration(sig.Labels().ValueOrDefault(common.LabelBusContenders, ""), transmitter),
+			}
+
+			this.Logger().Println("observed:", observation)
+			this.OutputByName(PortObservations).PutSignals(signal.New(observation))
+			return nil
+		}).ChainableErr()
+	})
+
+	// Add custom ports
+	snifferDevice.MCU.AddOutputs(PortObservations)
+
+	return snifferDevice
+}
+
+// lostArbitration returns the contenders other than the transmitter
+func lostArbitration(contenders, transmitter string) []string {
+	if contenders == "" {
+		return nil
+	}
+
+	winners := strings.Split(transmitter, ",")
+	var losers []string
+	for _, contender := range strings.Split(contenders, ",") {
+		if !slices.Contains(winners, contender) {
+			losers = append(losers, contender)
+		}
+	}
+	return losers
+}
+
+// String returns one line summary (the frame is shown as ID, DLC and data, like in bus monitors)
+func (observation *Observation) String() string {
+	frame := observation.Frame
+	id := fmt.Sprintf("%03X", frame.Id)
+	if frame.Extended {
+		id = fmt.Sprintf("%08X", frame.Id)
+	}
+
+	data := fmt.Sprintf("% X", frame.Data[:frame.DataLength()])
+	if frame.Remote {
+		data = "remote request"
+	}
+
+	s := fmt.Sprintf("[%d-%d] %s: %s [%d] %s", observation.StartTick, observation.EndTick, observation.Transmitter, id, frame.DLC, data)
+	if frame.FD {
+		s += " (FD)"
+	}
+	if len(observation.LostArbitration) > 0 {
+		s += fmt.Sprintf(", lost arbitration: %s", strings.Join(observation.LostArbitration, ", "))
+	}
+	return s
+}
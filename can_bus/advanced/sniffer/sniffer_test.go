@@ -0,0 +1,117 @@
+package sniffer
+
+import (
+	"testing"
+
+	"github.com/hovsep/fmesh"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/bus"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/codec"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/common"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/microcontroller"
+	"github.com/hovsep/fmesh/component"
+	"github.com/hovsep/fmesh/signal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newSenderNode creates the node which sends the frame right after power-on
+func newSenderNode(unitName string, frame *codec.Frame) *can.Node {
+	node := can.NewNode(unitName, func(state component.State) {
+	}, func(this *component.Component) error {
+		if microcontroller.CurrentTick(this) == 1 {
+			this.OutputByName(common.PortCANTx).PutSignals(signal.New(frame))
+		}
+		return nil
+	})
+	microcontroller.PowerOn(node.MCU)
+	return node
+}
+
+func TestSnifferNode(t *testing.T) {
+	low := &codec.Frame{Id: 0x100, DLC: 1, Data: [codec.ProtocolMaxFDDataBytes]byte{0x01}}
+	high := &codec.Frame{Id: 0x200, DLC: 1, Data: [codec.ProtocolMaxFDDataBytes]byte{0x02}}
+
+	snifferNode := NewNode()
+	nodes := can.Nodes{
+		newSenderNode("ecu-a", high),
+		newSenderNode("ecu-b", low),
+		snifferNode,
+	}
+
+	b := bus.New("test-bus")
+	nodes.ConnectToBus(b)
+
+	var observations []*Observation
+	probe := component.New("probe").
+		AddInputs(PortObservations).
+		WithActivationFunc(func(this *component.Component) error {
+			return this.InputByName(PortObservations).Signals().ForEach(func(sig *signal.Signal) error {
+				observations = append(observations, sig.PayloadOrNil().(*Observation))
+				return nil
+			}).ChainableErr()
+		})
+	snifferNode.MCU.OutputByName(PortObservations).PipeTo(probe.InputByName(PortObservations))
+
+	_, err := fmesh.New("sniffer_test").
+		AddComponents(b.GetAllComponents()...).
+		AddComponents(nodes.GetAllComponents()...).
+		AddComponents(probe).
+		Run()
+	require.NoError(t, err)
+
+	require.Len(t, observations, 2)
+
+	// Both nodes started at once, the frame with the lower ID won
+	assert.Equal(t, low, observations[0].Frame)
+	assert.Equal(t, "ecu-b", observations[0].Transmitter)
+	assert.Equal(t, []string{"ecu-a"}, observations[0].LostArbitration)
+
+	// The loser retried alone
+	assert.Equal(t, high, observations[1].Frame)
+	assert.Equal(t, "ecu-a", observations[1].Transmitter)
+	assert.Empty(t, observations[1].LostArbitration)
+
+	// Ticks span SOF..EOF of each frame
+	for i, frame := range []*codec.Frame{low, high} {
+		assert.Equal(t, frame.ToBits().Len(), observations[i].EndTick-observations[i].StartTick+1)
+	}
+	assert.Greater(t, observations[1].StartTick, observations[0].EndTick+codec.ProtocolIFSSize)
+	assert.Equal(t, "[12-66] ecu-b: 100 [1] 01, lost arbitration: ecu-a", observations[0].String())
+}
+
+func TestLostArbitration(t *testing.T) {
+	tests := []struct {
+		name        string
+		contenders  string
+		transmitter string
+		want        []string
+	}{
+		{
+			name:        "no contenders",
+			transmitter: "ecu-a",
+		},
+		{
+			name:        "transmitter alone",
+			contenders:  "ecu-a",
+			transmitter: "ecu-a",
+		},
+		{
+			name:        "losers",
+			contenders:  "ecu-a,ecu-b,ecu-c",
+			transmitter: "ecu-b",
+			want:        []string{"ecu-a", "ecu-c"},
+		},
+		{
+			name:        "identical frames sent by multiple units",
+			contenders:  "ecu-a,ecu-b,ecu-c",
+			transmitter: "ecu-a,ecu-c",
+			want:        []string{"ecu-b"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, lostArbitration(tt.contenders, tt.transmitter))
+		})
+	}
+}
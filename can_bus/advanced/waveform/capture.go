@@ -0,0 +1,211 @@
+package waveform
+
+import (
+	"fmt"
+	"io"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/bus"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/codec"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/common"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/controller"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/physical"
+	"github.com/hovsep/fmesh/component"
+	"github.com/hovsep/fmesh/signal"
+)
+
+// Capture is a virtual logic analyzer: it samples the bus wires and states of controllers every cycle
+// and writes the waveforms as Value Change Dump (opens in GTKWave)
+type Capture struct {
+	captureComponent *component.Component
+	out              io.Writer
+	canH             *vcdVariable
+	canL             *vcdVariable
+	bit              *vcdVariable
+	cyclesPerBit     int
+	controllers      map[string]*vcdVariable // By controller component name
+	scopes           []*vcdScope
+}
+
+const (
+	// VCDFileEnv is the environment variable with the path of VCD file to write the waveforms to
+	VCDFileEnv = "CAN_VCD_FILE"
+
+	stateKeyTime          = "time"
+	stateKeyCycleDuration = "cycle_duration"
+	stateKeyIdleCycles    = "idle_cycles"
+	stateKeyHeaderWritten = "header_written"
+
+	// Stop sampling when nothing happens for as long as the watchdog waits before letting the bus stop
+	stopAfterIdleCycles = 11 + 1
+)
+
+// NewCapture creates the capture writing VCD to the given writer (connect it to the bus before running the mesh)
+func NewCapture(name string, out io.Writer) *Capture {
+	c := &Capture{
+		out:         out,
+		controllers: make(map[string]*vcdVariable),
+	}
+
+	c.captureComponent = component.New(name).
+		WithDescription("Samples bus voltages, bits and controller states, writes them as VCD").
+		AddInputs(common.PortCANH, common.PortCANL, common.PortControllerState, common.PortSelfActivation).
+		AddOutputs(common.PortSelfActivation).
+		WithInitialState(func(state component.State) {
+			state.Set(stateKeyTime, time.Duration(0))
+			state.Set(stateKeyCycleDuration, time.Duration(0)) // Known when connected to the bus
+			state.Set(stateKeyIdleCycles, 0)
+			state.Set(stateKeyHeaderWritten, false)
+		}).
+		WithActivationFunc(c.sample)
+
+	c.captureComponent.OutputByName(common.PortSelfActivation).PipeTo(c.captureComponent.InputByName(common.PortSelfActivation))
+
+	// Power on: sampling starts with the first cycle
+	c.captureComponent.InputByName(common.PortSelfActivation).PutSignals(signal.New(true))
+
+	return c
+}
+
+// ConnectToBus attaches the probes to the bus wires and to controllers of the given nodes
+// (listen-only controllers do not report their state, so they stay unknown)
+func (c *Capture) ConnectToBus(b *bus.Bus, nodes can.Nodes) error {
+	// The capture samples every cycle, so a cycle takes a fraction of the bit time
+	c.cyclesPerBit = b.CyclesPerBit()
+	c.captureComponent.State().Set(stateKeyCycleDuration, codec.ProtocolNominalBitTime/time.Duration(c.cyclesPerBit))
+
+	c.canH = &vcdVariable{kind: "real", width: 64, name: "CAN_H", code: vcdCode(0)}
+	c.canL = &vcdVariable{kind: "real", width: 64, name: "CAN_L", code: vcdCode(1)}
+	c.bit = &vcdVariable{kind: "wire", width: 1, name: "bit", code: vcdCode(2)}
+	c.scopes = []*vcdScope{
+		{
+			name:      b.Wires.Name(),
+			variables: []*vcdVariable{c.canH, c.canL, c.bit},
+		},
+	}
+
+	controllersScope := &vcdScope{name: "controllers"}
+	stateWidth := bits.Len(uint(controller.StateBusOff))
+	for _, node := range nodes {
+		variable := &vcdVariable{kind: "reg", width: stateWidth, name: node.Controller.Name(), code: vcdCode(3 + len(controllersScope.variables))}
+		c.controllers[node.Controller.Name()] = variable
+		controllersScope.variables = append(controllersScope.variables, variable)
+
+		// ctl -> capture
+		node.Controller.OutputByName(common.PortControllerState).PipeTo(c.captureComponent.InputByName(common.PortControllerState))
+		if node.Controller.HasChainableErr() {
+			return node.Controller.ChainableErr()
+		}
+	}
+	c.scopes = append(c.scopes, controllersScope)
+
+	// wires -> capture
+	b.Wires.OutputByName(common.PortCANH).PipeTo(c.captureComponent.InputByName(common.PortCANH))
+	b.Wires.OutputByName(common.PortCANL).PipeTo(c.captureComponent.InputByName(common.PortCANL))
+	if b.Wires.HasChainableErr() {
+		return b.Wires.ChainableErr()
+	}
+
+	if c.captureComponent.HasChainableErr() {
+		return c.captureComponent.ChainableErr()
+	}
+
+	return nil
+}
+
+// sample writes the values changed in the current cycle, the capture keeps sampling until the bus is quiet
+func (c *Capture) sample(this *component.Component) error {
+	if !this.State().Get(stateKeyHeaderWritten).(bool) {
+		err := writeVCDHeader(c.out, "1 ns", controllerStatesLegend(), c.scopes)
+		if err != nil {
+			return fmt.Errorf("failed to write VCD header: %w", err)
+		}
+		this.State().Set(stateKeyHeaderWritten, true)
+	}
+
+	now := this.State().Get(stateKeyTime).(time.Duration)
+	cycleDuration := this.State().Get(stateKeyCycleDuration).(time.Duration)
+	idleCycles := this.State().Get(stateKeyIdleCycles).(int)
+
+	var changes []string
+	change := func(variable *vcdVariable, value string) {
+		if variable.value != value {
+			variable.value = value
+			changes = append(changes, variable.formatValue(value))
+		}
+	}
+
+	observed := false
+	if this.InputByName(common.PortCANH).HasSignals() && this.InputByName(common.PortCANL).HasSignals() {
+		vHigh := this.InputByName(common.PortCANH).Signals().FirstPayloadOrDefault(physical.NoVoltage).(physical.Voltage)
+		vLow := this.InputByName(common.PortCANL).Signals().FirstPayloadOrDefault(physical.NoVoltage).(physical.Voltage)
+
+		change(c.canH, strconv.FormatFloat(float64(vHigh), 'g', -1, 64))
+		change(c.canL, strconv.FormatFloat(float64(vLow), 'g', -1, 64))
+		change(c.bit, physical.VoltageToBit(vLow, vHigh).String())
+		observed = true
+
+		// Cycles take the time of the bit on the wires until the next one (bits of the data phase of FD frames are shorter)
+		bitTime, err := codec.ParseBitTime(this.InputByName(common.PortCANL).Signals().First().Labels().ValueOrDefault(common.LabelBitTime, ""))
+		if err != nil {
+			return err
+		}
+		cycleDuration = bitTime / time.Duration(c.cyclesPerBit)
+	}
+
+	this.InputByName(common.PortControllerState).Signals().ForEach(func(sig *signal.Signal) error {
+		ctlStateMap, ok := sig.PayloadOrNil().(controller.StateMap)
+		if !ok {
+			return nil
+		}
+
+		for name, ctlState := range ctlStateMap {
+			if variable, ok := c.controllers[name]; ok {
+				change(variable, strconv.FormatUint(uint64(ctlState), 2))
+			}
+		}
+		observed = true
+		return nil
+	})
+
+	if len(changes) > 0 {
+		_, err := fmt.Fprintf(c.out, "#%d\n%s\n", now.Nanoseconds(), strings.Join(changes, "\n"))
+		if err != nil {
+			return fmt.Errorf("failed to write VCD: %w", err)
+		}
+	}
+
+	if observed {
+		idleCycles = 0
+	} else {
+		idleCycles++
+	}
+	this.State().Set(stateKeyTime, now+cycleDuration)
+	this.State().Set(stateKeyCycleDuration, cycleDuration)
+	this.State().Set(stateKeyIdleCycles, idleCycles)
+
+	if idleCycles < stopAfterIdleCycles {
+		this.OutputByName(common.PortSelfActivation).PutSignals(signal.New(true))
+	}
+	return nil
+}
+
+// controllerStatesLegend explains the values of controller states
+func controllerStatesLegend() string {
+	var legend []string
+	for ctlState := controller.StateIdle; ctlState <= controller.StateBusOff; ctlState++ {
+		legend = append(legend, fmt.Sprintf("%d=%s", ctlState, ctlState))
+	}
+	return "controller states: " + strings.Join(legend, ", ")
+}
+
+// GetAllComponents returns all fmesh components of the capture
+func (c *Capture) GetAllComponents() []*component.Component {
+	return []*component.Component{
+		c.captureComponent,
+	}
+}
@@ -0,0 +1,79 @@
+package waveform
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/hovsep/fmesh"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/bus"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/can/codec"
+	"github.com/hovsep/fmesh-examples/can_bus/advanced/candump"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// captureReplayed sends the frame over the bus and returns the captured VCD
+func captureReplayed(t *testing.T, b *bus.Bus, frame *codec.Frame) string {
+	out := &bytes.Buffer{}
+	nodes := can.Nodes{
+		candump.NewReplayNode([]*candump.Entry{{Interface: "can0", Frame: frame}}),
+		candump.NewRecorderNode(candump.DefaultInterface, io.Discard), // Acknowledges the frame
+	}
+	nodes.ConnectToBus(b)
+
+	capture := NewCapture("vcd-capture", out)
+	require.NoError(t, capture.ConnectToBus(b, nodes))
+
+	_, err := fmesh.New("waveform_test").
+		AddComponents(b.GetAllComponents()...).
+		AddComponents(nodes.GetAllComponents()...).
+		AddComponents(capture.GetAllComponents()...).
+		Run()
+	require.NoError(t, err)
+	return out.String()
+}
+
+// bitEdges returns the timestamps (ns) of the changes of the bit on the wires since the start of frame
+// (recessive bits of the idle bus are not aligned with the bits of frames)
+func bitEdges(t *testing.T, vcd string) []int64 {
+	bitChange := regexp.MustCompile("^[01x]" + regexp.QuoteMeta(vcdCode(2)) + "$")
+
+	var now int64
+	var edges []int64
+	scanner := bufio.NewScanner(strings.NewReader(vcd))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "#"):
+			var err error
+			now, err = strconv.ParseInt(line[1:], 10, 64)
+			require.NoError(t, err)
+		case bitChange.MatchString(line) && (len(edges) > 0 || line[0] == '0'):
+			edges = append(edges, now)
+		}
+	}
+	return edges
+}
+
+func TestCapture(t *testing.T) {
+	frame := &codec.Frame{Id: 0x7E0, DLC: 8, Data: [codec.ProtocolMaxFDDataBytes]byte{0x02, 0x01, 0x0C}}
+	bitTime := codec.ProtocolNominalBitTime.Nanoseconds()
+
+	plain := bitEdges(t, captureReplayed(t, bus.New("test-bus"), frame))
+	require.Greater(t, len(plain), 2)
+
+	// The disturbance is one more hop, so the bit takes 5 cycles
+	disturbed := bitEdges(t, captureReplayed(t, bus.NewWithDisturbance("test-bus", &bus.DisturbanceConfig{}), frame))
+	require.Len(t, disturbed, len(plain))
+
+	for i := range plain {
+		assert.Zero(t, (plain[i]-plain[0])%bitTime, "edge %d is not on the bit boundary: %d ns", i, plain[i])
+		assert.Equal(t, plain[i]-plain[0], disturbed[i]-disturbed[0], "edge %d", i)
+	}
+}
@@ -0,0 +1,68 @@
+package waveform
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// vcdVariable is a signal of Value Change Dump (IEEE 1364), its value is written only when it changes
+type vcdVariable struct {
+	kind  string // real, wire or reg
+	width int
+	name  string
+	code  string // Short identifier used in value changes
+	value string // Last written value
+}
+
+// vcdScope groups variables (shown as a module in GTKWave)
+type vcdScope struct {
+	name      string
+	variables []*vcdVariable
+}
+
+// vcdCode returns the identifier of n-th variable (printable ASCII characters from '!' to '~')
+func vcdCode(n int) string {
+	const first, count = '!', '~' - '!' + 1
+
+	var sb strings.Builder
+	for {
+		sb.WriteByte(byte(first + n%count))
+		n /= count
+		if n == 0 {
+			return sb.String()
+		}
+		n--
+	}
+}
+
+// writeVCDHeader writes the definitions of all variables (values are unknown until the first change)
+func writeVCDHeader(w io.Writer, timescale, comment string, scopes []*vcdScope) error {
+	var sb strings.Builder
+	sb.WriteString("$version F-Mesh CAN bus simulation $end\n")
+	fmt.Fprintf(&sb, "$comment %s $end\n", comment)
+	fmt.Fprintf(&sb, "$timescale %s $end\n", timescale)
+	for _, scope := range scopes {
+		fmt.Fprintf(&sb, "$scope module %s $end\n", scope.name)
+		for _, variable := range scope.variables {
+			fmt.Fprintf(&sb, "$var %s %d %s %s $end\n", variable.kind, variable.width, variable.code, variable.name)
+		}
+		sb.WriteString("$upscope $end\n")
+	}
+	sb.WriteString("$enddefinitions $end\n")
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// formatValue returns the value change of the variable (real and vector values are separated from the identifier)
+func (variable *vcdVariable) formatValue(value string) string {
+	switch {
+	case variable.kind == "real":
+		return "r" + value + " " + variable.code
+	case variable.width > 1:
+		return "b" + value + " " + variable.code
+	default:
+		return value + variable.code
+	}
+}
@@ -0,0 +1,92 @@
+package waveform
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVCDCode(t *testing.T) {
+	tests := []struct {
+		n    int
+		want string
+	}{
+		{n: 0, want: "!"},
+		{n: 2, want: "#"},
+		{n: 93, want: "~"},
+		{n: 94, want: "!!"},
+		{n: 95, want: "\"!"},
+		{n: 94 + 94*94, want: "!!!"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, vcdCode(tt.n), "n = %d", tt.n)
+	}
+}
+
+func TestWriteVCDHeader(t *testing.T) {
+	scopes := []*vcdScope{
+		{
+			name: "bus-wires",
+			variables: []*vcdVariable{
+				{kind: "real", width: 64, name: "CAN_H", code: vcdCode(0)},
+				{kind: "wire", width: 1, name: "bit", code: vcdCode(1)},
+			},
+		},
+		{
+			name: "controllers",
+			variables: []*vcdVariable{
+				{kind: "reg", width: 3, name: "ecu-ctl", code: vcdCode(2)},
+			},
+		},
+	}
+
+	out := &bytes.Buffer{}
+	require.NoError(t, writeVCDHeader(out, "1 ns", "test header", scopes))
+	assert.Equal(t, `$version F-Mesh CAN bus simulation $end
+$comment test header $end
+$timescale 1 ns $end
+$scope module bus-wires $end
+$var real 64 ! CAN_H $end
+$var wire 1 " bit $end
+$upscope $end
+$scope module controllers $end
+$var reg 3 # ecu-ctl $end
+$upscope $end
+$enddefinitions $end
+`, out.String())
+}
+
+func TestFormatValue(t *testing.T) {
+	tests := []struct {
+		name     string
+		variable *vcdVariable
+		value    string
+		want     string
+	}{
+		{
+			name:     "real",
+			variable: &vcdVariable{kind: "real", width: 64, code: "!"},
+			value:    "3.5",
+			want:     "r3.5 !",
+		},
+		{
+			name:     "vector",
+			variable: &vcdVariable{kind: "reg", width: 3, code: "$"},
+			value:    "101",
+			want:     "b101 $",
+		},
+		{
+			name:     "scalar",
+			variable: &vcdVariable{kind: "wire", width: 1, code: "#"},
+			value:    "0",
+			want:     "0#",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.variable.formatValue(tt.value))
+		})
+	}
+}
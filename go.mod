@@ -5,6 +5,14 @@ go 1.26
 require (
 	github.com/hovsep/fmesh v1.8.3-Tarsus
 	github.com/hovsep/fmesh-graphviz v1.3.2
+	github.com/stretchr/testify v1.11.1
+	golang.org/x/sys v0.38.0
+	golang.org/x/term v0.37.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
-require github.com/emicklei/dot v1.9.2 // indirect
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/emicklei/dot v1.9.2 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+)
@@ -6,11 +6,6 @@ const (
 	Bias            Label = "bias"
 	Axis            Label = "axis"
 	Region          Label = "region"
-	TickCount       Label = "tick_count"
-	SimTime         Label = "sim_time"
-	SimWallTime     Label = "sim_wall_time"
-	DeltaT          Label = "dt"
-	TickMeta        Label = "tick_meta"
 	Sympathetic     Label = "sympathetic"
 	Parasympathetic Label = "parasympathetic"
 	Noise           Label = "noise"
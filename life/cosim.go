@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hovsep/fmesh"
+	"github.com/hovsep/fmesh-examples/life/organism/human"
+	"github.com/hovsep/fmesh-examples/simulation/step_sim"
+)
+
+const (
+	// coSimEnv selects the part of the simulation to run in this process (habitat or human),
+	// both parts must be started in separate processes, the habitat leads the ticks
+	coSimEnv = "LIFE_COSIM"
+
+	// coSimAddressEnv is the path of the socket connecting the parts (the same in both processes)
+	coSimAddressEnv = "LIFE_COSIM_SOCKET"
+
+	coSimNetwork = "unix"
+)
+
+// getCoSimAddress returns the socket path from the environment or the default one in the temporary directory
+func getCoSimAddress() string {
+	if address := os.Getenv(coSimAddressEnv); address != "" {
+		return address
+	}
+	return filepath.Join(os.TempDir(), "life_cosim.sock")
+}
+
+// runCoSimPart runs the habitat and the human in separate processes connected by the habitat's outputs
+func runCoSimPart(part string) error {
+	switch part {
+	case "habitat":
+		step_sim.NewApp(getHabitat().FM, initHabitatCoSim).Run()
+	case "human":
+		step_sim.NewApp(getHumanCoSimMesh(), initHumanCoSim).Run()
+	default:
+		return fmt.Errorf("unknown part: %s (expected habitat or human)", part)
+	}
+	return nil
+}
+
+// getHumanCoSimMesh returns the mesh with the human only, habitat signals come from the other process
+func getHumanCoSimMesh() *fmesh.FMesh {
+	return fmesh.NewWithConfig("human_cosim_mesh", &fmesh.Config{
+		CyclesLimit: fmesh.UnlimitedCycles,
+		TimeLimit:   60 * time.Second,
+	}).AddComponents(human.New("Leon"))
+}
+
+// initHabitatCoSim configures the habitat process (co-simulation master)
+func initHabitatCoSim(sim *step_sim.Simulation) {
+	sim.AutoPause = false
+	initClock(sim)
+	sim.Clock.Pacing = 1
+
+	err := setMeshCommands(sim)
+	if err != nil {
+		panic("Failed to set mesh commands: " + err.Error())
+	}
+
+	sim.CoSim = step_sim.NewCoSim(step_sim.CoSimMaster, coSimNetwork, getCoSimAddress()).
+		Export("time_tick", "time::tick").
+		Export("gas_temperature", "gas::temperature").
+		Export("gas_humidity", "gas::humidity").
+		Export("gas_composition", "gas::composition", "name", "alias")
+}
+
+// initHumanCoSim configures the human process (co-simulation slave)
+func initHumanCoSim(sim *step_sim.Simulation) {
+	sim.AutoPause = false
+	initClock(sim)
+
+	humanComponent := sim.FM.ComponentByName("human-Leon")
+	sim.MeshCommands["human:show"] = step_sim.NewMeshCommandDescriptor("Print human vitals", func(_ *fmesh.FMesh) {
+		for _, vital := range []string{"is_alive", "brain_activity", "heart_rate", "respiratory_rate"} {
+			fmt.Fprintln(sim.Out(), vital+":", humanComponent.OutputByName(vital).Signals().FirstPayloadOrNil())
+		}
+	}).AsReadOnly()
+
+	sim.CoSim = step_sim.NewCoSim(step_sim.CoSimSlave, coSimNetwork, getCoSimAddress()).
+		Import("time_tick", "human-Leon::habitat_time_tick").
+		Import("gas_temperature", "human-Leon::habitat_gas_temperature").
+		Import("gas_humidity", "human-Leon::habitat_gas_humidity").
+		Import("gas_composition", "human-Leon::habitat_gas_composition")
+}
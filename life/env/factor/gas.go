@@ -12,7 +12,7 @@ import (
 func GetGasComponent() *component.Component {
 	return component.New("gas").
 		WithDescription("Gas factor").
-		AddInputs("time", "ctl").
+		AddInputs("habitat_time_tick", "ctl").
 		// For the sake of simplicity, we skip parameters like barometric pressure or wind
 		AddOutputs("temperature", "composition", "humidity").
 		WithInitialState(func(state component.State) {
@@ -8,7 +8,7 @@ import (
 func GetSunComponent() *component.Component {
 	return component.New("sun").
 		WithDescription("Sun radiation exposure factor").
-		AddInputs("time", "ctl").
+		AddInputs("habitat_time_tick", "ctl").
 		AddOutputs("uvi", "lux"). // UV index from 0 to 11, illuminance in lux
 		WithActivationFunc(func(this *component.Component) error {
 
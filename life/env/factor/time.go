@@ -3,50 +3,34 @@ package factor
 import (
 	"time"
 
-	"github.com/hovsep/fmesh-examples/life/helper"
+	"github.com/hovsep/fmesh-examples/simulation/step_sim"
 	"github.com/hovsep/fmesh/component"
+	"github.com/hovsep/fmesh/port"
 )
 
-const durationPerTick = 10 * time.Millisecond
-
-// GetTimeComponent returns the time component of the habitat
+// GetTimeComponent returns the time component of the habitat,
+// it receives ticks from the simulation clock and shares them with the inhabitants
 func GetTimeComponent() *component.Component {
 	c := component.New("time").
 		WithDescription("Time management for the simulation").
 		WithInitialState(func(state component.State) {
 			state.Set("tick_count", uint64(0))      // Discrete step counter
 			state.Set("sim_time", time.Duration(0)) // Elapsed simulated duration
-			state.Set("sim_start_time", time.Now()) // Fixed wall-clock anchor
-			state.Set("sim_wall_time", time.Now())  // Simulation wall-clock time
+			state.Set("sim_wall_time", time.Time{}) // Simulation wall-clock time
 		}).
-		AddInputs("ctl").
+		AddInputs(step_sim.TimePort).
 		AddOutputs("tick").
 		WithActivationFunc(func(this *component.Component) error {
-			// No need to check for inputs, just tick on every activation
-
-			this.State().Update("tick_count", func(v any) any {
-				return v.(uint64) + 1
-			})
-
-			this.State().Update("sim_time", func(v any) any {
-				return v.(time.Duration) + durationPerTick
-			})
-
-			simStartTime := this.State().Get("sim_start_time").(time.Time)
-			simTime := this.State().Get("sim_time").(time.Duration)
-			this.State().Update("sim_wall_time", func(v any) any {
-				return simStartTime.Add(simTime)
-			})
+			tick, err := step_sim.TickFromSignal(this.InputByName(step_sim.TimePort).Signals().First())
+			if err != nil {
+				return err
+			}
 
-			nextTick := helper.PackTick(
-				this.State().Get("tick_count").(uint64),
-				this.State().Get("sim_time").(time.Duration),
-				this.State().Get("sim_wall_time").(time.Time),
-				durationPerTick,
-			)
-			this.OutputByName("tick").PutSignals(nextTick)
+			this.State().Set("tick_count", tick.Count)
+			this.State().Set("sim_time", tick.SimTime)
+			this.State().Set("sim_wall_time", tick.SimWallTime)
 
-			return this.ChainableErr()
+			return port.ForwardSignals(this.InputByName(step_sim.TimePort), this.OutputByName("tick"))
 		})
 
 	return c
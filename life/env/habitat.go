@@ -86,10 +86,12 @@ func (h *Habitat) getTimeFactor() *component.Component {
 }
 
 // connectToTimeFactor connects the given component to the time factor
+// (only the time factor gets ticks from the simulation clock, other factors see them one cycle later
+// on the habitat_time_tick input, like organisms do)
 func (h *Habitat) connectToTimeFactor(c *component.Component) {
 	habitatTimeFactor := h.getTimeFactor()
 	c.Inputs().ForEach(func(p *port.Port) error {
-		if p.Name() == "time" {
+		if p.Name() == "habitat_time_tick" {
 			habitatTimeFactor.OutputByName("tick").PipeTo(p)
 		}
 		return p.ChainableErr()
@@ -14,6 +14,8 @@ require (
 	github.com/emicklei/dot v1.9.2 // indirect
 	github.com/hovsep/fmesh-graphviz v1.3.2 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
+	golang.org/x/sys v0.38.0 // indirect
+	golang.org/x/term v0.37.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
 
@@ -24,14 +24,14 @@ func ClampAndLogAnomaly(value, minVal, maxVal float64, logger *log.Logger, key s
 	return valueClamped
 }
 
-// Jitter returns a value randomly jittered by ±percent%
+// Jitter returns a value randomly jittered by ±percent% using the given random source
 // percent can be decimal, e.g., 0.5 → ±0.5%, 5 → ±5%
-func Jitter(value, percent float64) float64 {
+func Jitter(rng *rand.Rand, value, percent float64) float64 {
 	// amplitude = percent of value
 	amp := value * percent / 100.0
 
 	// random delta in [-amp, +amp]
-	delta := (rand.Float64()*2 - 1) * amp
+	delta := (rng.Float64()*2 - 1) * amp
 
 	return value + delta
 }
@@ -23,7 +23,7 @@ import (
 //
 //	Time is discrete. Each simulation tick represents 10ms of simulated time.
 //	The habitat is forward-predictive:
-//	   - The time component generates a tick.
+//	   - The simulation clock generates a tick, the time component shares it with the inhabitants.
 //	   - All habitat factors activate on that tick and compute their next state
 //	     (e.g., temperature, humidity, gas composition).
 //	The human is reactive:
@@ -44,6 +44,16 @@ import (
 //	The simulation is single-directional (habitat → human), as the primary
 //	goal is studying human physiology rather than environmental dynamics.
 func main() {
+	// Run only a part of the simulation, the other part runs in another process
+	if coSimPart := os.Getenv(coSimEnv); coSimPart != "" {
+		err := runCoSimPart(coSimPart)
+		if err != nil {
+			fmt.Println("Co-simulation failed:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	simMesh := getSimulationMesh()
 
 	// Now run the simulation; the producer is non-blocking
@@ -53,17 +63,36 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Run the mesh headless for a range of parameters
+	if sweepPath := os.Getenv(sweepEnv); sweepPath != "" {
+		err = runTemperatureSweep(sweepPath)
+		if err != nil {
+			fmt.Println("Sweep failed:", err)
+			os.Exit(1)
+		}
+		fmt.Println("Sweep results written to", sweepPath)
+		return
+	}
+
 	// Run the mesh in a step simulation
 	step_sim.NewApp(simMesh, initSim).Run()
 }
 
+// tickDuration is the simulated time of one tick
+const tickDuration = 10 * time.Millisecond
+
 // initSim configures simulation and adds custom commands
 func initSim(sim *step_sim.Simulation) {
 	// Configure simulation
 	sim.AutoPause = false
+	initClock(sim)
+	sim.Clock.Pacing = 1 // Near real time
 
 	// Add custom commands
-	setMeshCommands(sim.FM, sim.MeshCommands)
+	err := setMeshCommands(sim)
+	if err != nil {
+		panic("Failed to set mesh commands: " + err.Error())
+	}
 
 	// Setup hooks to stream data to UI
 	sim.FM.SetupHooks(func(hooks *fmesh.Hooks) {
@@ -71,10 +100,12 @@ func initSim(sim *step_sim.Simulation) {
 			mesh.ComponentByName("aggregated_state_publisher").OutputByName("stream").Signals().ForEach(func(line *signal.Signal) error {
 				return sim.Sink.Publish(line.PayloadOrNil().(string))
 			})
-
-			// @TODO: take this delay from flag or cmd to not affect tests
-			time.Sleep(10 * time.Millisecond) // Near real time
 			return nil
 		})
 	})
 }
+
+// initClock configures the simulation clock
+func initClock(sim *step_sim.Simulation) {
+	sim.Clock.TickDuration = tickDuration
+}
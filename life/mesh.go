@@ -1,7 +1,9 @@
 package main
 
 import (
+	_ "embed"
 	"fmt"
+	"time"
 
 	"github.com/hovsep/fmesh"
 	"github.com/hovsep/fmesh-examples/life/env"
@@ -9,27 +11,24 @@ import (
 	"github.com/hovsep/fmesh-examples/life/organism/human"
 	"github.com/hovsep/fmesh-examples/simulation/step_sim"
 	"github.com/hovsep/fmesh/component"
-	"github.com/hovsep/fmesh/signal"
 )
 
+//go:embed commands.yaml
+var commandsConfig []byte
+
 // getSimulationMesh returns the main mesh of the simulation
 func getSimulationMesh() *fmesh.FMesh {
+	return getSeededSimulationMesh(time.Now().UnixNano())
+}
+
+// getSeededSimulationMesh returns the main mesh of the simulation, where all randomness is derived from the seed
+func getSeededSimulationMesh(seed int64) *fmesh.FMesh {
 	// Set up the world
 	habitat := getHabitat().
-		AddOrganisms(human.New("Leon")).
+		AddOrganisms(human.NewSeeded("Leon", seed)).
 		AddAggregatedState().
 		AddAggregatedStatePublisher()
 
-	// Set up the mesh
-	habitat.FM.SetupHooks(func(hooks *fmesh.Hooks) {
-		// Generate a tick signal before each run (time step simulation)
-		hooks.BeforeRun(func(mesh *fmesh.FMesh) error {
-			mesh.ComponentByName("time").InputByName("ctl").PutSignals(signal.New("tick"))
-			return nil
-		})
-
-	})
-
 	return habitat.FM
 }
 
@@ -43,50 +42,18 @@ func getHabitat() *env.Habitat {
 }
 
 // setMeshCommands sets the commands that can be executed on the mesh
-func setMeshCommands(mesh *fmesh.FMesh, commands step_sim.MeshCommandMap) {
-	timeComponent := mesh.ComponentByName("time")
-
-	//@TODO: ability to pass params to commands
-	//@TODO: a cmd that allows to schedule another cmd at\after exact wall\sim time
-
-	// Print current time
-	commands["time:now"] = step_sim.NewMeshCommandDescriptor("Print current time", func(_ *fmesh.FMesh) {
-		tickCount := timeComponent.State().Get("tick_count")
-		simTime := timeComponent.State().Get("sim_time")
-		simWallTime := timeComponent.State().Get("sim_wall_time")
-		fmt.Println("Current tick count:", tickCount)
-		fmt.Println("Simulation duration:", simTime)
-		fmt.Println("Simulation wall-clock time:", simWallTime)
-	})
-
+func setMeshCommands(sim *step_sim.Simulation) error {
 	// Print habitat state
-	commands["habitat:show"] = step_sim.NewMeshCommandDescriptor("Print habitat state", func(fm *fmesh.FMesh) {
+	sim.MeshCommands["habitat:show"] = step_sim.NewMeshCommandDescriptor("Print habitat state", func(fm *fmesh.FMesh) {
 		temperature := fm.ComponentByName("gas").State().Get("temperature")
-		fmt.Println("Current gas temperature: ", temperature)
-	})
-
-	// Increase temperature
-	commands["temp:inc"] = step_sim.NewMeshCommandDescriptor("Increase gas temperature by 1.0 degree", func(fm *fmesh.FMesh) {
-		fm.ComponentByName("gas").Inputs().ByName("ctl").PutSignals(signal.New(+1.0).AddLabel("cmd", "change_temperature"))
-	})
-
-	// Decrease temperature
-	commands["temp:dec"] = step_sim.NewMeshCommandDescriptor("Decrease gas temperature by 1.0 degree", func(fm *fmesh.FMesh) {
-		fm.ComponentByName("gas").Inputs().ByName("ctl").PutSignals(signal.New(-1.0).AddLabel("cmd", "change_temperature"))
-	})
-
-	// Set the temperature to zero
-	commands["temp:zero"] = step_sim.NewMeshCommandDescriptor("Set gas temperature to zeo degrees", func(fm *fmesh.FMesh) {
-		mesh.ComponentByName("gas").Inputs().ByName("ctl").PutSignals(signal.New(0.0).AddLabel("cmd", "set_temperature"))
-	})
+		fmt.Fprintln(sim.Out(), "Current gas temperature: ", temperature)
+	}).AsReadOnly()
 
-	// Make the gas hot
-	commands["temp:hot"] = step_sim.NewMeshCommandDescriptor("Set gas temperature to +38.0", func(fm *fmesh.FMesh) {
-		mesh.ComponentByName("gas").Inputs().ByName("ctl").PutSignals(signal.New(+38.0).AddLabel("cmd", "set_temperature"))
-	})
+	// Commands that only put a signal into the mesh are declared in commands.yaml
+	definitions, err := step_sim.ParseCommandDefinitions(commandsConfig)
+	if err != nil {
+		return err
+	}
 
-	// Make the gas cold
-	commands["temp:cold"] = step_sim.NewMeshCommandDescriptor("Set gas temperature to -35.0", func(fm *fmesh.FMesh) {
-		mesh.ComponentByName("gas").Inputs().ByName("ctl").PutSignals(signal.New(-35.0).AddLabel("cmd", "set_temperature"))
-	})
+	return sim.MeshCommands.AddFromDefinitions(sim.FM, definitions...)
 }
@@ -2,6 +2,7 @@ package human
 
 import (
 	"fmt"
+	"math/rand"
 	"os"
 	"time"
 
@@ -23,7 +24,7 @@ const (
 )
 
 // getMesh builds the mesh that simulates the human being
-func getMesh() *fmesh.FMesh {
+func getMesh(rng *rand.Rand) *fmesh.FMesh {
 	// Create the mesh
 	mesh := fmesh.NewWithConfig(meshName, &fmesh.Config{
 		Debug:       false,
@@ -31,7 +32,7 @@ func getMesh() *fmesh.FMesh {
 		TimeLimit:   5 * time.Second,
 	})
 
-	components := getComponents()
+	components := getComponents(rng)
 	// Add components to the mesh
 	components.ForEach(func(c *component.Component) error {
 		mesh.AddComponents(c)
@@ -149,8 +150,9 @@ func wireLungs(components *component.Collection) {
 	)
 }
 
-// getComponents returns the collection of human components (organs, systems, etc.)
-func getComponents() *component.Collection {
+// getComponents returns the collection of human components (organs, systems, etc.),
+// the components share the random source, so the whole human is reproducible from its seed
+func getComponents(rng *rand.Rand) *component.Collection {
 	// @TODO:
 
 	// other organs:
@@ -181,7 +183,7 @@ func getComponents() *component.Collection {
 			controller.GetExcretion(),
 
 			// Physiological systems
-			physiology.GetAutonomicCoordination(),
+			physiology.GetAutonomicCoordination(rng),
 			physiology.GetPhysiologicalLoad(),
 			physiology.GetEndocrineAxis(),
 			physiology.GetObservableState(),
@@ -191,11 +193,11 @@ func getComponents() *component.Collection {
 			regulation.GetHomeostasis(),
 
 			// Organs
-			organ.GetBrain(),
+			organ.GetBrain(rng),
 			organ.GetHeart(),
 			organ.GetDiaphragm(),
-			organ.GetLung(common.Left),
-			organ.GetLung(common.Right),
+			organ.GetLung(common.Left, rng),
+			organ.GetLung(common.Right, rng),
 
 			// Distributed anatomy
 			da.GetSkin(),
@@ -208,7 +210,13 @@ func getComponents() *component.Collection {
 
 // New returns a new human as a component (for simplicity we skip a clothing insulation factor, so the human being is naked)
 func New(name string) *component.Component {
-	mesh := getMesh()
+	return NewSeeded(name, time.Now().UnixNano())
+}
+
+// NewSeeded returns a new human whose random variability (organ asymmetry, neural drive fluctuations) is derived from the seed,
+// so the same seed gives the same human
+func NewSeeded(name string, seed int64) *component.Component {
+	mesh := getMesh(rand.New(rand.NewSource(seed)))
 
 	return component.New("human-"+name).
 		WithDescription("A human being").
@@ -1,6 +1,8 @@
 package organ
 
 import (
+	"math/rand"
+
 	"github.com/hovsep/fmesh-examples/life/common"
 	"github.com/hovsep/fmesh-examples/life/helper"
 	. "github.com/hovsep/fmesh-examples/life/unit"
@@ -21,8 +23,8 @@ const (
 	defaultNeuralDrive = 0.3 * DNCS
 )
 
-// GetBrain returns brain organ component
-func GetBrain() *component.Component {
+// GetBrain returns brain organ component (neural drive fluctuations are drawn from the given random source)
+func GetBrain(rng *rand.Rand) *component.Component {
 	return component.New("organ:brain").
 		WithDescription("The Brain").
 		WithInitialState(func(state component.State) {
@@ -54,7 +56,7 @@ func GetBrain() *component.Component {
 			this.State().Update(NeuralDrive, func(currentND any) any {
 
 				// Flat ND (we will add more logic later)
-				nextND = helper.Clamp(helper.Jitter(currentND.(float64), NeuralDriveJitter), MinNeuralDrive, MaxNeuralDrive)
+				nextND = helper.Clamp(helper.Jitter(rng, currentND.(float64), NeuralDriveJitter), MinNeuralDrive, MaxNeuralDrive)
 				return nextND
 			})
 
@@ -2,6 +2,7 @@ package organ
 
 import (
 	"math"
+	"math/rand"
 
 	"github.com/hovsep/fmesh-examples/life/common"
 	"github.com/hovsep/fmesh-examples/life/helper"
@@ -39,7 +40,8 @@ var (
 	FRC = restingLungVolume + defaultLungCompliance*math.Abs(BasePleuralPressure)*Milliliter
 )
 
-func GetLung(side common.Side) *component.Component {
+// GetLung returns the lung organ component, lungs are slightly different (the asymmetry is drawn from the given random source)
+func GetLung(side common.Side, rng *rand.Rand) *component.Component {
 	return component.New("organ:lung_"+string(side)).
 		WithDescription(string(side)+" lung").
 		AddInputs(
@@ -54,10 +56,10 @@ func GetLung(side common.Side) *component.Component {
 			"gas_composition",   // passthrough (not modeled yet)
 		).
 		WithInitialState(func(state component.State) {
-			state.Set(stateVolume, helper.Jitter(FRC, lungVolumeAsymmetry)) // start at equilibrium
-			state.Set(stateCompliance, helper.Jitter(defaultLungCompliance, lungComplianceAsymmetry))
-			state.Set(stateResistance, helper.Jitter(defaultAirwayResistance, lungResistanceAsymmetry))
-			state.Set(statePleuralAsymmetry, helper.Jitter(pleuralPressureAsymmetryBase, pleuralPressureAsymmetry))
+			state.Set(stateVolume, helper.Jitter(rng, FRC, lungVolumeAsymmetry)) // start at equilibrium
+			state.Set(stateCompliance, helper.Jitter(rng, defaultLungCompliance, lungComplianceAsymmetry))
+			state.Set(stateResistance, helper.Jitter(rng, defaultAirwayResistance, lungResistanceAsymmetry))
+			state.Set(statePleuralAsymmetry, helper.Jitter(rng, pleuralPressureAsymmetryBase, pleuralPressureAsymmetry))
 		}).
 		WithActivationFunc(handleMechanics)
 }
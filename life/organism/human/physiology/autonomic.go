@@ -1,6 +1,8 @@
 package physiology
 
 import (
+	"math/rand"
+
 	"github.com/hovsep/fmesh-examples/life/helper"
 	"github.com/hovsep/fmesh-examples/life/organism/human/organ"
 	. "github.com/hovsep/fmesh-examples/life/unit"
@@ -15,7 +17,7 @@ const (
 )
 
 // GetAutonomicCoordination ...
-func GetAutonomicCoordination() *component.Component {
+func GetAutonomicCoordination(rng *rand.Rand) *component.Component {
 	return component.New("physiology:autonomic_coordination").
 		WithDescription("Autonomic coordination system").
 		AddInputs("time", "neural_drive").
@@ -33,13 +35,13 @@ func GetAutonomicCoordination() *component.Component {
 				return nil
 			}
 
-			this.OutputByName("autonomic_tone").PutSignals(getAutonomicToneSignal(neuralDrive))
+			this.OutputByName("autonomic_tone").PutSignals(getAutonomicToneSignal(rng, neuralDrive))
 			return nil
 		})
 
 }
 
-func getAutonomicToneSignal(neuralDrive float64) *signal.Signal {
+func getAutonomicToneSignal(rng *rand.Rand, neuralDrive float64) *signal.Signal {
 	// Sympathetic level rises with ND
 	sym, paraSym := neuralDrive, helper.Clamp(1.0-neuralDrive, 0.0, 1.0)
 
@@ -48,10 +50,10 @@ func getAutonomicToneSignal(neuralDrive float64) *signal.Signal {
 
 	// Regional biases as a fraction of ND, with some small variability
 	regionalDriveBaser := neuralDrive * 0.5
-	cardiacBias := helper.Jitter(regionalDriveBaser, defaultRegionalBiasJitter) // ±5% jitter
-	vascularBias := helper.Jitter(regionalDriveBaser, defaultRegionalBiasJitter)
-	respiratoryBias := helper.Jitter(regionalDriveBaser, defaultRegionalBiasJitter)
-	giBias := helper.Jitter(regionalDriveBaser, defaultRegionalBiasJitter)
+	cardiacBias := helper.Jitter(rng, regionalDriveBaser, defaultRegionalBiasJitter) // ±5% jitter
+	vascularBias := helper.Jitter(rng, regionalDriveBaser, defaultRegionalBiasJitter)
+	respiratoryBias := helper.Jitter(rng, regionalDriveBaser, defaultRegionalBiasJitter)
+	giBias := helper.Jitter(rng, regionalDriveBaser, defaultRegionalBiasJitter)
 
 	return helper.PackAutonomicTone(sym, paraSym, defaultAutonomicCoordinationNoise, gain, cardiacBias, vascularBias, respiratoryBias, giBias)
 }
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/hovsep/fmesh"
+	"github.com/hovsep/fmesh-examples/simulation/step_sim"
+	"github.com/hovsep/fmesh/signal"
+)
+
+const (
+	// sweepEnv is the path of the file the ambient temperature sweep is written to (.json or .csv),
+	// when set, the sweep runs instead of the interactive simulation
+	sweepEnv = "LIFE_SWEEP"
+
+	sweepTicks = 1000 // 10 seconds of simulated time
+	sweepRuns  = 3    // Runs per temperature
+)
+
+// runTemperatureSweep runs the simulation headless for a range of ambient temperatures and writes human vitals
+func runTemperatureSweep(outputPath string) error {
+	batch := step_sim.NewBatch(getSweepMesh, sweepTicks).
+		WithSimInit(initClock).
+		WithParams(step_sim.ParamGrid(map[string][]any{
+			"ambient_temperature": {-35.0, -10.0, 0.0, 26.0, 38.0, 50.0},
+		})...).
+		// Each seed gives a slightly different human (organ asymmetry, neural drive fluctuations)
+		WithSeeds(step_sim.SeedRange(1, sweepRuns)...).
+		WithCollector("is_alive", aggregatedValue("human-Leon::is_alive")).
+		WithCollector("brain_activity", aggregatedValue("human-Leon::brain_activity")).
+		WithCollector("heart_rate", aggregatedValue("human-Leon::heart_rate")).
+		WithCollector("respiratory_rate", aggregatedValue("human-Leon::respiratory_rate"))
+
+	results, err := batch.Run(context.Background())
+	if err != nil {
+		return err
+	}
+
+	out, err := os.Create(outputPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if filepath.Ext(outputPath) == ".json" {
+		return results.WriteJSON(out)
+	}
+	return results.WriteCSV(out)
+}
+
+// getSweepMesh builds the simulation mesh of the seeded human with the given ambient temperature
+func getSweepMesh(params step_sim.BatchParams, seed int64) (*fmesh.FMesh, error) {
+	mesh := getSeededSimulationMesh(seed)
+
+	err := mesh.ComponentByName("gas").InputByName("ctl").PutSignals(
+		signal.New(params["ambient_temperature"]).AddLabel("cmd", "set_temperature"),
+	).ChainableErr()
+	if err != nil {
+		return nil, err
+	}
+
+	return mesh, nil
+}
+
+// aggregatedValue collects the last value of the given aggregated state path
+func aggregatedValue(path string) step_sim.BatchCollector {
+	return func(fm *fmesh.FMesh) (any, error) {
+		value, err := fm.ComponentByName("aggregated_state").OutputByName(path).Signals().FirstPayload()
+		if err != nil {
+			return nil, fmt.Errorf("no value in %s: %w", path, err)
+		}
+		return value, nil
+	}
+}
@@ -47,6 +47,28 @@ func Test_Time(t *testing.T) {
 
 			},
 		},
+		{
+			name: "habitat factors get one tick per step",
+			assertions: func(t *testing.T, sim *step_sim.Simulation) {
+				const ticks = 5
+				activations := make(map[string]int)
+
+				for _, name := range []string{"time", "gas", "sun"} {
+					factor := sim.FM.ComponentByName(name)
+					require.NotNil(t, factor)
+
+					factor.SetupHooks(func(hooks *component.Hooks) {
+						hooks.AfterActivation(func(activationContext *component.ActivationContext) error {
+							activations[name]++
+							return nil
+						})
+					})
+				}
+
+				require.NoError(t, sim.RunTicks(ticks))
+				assert.Equal(t, map[string]int{"time": ticks, "gas": ticks, "sun": ticks}, activations)
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
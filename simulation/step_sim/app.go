@@ -3,12 +3,16 @@ package step_sim
 import (
 	"context"
 	"fmt"
+	"os"
 	"time"
 
 	"github.com/hovsep/fmesh"
 	step_sim_sink "github.com/hovsep/fmesh-examples/simulation/step_sim/sink"
 )
 
+// CommandsFileEnv is the environment variable pointing to a file with extra command definitions
+const CommandsFileEnv = "STEP_SIM_COMMANDS"
+
 type Application struct {
 	ctx     context.Context
 	cancel  context.CancelFunc
@@ -28,12 +32,35 @@ func NewApp(fm *fmesh.FMesh, simInitFunc SimInitFunc) *Application {
 		panic(err)
 	}
 
+	sim := NewSimulation(ctx, fm, cmdChan, sink).Init(simInitFunc)
+
 	app := &Application{
 		ctx:     ctx,
 		cancel:  cancel,
 		cmdChan: cmdChan,
-		REPL:    NewREPL(cmdChan),
-		Sim:     NewSimulation(ctx, fm, cmdChan, sink).Init(simInitFunc),
+		REPL:    NewREPL(cmdChan, sim),
+		Sim:     sim,
+	}
+
+	// Operators can connect to the control socket (owner only) or observe via the read-only socket
+	if os.Getenv(SessionsEnv) == "1" {
+		_, err = NewCommandServer(ctx, sim, "/tmp/"+fm.Name()+".ctl.sock", false)
+		if err != nil {
+			panic(err)
+		}
+
+		_, err = NewCommandServer(ctx, sim, "/tmp/"+fm.Name()+".ro.sock", true)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	// Operators can declare scenario-specific commands without recompiling
+	if commandsFile := os.Getenv(CommandsFileEnv); commandsFile != "" {
+		err = app.Sim.LoadCommands(commandsFile)
+		if err != nil {
+			panic(err)
+		}
 	}
 
 	return app
@@ -49,7 +76,12 @@ func (app *Application) Run() {
 		fmt.Println("Shutting down the application...")
 	}()
 
-	go app.Sim.Run()
+	go func() {
+		app.Sim.Run()
+
+		// Do not let the REPL wait for the simulation which is not running anymore (e.g., stopped with error)
+		app.cancel()
+	}()
 
 	app.REPL.Run()
 }
@@ -0,0 +1,267 @@
+package step_sim
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"runtime"
+	"slices"
+	"strconv"
+	"sync"
+
+	"github.com/hovsep/fmesh"
+	"github.com/hovsep/fmesh-examples/simulation/step_sim/sink"
+)
+
+// BatchParams is a combination of parameter values used in a single batch run
+type BatchParams map[string]any
+
+// BatchMeshFactory builds a new mesh for a single batch run,
+// any randomness in the mesh should be derived from the given seed to make runs reproducible
+type BatchMeshFactory func(params BatchParams, seed int64) (*fmesh.FMesh, error)
+
+// BatchCollector extracts a value from the mesh when the run is finished
+type BatchCollector func(fm *fmesh.FMesh) (any, error)
+
+// Batch runs a mesh headless for a fixed number of ticks once per parameter combination and seed
+// (parameter sweeps and Monte Carlo simulations), each run gets a freshly built mesh
+type Batch struct {
+	meshFactory    BatchMeshFactory
+	simInit        SimInitFunc
+	ticks          int
+	params         []BatchParams
+	seeds          []int64
+	workers        int
+	collectorNames []string // Keeps the order of columns
+	collectors     map[string]BatchCollector
+}
+
+// BatchResult is the outcome of a single batch run
+type BatchResult struct {
+	Params BatchParams    `json:"params"`
+	Seed   int64          `json:"seed"`
+	Values map[string]any `json:"values"`
+	Error  string         `json:"error,omitempty"`
+}
+
+// BatchResults is the summary table of all batch runs
+type BatchResults struct {
+	ParamNames []string
+	ValueNames []string
+	Runs       []BatchResult
+}
+
+// NewBatch creates a batch which runs each mesh for the given number of ticks
+func NewBatch(meshFactory BatchMeshFactory, ticks int) *Batch {
+	return &Batch{
+		meshFactory: meshFactory,
+		ticks:       ticks,
+		workers:     runtime.NumCPU(),
+		collectors:  make(map[string]BatchCollector),
+	}
+}
+
+// WithParams adds parameter combinations (see ParamGrid)
+func (b *Batch) WithParams(params ...BatchParams) *Batch {
+	b.params = append(b.params, params...)
+	return b
+}
+
+// WithSeeds adds seeds, each parameter combination is run once per seed (see SeedRange)
+func (b *Batch) WithSeeds(seeds ...int64) *Batch {
+	b.seeds = append(b.seeds, seeds...)
+	return b
+}
+
+// WithWorkers sets the number of meshes running in parallel
+func (b *Batch) WithWorkers(workers int) *Batch {
+	b.workers = workers
+	return b
+}
+
+// WithSimInit sets the function which initializes the simulation of each run (e.g., to set up hooks)
+func (b *Batch) WithSimInit(simInit SimInitFunc) *Batch {
+	b.simInit = simInit
+	return b
+}
+
+// WithCollector adds a named column to the summary table
+func (b *Batch) WithCollector(name string, collector BatchCollector) *Batch {
+	if _, exists := b.collectors[name]; !exists {
+		b.collectorNames = append(b.collectorNames, name)
+	}
+	b.collectors[name] = collector
+	return b
+}
+
+// Run executes all runs and returns the summary table,
+// runs are reported in the order of parameters and seeds regardless of parallelism,
+// a failed run does not stop the batch, its error is recorded in the result instead
+func (b *Batch) Run(ctx context.Context) (*BatchResults, error) {
+	if b.meshFactory == nil {
+		return nil, fmt.Errorf("mesh factory is required")
+	}
+
+	if b.ticks <= 0 {
+		return nil, fmt.Errorf("ticks must be positive, got %d", b.ticks)
+	}
+
+	if b.workers <= 0 {
+		return nil, fmt.Errorf("workers must be positive, got %d", b.workers)
+	}
+
+	params := b.params
+	if len(params) == 0 {
+		params = []BatchParams{{}}
+	}
+
+	seeds := b.seeds
+	if len(seeds) == 0 {
+		seeds = []int64{0}
+	}
+
+	results := &BatchResults{
+		ParamNames: getParamNames(params),
+		ValueNames: slices.Clone(b.collectorNames),
+		Runs:       make([]BatchResult, len(params)*len(seeds)),
+	}
+
+	jobs := make(chan int)
+	wg := sync.WaitGroup{}
+	for range b.workers {
+		wg.Go(func() {
+			for idx := range jobs {
+				results.Runs[idx] = b.runOne(ctx, params[idx/len(seeds)], seeds[idx%len(seeds)])
+			}
+		})
+	}
+
+	for idx := range results.Runs {
+		jobs <- idx
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results, ctx.Err()
+}
+
+// runOne builds the mesh, runs it and collects the values
+func (b *Batch) runOne(ctx context.Context, params BatchParams, seed int64) BatchResult {
+	result := BatchResult{
+		Params: params,
+		Seed:   seed,
+		Values: make(map[string]any, len(b.collectors)),
+	}
+
+	fm, err := b.meshFactory(params, seed)
+	if err != nil {
+		result.Error = fmt.Sprintf("failed to build mesh: %v", err)
+		return result
+	}
+
+	sim := NewSimulation(ctx, fm, nil, sink.NewNoopSink())
+	if b.simInit != nil {
+		sim.Init(b.simInit)
+	}
+
+	err = sim.RunTicks(b.ticks)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	for _, name := range b.collectorNames {
+		value, err := b.collectors[name](fm)
+		if err != nil {
+			result.Error = fmt.Sprintf("failed to collect %s: %v", name, err)
+			return result
+		}
+		result.Values[name] = value
+	}
+
+	return result
+}
+
+// ParamGrid returns all combinations of the given parameter values (cartesian product)
+func ParamGrid(axes map[string][]any) []BatchParams {
+	grid := []BatchParams{{}}
+	for _, name := range slices.Sorted(maps.Keys(axes)) {
+		var next []BatchParams
+		for _, params := range grid {
+			for _, value := range axes[name] {
+				combination := maps.Clone(params)
+				combination[name] = value
+				next = append(next, combination)
+			}
+		}
+		grid = next
+	}
+	return grid
+}
+
+// SeedRange returns n consecutive seeds starting from the given one
+func SeedRange(from int64, n int) []int64 {
+	seeds := make([]int64, n)
+	for i := range seeds {
+		seeds[i] = from + int64(i)
+	}
+	return seeds
+}
+
+// WriteCSV writes the summary table as CSV: parameters, seed, collected values and error
+func (r *BatchResults) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+
+	header := slices.Concat(r.ParamNames, []string{"seed"}, r.ValueNames, []string{"error"})
+	err := writer.Write(header)
+	if err != nil {
+		return err
+	}
+
+	for _, run := range r.Runs {
+		row := make([]string, 0, len(header))
+		for _, name := range r.ParamNames {
+			row = append(row, formatCell(run.Params[name]))
+		}
+		row = append(row, strconv.FormatInt(run.Seed, 10))
+		for _, name := range r.ValueNames {
+			row = append(row, formatCell(run.Values[name]))
+		}
+		row = append(row, run.Error)
+
+		err = writer.Write(row)
+		if err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// WriteJSON writes the summary table as a JSON array of runs
+func (r *BatchResults) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r.Runs)
+}
+
+func formatCell(value any) string {
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+func getParamNames(params []BatchParams) []string {
+	names := make(map[string]struct{})
+	for _, p := range params {
+		for name := range p {
+			names[name] = struct{}{}
+		}
+	}
+	return slices.Sorted(maps.Keys(names))
+}
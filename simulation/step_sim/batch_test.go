@@ -0,0 +1,246 @@
+package step_sim
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/hovsep/fmesh"
+	"github.com/hovsep/fmesh/component"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// getTickCounterMesh returns the mesh with one component counting ticks delivered by the clock
+func getTickCounterMesh() *fmesh.FMesh {
+	return fmesh.New("tick_counter").AddComponents(
+		component.New("counter").
+			WithInitialState(func(state component.State) {
+				state.Set("ticks", 0)
+			}).
+			AddInputs(TimePort).
+			WithActivationFunc(func(this *component.Component) error {
+				_, err := TickFromSignal(this.InputByName(TimePort).Signals().First())
+				if err != nil {
+					return err
+				}
+
+				this.State().Update("ticks", func(ticks any) any {
+					return ticks.(int) + 1
+				})
+				return nil
+			}),
+	)
+}
+
+func countedTicks(fm *fmesh.FMesh) (any, error) {
+	return fm.ComponentByName("counter").State().Get("ticks"), nil
+}
+
+func TestParamGrid(t *testing.T) {
+	tests := []struct {
+		name string
+		axes map[string][]any
+		want []BatchParams
+	}{
+		{
+			name: "no axes",
+			axes: map[string][]any{},
+			want: []BatchParams{{}},
+		},
+		{
+			name: "single axis",
+			axes: map[string][]any{"temperature": {-10, 20}},
+			want: []BatchParams{{"temperature": -10}, {"temperature": 20}},
+		},
+		{
+			name: "cartesian product in order of sorted names",
+			axes: map[string][]any{
+				"temperature": {-10, 20},
+				"humidity":    {0.3, 0.6, 0.9},
+			},
+			want: []BatchParams{
+				{"humidity": 0.3, "temperature": -10},
+				{"humidity": 0.3, "temperature": 20},
+				{"humidity": 0.6, "temperature": -10},
+				{"humidity": 0.6, "temperature": 20},
+				{"humidity": 0.9, "temperature": -10},
+				{"humidity": 0.9, "temperature": 20},
+			},
+		},
+		{
+			name: "empty axis gives no combinations",
+			axes: map[string][]any{"temperature": {-10, 20}, "humidity": {}},
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ParamGrid(tt.axes))
+		})
+	}
+}
+
+func TestSeedRange(t *testing.T) {
+	assert.Equal(t, []int64{5, 6, 7}, SeedRange(5, 3))
+	assert.Empty(t, SeedRange(5, 0))
+}
+
+func TestBatchRun(t *testing.T) {
+	t.Run("invalid configuration", func(t *testing.T) {
+		factory := func(BatchParams, int64) (*fmesh.FMesh, error) {
+			return getTickCounterMesh(), nil
+		}
+
+		_, err := NewBatch(nil, 10).Run(context.Background())
+		assert.ErrorContains(t, err, "mesh factory is required")
+
+		_, err = NewBatch(factory, 0).Run(context.Background())
+		assert.ErrorContains(t, err, "ticks must be positive")
+
+		_, err = NewBatch(factory, 10).WithWorkers(0).Run(context.Background())
+		assert.ErrorContains(t, err, "workers must be positive")
+	})
+
+	t.Run("results are in order of parameters and seeds regardless of parallelism", func(t *testing.T) {
+		factory := func(params BatchParams, seed int64) (*fmesh.FMesh, error) {
+			// Make earlier runs finish later
+			time.Sleep(time.Duration(10-params["n"].(int)) * time.Millisecond)
+			return getTickCounterMesh(), nil
+		}
+
+		results, err := NewBatch(factory, 3).
+			WithParams(ParamGrid(map[string][]any{"n": {0, 1, 2, 3, 4, 5, 6, 7, 8, 9}})...).
+			WithSeeds(SeedRange(1, 2)...).
+			WithWorkers(8).
+			WithCollector("ticks", countedTicks).
+			Run(context.Background())
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"n"}, results.ParamNames)
+		assert.Equal(t, []string{"ticks"}, results.ValueNames)
+		require.Len(t, results.Runs, 20)
+		for idx, run := range results.Runs {
+			assert.Equal(t, idx/2, run.Params["n"])
+			assert.Equal(t, int64(idx%2+1), run.Seed)
+			assert.Equal(t, 3, run.Values["ticks"])
+			assert.Empty(t, run.Error)
+		}
+	})
+
+	t.Run("same seed gives the same result", func(t *testing.T) {
+		factory := func(_ BatchParams, seed int64) (*fmesh.FMesh, error) {
+			rng := rand.New(rand.NewSource(seed))
+			return getTickCounterMesh().AddComponents(
+				component.New("noise").
+					WithInitialState(func(state component.State) {
+						state.Set("value", rng.Float64())
+					}).
+					WithActivationFunc(func(this *component.Component) error {
+						return nil
+					}),
+			), nil
+		}
+
+		results, err := NewBatch(factory, 1).
+			WithSeeds(1, 2, 1).
+			WithWorkers(3).
+			WithCollector("noise", func(fm *fmesh.FMesh) (any, error) {
+				return fm.ComponentByName("noise").State().Get("value"), nil
+			}).
+			Run(context.Background())
+		require.NoError(t, err)
+
+		assert.Equal(t, results.Runs[0].Values, results.Runs[2].Values)
+		assert.NotEqual(t, results.Runs[0].Values, results.Runs[1].Values)
+	})
+
+	t.Run("failed run does not stop the batch", func(t *testing.T) {
+		factory := func(params BatchParams, _ int64) (*fmesh.FMesh, error) {
+			if params["n"] == 1 {
+				return nil, errors.New("bad parameter")
+			}
+			return getTickCounterMesh(), nil
+		}
+
+		results, err := NewBatch(factory, 2).
+			WithParams(ParamGrid(map[string][]any{"n": {0, 1, 2}})...).
+			WithCollector("ticks", countedTicks).
+			WithCollector("missing", func(fm *fmesh.FMesh) (any, error) {
+				if fm.ComponentByName("counter").State().Get("ticks") != 2 {
+					return nil, errors.New("unexpected ticks")
+				}
+				return "ok", nil
+			}).
+			Run(context.Background())
+		require.NoError(t, err)
+
+		require.Len(t, results.Runs, 3)
+		assert.Empty(t, results.Runs[0].Error)
+		assert.Equal(t, "failed to build mesh: bad parameter", results.Runs[1].Error)
+		assert.Empty(t, results.Runs[2].Error)
+		assert.Equal(t, map[string]any{"ticks": 2, "missing": "ok"}, results.Runs[2].Values)
+	})
+
+	t.Run("cancelled batch", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		results, err := NewBatch(func(BatchParams, int64) (*fmesh.FMesh, error) {
+			return getTickCounterMesh(), nil
+		}, 10).Run(ctx)
+		require.ErrorIs(t, err, context.Canceled)
+		require.Len(t, results.Runs, 1)
+		assert.Contains(t, results.Runs[0].Error, context.Canceled.Error())
+	})
+}
+
+func TestBatchResultsWriters(t *testing.T) {
+	results := &BatchResults{
+		ParamNames: []string{"humidity", "temperature"},
+		ValueNames: []string{"heart_rate", "is_alive"},
+		Runs: []BatchResult{
+			{
+				Params: BatchParams{"humidity": 0.3, "temperature": -10},
+				Seed:   1,
+				Values: map[string]any{"heart_rate": 63, "is_alive": true},
+			},
+			{
+				Params: BatchParams{"humidity": 0.3, "temperature": 50},
+				Seed:   2,
+				Values: map[string]any{},
+				Error:  "simulation cycle 7 finished with error: boom, \"quoted\"",
+			},
+		},
+	}
+
+	t.Run("csv", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		require.NoError(t, results.WriteCSV(buf))
+
+		assert.Equal(t, `humidity,temperature,seed,heart_rate,is_alive,error
+0.3,-10,1,63,true,
+0.3,50,2,,,"simulation cycle 7 finished with error: boom, ""quoted"""
+`, buf.String())
+	})
+
+	t.Run("json", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		require.NoError(t, results.WriteJSON(buf))
+
+		var runs []map[string]any
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &runs))
+		require.Len(t, runs, 2)
+
+		assert.Equal(t, map[string]any{
+			"params": map[string]any{"humidity": 0.3, "temperature": -10.0},
+			"seed":   1.0,
+			"values": map[string]any{"heart_rate": 63.0, "is_alive": true},
+		}, runs[0])
+		assert.Equal(t, "simulation cycle 7 finished with error: boom, \"quoted\"", runs[1]["error"])
+	})
+}
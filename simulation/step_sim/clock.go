@@ -0,0 +1,197 @@
+package step_sim
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hovsep/fmesh"
+	"github.com/hovsep/fmesh/component"
+	"github.com/hovsep/fmesh/port"
+	"github.com/hovsep/fmesh/signal"
+)
+
+const (
+	// TimePort is the name of the input port the clock delivers ticks to (in every component that has it, see Clock.Targets)
+	TimePort = "time"
+
+	DefaultTickDuration = 10 * time.Millisecond
+
+	// Clock commands
+	TimeNow  Command = "time:now"
+	TimePace Command = "time:pace"
+	Schedule Command = "schedule"
+)
+
+// Tick is the payload of the signals delivered by the clock
+type Tick struct {
+	Count       uint64        // Discrete step counter
+	SimTime     time.Duration // Elapsed simulated duration
+	SimWallTime time.Time     // Simulation wall-clock time (start anchor + elapsed simulated duration)
+	Duration    time.Duration // Simulated duration of one tick
+}
+
+// Clock drives the simulation time, one tick per mesh run
+type Clock struct {
+	TickDuration time.Duration // Simulated duration of one tick
+	SimStartTime time.Time     // Wall-clock anchor of the simulated world
+	Pacing       float64       // Simulated time per real time: 1 is real time, 2 is twice faster, 0 is as fast as possible
+	Targets      []string      // Components the ticks are delivered to (when empty, all components having the time input)
+
+	current      Tick
+	lastTickTime time.Time // Real time of the last tick (used for pacing)
+}
+
+// scheduledCommand is a command which is executed when the simulated time comes
+type scheduledCommand struct {
+	at      time.Duration
+	cmd     Command
+	session *Session // Session which scheduled the command, its permissions are checked again when the command is executed
+}
+
+// NewClock creates a clock anchored at the current wall-clock time
+func NewClock(tickDuration time.Duration) *Clock {
+	now := time.Now()
+	return &Clock{
+		TickDuration: tickDuration,
+		SimStartTime: now,
+		current: Tick{
+			SimWallTime: now,
+			Duration:    tickDuration,
+		},
+	}
+}
+
+// Now returns the last tick
+func (c *Clock) Now() Tick {
+	return c.current
+}
+
+// Advance moves the clock one tick forward
+func (c *Clock) Advance() Tick {
+	simTime := c.current.SimTime + c.TickDuration
+	c.current = Tick{
+		Count:       c.current.Count + 1,
+		SimTime:     simTime,
+		SimWallTime: c.SimStartTime.Add(simTime),
+		Duration:    c.TickDuration,
+	}
+	return c.current
+}
+
+// Pace sleeps long enough to keep the configured ratio of simulated and real time
+func (c *Clock) Pace() {
+	if c.Pacing > 0 && !c.lastTickTime.IsZero() {
+		tickRealDuration := time.Duration(float64(c.TickDuration) / c.Pacing)
+		time.Sleep(tickRealDuration - time.Since(c.lastTickTime))
+	}
+	c.lastTickTime = time.Now()
+}
+
+// ToSignal returns the tick signal
+func (t Tick) ToSignal() *signal.Signal {
+	return signal.New(t)
+}
+
+// TickFromSignal extracts the tick from the signal sent by the clock
+func TickFromSignal(sig *signal.Signal) (Tick, error) {
+	if sig == nil {
+		return Tick{}, errors.New("tick signal cannot be nil")
+	}
+
+	tick, ok := sig.PayloadOrNil().(Tick)
+	if !ok {
+		return Tick{}, fmt.Errorf("unexpected tick signal payload: %T", sig.PayloadOrNil())
+	}
+	return tick, nil
+}
+
+// deliverTick puts the tick signal into the time input of targeted components
+func (s *Simulation) deliverTick(tick Tick) error {
+	return s.FM.Components().ForEach(func(c *component.Component) error {
+		if len(s.Clock.Targets) > 0 && !slices.Contains(s.Clock.Targets, c.Name()) {
+			return nil
+		}
+
+		timeInput := c.Inputs().FindAny(func(p *port.Port) bool {
+			return p.Name() == TimePort
+		})
+
+		if timeInput == nil {
+			return nil
+		}
+
+		return timeInput.PutSignals(tick.ToSignal()).ChainableErr()
+	}).ChainableErr()
+}
+
+// runScheduledCommands executes commands which are due at the current simulated time
+func (s *Simulation) runScheduledCommands() {
+	now := s.Clock.Now().SimTime
+	for len(s.scheduled) > 0 && s.scheduled[0].at <= now {
+		scheduled := s.scheduled[0]
+		s.scheduled = s.scheduled[1:]
+
+		if scheduled.session == nil {
+			s.runCommand(scheduled.cmd)
+			continue
+		}
+
+		// The lock may be taken by another session since the command was scheduled
+		s.handleSessionCommand(sessionCommand{session: scheduled.session, cmd: scheduled.cmd})
+	}
+}
+
+// addClockCommands adds commands to inspect and control the simulation time
+func (s *Simulation) addClockCommands() {
+	s.MeshCommands[TimeNow] = NewMeshCommandDescriptor("print current time", func(_ *fmesh.FMesh) {
+		tick := s.Clock.Now()
+		fmt.Fprintln(s.out, "Current tick count:", tick.Count)
+		fmt.Fprintln(s.out, "Simulation duration:", tick.SimTime)
+		fmt.Fprintln(s.out, "Simulation wall-clock time:", tick.SimWallTime)
+	}).AsReadOnly()
+
+	s.MeshCommands[TimePace] = NewMeshCommandDescriptorWithArgs("set simulated time per real time (0 runs as fast as possible)", []string{"factor"}, func(_ *fmesh.FMesh, args []string) error {
+		if len(args) != 1 {
+			return fmt.Errorf("expected 1 argument, got %d", len(args))
+		}
+
+		pacing, err := strconv.ParseFloat(args[0], 64)
+		if err != nil || pacing < 0 {
+			return fmt.Errorf("invalid pacing: %s", args[0])
+		}
+
+		s.Clock.Pacing = pacing
+		return nil
+	})
+
+	s.MeshCommands[Schedule] = NewMeshCommandDescriptorWithArgs("run a command after the given simulated time, e.g. schedule 5s temp:hot", []string{"delay", "command"}, func(_ *fmesh.FMesh, args []string) error {
+		if len(args) < 2 {
+			return fmt.Errorf("expected delay and command, got %d argument(s)", len(args))
+		}
+
+		delay, err := time.ParseDuration(args[0])
+		if err != nil || delay < 0 {
+			return fmt.Errorf("invalid delay: %s", args[0])
+		}
+
+		scheduled := scheduledCommand{
+			at:      s.Clock.Now().SimTime + delay,
+			cmd:     Command(strings.Join(args[1:], " ")),
+			session: s.session,
+		}
+
+		// Keep commands ordered by time (commands scheduled at the same time are executed in the order they were added)
+		idx := slices.IndexFunc(s.scheduled, func(sc scheduledCommand) bool {
+			return sc.at > scheduled.at
+		})
+		if idx < 0 {
+			idx = len(s.scheduled)
+		}
+		s.scheduled = slices.Insert(s.scheduled, idx, scheduled)
+		return nil
+	})
+}
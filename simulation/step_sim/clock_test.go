@@ -0,0 +1,242 @@
+package step_sim
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hovsep/fmesh"
+	"github.com/hovsep/fmesh-examples/simulation/step_sim/sink"
+	"github.com/hovsep/fmesh/component"
+	"github.com/hovsep/fmesh/signal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// getTestSimulation returns the simulation of the given mesh with the output captured
+func getTestSimulation(t *testing.T, fm *fmesh.FMesh) (*Simulation, *bytes.Buffer) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	out := &bytes.Buffer{}
+	sim := NewSimulation(ctx, fm, nil, sink.NewNoopSink())
+	sim.out = out
+	return sim, out
+}
+
+// withRecordedCommand adds the command which records its arguments
+func withRecordedCommand(sim *Simulation, name Command, recorded *[]string) {
+	sim.MeshCommands[name] = NewMeshCommandDescriptorWithArgs("record", []string{"value"}, func(_ *fmesh.FMesh, args []string) error {
+		*recorded = append(*recorded, args...)
+		return nil
+	})
+}
+
+func TestClock(t *testing.T) {
+	t.Run("advance", func(t *testing.T) {
+		clock := NewClock(10 * time.Millisecond)
+		start := clock.SimStartTime
+
+		assert.Equal(t, uint64(0), clock.Now().Count)
+		assert.Equal(t, start, clock.Now().SimWallTime)
+
+		clock.Advance()
+		clock.TickDuration = time.Second
+		tick := clock.Advance()
+
+		assert.Equal(t, tick, clock.Now())
+		assert.Equal(t, uint64(2), tick.Count)
+		assert.Equal(t, 1010*time.Millisecond, tick.SimTime)
+		assert.Equal(t, start.Add(1010*time.Millisecond), tick.SimWallTime)
+		assert.Equal(t, time.Second, tick.Duration)
+	})
+
+	t.Run("pacing keeps the ratio of simulated and real time", func(t *testing.T) {
+		clock := NewClock(100 * time.Millisecond)
+		clock.Pacing = 5 // 20ms per tick
+
+		started := time.Now()
+		for range 4 {
+			clock.Advance()
+			clock.Pace()
+		}
+
+		// The first tick is not paced
+		assert.GreaterOrEqual(t, time.Since(started), 60*time.Millisecond)
+	})
+
+	t.Run("no pacing", func(t *testing.T) {
+		clock := NewClock(time.Hour)
+
+		started := time.Now()
+		for range 4 {
+			clock.Advance()
+			clock.Pace()
+		}
+
+		assert.Less(t, time.Since(started), time.Second)
+	})
+}
+
+func TestTickFromSignal(t *testing.T) {
+	tick := Tick{Count: 3, SimTime: 30 * time.Millisecond}
+
+	got, err := TickFromSignal(tick.ToSignal())
+	require.NoError(t, err)
+	assert.Equal(t, tick, got)
+
+	_, err = TickFromSignal(nil)
+	assert.ErrorContains(t, err, "tick signal cannot be nil")
+
+	_, err = TickFromSignal(signal.New("tick"))
+	assert.ErrorContains(t, err, "unexpected tick signal payload: string")
+}
+
+func TestSimulationDeliverTick(t *testing.T) {
+	getMesh := func() *fmesh.FMesh {
+		return getTickCounterMesh().AddComponents(
+			component.New("sensor").
+				WithInitialState(func(state component.State) {
+					state.Set("ticks", 0)
+				}).
+				AddInputs(TimePort, "ctl").
+				WithActivationFunc(func(this *component.Component) error {
+					if this.InputByName(TimePort).HasSignals() {
+						this.State().Update("ticks", func(ticks any) any {
+							return ticks.(int) + 1
+						})
+					}
+					return nil
+				}),
+			component.New("display").
+				AddInputs("ctl").
+				WithActivationFunc(func(this *component.Component) error {
+					return nil
+				}),
+		)
+	}
+
+	tests := []struct {
+		name        string
+		targets     []string
+		wantCounter int
+		wantSensor  int
+	}{
+		{
+			name:        "all components with the time input",
+			wantCounter: 3,
+			wantSensor:  3,
+		},
+		{
+			name:        "targeted components only",
+			targets:     []string{"sensor", "display"},
+			wantCounter: 0,
+			wantSensor:  3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sim, _ := getTestSimulation(t, getMesh())
+			sim.Clock.Targets = tt.targets
+
+			require.NoError(t, sim.RunTicks(3))
+
+			assert.Equal(t, uint64(3), sim.Clock.Now().Count)
+			assert.Equal(t, tt.wantCounter, sim.FM.ComponentByName("counter").State().Get("ticks"))
+			assert.Equal(t, tt.wantSensor, sim.FM.ComponentByName("sensor").State().Get("ticks"))
+		})
+	}
+}
+
+func TestSimulationClockCommands(t *testing.T) {
+	t.Run("time:now", func(t *testing.T) {
+		sim, out := getTestSimulation(t, getTickCounterMesh())
+		require.NoError(t, sim.RunTicks(2))
+
+		sim.handleCommand(TimeNow)
+		assert.Contains(t, out.String(), "Current tick count: 2\n")
+		assert.Contains(t, out.String(), "Simulation duration: 20ms\n")
+	})
+
+	t.Run("time:pace", func(t *testing.T) {
+		sim, out := getTestSimulation(t, getTickCounterMesh())
+
+		sim.handleCommand("time:pace 2.5")
+		assert.Equal(t, 2.5, sim.Clock.Pacing)
+
+		sim.handleCommand("time:pace 0")
+		assert.Equal(t, 0.0, sim.Clock.Pacing)
+		assert.Empty(t, out.String())
+
+		sim.handleCommand("time:pace -1")
+		sim.handleCommand("time:pace fast")
+		sim.handleCommand("time:pace")
+		assert.Equal(t, 0.0, sim.Clock.Pacing)
+		assert.Contains(t, out.String(), "invalid pacing: -1")
+		assert.Contains(t, out.String(), "invalid pacing: fast")
+		assert.Contains(t, out.String(), "expected 1 argument, got 0")
+	})
+
+	t.Run("schedule runs commands when the simulated time comes", func(t *testing.T) {
+		sim, out := getTestSimulation(t, getTickCounterMesh())
+		var recorded []string
+		withRecordedCommand(sim, "record", &recorded)
+
+		sim.handleCommand("schedule 30ms record third")
+		sim.handleCommand("schedule 10ms record first")
+		sim.handleCommand("schedule 30ms record fourth")
+		sim.handleCommand("schedule 20ms record second")
+		sim.handleCommand("schedule 0s record now")
+		require.Empty(t, out.String())
+
+		require.NoError(t, sim.RunTicks(1))
+		assert.Equal(t, []string{"now", "first"}, recorded)
+
+		require.NoError(t, sim.RunTicks(2))
+		assert.Equal(t, []string{"now", "first", "second", "third", "fourth"}, recorded)
+		assert.Empty(t, sim.scheduled)
+	})
+
+	t.Run("schedule is relative to the current time", func(t *testing.T) {
+		sim, _ := getTestSimulation(t, getTickCounterMesh())
+		var recorded []string
+		withRecordedCommand(sim, "record", &recorded)
+
+		require.NoError(t, sim.RunTicks(5))
+		sim.handleCommand("schedule 20ms record later")
+
+		require.NoError(t, sim.RunTicks(1))
+		assert.Empty(t, recorded)
+
+		require.NoError(t, sim.RunTicks(1))
+		assert.Equal(t, []string{"later"}, recorded)
+	})
+
+	t.Run("scheduled pause and resume", func(t *testing.T) {
+		sim, out := getTestSimulation(t, getTickCounterMesh())
+
+		sim.handleCommand("schedule 10ms pause")
+		require.NoError(t, sim.RunTicks(1))
+		assert.True(t, sim.isPaused)
+		assert.Equal(t, "Simulation paused\n", out.String())
+
+		sim.handleCommand("schedule 0s resume")
+		require.NoError(t, sim.RunTicks(1))
+		assert.False(t, sim.isPaused)
+		assert.Equal(t, "Simulation paused\nSimulation resumed\n", out.String())
+	})
+
+	t.Run("invalid schedule", func(t *testing.T) {
+		sim, out := getTestSimulation(t, getTickCounterMesh())
+
+		sim.handleCommand("schedule 10ms")
+		sim.handleCommand("schedule soon pause")
+		sim.handleCommand("schedule -1s pause")
+
+		assert.Contains(t, out.String(), "expected delay and command, got 1 argument(s)")
+		assert.Contains(t, out.String(), "invalid delay: soon")
+		assert.Contains(t, out.String(), "invalid delay: -1s")
+		assert.Empty(t, sim.scheduled)
+	})
+}
@@ -1,12 +1,23 @@
 package step_sim
 
-import "github.com/hovsep/fmesh"
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hovsep/fmesh"
+)
 
 type Command string
 
+// MeshCommandArgsFunc is the function of a command that accepts arguments
+type MeshCommandArgsFunc func(fm *fmesh.FMesh, args []string) error
+
 type MeshCommandDescriptor struct {
 	Description string
 	Func        func(*fmesh.FMesh)
+	Args        []string            // Names of the arguments (only used in help)
+	ArgsFunc    MeshCommandArgsFunc // Used instead of Func when set
+	ReadOnly    bool                // Command does not change the simulation, so read-only sessions can run it
 }
 
 const (
@@ -14,6 +25,16 @@ const (
 	Resume Command = "resume"
 	Exit   Command = "exit"
 	Help   Command = "help"
+
+	// REPL-only commands
+	Define  Command = "define"
+	Alias   Command = "alias"
+	Wait    Command = "wait"
+	History Command = "history"
+
+	// Session commands
+	Lock   Command = "lock"
+	Unlock Command = "unlock"
 )
 
 var NoopMeshCommand = func(*fmesh.FMesh) {
@@ -21,9 +42,47 @@ var NoopMeshCommand = func(*fmesh.FMesh) {
 }
 
 func NewMeshCommandDescriptor(desc string, cmdFunc func(*fmesh.FMesh)) MeshCommandDescriptor {
-	return MeshCommandDescriptor{desc, cmdFunc}
+	return MeshCommandDescriptor{Description: desc, Func: cmdFunc}
+}
+
+// NewMeshCommandDescriptorWithArgs creates a descriptor of a command that accepts arguments
+func NewMeshCommandDescriptorWithArgs(desc string, args []string, cmdFunc MeshCommandArgsFunc) MeshCommandDescriptor {
+	return MeshCommandDescriptor{Description: desc, Args: args, ArgsFunc: cmdFunc}
 }
 
-func (md MeshCommandDescriptor) RunWithMesh(fm *fmesh.FMesh) {
+func (md MeshCommandDescriptor) RunWithMesh(fm *fmesh.FMesh, args ...string) error {
+	if md.ArgsFunc != nil {
+		return md.ArgsFunc(fm, args)
+	}
+
+	if len(args) > 0 {
+		return fmt.Errorf("command does not accept arguments, got %d", len(args))
+	}
+
 	md.Func(fm)
+	return nil
+}
+
+// AsReadOnly marks the command as not changing the simulation
+func (md MeshCommandDescriptor) AsReadOnly() MeshCommandDescriptor {
+	md.ReadOnly = true
+	return md
+}
+
+// Usage returns the command name followed by its argument names
+func (md MeshCommandDescriptor) Usage(cmd Command) string {
+	usage := string(cmd)
+	for _, arg := range md.Args {
+		usage += " <" + arg + ">"
+	}
+	return usage
+}
+
+// Split splits the command line into the command name and its arguments
+func (cmd Command) Split() (Command, []string) {
+	fields := strings.Fields(string(cmd))
+	if len(fields) == 0 {
+		return "", nil
+	}
+	return Command(fields[0]), fields[1:]
 }
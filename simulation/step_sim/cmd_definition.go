@@ -0,0 +1,218 @@
+package step_sim
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+
+	"github.com/hovsep/fmesh"
+	"github.com/hovsep/fmesh/signal"
+	"gopkg.in/yaml.v3"
+)
+
+// Supported payload types of declarative commands
+const (
+	PayloadTypeAny    = ""
+	PayloadTypeString = "string"
+	PayloadTypeInt    = "int"
+	PayloadTypeFloat  = "float"
+	PayloadTypeBool   = "bool"
+)
+
+// argPlaceholder matches argument placeholders in templates: $1, $2, ...
+var argPlaceholder = regexp.MustCompile(`\$(\d+)`)
+
+// CommandDefinition declaratively describes a mesh command,
+// which puts a signal into the given input port of the given component.
+// Payload and label values are templates, so they can reference command arguments as $1, $2, ...
+type CommandDefinition struct {
+	Name        string            `yaml:"name"`
+	Description string            `yaml:"description"`
+	Args        []string          `yaml:"args"`         // Argument names
+	Component   string            `yaml:"component"`    // Target component
+	Port        string            `yaml:"port"`         // Target input port
+	Payload     any               `yaml:"payload"`      // Payload template
+	PayloadType string            `yaml:"payload_type"` // Optional payload conversion (string, int, float or bool)
+	Labels      map[string]string `yaml:"labels"`       // Signal labels (values are templates)
+}
+
+// CommandDefinitions is the layout of a commands file
+type CommandDefinitions struct {
+	Commands []CommandDefinition `yaml:"commands"`
+}
+
+// ParseCommandDefinitions parses command definitions from YAML or JSON (which is a subset of YAML)
+func ParseCommandDefinitions(data []byte) ([]CommandDefinition, error) {
+	var definitions CommandDefinitions
+	err := yaml.Unmarshal(data, &definitions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse command definitions: %w", err)
+	}
+
+	for _, def := range definitions.Commands {
+		err = def.Validate()
+		if err != nil {
+			return nil, fmt.Errorf("invalid definition of command %q: %w", def.Name, err)
+		}
+	}
+
+	return definitions.Commands, nil
+}
+
+// LoadCommandDefinitions reads command definitions from the given YAML or JSON file
+func LoadCommandDefinitions(path string) ([]CommandDefinition, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read command definitions: %w", err)
+	}
+
+	return ParseCommandDefinitions(data)
+}
+
+// Validate checks the definition without looking into the mesh
+func (def CommandDefinition) Validate() error {
+	if def.Name == "" {
+		return errors.New("name is required")
+	}
+
+	if def.Component == "" {
+		return errors.New("component is required")
+	}
+
+	if def.Port == "" {
+		return errors.New("port is required")
+	}
+
+	switch def.PayloadType {
+	case PayloadTypeAny, PayloadTypeString, PayloadTypeInt, PayloadTypeFloat, PayloadTypeBool:
+	default:
+		return fmt.Errorf("unsupported payload type: %s", def.PayloadType)
+	}
+
+	templates := make([]string, 0, len(def.Labels)+1)
+	if payloadTemplate, ok := def.Payload.(string); ok {
+		templates = append(templates, payloadTemplate)
+	}
+	for _, labelTemplate := range def.Labels {
+		templates = append(templates, labelTemplate)
+	}
+
+	for _, template := range templates {
+		for _, match := range argPlaceholder.FindAllStringSubmatch(template, -1) {
+			argIndex, _ := strconv.Atoi(match[1])
+			if argIndex < 1 || argIndex > len(def.Args) {
+				return fmt.Errorf("placeholder %s refers to undeclared argument", match[0])
+			}
+		}
+	}
+
+	return nil
+}
+
+// ToMeshCommandDescriptor converts the definition into a regular command descriptor
+func (def CommandDefinition) ToMeshCommandDescriptor() MeshCommandDescriptor {
+	return NewMeshCommandDescriptorWithArgs(def.Description, def.Args, func(fm *fmesh.FMesh, args []string) error {
+		if len(args) != len(def.Args) {
+			return fmt.Errorf("expected %d argument(s), got %d", len(def.Args), len(args))
+		}
+
+		payload, err := def.renderPayload(args)
+		if err != nil {
+			return fmt.Errorf("failed to render payload: %w", err)
+		}
+
+		sig := signal.New(payload)
+		for labelName, labelTemplate := range def.Labels {
+			sig.AddLabel(labelName, expandArgs(labelTemplate, args))
+		}
+
+		targetComponent := fm.ComponentByName(def.Component)
+		if targetComponent == nil {
+			return fmt.Errorf("component not found: %s", def.Component)
+		}
+
+		targetPort := targetComponent.InputByName(def.Port)
+		if targetPort == nil {
+			return fmt.Errorf("input port not found: %s::%s", def.Component, def.Port)
+		}
+
+		return targetPort.PutSignals(sig).ChainableErr()
+	})
+}
+
+// AddFromDefinitions adds commands from definitions, making sure they target existing ports of the given mesh
+func (m MeshCommandMap) AddFromDefinitions(fm *fmesh.FMesh, definitions ...CommandDefinition) error {
+	for _, def := range definitions {
+		err := def.Validate()
+		if err != nil {
+			return fmt.Errorf("invalid definition of command %q: %w", def.Name, err)
+		}
+
+		targetComponent := fm.ComponentByName(def.Component)
+		if targetComponent == nil {
+			return fmt.Errorf("command %q targets unknown component: %s", def.Name, def.Component)
+		}
+
+		if targetComponent.InputByName(def.Port) == nil {
+			return fmt.Errorf("command %q targets unknown input port: %s::%s", def.Name, def.Component, def.Port)
+		}
+
+		m[Command(def.Name)] = def.ToMeshCommandDescriptor()
+	}
+	return nil
+}
+
+// renderPayload substitutes arguments into the payload template and converts the result to the declared type
+func (def CommandDefinition) renderPayload(args []string) (any, error) {
+	payload := def.Payload
+	if payloadTemplate, ok := payload.(string); ok {
+		payload = expandArgs(payloadTemplate, args)
+	}
+
+	switch def.PayloadType {
+	case PayloadTypeAny:
+		return payload, nil
+	case PayloadTypeString:
+		return fmt.Sprint(payload), nil
+	case PayloadTypeInt:
+		switch v := payload.(type) {
+		case int:
+			return v, nil
+		case float64:
+			return int(v), nil
+		case string:
+			return strconv.Atoi(v)
+		}
+	case PayloadTypeFloat:
+		switch v := payload.(type) {
+		case int:
+			return float64(v), nil
+		case float64:
+			return v, nil
+		case string:
+			return strconv.ParseFloat(v, 64)
+		}
+	case PayloadTypeBool:
+		switch v := payload.(type) {
+		case bool:
+			return v, nil
+		case string:
+			return strconv.ParseBool(v)
+		}
+	}
+
+	return nil, fmt.Errorf("can not convert %v (%T) to %s", payload, payload, def.PayloadType)
+}
+
+// expandArgs replaces argument placeholders with actual arguments
+func expandArgs(template string, args []string) string {
+	return argPlaceholder.ReplaceAllStringFunc(template, func(placeholder string) string {
+		argIndex, _ := strconv.Atoi(placeholder[1:])
+		if argIndex < 1 || argIndex > len(args) {
+			return placeholder
+		}
+		return args[argIndex-1]
+	})
+}
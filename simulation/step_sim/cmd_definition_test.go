@@ -0,0 +1,324 @@
+package step_sim
+
+import (
+	"testing"
+
+	"github.com/hovsep/fmesh"
+	"github.com/hovsep/fmesh/component"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// getCommandTestMesh returns the mesh with one component to put signals into
+func getCommandTestMesh() *fmesh.FMesh {
+	return fmesh.New("commands_test").AddComponents(
+		component.New("heater").
+			AddInputs("temperature").
+			WithActivationFunc(func(this *component.Component) error {
+				return nil
+			}),
+	)
+}
+
+func TestParseCommandDefinitions(t *testing.T) {
+	tests := []struct {
+		name          string
+		data          string
+		wantNames     []string
+		wantErrString string
+	}{
+		{
+			name: "yaml",
+			data: `
+commands:
+  - name: heat
+    description: Set the temperature
+    args: [degrees]
+    component: heater
+    port: temperature
+    payload: $1
+    payload_type: float
+    labels:
+      source: $1-repl
+`,
+			wantNames: []string{"heat"},
+		},
+		{
+			name:      "json",
+			data:      `{"commands": [{"name": "heat", "component": "heater", "port": "temperature", "payload": 20}]}`,
+			wantNames: []string{"heat"},
+		},
+		{
+			name:          "malformed",
+			data:          `commands: [`,
+			wantErrString: "failed to parse command definitions",
+		},
+		{
+			name:          "missing name",
+			data:          `{"commands": [{"component": "heater", "port": "temperature"}]}`,
+			wantErrString: "name is required",
+		},
+		{
+			name:          "missing component",
+			data:          `{"commands": [{"name": "heat", "port": "temperature"}]}`,
+			wantErrString: "component is required",
+		},
+		{
+			name:          "missing port",
+			data:          `{"commands": [{"name": "heat", "component": "heater"}]}`,
+			wantErrString: "port is required",
+		},
+		{
+			name:          "unsupported payload type",
+			data:          `{"commands": [{"name": "heat", "component": "heater", "port": "temperature", "payload_type": "complex"}]}`,
+			wantErrString: "unsupported payload type: complex",
+		},
+		{
+			name:          "placeholder of undeclared argument in payload",
+			data:          `{"commands": [{"name": "heat", "args": ["degrees"], "component": "heater", "port": "temperature", "payload": "$2"}]}`,
+			wantErrString: "placeholder $2 refers to undeclared argument",
+		},
+		{
+			name:          "placeholder of undeclared argument in label",
+			data:          `{"commands": [{"name": "heat", "component": "heater", "port": "temperature", "labels": {"source": "$1"}}]}`,
+			wantErrString: "placeholder $1 refers to undeclared argument",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			definitions, err := ParseCommandDefinitions([]byte(tt.data))
+			if tt.wantErrString != "" {
+				require.Error(t, err)
+				assert.ErrorContains(t, err, tt.wantErrString)
+				return
+			}
+
+			require.NoError(t, err)
+			var names []string
+			for _, def := range definitions {
+				names = append(names, def.Name)
+			}
+			assert.Equal(t, tt.wantNames, names)
+		})
+	}
+}
+
+func TestExpandArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		args     []string
+		want     string
+	}{
+		{
+			name:     "no placeholders",
+			template: "plain",
+			args:     []string{"a"},
+			want:     "plain",
+		},
+		{
+			name:     "placeholders in any order",
+			template: "$2 then $1 and $2",
+			args:     []string{"a", "b"},
+			want:     "b then a and b",
+		},
+		{
+			name:     "multi-digit placeholder",
+			template: "$10",
+			args:     []string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "ten"},
+			want:     "ten",
+		},
+		{
+			name:     "missing argument is kept as is",
+			template: "$1 $3 $0",
+			args:     []string{"a"},
+			want:     "a $3 $0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, expandArgs(tt.template, tt.args))
+		})
+	}
+}
+
+func TestCommandDefinitionRenderPayload(t *testing.T) {
+	tests := []struct {
+		name          string
+		def           CommandDefinition
+		args          []string
+		want          any
+		wantErrString string
+	}{
+		{
+			name: "any keeps the template result",
+			def:  CommandDefinition{Payload: "to $1"},
+			args: []string{"20"},
+			want: "to 20",
+		},
+		{
+			name: "any keeps non-string payload",
+			def:  CommandDefinition{Payload: 42},
+			want: 42,
+		},
+		{
+			name: "string",
+			def:  CommandDefinition{Payload: 42, PayloadType: PayloadTypeString},
+			want: "42",
+		},
+		{
+			name: "int from argument",
+			def:  CommandDefinition{Payload: "$1", PayloadType: PayloadTypeInt},
+			args: []string{"-7"},
+			want: -7,
+		},
+		{
+			name: "int from float",
+			def:  CommandDefinition{Payload: 3.9, PayloadType: PayloadTypeInt},
+			want: 3,
+		},
+		{
+			name:          "int from bad argument",
+			def:           CommandDefinition{Payload: "$1", PayloadType: PayloadTypeInt},
+			args:          []string{"seven"},
+			wantErrString: "invalid syntax",
+		},
+		{
+			name:          "int from bool",
+			def:           CommandDefinition{Payload: true, PayloadType: PayloadTypeInt},
+			wantErrString: "can not convert true (bool) to int",
+		},
+		{
+			name: "float from argument",
+			def:  CommandDefinition{Payload: "$1", PayloadType: PayloadTypeFloat},
+			args: []string{"36.6"},
+			want: 36.6,
+		},
+		{
+			name: "float from int",
+			def:  CommandDefinition{Payload: 2, PayloadType: PayloadTypeFloat},
+			want: 2.0,
+		},
+		{
+			name:          "float from bad argument",
+			def:           CommandDefinition{Payload: "$1", PayloadType: PayloadTypeFloat},
+			args:          []string{"warm"},
+			wantErrString: "invalid syntax",
+		},
+		{
+			name: "bool from argument",
+			def:  CommandDefinition{Payload: "$1", PayloadType: PayloadTypeBool},
+			args: []string{"true"},
+			want: true,
+		},
+		{
+			name:          "bool from number",
+			def:           CommandDefinition{Payload: 1, PayloadType: PayloadTypeBool},
+			wantErrString: "can not convert 1 (int) to bool",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, err := tt.def.renderPayload(tt.args)
+			if tt.wantErrString != "" {
+				require.Error(t, err)
+				assert.ErrorContains(t, err, tt.wantErrString)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, payload)
+		})
+	}
+}
+
+func TestMeshCommandMapAddFromDefinitions(t *testing.T) {
+	heat := CommandDefinition{
+		Name:        "heat",
+		Args:        []string{"degrees"},
+		Component:   "heater",
+		Port:        "temperature",
+		Payload:     "$1",
+		PayloadType: PayloadTypeFloat,
+		Labels:      map[string]string{"source": "repl-$1"},
+	}
+
+	tests := []struct {
+		name          string
+		def           CommandDefinition
+		wantErrString string
+	}{
+		{
+			name: "valid",
+			def:  heat,
+		},
+		{
+			name: "unknown component",
+			def: CommandDefinition{
+				Name:      "cool",
+				Component: "cooler",
+				Port:      "temperature",
+			},
+			wantErrString: `command "cool" targets unknown component: cooler`,
+		},
+		{
+			name: "unknown port",
+			def: CommandDefinition{
+				Name:      "cool",
+				Component: "heater",
+				Port:      "humidity",
+			},
+			wantErrString: `command "cool" targets unknown input port: heater::humidity`,
+		},
+		{
+			name: "invalid definition",
+			def: CommandDefinition{
+				Name:      "cool",
+				Component: "heater",
+			},
+			wantErrString: `invalid definition of command "cool": port is required`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			commands := MeshCommandMap{}
+			err := commands.AddFromDefinitions(getCommandTestMesh(), tt.def)
+			if tt.wantErrString != "" {
+				require.Error(t, err)
+				assert.ErrorContains(t, err, tt.wantErrString)
+				assert.Empty(t, commands)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Contains(t, commands, Command(tt.def.Name))
+		})
+	}
+
+	t.Run("run puts the rendered signal", func(t *testing.T) {
+		fm := getCommandTestMesh()
+		descriptor := heat.ToMeshCommandDescriptor()
+
+		require.NoError(t, descriptor.RunWithMesh(fm, "21.5"))
+
+		sig := fm.ComponentByName("heater").InputByName("temperature").Signals().First()
+		require.NotNil(t, sig)
+		assert.Equal(t, 21.5, sig.PayloadOrNil())
+		assert.Equal(t, "repl-21.5", sig.Labels().ValueOrDefault("source", ""))
+	})
+
+	t.Run("run with missing argument", func(t *testing.T) {
+		err := heat.ToMeshCommandDescriptor().RunWithMesh(getCommandTestMesh())
+		assert.ErrorContains(t, err, "expected 1 argument(s), got 0")
+	})
+
+	t.Run("run with bad argument type", func(t *testing.T) {
+		err := heat.ToMeshCommandDescriptor().RunWithMesh(getCommandTestMesh(), "hot")
+		assert.ErrorContains(t, err, "failed to render payload")
+	})
+
+	t.Run("run on mesh without the component", func(t *testing.T) {
+		err := heat.ToMeshCommandDescriptor().RunWithMesh(fmesh.New("empty"), "20")
+		assert.ErrorContains(t, err, "component not found: heater")
+	})
+}
@@ -0,0 +1,384 @@
+package step_sim
+
+import (
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hovsep/fmesh"
+	"github.com/hovsep/fmesh/port"
+	"github.com/hovsep/fmesh/signal"
+)
+
+// CoSimRole is the role of the process in the co-simulation
+type CoSimRole string
+
+const (
+	CoSimMaster CoSimRole = "master" // Listens for the slave and leads the ticks
+	CoSimSlave  CoSimRole = "slave"  // Connects to the master and follows its ticks
+
+	coSimDialInterval = 500 * time.Millisecond
+)
+
+func init() {
+	// Ticks are usually shared between co-simulated meshes
+	gob.Register(Tick{})
+}
+
+// CoSimPort is a boundary port connected to the peer process through a named channel
+type CoSimPort struct {
+	Channel string   // Channel name, the same in both processes
+	Path    string   // Local port path: component::port
+	Labels  []string // Signal labels sent along with payloads (exports only)
+}
+
+// CoSim connects boundary ports of the simulated mesh with a mesh simulated in another process.
+// Processes run in lockstep: after each tick the master sends its exported signals and waits for the slave,
+// the slave receives them before running the same tick and replies with its own exported signals.
+// So signals cross the boundary with one tick delay.
+// Payloads are transferred with encoding/gob, so custom payload types must be registered with gob.Register in both processes
+type CoSim struct {
+	role    CoSimRole
+	network string // "unix" or "tcp"
+	address string
+	exports []CoSimPort // Local outputs sent to the peer after each tick
+	imports []CoSimPort // Local inputs receiving the peer's signals
+
+	conn    net.Conn
+	encoder *gob.Encoder
+	decoder *gob.Decoder
+}
+
+// coSimHello is exchanged once the connection is established
+type coSimHello struct {
+	Role     CoSimRole
+	Channels []string // Exported channels
+}
+
+// coSimFrame carries the signals of all exported channels produced in the given tick
+type coSimFrame struct {
+	Tick     uint64
+	Channels map[string][]coSimSignal
+}
+
+// coSimSignal is the wire representation of a signal
+type coSimSignal struct {
+	Payload any
+	Labels  map[string]string
+	IsGroup bool          // The payload is a signal group
+	Group   []coSimSignal // Signals of the group payload
+}
+
+// NewCoSim creates a co-simulation endpoint, the connection is established when the simulation runs the first tick
+func NewCoSim(role CoSimRole, network, address string) *CoSim {
+	return &CoSim{
+		role:    role,
+		network: network,
+		address: address,
+	}
+}
+
+// Export sends signals of the local output port to the given channel (with the given labels)
+func (c *CoSim) Export(channel, path string, labels ...string) *CoSim {
+	c.exports = append(c.exports, CoSimPort{Channel: channel, Path: path, Labels: labels})
+	return c
+}
+
+// Import puts signals received from the given channel into the local input port
+func (c *CoSim) Import(channel, path string) *CoSim {
+	c.imports = append(c.imports, CoSimPort{Channel: channel, Path: path})
+	return c
+}
+
+// Close closes the connection to the peer
+func (c *CoSim) Close() error {
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.Close()
+}
+
+// connect establishes the connection and checks the peer is compatible
+func (c *CoSim) connect(ctx context.Context, fm *fmesh.FMesh) error {
+	err := c.validatePorts(fm)
+	if err != nil {
+		return err
+	}
+
+	switch c.role {
+	case CoSimMaster:
+		c.conn, err = c.accept(ctx)
+	case CoSimSlave:
+		c.conn, err = c.dial(ctx)
+	default:
+		err = fmt.Errorf("unknown co-simulation role: %s", c.role)
+	}
+	if err != nil {
+		return err
+	}
+
+	c.encoder = gob.NewEncoder(c.conn)
+	c.decoder = gob.NewDecoder(c.conn)
+
+	err = c.handshake()
+	if err != nil {
+		// Do not leave the peer waiting for the first tick
+		_ = c.conn.Close()
+		return err
+	}
+	return nil
+}
+
+func (c *CoSim) accept(ctx context.Context) (net.Conn, error) {
+	if c.network == "unix" {
+		// Remove the socket left by a previous run
+		_ = os.Remove(c.address)
+	}
+
+	listener, err := net.Listen(c.network, c.address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for co-simulation slave: %w", err)
+	}
+	defer listener.Close()
+
+	// Unblock accept when the simulation is cancelled
+	stopListening := context.AfterFunc(ctx, func() {
+		_ = listener.Close()
+	})
+	defer stopListening()
+
+	fmt.Printf("Waiting for co-simulation slave on %s:%s...\n", c.network, c.address)
+	conn, err := listener.Accept()
+	if err != nil {
+		return nil, fmt.Errorf("failed to accept co-simulation slave: %w", err)
+	}
+
+	fmt.Println("Co-simulation slave connected")
+	return conn, nil
+}
+
+func (c *CoSim) dial(ctx context.Context) (net.Conn, error) {
+	fmt.Printf("Connecting to co-simulation master on %s:%s...\n", c.network, c.address)
+	for {
+		conn, err := net.Dial(c.network, c.address)
+		if err == nil {
+			fmt.Println("Connected to co-simulation master")
+			return conn, nil
+		}
+
+		// The master may be not started yet
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(coSimDialInterval):
+		}
+	}
+}
+
+func (c *CoSim) handshake() error {
+	hello := coSimHello{Role: c.role}
+	for _, export := range c.exports {
+		hello.Channels = append(hello.Channels, export.Channel)
+	}
+
+	err := c.encoder.Encode(hello)
+	if err != nil {
+		return fmt.Errorf("failed to send co-simulation handshake: %w", err)
+	}
+
+	var peerHello coSimHello
+	err = c.decoder.Decode(&peerHello)
+	if err != nil {
+		return fmt.Errorf("failed to receive co-simulation handshake: %w", err)
+	}
+
+	if peerHello.Role == c.role {
+		return fmt.Errorf("co-simulation peer has the same role: %s", c.role)
+	}
+
+	for _, imp := range c.imports {
+		if !slices.Contains(peerHello.Channels, imp.Channel) {
+			return fmt.Errorf("co-simulation peer does not export channel: %s", imp.Channel)
+		}
+	}
+
+	return nil
+}
+
+// validatePorts makes sure all boundary ports exist
+func (c *CoSim) validatePorts(fm *fmesh.FMesh) error {
+	for _, export := range c.exports {
+		_, err := findPort(fm, export.Path, false)
+		if err != nil {
+			return fmt.Errorf("invalid export of channel %s: %w", export.Channel, err)
+		}
+	}
+
+	for _, imp := range c.imports {
+		_, err := findPort(fm, imp.Path, true)
+		if err != nil {
+			return fmt.Errorf("invalid import of channel %s: %w", imp.Channel, err)
+		}
+	}
+	return nil
+}
+
+// beforeStep connects to the peer (on the first tick), the slave also waits for the master's signals of the upcoming tick
+func (c *CoSim) beforeStep(s *Simulation) error {
+	if c.conn == nil {
+		err := c.connect(s.ctx, s.FM)
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.role == CoSimSlave {
+		return c.receive(s.FM, s.Clock.Now().Count+1)
+	}
+	return nil
+}
+
+// afterStep sends the exported signals of the tick, the master also waits for the slave's reply (tick barrier)
+func (c *CoSim) afterStep(s *Simulation) error {
+	err := c.send(s.FM, s.Clock.Now().Count)
+	if err != nil {
+		return err
+	}
+
+	if c.role == CoSimMaster {
+		return c.receive(s.FM, s.Clock.Now().Count)
+	}
+	return nil
+}
+
+func (c *CoSim) send(fm *fmesh.FMesh, tick uint64) error {
+	frame := coSimFrame{
+		Tick:     tick,
+		Channels: make(map[string][]coSimSignal, len(c.exports)),
+	}
+
+	for _, export := range c.exports {
+		out, err := findPort(fm, export.Path, false)
+		if err != nil {
+			return err
+		}
+
+		var signals []coSimSignal
+		out.Signals().ForEach(func(sig *signal.Signal) error {
+			signals = append(signals, toCoSimSignal(sig, export.Labels))
+			return nil
+		})
+		frame.Channels[export.Channel] = append(frame.Channels[export.Channel], signals...)
+	}
+
+	err := c.encoder.Encode(frame)
+	if err != nil {
+		return fmt.Errorf("failed to send co-simulation frame: %w", err)
+	}
+	return nil
+}
+
+func (c *CoSim) receive(fm *fmesh.FMesh, expectedTick uint64) error {
+	var frame coSimFrame
+	err := c.decoder.Decode(&frame)
+	if errors.Is(err, io.EOF) {
+		return errors.New("co-simulation peer disconnected")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to receive co-simulation frame: %w", err)
+	}
+
+	if frame.Tick != expectedTick {
+		return fmt.Errorf("co-simulation is out of sync: expected tick %d, got %d", expectedTick, frame.Tick)
+	}
+
+	for _, imp := range c.imports {
+		in, err := findPort(fm, imp.Path, true)
+		if err != nil {
+			return err
+		}
+
+		for _, sig := range frame.Channels[imp.Channel] {
+			err = in.PutSignals(fromCoSimSignal(sig)).ChainableErr()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// findPort finds the input or output port by path (component::port)
+func findPort(fm *fmesh.FMesh, path string, input bool) (*port.Port, error) {
+	componentName, portName, found := strings.Cut(path, "::")
+	if !found {
+		return nil, fmt.Errorf("invalid port path: %s", path)
+	}
+
+	c := fm.ComponentByName(componentName)
+	if c == nil {
+		return nil, fmt.Errorf("component not found: %s", componentName)
+	}
+
+	ports := c.Outputs()
+	if input {
+		ports = c.Inputs()
+	}
+
+	p := ports.FindAny(func(p *port.Port) bool {
+		return p.Name() == portName
+	})
+	if p == nil {
+		return nil, fmt.Errorf("port not found: %s", path)
+	}
+	return p, nil
+}
+
+func toCoSimSignal(sig *signal.Signal, labels []string) coSimSignal {
+	wireSig := coSimSignal{
+		Labels: make(map[string]string),
+	}
+
+	for _, label := range labels {
+		if sig.Labels().Has(label) {
+			wireSig.Labels[label] = sig.Labels().ValueOrDefault(label, "")
+		}
+	}
+
+	if group, ok := sig.PayloadOrNil().(*signal.Group); ok {
+		wireSig.IsGroup = true
+		group.ForEach(func(groupSig *signal.Signal) error {
+			wireSig.Group = append(wireSig.Group, toCoSimSignal(groupSig, labels))
+			return nil
+		})
+		return wireSig
+	}
+
+	wireSig.Payload = sig.PayloadOrNil()
+	return wireSig
+}
+
+func fromCoSimSignal(wireSig coSimSignal) *signal.Signal {
+	var sig *signal.Signal
+	if wireSig.IsGroup {
+		group := signal.NewGroup()
+		for _, groupSig := range wireSig.Group {
+			group = group.Add(fromCoSimSignal(groupSig))
+		}
+		sig = signal.New(group)
+	} else {
+		sig = signal.New(wireSig.Payload)
+	}
+
+	for label, value := range wireSig.Labels {
+		sig.AddLabel(label, value)
+	}
+	return sig
+}
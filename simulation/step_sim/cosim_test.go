@@ -0,0 +1,199 @@
+package step_sim
+
+import (
+	"encoding/gob"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hovsep/fmesh"
+	"github.com/hovsep/fmesh/component"
+	"github.com/hovsep/fmesh/signal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// getCoSimTestMesh returns the mesh with a component, which records the signals received in the input
+// along with the tick they are received in and replies with the given function of the tick
+func getCoSimTestMesh(name string, reply func(tick Tick) any) *fmesh.FMesh {
+	return fmesh.New(name).AddComponents(
+		component.New("node").
+			WithInitialState(func(state component.State) {
+				state.Set("received", [][2]uint64{})
+			}).
+			AddInputs(TimePort, "in").
+			AddOutputs("out").
+			WithActivationFunc(func(this *component.Component) error {
+				tick, err := TickFromSignal(this.InputByName(TimePort).Signals().First())
+				if err != nil {
+					return err
+				}
+
+				this.InputByName("in").Signals().ForEach(func(sig *signal.Signal) error {
+					this.State().Update("received", func(received any) any {
+						return append(received.([][2]uint64), [2]uint64{tick.Count, sig.PayloadOrNil().(uint64)})
+					})
+					return nil
+				})
+
+				return this.OutputByName("out").PutSignals(signal.New(reply(tick)).AddLabel("tick_parity", parity(tick.Count)).AddLabel("secret", "x")).ChainableErr()
+			}),
+	)
+}
+
+func parity(n uint64) string {
+	if n%2 == 0 {
+		return "even"
+	}
+	return "odd"
+}
+
+func received(fm *fmesh.FMesh) [][2]uint64 {
+	return fm.ComponentByName("node").State().Get("received").([][2]uint64)
+}
+
+// runCoSim runs both simulations for the given number of ticks in parallel, as they would run in separate processes
+func runCoSim(t *testing.T, master, slave *Simulation, ticks int) (error, error) {
+	var masterErr, slaveErr error
+	wg := sync.WaitGroup{}
+	wg.Go(func() {
+		masterErr = master.RunTicks(ticks)
+	})
+	wg.Go(func() {
+		slaveErr = slave.RunTicks(ticks)
+	})
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("co-simulation is stuck")
+	}
+	return masterErr, slaveErr
+}
+
+func TestCoSim(t *testing.T) {
+	t.Run("lockstep with signals crossing the boundary", func(t *testing.T) {
+		address := filepath.Join(t.TempDir(), "cosim.sock")
+
+		master, _ := getTestSimulation(t, getCoSimTestMesh("master", func(tick Tick) any {
+			return tick.Count * 10
+		}))
+		master.CoSim = NewCoSim(CoSimMaster, "unix", address).
+			Export("tens", "node::out", "tick_parity").
+			Import("hundreds", "node::in")
+
+		slave, _ := getTestSimulation(t, getCoSimTestMesh("slave", func(tick Tick) any {
+			return tick.Count * 100
+		}))
+		slave.CoSim = NewCoSim(CoSimSlave, "unix", address).
+			Export("hundreds", "node::out").
+			Import("tens", "node::in")
+
+		// Check the labels of the imported signals
+		var labels []map[string]string
+		slave.FM.ComponentByName("node").SetupHooks(func(hooks *component.Hooks) {
+			hooks.AfterActivation(func(ctx *component.ActivationContext) error {
+				slave.FM.ComponentByName("node").InputByName("in").Signals().ForEach(func(sig *signal.Signal) error {
+					labels = append(labels, map[string]string{
+						"tick_parity": sig.Labels().ValueOrDefault("tick_parity", ""),
+						"secret":      sig.Labels().ValueOrDefault("secret", ""),
+					})
+					return nil
+				})
+				return nil
+			})
+		})
+
+		masterErr, slaveErr := runCoSim(t, master, slave, 4)
+		require.NoError(t, masterErr)
+		require.NoError(t, slaveErr)
+		defer master.CoSim.Close()
+		defer slave.CoSim.Close()
+
+		assert.Equal(t, uint64(4), master.Clock.Now().Count)
+		assert.Equal(t, uint64(4), slave.Clock.Now().Count)
+
+		// The slave gets the master's signals before running the same tick
+		assert.Equal(t, [][2]uint64{{1, 10}, {2, 20}, {3, 30}, {4, 40}}, received(slave.FM))
+
+		// The master gets the slave's reply after the tick, so it sees it in the next tick
+		assert.Equal(t, [][2]uint64{{2, 100}, {3, 200}, {4, 300}}, received(master.FM))
+
+		// Only exported labels cross the boundary
+		require.Len(t, labels, 4)
+		assert.Equal(t, map[string]string{"tick_parity": "odd", "secret": ""}, labels[0])
+		assert.Equal(t, map[string]string{"tick_parity": "even", "secret": ""}, labels[1])
+	})
+
+	t.Run("peer does not export imported channel", func(t *testing.T) {
+		address := filepath.Join(t.TempDir(), "cosim.sock")
+
+		master, _ := getTestSimulation(t, getCoSimTestMesh("master", func(tick Tick) any {
+			return tick.Count
+		}))
+		master.CoSim = NewCoSim(CoSimMaster, "unix", address).Export("tens", "node::out")
+
+		slave, _ := getTestSimulation(t, getCoSimTestMesh("slave", func(tick Tick) any {
+			return tick.Count
+		}))
+		slave.CoSim = NewCoSim(CoSimSlave, "unix", address).Import("thousands", "node::in")
+
+		masterErr, slaveErr := runCoSim(t, master, slave, 1)
+		defer master.CoSim.Close()
+		defer slave.CoSim.Close()
+
+		assert.ErrorContains(t, slaveErr, "co-simulation peer does not export channel: thousands")
+		// The slave disconnects, so the master fails to send or to receive the first frame
+		assert.ErrorContains(t, masterErr, "co-simulation")
+	})
+
+	t.Run("peers with the same role", func(t *testing.T) {
+		address := filepath.Join(t.TempDir(), "cosim.sock")
+		listener, err := net.Listen("unix", address)
+		require.NoError(t, err)
+		defer listener.Close()
+
+		dialed, err := net.Dial("unix", address)
+		require.NoError(t, err)
+		defer dialed.Close()
+
+		accepted, err := listener.Accept()
+		require.NoError(t, err)
+		defer accepted.Close()
+
+		peers := make([]*CoSim, 0, 2)
+		for _, conn := range []net.Conn{accepted, dialed} {
+			peer := NewCoSim(CoSimMaster, "unix", address)
+			peer.conn, peer.encoder, peer.decoder = conn, gob.NewEncoder(conn), gob.NewDecoder(conn)
+			peers = append(peers, peer)
+		}
+
+		errs := make(chan error, 2)
+		for _, peer := range peers {
+			go func() {
+				errs <- peer.handshake()
+			}()
+		}
+
+		assert.ErrorContains(t, <-errs, "co-simulation peer has the same role: master")
+		assert.ErrorContains(t, <-errs, "co-simulation peer has the same role: master")
+	})
+
+	t.Run("invalid boundary port", func(t *testing.T) {
+		sim, _ := getTestSimulation(t, getCoSimTestMesh("master", func(tick Tick) any {
+			return tick.Count
+		}))
+		sim.CoSim = NewCoSim(CoSimMaster, "unix", filepath.Join(t.TempDir(), "cosim.sock")).Export("tens", "node::in")
+
+		err := sim.RunTicks(1)
+		assert.ErrorContains(t, err, "invalid export of channel tens: port not found: node::in")
+	})
+}
@@ -3,59 +3,311 @@ package step_sim
 import (
 	"bufio"
 	"fmt"
+	"io"
+	"maps"
 	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+const (
+	replPrompt = "> "
+
+	// maxExpansionDepth limits nesting of aliases and macros (protects from recursive definitions)
+	maxExpansionDepth = 16
 )
 
+// REPL reads commands of a single session (the console or a socket client) and passes them to the simulation
 type REPL struct {
-	cmdChan chan Command
+	cmdChan chan Command // Closed when the console REPL exits (nil for client sessions)
+	sim     *Simulation
+	session *Session
+	in      io.Reader
+
+	aliases map[Command]string    // Alias name -> command line
+	macros  map[Command][]Command // Macro name -> sequence of command lines
+
+	history  *fileHistory
+	terminal *term.Terminal
 }
 
-func NewREPL(cmdChan chan Command) *REPL {
+// NewREPL creates the console REPL (stdin/stdout)
+func NewREPL(cmdChan chan Command, sim *Simulation) *REPL {
+	repl := newSessionREPL(sim, ConsoleSession, os.Stdin)
+	repl.cmdChan = cmdChan
+	return repl
+}
+
+// newSessionREPL creates a REPL reading commands of the given session
+func newSessionREPL(sim *Simulation, session *Session, in io.Reader) *REPL {
 	return &REPL{
-		cmdChan: cmdChan,
+		sim:     sim,
+		session: session,
+		in:      in,
+		aliases: make(map[Command]string),
+		macros:  make(map[Command][]Command),
 	}
 }
 
 func (repl *REPL) Run() {
-	fmt.Println("Starting REPL...")
+	repl.println("Starting REPL...")
+
+	if repl.cmdChan != nil {
+		defer close(repl.cmdChan)
+	}
 
-	defer close(repl.cmdChan)
+	readLine, closeReader := repl.getLineReader()
+	defer closeReader()
 
-	scanner := bufio.NewScanner(os.Stdin)
 	for {
 		_ = os.Stdout.Sync()
-		if !scanner.Scan() {
-			if err := scanner.Err(); err != nil {
-				fmt.Println(fmt.Errorf("failed to read from stdIn: %w", err))
+		line, err := readLine()
+		if err != nil {
+			if err != io.EOF {
+				repl.println(fmt.Errorf("failed to read commands: %w", err))
 			}
 			return
 		}
 
-		cmd := Command(strings.TrimSpace(scanner.Text()))
-
-		if cmd == "" {
-			continue
+		if repl.handleLine(line, 0) {
+			repl.println("Shutting down REPL...")
+			return
 		}
+	}
+}
 
-		if repl.handleCommand(cmd) {
-			fmt.Println("Shutting down REPL...")
-			return
+// getLineReader returns the line editor (with history and tab completion) when the console is a terminal,
+// otherwise lines are just scanned (e.g., when commands are piped in or come from a socket)
+func (repl *REPL) getLineReader() (func() (string, error), func()) {
+	if repl.in != os.Stdin || !term.IsTerminal(int(os.Stdin.Fd())) {
+		repl.history = newFileHistory("")
+		return repl.getScanner(), func() {}
+	}
+
+	stdinFd := int(os.Stdin.Fd())
+	restoreTerminal, err := makeCbreak(stdinFd)
+	if err != nil {
+		repl.println("Line editing is disabled:", err)
+		repl.history = newFileHistory("")
+		return repl.getScanner(), func() {}
+	}
+
+	repl.terminal = term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{os.Stdin, os.Stdout}, replPrompt)
+	repl.terminal.AutoCompleteCallback = repl.complete
+
+	if width, height, err := term.GetSize(stdinFd); err == nil && width > 0 && height > 0 {
+		_ = repl.terminal.SetSize(width, height)
+	}
+
+	repl.history = newFileHistory(repl.getDotFilePath("history"))
+	repl.terminal.History = repl.history
+
+	return repl.terminal.ReadLine, func() {
+		repl.history.Close()
+		restoreTerminal()
+	}
+}
+
+// getScanner returns the line reader without editing, history is recorded by the REPL itself
+func (repl *REPL) getScanner() func() (string, error) {
+	scanner := bufio.NewScanner(repl.in)
+	return func() (string, error) {
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return "", err
+			}
+			return "", io.EOF
 		}
+		repl.history.Add(strings.TrimSpace(scanner.Text()))
+		return scanner.Text(), nil
 	}
 }
 
-// handleCommand processes a single REPL command and returns true if the REPL should be closed
-func (repl *REPL) handleCommand(cmd Command) bool {
-	// Handle REPL-specific commands immediately and pass others to the channel
-	switch cmd {
+// getDotFilePath returns the path of a per-mesh file in the user's home directory, e.g. ~/.step_sim/my_mesh.history
+func (repl *REPL) getDotFilePath(ext string) string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".step_sim", repl.sim.FM.Name()+"."+ext)
+}
+
+// handleLine processes a single line and returns true if the REPL should be closed
+func (repl *REPL) handleLine(line string, depth int) bool {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return false
+	}
+
+	if depth > maxExpansionDepth {
+		repl.println("Too deep alias or macro expansion, check for recursive definitions")
+		return false
+	}
+
+	cmd := Command(line)
+	cmdName, args := cmd.Split()
+
+	// Handle REPL-specific commands immediately and pass others to the simulation
+	switch cmdName {
 	case Exit:
 		return true
-	case Help:
-		// Pass to simulation, so custom commands can be also displayed
-		fallthrough
-	default:
-		repl.cmdChan <- cmd
+	case Define:
+		repl.define(strings.TrimSpace(strings.TrimPrefix(line, string(Define))))
+		return false
+	case Alias:
+		repl.alias(strings.TrimSpace(strings.TrimPrefix(line, string(Alias))))
+		return false
+	case Wait:
+		repl.wait(args)
+		return false
+	case History:
+		repl.printHistory()
+		return false
+	}
+
+	if aliasedLine, ok := repl.aliases[cmdName]; ok {
+		return repl.handleLine(aliasedLine+" "+strings.Join(args, " "), depth+1)
+	}
+
+	if macro, ok := repl.macros[cmdName]; ok {
+		for _, macroCmd := range macro {
+			if repl.handleLine(string(macroCmd), depth+1) {
+				return true
+			}
+		}
 		return false
 	}
+
+	// Help is passed to simulation as well, so custom commands can be also displayed
+	if !repl.sim.submit(repl.session, cmd) {
+		// Do not wait for the simulation which is not running anymore (e.g., stopped with error)
+		repl.println("Simulation is not running")
+		return true
+	}
+	return false
+}
+
+// define handles "define <name> = <cmd>; <cmd>; ..." (without arguments, lists all macros)
+func (repl *REPL) define(definition string) {
+	if definition == "" {
+		for _, name := range slices.Sorted(maps.Keys(repl.macros)) {
+			repl.printf("  %s = %s\n", name, joinCommands(repl.macros[name]))
+		}
+		return
+	}
+
+	name, body, err := parseDefinition(definition)
+	if err != nil {
+		repl.println("Invalid macro:", err)
+		return
+	}
+
+	var macro []Command
+	for _, macroCmd := range strings.Split(body, ";") {
+		if macroCmd = strings.TrimSpace(macroCmd); macroCmd != "" {
+			macro = append(macro, Command(macroCmd))
+		}
+	}
+
+	if len(macro) == 0 {
+		repl.println("Invalid macro: no commands given")
+		return
+	}
+
+	delete(repl.aliases, name)
+	repl.macros[name] = macro
+}
+
+// alias handles "alias <name> = <command line>" (without arguments, lists all aliases)
+func (repl *REPL) alias(definition string) {
+	if definition == "" {
+		for _, name := range slices.Sorted(maps.Keys(repl.aliases)) {
+			repl.printf("  %s = %s\n", name, repl.aliases[name])
+		}
+		return
+	}
+
+	name, body, err := parseDefinition(definition)
+	if err != nil {
+		repl.println("Invalid alias:", err)
+		return
+	}
+
+	delete(repl.macros, name)
+	repl.aliases[name] = body
+}
+
+// wait pauses the REPL (not the simulation) for the given number of milliseconds
+func (repl *REPL) wait(args []string) {
+	if len(args) != 1 {
+		repl.println("Usage: wait <milliseconds>")
+		return
+	}
+
+	ms, err := strconv.Atoi(args[0])
+	if err != nil || ms < 0 {
+		repl.println("Invalid duration:", args[0])
+		return
+	}
+
+	time.Sleep(time.Duration(ms) * time.Millisecond)
+}
+
+func (repl *REPL) printHistory() {
+	for i := repl.history.Len() - 1; i >= 0; i-- {
+		repl.printf("  %d  %s\n", repl.history.Len()-i, repl.history.At(i))
+	}
+}
+
+// println prints to the session output
+func (repl *REPL) println(a ...any) {
+	_, _ = fmt.Fprintln(repl.session.Out, a...)
+}
+
+// printf prints to the session output
+func (repl *REPL) printf(format string, a ...any) {
+	_, _ = fmt.Fprintf(repl.session.Out, format, a...)
+}
+
+// parseDefinition splits "<name> = <body>"
+func parseDefinition(definition string) (Command, string, error) {
+	name, body, found := strings.Cut(definition, "=")
+	if !found {
+		return "", "", fmt.Errorf("expected <name> = <commands>")
+	}
+
+	name, body = strings.TrimSpace(name), strings.TrimSpace(body)
+	if name == "" || strings.ContainsAny(name, " \t;") {
+		return "", "", fmt.Errorf("invalid name: %q", name)
+	}
+
+	if isBuiltinCommand(Command(name)) {
+		return "", "", fmt.Errorf("can not redefine built-in command: %s", name)
+	}
+
+	if body == "" {
+		return "", "", fmt.Errorf("expected <name> = <commands>")
+	}
+
+	return Command(name), body, nil
+}
+
+func isBuiltinCommand(cmd Command) bool {
+	return slices.Contains([]Command{Pause, Resume, Exit, Help, Define, Alias, Wait, History, Lock, Unlock}, cmd)
+}
+
+func joinCommands(cmds []Command) string {
+	lines := make([]string, 0, len(cmds))
+	for _, cmd := range cmds {
+		lines = append(lines, string(cmd))
+	}
+	return strings.Join(lines, "; ")
 }
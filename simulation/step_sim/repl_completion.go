@@ -0,0 +1,100 @@
+package step_sim
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/hovsep/fmesh/component"
+	"github.com/hovsep/fmesh/port"
+)
+
+// complete is the tab completion callback of the line editor:
+// the first word of a command is completed with command names (including aliases and macros),
+// other words are completed with component names and ports (component::port)
+func (repl *REPL) complete(line string, pos int, key rune) (string, int, bool) {
+	if key != '\t' {
+		return "", 0, false
+	}
+
+	head := line[:pos]
+	wordStart := strings.LastIndexAny(head, " ;=") + 1
+	word := head[wordStart:]
+
+	var candidates []string
+	if isCommandPosition(head[:wordStart]) {
+		candidates = repl.getCommandNames()
+	} else {
+		candidates = repl.getComponentPaths()
+	}
+
+	var matches []string
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, word) {
+			matches = append(matches, candidate)
+		}
+	}
+
+	if len(matches) == 0 {
+		return "", 0, false
+	}
+
+	completion := longestCommonPrefix(matches)
+	if len(matches) == 1 {
+		completion += " "
+	} else if completion == word {
+		// Nothing to complete, show the options
+		_, _ = repl.terminal.Write([]byte(strings.Join(matches, "  ") + "\n"))
+	}
+
+	return head[:wordStart] + completion + line[pos:], wordStart + len(completion), true
+}
+
+// isCommandPosition returns true if a command name is expected after the given input,
+// that is the beginning of the line or the body of a macro or an alias
+func isCommandPosition(before string) bool {
+	before = strings.TrimSpace(before)
+	return before == "" || strings.HasSuffix(before, ";") || strings.HasSuffix(before, "=")
+}
+
+func (repl *REPL) getCommandNames() []string {
+	var names []string
+	for cmd := range repl.sim.MeshCommands {
+		names = append(names, string(cmd))
+	}
+	for cmd := range repl.aliases {
+		names = append(names, string(cmd))
+	}
+	for cmd := range repl.macros {
+		names = append(names, string(cmd))
+	}
+	slices.Sort(names)
+	return slices.Compact(names)
+}
+
+// getComponentPaths returns the names of all components and their ports
+func (repl *REPL) getComponentPaths() []string {
+	var paths []string
+	repl.sim.FM.Components().ForEach(func(c *component.Component) error {
+		paths = append(paths, c.Name())
+
+		addPort := func(p *port.Port) error {
+			paths = append(paths, c.Name()+"::"+p.Name())
+			return nil
+		}
+		c.Inputs().ForEach(addPort)
+		c.Outputs().ForEach(addPort)
+		return nil
+	})
+	slices.Sort(paths)
+	return slices.Compact(paths)
+}
+
+func longestCommonPrefix(words []string) string {
+	prefix := words[0]
+	for _, word := range words[1:] {
+		for !strings.HasPrefix(word, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
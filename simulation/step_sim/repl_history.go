@@ -0,0 +1,84 @@
+package step_sim
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxHistorySize is the number of history entries kept (in memory and in the file)
+const maxHistorySize = 1000
+
+// fileHistory is a bounded REPL history which is persisted to a file, so it survives restarts
+// (implements term.History)
+type fileHistory struct {
+	entries []string // Oldest first
+	file    *os.File // Entries are appended as they come, nil when history is kept in memory only
+}
+
+// newFileHistory loads the history from the given file (if it exists) and keeps it open for appending,
+// on any error the history is kept in memory only
+func newFileHistory(path string) *fileHistory {
+	h := &fileHistory{}
+	if path == "" {
+		return h
+	}
+
+	if data, err := os.ReadFile(path); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			if line != "" {
+				h.entries = append(h.entries, line)
+			}
+		}
+	}
+	h.trim()
+
+	// Rewrite the file, so it does not grow infinitely
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+	if err == nil {
+		err = os.WriteFile(path, []byte(strings.Join(h.entries, "\n")+"\n"), 0o600)
+	}
+	if err == nil {
+		h.file, err = os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	}
+	if err != nil {
+		fmt.Println("History will not be saved:", err)
+	}
+
+	return h
+}
+
+func (h *fileHistory) Add(entry string) {
+	if entry == "" || (len(h.entries) > 0 && h.entries[len(h.entries)-1] == entry) {
+		return
+	}
+
+	h.entries = append(h.entries, entry)
+	h.trim()
+
+	if h.file != nil {
+		_, _ = h.file.WriteString(entry + "\n")
+	}
+}
+
+func (h *fileHistory) Len() int {
+	return len(h.entries)
+}
+
+// At returns the entry by index, where 0 is the most recent one
+func (h *fileHistory) At(idx int) string {
+	return h.entries[len(h.entries)-1-idx]
+}
+
+func (h *fileHistory) Close() {
+	if h.file != nil {
+		_ = h.file.Close()
+	}
+}
+
+func (h *fileHistory) trim() {
+	if len(h.entries) > maxHistorySize {
+		h.entries = h.entries[len(h.entries)-maxHistorySize:]
+	}
+}
@@ -0,0 +1,383 @@
+package step_sim
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hovsep/fmesh-examples/simulation/step_sim/sink"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/term"
+)
+
+// getTestREPL returns the REPL of a test session and the function returning the commands it passed to the simulation
+func getTestREPL(t *testing.T) (*REPL, *bytes.Buffer, func() []Command) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	sim := NewSimulation(ctx, getCommandTestMesh(), make(chan Command), sink.NewNoopSink())
+	require.NoError(t, sim.MeshCommands.AddFromDefinitions(sim.FM, CommandDefinition{
+		Name:      "heat",
+		Args:      []string{"degrees"},
+		Component: "heater",
+		Port:      "temperature",
+		Payload:   "$1",
+	}))
+
+	submitted := make(chan Command, 100)
+	go func() {
+		for {
+			select {
+			case sc := <-sim.sessionCmdChan:
+				submitted <- sc.cmd
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	out := &bytes.Buffer{}
+	repl := newSessionREPL(sim, &Session{ID: "test", Out: out}, strings.NewReader(""))
+	repl.history = newFileHistory("")
+
+	return repl, out, func() []Command {
+		// Commands are received in order, so all of them are collected once the marker is received
+		const marker = Command("end of test")
+		sim.submit(repl.session, marker)
+
+		var cmds []Command
+		for cmd := range submitted {
+			if cmd == marker {
+				return cmds
+			}
+			cmds = append(cmds, cmd)
+		}
+		return cmds
+	}
+}
+
+func TestParseDefinition(t *testing.T) {
+	tests := []struct {
+		name          string
+		definition    string
+		wantName      Command
+		wantBody      string
+		wantErrString string
+	}{
+		{
+			name:       "valid",
+			definition: " warm =  heat 25; pause ",
+			wantName:   "warm",
+			wantBody:   "heat 25; pause",
+		},
+		{
+			name:          "no equals sign",
+			definition:    "warm heat 25",
+			wantErrString: "expected <name> = <commands>",
+		},
+		{
+			name:          "empty name",
+			definition:    " = heat 25",
+			wantErrString: `invalid name: ""`,
+		},
+		{
+			name:          "name with spaces",
+			definition:    "warm up = heat 25",
+			wantErrString: `invalid name: "warm up"`,
+		},
+		{
+			name:          "built-in command",
+			definition:    "pause = heat 0",
+			wantErrString: "can not redefine built-in command: pause",
+		},
+		{
+			name:          "empty body",
+			definition:    "warm = ",
+			wantErrString: "expected <name> = <commands>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, body, err := parseDefinition(tt.definition)
+			if tt.wantErrString != "" {
+				require.Error(t, err)
+				assert.ErrorContains(t, err, tt.wantErrString)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantName, name)
+			assert.Equal(t, tt.wantBody, body)
+		})
+	}
+}
+
+func TestREPLHandleLine(t *testing.T) {
+	tests := []struct {
+		name          string
+		lines         []string
+		wantExit      bool
+		wantSubmitted []Command
+		wantOutput    string
+	}{
+		{
+			name:          "command is passed to the simulation",
+			lines:         []string{"  heat 20  "},
+			wantSubmitted: []Command{"heat 20"},
+		},
+		{
+			name:     "exit",
+			lines:    []string{"exit"},
+			wantExit: true,
+		},
+		{
+			name:          "alias appends arguments",
+			lines:         []string{"alias h = heat", "h 25"},
+			wantSubmitted: []Command{"heat 25"},
+		},
+		{
+			name:          "macro runs commands in order",
+			lines:         []string{"define warm = heat 20; wait 0;; resume", "warm"},
+			wantSubmitted: []Command{"heat 20", "resume"},
+		},
+		{
+			name:          "macro can use aliases",
+			lines:         []string{"alias h = heat", "define warm = h 20; h 30", "warm"},
+			wantSubmitted: []Command{"heat 20", "heat 30"},
+		},
+		{
+			name:     "exit in macro closes REPL",
+			lines:    []string{"define quit = heat 0; exit; heat 1", "quit"},
+			wantExit: true,
+			// Commands after exit are not run
+			wantSubmitted: []Command{"heat 0"},
+		},
+		{
+			name:          "alias replaces macro with the same name",
+			lines:         []string{"define warm = heat 20", "alias warm = heat 30", "warm"},
+			wantSubmitted: []Command{"heat 30"},
+		},
+		{
+			name:       "recursive aliases are stopped",
+			lines:      []string{"alias a = b", "alias b = a", "a"},
+			wantOutput: "Too deep alias or macro expansion",
+		},
+		{
+			name:       "invalid macro",
+			lines:      []string{"define help = heat 20"},
+			wantOutput: "Invalid macro: can not redefine built-in command: help",
+		},
+		{
+			name:       "empty macro",
+			lines:      []string{"define warm = ;;"},
+			wantOutput: "Invalid macro: no commands given",
+		},
+		{
+			name:       "list aliases and macros",
+			lines:      []string{"alias h = heat", "define warm = heat 20; resume", "alias", "define"},
+			wantOutput: "  h = heat\n  warm = heat 20; resume\n",
+		},
+		{
+			name:       "wait without duration",
+			lines:      []string{"wait"},
+			wantOutput: "Usage: wait <milliseconds>",
+		},
+		{
+			name:       "wait with invalid duration",
+			lines:      []string{"wait -1"},
+			wantOutput: "Invalid duration: -1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repl, out, getSubmitted := getTestREPL(t)
+
+			exit := false
+			for _, line := range tt.lines {
+				exit = repl.handleLine(line, 0)
+			}
+
+			assert.Equal(t, tt.wantExit, exit)
+			assert.Equal(t, tt.wantSubmitted, getSubmitted())
+			assert.Contains(t, out.String(), tt.wantOutput)
+		})
+	}
+}
+
+func TestREPLComplete(t *testing.T) {
+	tests := []struct {
+		name       string
+		setup      []string
+		line       string
+		pos        int
+		key        rune
+		wantLine   string
+		wantPos    int
+		wantOk     bool
+		wantOutput string
+	}{
+		{
+			name:     "not a tab",
+			line:     "he",
+			pos:      2,
+			key:      'x',
+			wantLine: "",
+			wantOk:   false,
+		},
+		{
+			name:     "single command",
+			line:     "hea",
+			pos:      3,
+			key:      '\t',
+			wantLine: "heat ",
+			wantPos:  5,
+			wantOk:   true,
+		},
+		{
+			name:     "common prefix of commands",
+			setup:    []string{"alias warm1 = heat 20", "alias warm2 = heat 30"},
+			line:     "war",
+			pos:      3,
+			key:      '\t',
+			wantLine: "warm",
+			wantPos:  4,
+			wantOk:   true,
+		},
+		{
+			name:       "options are shown when nothing to complete",
+			line:       "he",
+			pos:        2,
+			key:        '\t',
+			wantLine:   "he",
+			wantPos:    2,
+			wantOk:     true,
+			wantOutput: "heat  help",
+		},
+		{
+			name:     "aliases and macros are commands",
+			setup:    []string{"alias warm = heat 20", "define cool = heat 0"},
+			line:     "war",
+			pos:      3,
+			key:      '\t',
+			wantLine: "warm ",
+			wantPos:  5,
+			wantOk:   true,
+		},
+		{
+			name:     "component ports in arguments",
+			line:     "heat heater::t",
+			pos:      14,
+			key:      '\t',
+			wantLine: "heat heater::temperature ",
+			wantPos:  25,
+			wantOk:   true,
+		},
+		{
+			name:     "command after semicolon in macro body",
+			line:     "define warm = heat 20; res",
+			pos:      26,
+			key:      '\t',
+			wantLine: "define warm = heat 20; resume ",
+			wantPos:  30,
+			wantOk:   true,
+		},
+		{
+			name:     "text after cursor is kept",
+			line:     "hea 20",
+			pos:      3,
+			key:      '\t',
+			wantLine: "heat  20",
+			wantPos:  5,
+			wantOk:   true,
+		},
+		{
+			name:   "no match",
+			line:   "xyz",
+			pos:    3,
+			key:    '\t',
+			wantOk: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repl, _, _ := getTestREPL(t)
+			for _, line := range tt.setup {
+				repl.handleLine(line, 0)
+			}
+
+			termOut := &bytes.Buffer{}
+			repl.terminal = term.NewTerminal(struct {
+				io.Reader
+				io.Writer
+			}{strings.NewReader(""), termOut}, replPrompt)
+
+			line, pos, ok := repl.complete(tt.line, tt.pos, tt.key)
+			assert.Equal(t, tt.wantOk, ok)
+			if tt.wantOk {
+				assert.Equal(t, tt.wantLine, line)
+				assert.Equal(t, tt.wantPos, pos)
+			}
+			assert.Contains(t, termOut.String(), tt.wantOutput)
+		})
+	}
+}
+
+func TestFileHistory(t *testing.T) {
+	t.Run("persisted between sessions", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "nested", "mesh.history")
+
+		h := newFileHistory(path)
+		h.Add("heat 20")
+		h.Add("heat 20") // Consecutive duplicates are not recorded
+		h.Add("")
+		h.Add("pause")
+		h.Add("heat 20")
+		h.Close()
+
+		reloaded := newFileHistory(path)
+		defer reloaded.Close()
+
+		require.Equal(t, 3, reloaded.Len())
+		assert.Equal(t, "heat 20", reloaded.At(0))
+		assert.Equal(t, "pause", reloaded.At(1))
+		assert.Equal(t, "heat 20", reloaded.At(2))
+	})
+
+	t.Run("file is trimmed on load", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "mesh.history")
+
+		var lines []string
+		for i := range maxHistorySize + 10 {
+			lines = append(lines, fmt.Sprintf("heat %d", i))
+		}
+		require.NoError(t, os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o600))
+
+		h := newFileHistory(path)
+		h.Add("pause")
+		h.Close()
+
+		assert.Equal(t, maxHistorySize, h.Len())
+		assert.Equal(t, "pause", h.At(0))
+		assert.Equal(t, fmt.Sprintf("heat %d", maxHistorySize+9), h.At(1))
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Len(t, strings.Split(strings.TrimSpace(string(data)), "\n"), maxHistorySize+1)
+		assert.False(t, strings.HasPrefix(string(data), "heat 0\n"))
+	})
+
+	t.Run("in memory only", func(t *testing.T) {
+		h := newFileHistory("")
+		h.Add("heat 20")
+		h.Close()
+
+		assert.Equal(t, 1, h.Len())
+		assert.Equal(t, "heat 20", h.At(0))
+	})
+}
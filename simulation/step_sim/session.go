@@ -0,0 +1,231 @@
+package step_sim
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+)
+
+// SessionsEnv enables command sockets for operator sessions when set to "1"
+const SessionsEnv = "STEP_SIM_SESSIONS"
+
+// Session is an operator connected to the simulation (the console or a socket client)
+type Session struct {
+	ID       string
+	Out      io.Writer // Output of commands issued in this session
+	ReadOnly bool      // Read-only sessions can only run read-only commands
+}
+
+// ConsoleSession is the session of the operator on stdin
+var ConsoleSession = &Session{
+	ID:  "console",
+	Out: os.Stdout,
+}
+
+// sessionCommand is a command issued in a session
+type sessionCommand struct {
+	session *Session
+	cmd     Command
+}
+
+// CommandServer accepts operator sessions on a unix socket, each client gets its own REPL
+type CommandServer struct {
+	ctx      context.Context
+	sim      *Simulation
+	listener net.Listener
+	readOnly bool
+	clients  atomic.Uint64
+}
+
+// NewCommandServer starts accepting sessions on the given socket,
+// control sockets are only accessible by the owner, read-only sockets are accessible by anyone
+func NewCommandServer(ctx context.Context, sim *Simulation, socketPath string, readOnly bool) (*CommandServer, error) {
+	_ = os.Remove(socketPath)
+
+	permissions := os.FileMode(0o600)
+	if readOnly {
+		permissions = 0o666
+	}
+
+	listener, err := listenUnix(socketPath, permissions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for sessions: %w", err)
+	}
+
+	server := &CommandServer{
+		ctx:      ctx,
+		sim:      sim,
+		listener: listener,
+		readOnly: readOnly,
+	}
+
+	context.AfterFunc(ctx, func() {
+		_ = listener.Close()
+		_ = os.Remove(socketPath)
+	})
+
+	go server.acceptSessions()
+
+	fmt.Println("Accepting sessions on", socketPath)
+	return server, nil
+}
+
+// listenUnix creates the socket with the given permissions: the socket is created in a private directory
+// and moved to the given path once the permissions are set, so it is never accessible with the default ones
+func listenUnix(socketPath string, permissions os.FileMode) (net.Listener, error) {
+	dir, err := os.MkdirTemp(filepath.Dir(socketPath), ".step_sim-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	privatePath := filepath.Join(dir, filepath.Base(socketPath))
+	listener, err := net.Listen("unix", privatePath)
+	if err != nil {
+		return nil, err
+	}
+
+	// The socket is moved, so the listener must not remove it by the old path
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+
+	err = os.Chmod(privatePath, permissions)
+	if err == nil {
+		err = os.Rename(privatePath, socketPath)
+	}
+	if err != nil {
+		_ = listener.Close()
+		return nil, fmt.Errorf("failed to set socket permissions: %w", err)
+	}
+
+	return listener, nil
+}
+
+func (cs *CommandServer) acceptSessions() {
+	for {
+		conn, err := cs.listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			fmt.Println("accept error:", err)
+			continue
+		}
+
+		go cs.serveSession(conn)
+	}
+}
+
+// serveSession runs the REPL of a single client until it disconnects
+func (cs *CommandServer) serveSession(conn net.Conn) {
+	defer conn.Close()
+
+	role := "operator"
+	if cs.readOnly {
+		role = "observer"
+	}
+
+	session := &Session{
+		ID:       fmt.Sprintf("%s-%d", role, cs.clients.Add(1)),
+		Out:      conn,
+		ReadOnly: cs.readOnly,
+	}
+
+	fmt.Println("Session started:", session.ID)
+	_, _ = fmt.Fprintf(conn, "Connected as %s\n", session.ID)
+
+	newSessionREPL(cs.sim, session, conn).Run()
+
+	// Do not keep the simulation locked by a gone operator
+	cs.sim.submit(session, Unlock)
+	fmt.Println("Session finished:", session.ID)
+}
+
+// submit passes the command issued in the session to the simulation loop, returns false if the simulation is not running
+func (s *Simulation) submit(session *Session, cmd Command) bool {
+	select {
+	case s.sessionCmdChan <- sessionCommand{session: session, cmd: cmd}:
+		return true
+	case <-s.ctx.Done():
+		return false
+	}
+}
+
+// handleSessionCommand checks the permissions of the session and executes the command with the output routed to the session
+func (s *Simulation) handleSessionCommand(sc sessionCommand) {
+	s.out = sc.session.Out
+	s.session = sc.session
+	defer func() {
+		s.out = os.Stdout
+		s.session = nil
+	}()
+
+	cmdName, _ := sc.cmd.Split()
+
+	switch cmdName {
+	case Lock:
+		s.lock(sc.session)
+		return
+	case Unlock:
+		s.unlock(sc.session)
+		return
+	}
+
+	err := s.checkPermissions(sc.session, cmdName)
+	if err != nil {
+		fmt.Fprintf(s.out, "Command %v rejected: %v\n", cmdName, err)
+		return
+	}
+
+	s.runCommand(sc.cmd)
+}
+
+// checkPermissions returns an error if the session is not allowed to run the command
+func (s *Simulation) checkPermissions(session *Session, cmdName Command) error {
+	if descriptor, ok := s.MeshCommands[cmdName]; ok && descriptor.ReadOnly {
+		return nil
+	}
+
+	if session.ReadOnly {
+		return errors.New("session is read-only")
+	}
+
+	if s.lockedBy != nil && s.lockedBy != session {
+		return fmt.Errorf("simulation is locked by %s", s.lockedBy.ID)
+	}
+
+	return nil
+}
+
+// lock gives the session exclusive control over the simulation
+func (s *Simulation) lock(session *Session) {
+	switch {
+	case session.ReadOnly:
+		fmt.Fprintln(s.out, "Read-only session can not lock the simulation")
+	case s.lockedBy != nil && s.lockedBy != session:
+		fmt.Fprintln(s.out, "Simulation is already locked by", s.lockedBy.ID)
+	default:
+		s.lockedBy = session
+		fmt.Println("Simulation locked by", session.ID)
+		if session != ConsoleSession {
+			fmt.Fprintln(s.out, "Simulation locked")
+		}
+	}
+}
+
+// unlock releases the lock held by the session
+func (s *Simulation) unlock(session *Session) {
+	if s.lockedBy != session {
+		return
+	}
+
+	s.lockedBy = nil
+	fmt.Println("Simulation unlocked by", session.ID)
+	if session != ConsoleSession {
+		fmt.Fprintln(s.out, "Simulation unlocked")
+	}
+}
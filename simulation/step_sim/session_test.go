@@ -0,0 +1,231 @@
+package step_sim
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hovsep/fmesh"
+	"github.com/hovsep/fmesh-examples/simulation/step_sim/sink"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sessionClient is an operator connected to the command socket
+type sessionClient struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// dialSession connects to the command socket and waits for the REPL of the session with the given ID
+func dialSession(t *testing.T, socketPath string, sessionID string) *sessionClient {
+	conn, err := net.Dial("unix", socketPath)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+
+	client := &sessionClient{t: t, conn: conn, reader: bufio.NewReader(conn)}
+	client.expect("Connected as " + sessionID)
+	client.expect("Starting REPL...")
+	return client
+}
+
+func (c *sessionClient) send(line string) {
+	_, err := fmt.Fprintln(c.conn, line)
+	require.NoError(c.t, err)
+}
+
+// expect reads the output until the line containing the given text
+func (c *sessionClient) expect(text string) {
+	require.NoError(c.t, c.conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	var lines []string
+	for {
+		line, err := c.reader.ReadString('\n')
+		require.NoError(c.t, err, "expected %q, got %q", text, lines)
+		if strings.Contains(line, text) {
+			return
+		}
+		lines = append(lines, line)
+	}
+}
+
+// expectNothing makes sure there is no output for a while
+func (c *sessionClient) expectNothing() {
+	require.NoError(c.t, c.conn.SetReadDeadline(time.Now().Add(100*time.Millisecond)))
+	line, err := c.reader.ReadString('\n')
+	assert.Error(c.t, err, "unexpected output: %q", line)
+}
+
+// startSessionServers runs the simulation with the control and the read-only command sockets,
+// the simulation has the "bump" command which increments the returned counter
+func startSessionServers(t *testing.T) (string, string, *atomic.Int64) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	bumps := &atomic.Int64{}
+	sim := NewSimulation(ctx, getTickCounterMesh(), nil, sink.NewNoopSink())
+	sim.Clock.Pacing = 1
+	sim.MeshCommands["bump"] = NewMeshCommandDescriptor("increment the counter", func(*fmesh.FMesh) {
+		bumps.Add(1)
+		fmt.Fprintln(sim.Out(), "bumped")
+	})
+
+	// Socket paths are limited to about 100 bytes, so the test name is not a part of the directory
+	dir, err := os.MkdirTemp("", "step_sim")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = os.RemoveAll(dir)
+	})
+	controlPath, readOnlyPath := filepath.Join(dir, "ctl.sock"), filepath.Join(dir, "ro.sock")
+
+	_, err = NewCommandServer(ctx, sim, controlPath, false)
+	require.NoError(t, err)
+
+	_, err = NewCommandServer(ctx, sim, readOnlyPath, true)
+	require.NoError(t, err)
+
+	go sim.Run()
+	return controlPath, readOnlyPath, bumps
+}
+
+func TestCommandServerSocketPermissions(t *testing.T) {
+	controlPath, readOnlyPath, _ := startSessionServers(t)
+
+	info, err := os.Stat(controlPath)
+	require.NoError(t, err)
+	assert.Equal(t, os.ModeSocket, info.Mode().Type())
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	info, err = os.Stat(readOnlyPath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o666), info.Mode().Perm())
+
+	// No private directories are left behind
+	entries, err := os.ReadDir(filepath.Dir(controlPath))
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+}
+
+func TestCommandServerSessions(t *testing.T) {
+	t.Run("output is routed to the session which issued the command", func(t *testing.T) {
+		controlPath, _, bumps := startSessionServers(t)
+
+		alice := dialSession(t, controlPath, "operator-1")
+		bob := dialSession(t, controlPath, "operator-2")
+
+		alice.send("bump")
+		alice.expect("bumped")
+		bob.expectNothing()
+
+		bob.send("nonsense")
+		bob.expect("Unknown command: nonsense")
+		alice.expectNothing()
+
+		assert.Equal(t, int64(1), bumps.Load())
+	})
+
+	t.Run("read-only session", func(t *testing.T) {
+		_, readOnlyPath, bumps := startSessionServers(t)
+
+		observer := dialSession(t, readOnlyPath, "observer-1")
+
+		observer.send("time:now")
+		observer.expect("Current tick count:")
+
+		observer.send("bump")
+		observer.expect("Command bump rejected: session is read-only")
+
+		observer.send("pause")
+		observer.expect("Command pause rejected: session is read-only")
+
+		observer.send("lock")
+		observer.expect("Read-only session can not lock the simulation")
+
+		assert.Equal(t, int64(0), bumps.Load())
+	})
+
+	t.Run("lock and unlock", func(t *testing.T) {
+		controlPath, readOnlyPath, bumps := startSessionServers(t)
+
+		alice := dialSession(t, controlPath, "operator-1")
+		bob := dialSession(t, controlPath, "operator-2")
+		observer := dialSession(t, readOnlyPath, "observer-1")
+
+		alice.send("lock")
+		alice.expect("Simulation locked")
+
+		bob.send("bump")
+		bob.expect("Command bump rejected: simulation is locked by operator-1")
+		bob.send("lock")
+		bob.expect("Simulation is already locked by operator-1")
+
+		// Read-only commands are still available
+		observer.send("time:now")
+		observer.expect("Current tick count:")
+
+		alice.send("bump")
+		alice.expect("bumped")
+
+		// Only the owner can unlock
+		bob.send("unlock")
+		bob.send("bump")
+		bob.expect("Command bump rejected: simulation is locked by operator-1")
+
+		alice.send("unlock")
+		alice.expect("Simulation unlocked")
+
+		bob.send("bump")
+		bob.expect("bumped")
+		assert.Equal(t, int64(2), bumps.Load())
+	})
+
+	t.Run("lock is released when the session is gone", func(t *testing.T) {
+		controlPath, _, _ := startSessionServers(t)
+
+		alice := dialSession(t, controlPath, "operator-1")
+		bob := dialSession(t, controlPath, "operator-2")
+
+		alice.send("lock")
+		alice.expect("Simulation locked")
+		require.NoError(t, alice.conn.Close())
+
+		require.Eventually(t, func() bool {
+			bob.send("bump")
+			line, err := bob.reader.ReadString('\n')
+			return err == nil && strings.Contains(line, "bumped")
+		}, 5*time.Second, 50*time.Millisecond)
+	})
+
+	t.Run("scheduled command is rejected when another session takes the lock", func(t *testing.T) {
+		controlPath, _, bumps := startSessionServers(t)
+
+		alice := dialSession(t, controlPath, "operator-1")
+		bob := dialSession(t, controlPath, "operator-2")
+
+		bob.send("schedule 200ms bump")
+		// Commands of the session are executed in order, so the bump is scheduled once the time is printed
+		bob.send("time:now")
+		bob.expect("Current tick count:")
+
+		alice.send("lock")
+		alice.expect("Simulation locked")
+
+		bob.expect("Command bump rejected: simulation is locked by operator-1")
+		assert.Equal(t, int64(0), bumps.Load())
+
+		// The owner's scheduled commands are executed, the output goes to the owner
+		alice.send("schedule 50ms bump")
+		alice.expect("bumped")
+		bob.expectNothing()
+		assert.Equal(t, int64(1), bumps.Load())
+	})
+}
@@ -3,7 +3,9 @@ package step_sim
 import (
 	"context"
 	"fmt"
+	"io"
 	"maps"
+	"os"
 	"slices"
 	"time"
 
@@ -26,16 +28,33 @@ type Simulation struct {
 	MeshCommands MeshCommandMap  // Commands that can be executed on the mesh
 	AutoPause    bool            // Automatically pause the simulation if nothing happens
 	Sink         sink.Sink       // Sink is useful for sending messages to the outside (ui, metrics, etc.)
+	Clock        *Clock          // Drives the simulation time, ticks are delivered to components with the time input
+	CoSim        *CoSim          // Optional connection to a mesh simulated in another process
+	scheduled    []scheduledCommand
+
+	sessionCmdChan chan sessionCommand // Commands issued in operator sessions
+	out            io.Writer           // Output of the command being executed (routed to the session which issued it)
+	session        *Session            // Session which issued the command being executed (nil for commands from the command channel)
+	lockedBy       *Session            // Session having exclusive control over the simulation
 }
 
 func NewSimulation(ctx context.Context, fm *fmesh.FMesh, cmdChan chan Command, sink sink.Sink) *Simulation {
-	return &Simulation{
+	s := &Simulation{
 		ctx:          ctx,
 		FM:           fm,
 		cmdChan:      cmdChan,
 		MeshCommands: getDefaultMeshCommands(),
 		Sink:         sink,
+		Clock:        NewClock(DefaultTickDuration),
+
+		sessionCmdChan: make(chan sessionCommand),
+		out:            os.Stdout,
 	}
+	s.MeshCommands[Help] = NewMeshCommandDescriptor("show this help message", func(_ *fmesh.FMesh) {
+		showHelp(s.out, s.MeshCommands)
+	}).AsReadOnly()
+	s.addClockCommands()
+	return s
 }
 
 func getDefaultMeshCommands() MeshCommandMap {
@@ -44,9 +63,12 @@ func getDefaultMeshCommands() MeshCommandMap {
 	meshCommands[Exit] = NewMeshCommandDescriptor("exit REPL", NoopMeshCommand)
 	meshCommands[Pause] = NewMeshCommandDescriptor("pause simulation", NoopMeshCommand)
 	meshCommands[Resume] = NewMeshCommandDescriptor("resume simulation", NoopMeshCommand)
-	meshCommands[Help] = NewMeshCommandDescriptor("show this help message", func(_ *fmesh.FMesh) {
-		showHelp(meshCommands)
-	})
+	meshCommands[Define] = NewMeshCommandDescriptor("define a macro: define <name> = <cmd>; wait <ms>; <cmd> (lists macros when used without arguments)", NoopMeshCommand)
+	meshCommands[Alias] = NewMeshCommandDescriptor("define an alias: alias <name> = <cmd> [args] (lists aliases when used without arguments)", NoopMeshCommand)
+	meshCommands[Wait] = NewMeshCommandDescriptor("wait <ms>: pause the REPL for given milliseconds (useful in macros)", NoopMeshCommand)
+	meshCommands[History] = NewMeshCommandDescriptor("show command history", NoopMeshCommand)
+	meshCommands[Lock] = NewMeshCommandDescriptor("take exclusive control over the simulation (other sessions can only run read-only commands)", NoopMeshCommand)
+	meshCommands[Unlock] = NewMeshCommandDescriptor("release exclusive control over the simulation", NoopMeshCommand)
 	return meshCommands
 }
 
@@ -61,6 +83,10 @@ func (s *Simulation) Init(initFunc func(sim *Simulation)) *Simulation {
 func (s *Simulation) Run() {
 	fmt.Println("Starting simulation...")
 
+	if s.CoSim != nil {
+		defer s.CoSim.Close()
+	}
+
 	for {
 		// Process incoming commands
 		checkCommands := true
@@ -74,17 +100,13 @@ func (s *Simulation) Run() {
 					fmt.Println("Command channel closed, shutting down simulation...")
 					return
 				}
-				switch cmd {
-				case Pause:
-					s.Pause()
-				case Resume:
-					s.Resume()
-				case Exit:
+				if cmd == Exit {
 					fmt.Println("Exiting simulation...")
 					return
-				default:
-					s.handleCommand(cmd)
 				}
+				s.runCommand(cmd)
+			case sc := <-s.sessionCmdChan:
+				s.handleSessionCommand(sc)
 			default:
 				// No more commands in the channel, break the inner loop
 				checkCommands = false
@@ -98,7 +120,7 @@ func (s *Simulation) Run() {
 		}
 
 		// Run a single simulation cycle
-		runResult, err := s.FM.Run()
+		runResult, err := s.step()
 		if err != nil {
 			fmt.Println("Simulation cycle finished with error:", err)
 			return
@@ -108,6 +130,54 @@ func (s *Simulation) Run() {
 	}
 }
 
+// RunTicks runs the given number of simulation cycles without processing commands (headless mode)
+func (s *Simulation) RunTicks(ticks int) error {
+	for tick := range ticks {
+		if err := s.ctx.Err(); err != nil {
+			return err
+		}
+
+		_, err := s.step()
+		if err != nil {
+			return fmt.Errorf("simulation cycle %d finished with error: %w", tick, err)
+		}
+	}
+	return nil
+}
+
+// step advances the clock, delivers the tick and runs the mesh once
+func (s *Simulation) step() (*fmesh.RuntimeInfo, error) {
+	if s.CoSim != nil {
+		err := s.CoSim.beforeStep(s)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	tick := s.Clock.Advance()
+	s.runScheduledCommands()
+
+	err := s.deliverTick(tick)
+	if err != nil {
+		return nil, fmt.Errorf("failed to deliver tick: %w", err)
+	}
+
+	runResult, err := s.FM.Run()
+	if err != nil {
+		return runResult, err
+	}
+
+	if s.CoSim != nil {
+		err = s.CoSim.afterStep(s)
+		if err != nil {
+			return runResult, err
+		}
+	}
+
+	s.Clock.Pace()
+	return runResult, nil
+}
+
 func (s *Simulation) MaybeAutoPause(runResult *fmesh.RuntimeInfo) {
 	if !s.AutoPause {
 		return
@@ -123,33 +193,66 @@ func (s *Simulation) MaybeAutoPause(runResult *fmesh.RuntimeInfo) {
 }
 
 func (s *Simulation) Pause() {
-	fmt.Println("Simulation paused")
+	fmt.Fprintln(s.out, "Simulation paused")
 	s.isPaused = true
 }
 
 func (s *Simulation) Resume() {
-	fmt.Println("Simulation resumed")
+	fmt.Fprintln(s.out, "Simulation resumed")
 	s.isPaused = false
 }
 
+// runCommand executes the command, pausing and resuming is handled by the simulation itself
+func (s *Simulation) runCommand(cmd Command) {
+	cmdName, _ := cmd.Split()
+	switch cmdName {
+	case Pause:
+		s.Pause()
+	case Resume:
+		s.Resume()
+	default:
+		s.handleCommand(cmd)
+	}
+}
+
 // handleCommand executes a valid command
 func (s *Simulation) handleCommand(cmd Command) {
-	cmdDescriptor, ok := s.MeshCommands[cmd]
+	cmdName, args := cmd.Split()
+	cmdDescriptor, ok := s.MeshCommands[cmdName]
 	if !ok {
-		fmt.Printf("Unknown command: %v \n", cmd)
+		fmt.Fprintf(s.out, "Unknown command: %v \n", cmdName)
 		return
 	}
-	cmdDescriptor.RunWithMesh(s.FM)
+
+	err := cmdDescriptor.RunWithMesh(s.FM, args...)
+	if err != nil {
+		fmt.Fprintf(s.out, "Command %v failed: %v \n", cmdName, err)
+	}
+}
+
+// LoadCommands adds mesh commands declared in the given file
+func (s *Simulation) LoadCommands(path string) error {
+	definitions, err := LoadCommandDefinitions(path)
+	if err != nil {
+		return err
+	}
+
+	return s.MeshCommands.AddFromDefinitions(s.FM, definitions...)
 }
 
 func (s *Simulation) SendCommand(cmd Command) {
 	s.cmdChan <- cmd
 }
 
-func showHelp(meshCommands MeshCommandMap) {
-	fmt.Println("Available commands:")
+// Out returns the output of the command being executed, commands should print there to reach the operator who issued them
+func (s *Simulation) Out() io.Writer {
+	return s.out
+}
+
+func showHelp(out io.Writer, meshCommands MeshCommandMap) {
+	fmt.Fprintln(out, "Available commands:")
 
 	for _, cmd := range slices.Sorted(maps.Keys(meshCommands)) {
-		fmt.Printf("  %s - %s\n", cmd, meshCommands[cmd].Description)
+		fmt.Fprintf(out, "  %s - %s\n", meshCommands[cmd].Usage(cmd), meshCommands[cmd].Description)
 	}
 }
@@ -0,0 +1,10 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package step_sim
+
+import "errors"
+
+// makeCbreak is not supported on this platform, so the REPL falls back to plain line scanning
+func makeCbreak(int) (func(), error) {
+	return nil, errors.New("terminal mode switching is not supported on this platform")
+}
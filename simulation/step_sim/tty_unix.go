@@ -0,0 +1,60 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+
+package step_sim
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// makeCbreak switches the terminal into non-canonical mode without echo, so the line editor receives every key press.
+// Unlike raw mode, output processing and signals are kept, so the simulation can keep printing while the REPL is waiting for input
+// and Ctrl+C still interrupts it (the terminal is restored before the process is interrupted).
+// Returns a function which restores the previous terminal state.
+func makeCbreak(fd int) (func(), error) {
+	termios, err := unix.IoctlGetTermios(fd, ioctlGetTermios)
+	if err != nil {
+		return nil, err
+	}
+
+	oldState := *termios
+
+	termios.Lflag &^= unix.ECHO | unix.ICANON | unix.IEXTEN
+	termios.Cc[unix.VMIN] = 1
+	termios.Cc[unix.VTIME] = 0
+
+	err = unix.IoctlSetTermios(fd, ioctlSetTermios, termios)
+	if err != nil {
+		return nil, err
+	}
+
+	var once sync.Once
+	restore := func() {
+		once.Do(func() {
+			_ = unix.IoctlSetTermios(fd, ioctlSetTermios, &oldState)
+		})
+	}
+
+	interrupts := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(interrupts, unix.SIGINT, unix.SIGTERM, unix.SIGQUIT)
+	go func() {
+		select {
+		case sig := <-interrupts:
+			// Restore the terminal and let the signal do what it would do without the REPL
+			restore()
+			signal.Reset(sig)
+			_ = unix.Kill(os.Getpid(), sig.(unix.Signal))
+		case <-done:
+		}
+	}()
+
+	return func() {
+		signal.Stop(interrupts)
+		close(done)
+		restore()
+	}, nil
+}